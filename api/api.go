@@ -1,8 +1,13 @@
 package api
 
 import (
+	"errors"
 	"net/http"
+	"oms-services/carriers"
 	"oms-services/config"
+	"oms-services/mailer"
+	"oms-services/money"
+	"oms-services/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,3 +24,125 @@ func HealthCheck(c *gin.Context) {
 func RegisterHealthRoutes() {
 	config.Server.GET("/health", HealthCheck)
 }
+
+// errorStatuses maps service errors onto the HTTP status they are reported with. It is
+// checked in order and the first match wins, so an error wrapping several sentinels
+// always gets the same status.
+var errorStatuses = []struct {
+	err    error
+	status int
+}{
+	{services.ErrOrderNotFound, http.StatusNotFound},
+	{services.ErrAddressNotFound, http.StatusNotFound},
+	{services.ErrCustomerNotFound, http.StatusNotFound},
+	{services.ErrOrderItemNotFound, http.StatusNotFound},
+	{services.ErrCouponNotFound, http.StatusNotFound},
+	{services.ErrTaxRateNotFound, http.StatusNotFound},
+	{services.ErrShippingMethodNotFound, http.StatusNotFound},
+	{services.ErrScheduledPriceNotFound, http.StatusNotFound},
+	{services.ErrPriceHistoryNotFound, http.StatusNotFound},
+	{services.ErrVariantPriceNotFound, http.StatusNotFound},
+	{services.ErrCategoryNotFound, http.StatusNotFound},
+	{services.ErrCollectionNotFound, http.StatusNotFound},
+	{services.ErrProductNotFound, http.StatusNotFound},
+	{services.ErrMediaNotFound, http.StatusNotFound},
+	{services.ErrLocationNotFound, http.StatusNotFound},
+	{services.ErrNotificationNotFound, http.StatusNotFound},
+	{services.ErrSupplierNotFound, http.StatusNotFound},
+	{services.ErrPurchaseOrderNotFound, http.StatusNotFound},
+	{services.ErrCycleCountNotFound, http.StatusNotFound},
+	{services.ErrShipmentNotFound, http.StatusNotFound},
+	{services.ErrOrderEmpty, http.StatusUnprocessableEntity},
+	{services.ErrShippingAddressRequired, http.StatusUnprocessableEntity},
+	{services.ErrGuestEmailRequired, http.StatusUnprocessableEntity},
+	{services.ErrEmailNotVerified, http.StatusUnprocessableEntity},
+	{services.ErrVerificationToken, http.StatusUnprocessableEntity},
+	{services.ErrMergeSameCustomer, http.StatusUnprocessableEntity},
+	{services.ErrVariantNotFound, http.StatusUnprocessableEntity},
+	{services.ErrVariantInactive, http.StatusUnprocessableEntity},
+	{services.ErrPriceNotFound, http.StatusUnprocessableEntity},
+	{money.ErrCurrencyMismatch, http.StatusUnprocessableEntity},
+	{services.ErrCouponInactive, http.StatusUnprocessableEntity},
+	{services.ErrCouponNotStarted, http.StatusUnprocessableEntity},
+	{services.ErrCouponExpired, http.StatusUnprocessableEntity},
+	{services.ErrCouponCurrency, http.StatusUnprocessableEntity},
+	{services.ErrCouponMinSubtotal, http.StatusUnprocessableEntity},
+	{services.ErrCouponAlreadyApplied, http.StatusUnprocessableEntity},
+	{services.ErrCouponNotApplied, http.StatusUnprocessableEntity},
+	{services.ErrShippingMethodUnavailable, http.StatusUnprocessableEntity},
+	{services.ErrShippingMethodRequired, http.StatusUnprocessableEntity},
+	{services.ErrExchangeRateNotFound, http.StatusUnprocessableEntity},
+	{services.ErrCategoryParentNotFound, http.StatusUnprocessableEntity},
+	{services.ErrCategoryCycle, http.StatusUnprocessableEntity},
+	{services.ErrCollectionNotManual, http.StatusUnprocessableEntity},
+	{services.ErrVariantAttributes, http.StatusUnprocessableEntity},
+	{services.ErrMediaVariant, http.StatusUnprocessableEntity},
+	{services.ErrNotBundle, http.StatusUnprocessableEntity},
+	{services.ErrBundleComponent, http.StatusUnprocessableEntity},
+	{services.ErrInsufficientStock, http.StatusUnprocessableEntity},
+	{services.ErrStockBelowReserved, http.StatusUnprocessableEntity},
+	{services.ErrBundleInventory, http.StatusUnprocessableEntity},
+	{services.ErrDefaultLocationInactive, http.StatusUnprocessableEntity},
+	{services.ErrBackorderLimit, http.StatusUnprocessableEntity},
+	{services.ErrOrderBackordered, http.StatusUnprocessableEntity},
+	{services.ErrSupplierInactive, http.StatusUnprocessableEntity},
+	{services.ErrPurchaseOrderEmpty, http.StatusUnprocessableEntity},
+	{services.ErrPurchaseOrderOverReceipt, http.StatusUnprocessableEntity},
+	{services.ErrCycleCountEmpty, http.StatusUnprocessableEntity},
+	{services.ErrCycleCountIncomplete, http.StatusUnprocessableEntity},
+	{services.ErrOrderNotFulfilling, http.StatusUnprocessableEntity},
+	{services.ErrNothingToShip, http.StatusUnprocessableEntity},
+	{services.ErrShipmentAddress, http.StatusUnprocessableEntity},
+	{services.ErrShipmentNotTracked, http.StatusUnprocessableEntity},
+	{carriers.ErrUnknownCarrier, http.StatusNotFound},
+	{carriers.ErrTrackingNotFound, http.StatusNotFound},
+	{carriers.ErrUnknownService, http.StatusBadRequest},
+	{carriers.ErrInvalidWebhook, http.StatusBadRequest},
+	{carriers.ErrLabelVoided, http.StatusConflict},
+	{carriers.ErrLabelInUse, http.StatusConflict},
+	{services.ErrCouponDefinition, http.StatusBadRequest},
+	{services.ErrInvalidExchangeRate, http.StatusBadRequest},
+	{money.ErrInvalidRate, http.StatusBadRequest},
+	{services.ErrScheduledPriceWindow, http.StatusBadRequest},
+	{services.ErrCollectionRule, http.StatusBadRequest},
+	{services.ErrProductOptions, http.StatusBadRequest},
+	{services.ErrSKUPattern, http.StatusBadRequest},
+	{services.ErrVariantMatrixTooLarge, http.StatusBadRequest},
+	{services.ErrMediaType, http.StatusUnsupportedMediaType},
+	{services.ErrMediaUnreadable, http.StatusBadRequest},
+	{services.ErrMediaOrder, http.StatusBadRequest},
+	{services.ErrInvalidAdjustment, http.StatusBadRequest},
+	{services.ErrInventoryPolicy, http.StatusBadRequest},
+	{services.ErrReorderPolicy, http.StatusBadRequest},
+	{services.ErrPurchaseOrderLine, http.StatusBadRequest},
+	{services.ErrCycleCountLine, http.StatusBadRequest},
+	{services.ErrMediaTooLarge, http.StatusRequestEntityTooLarge},
+	{services.ErrScheduledPriceOverlap, http.StatusConflict},
+	{services.ErrScheduledPriceFinished, http.StatusConflict},
+	{services.ErrVariantOnSale, http.StatusConflict},
+	{services.ErrCategoryHasChildren, http.StatusConflict},
+	{services.ErrOptionsInUse, http.StatusConflict},
+	{services.ErrVariantCombinationTaken, http.StatusConflict},
+	{services.ErrSKUTaken, http.StatusConflict},
+	{services.ErrCouponUsageLimit, http.StatusConflict},
+	{services.ErrCouponCustomerLimit, http.StatusConflict},
+	{services.ErrPurchaseOrderStatus, http.StatusConflict},
+	{services.ErrCycleCountNotOpen, http.StatusConflict},
+	{services.ErrCycleCountOverlap, http.StatusConflict},
+	{services.ErrOrderTransition, http.StatusConflict},
+	{services.ErrShipmentStatus, http.StatusConflict},
+	{services.ErrOrderNotDraft, http.StatusConflict},
+	{services.ErrCustomerEmailTaken, http.StatusConflict},
+	{mailer.ErrNotConfigured, http.StatusServiceUnavailable},
+}
+
+// respondError maps service errors onto HTTP responses
+func respondError(c *gin.Context, err error) {
+	for _, mapping := range errorStatuses {
+		if errors.Is(err, mapping.err) {
+			c.JSON(mapping.status, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRespondError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	first, second := errorStatuses[0], errorStatuses[len(errorStatuses)-1]
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{name: "sentinel", err: second.err, want: second.status},
+		{name: "wrapped", err: fmt.Errorf("%w: detail", second.err), want: second.status},
+		{name: "earliest of several sentinels wins", err: fmt.Errorf("%w: %w", second.err, first.err), want: first.status},
+		{name: "unknown", err: errors.New("boom"), want: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Repeated so a random pick would show up
+			for i := 0; i < 20; i++ {
+				recorder := httptest.NewRecorder()
+				c, _ := gin.CreateTestContext(recorder)
+				respondError(c, tt.err)
+				if recorder.Code != tt.want {
+					t.Fatalf("respondError(%v) status = %d, want %d", tt.err, recorder.Code, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorStatusesAreUnique(t *testing.T) {
+	seen := map[error]bool{}
+	for _, mapping := range errorStatuses {
+		if seen[mapping.err] {
+			t.Errorf("%v is mapped twice", mapping.err)
+		}
+		seen[mapping.err] = true
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request DTOs
+type InventoryPolicyRequest struct {
+	Policy             models.InventoryPolicy `json:"inventory_policy" binding:"required,oneof=deny backorder preorder"`
+	BackorderLimit     *int                   `json:"backorder_limit" binding:"omitempty,min=0"` // null for no limit
+	PreorderExpectedAt *time.Time             `json:"preorder_expected_at"`                      // Required for pre-orders
+}
+
+// SetVariantInventoryPolicy sets whether a variant can be sold out of stock
+func SetVariantInventoryPolicy(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var input InventoryPolicyRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := config.DB.Select("id").First(&models.ProductVariant{}, variantID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+
+	variant, err := services.SetInventoryPolicy(config.DB, variantID, input.Policy, input.BackorderLimit, input.PreorderExpectedAt)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, variant)
+}
+
+// ListBackorders returns the backorders in the order they get stock, optionally filtered
+// by ?variant_id= and ?status= (open, fulfilled or cancelled)
+func ListBackorders(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	variantID := c.Query("variant_id")
+	status := c.Query("status")
+	offset := (page - 1) * limit
+
+	query := config.DB.Model(&models.Backorder{})
+	if variantID != "" {
+		if _, err := uuid.Parse(variantID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+			return
+		}
+		query = query.Where("variant_id = ?", variantID)
+	}
+	switch status {
+	case "":
+	case "open":
+		query = query.Where("fulfilled_at IS NULL AND cancelled_at IS NULL")
+	case "fulfilled":
+		query = query.Where("fulfilled_at IS NOT NULL")
+	case "cancelled":
+		query = query.Where("cancelled_at IS NOT NULL")
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status, expected open, fulfilled or cancelled"})
+		return
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var backorders []models.Backorder
+	err := query.Offset(offset).Limit(limit).Order("created_at, id").Find(&backorders).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch backorders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": backorders,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// RegisterBackorderRoutes registers the inventory policy and backorder routes
+func RegisterBackorderRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	api.PUT("/variants/:id/inventory-policy", SetVariantInventoryPolicy)
+	api.GET("/backorders", ListBackorders)
+}
@@ -0,0 +1,136 @@
+package api
+
+import (
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request DTOs
+type BundleComponentRequest struct {
+	ComponentVariantID uuid.UUID `json:"component_variant_id" binding:"required"`
+	Quantity           int       `json:"quantity" binding:"required,min=1"`
+}
+
+func BundleComponentRequestToModel(b *BundleComponentRequest) models.BundleComponent {
+	return models.BundleComponent{
+		ComponentVariantID: b.ComponentVariantID,
+		Quantity:           b.Quantity,
+	}
+}
+
+type BundleComponentsRequest struct {
+	Components []BundleComponentRequest `json:"components" binding:"dive"`
+}
+
+// GetBundleComponents returns the components of a bundle variant
+func GetBundleComponents(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var components []models.BundleComponent
+	err = config.DB.Preload("ComponentVariant").Where("bundle_variant_id = ?", variantID).Order("created_at").Find(&components).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch components"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": components})
+}
+
+// SetBundleComponents replaces the components of a bundle variant
+func SetBundleComponents(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var input BundleComponentsRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	components := make([]models.BundleComponent, len(input.Components))
+	for i := range input.Components {
+		components[i] = BundleComponentRequestToModel(&input.Components[i])
+	}
+
+	components, err = services.SetBundleComponents(config.DB, variantID, components)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": components})
+}
+
+// GetVariantAvailability returns the units of a variant, or of a bundle built from its
+// components stock, that can be sold right now. null means the stock is not tracked.
+func GetVariantAvailability(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var variant models.ProductVariant
+	if err := config.DB.First(&variant, variantID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+
+	available, err := services.VariantAvailability(config.DB, variant.ID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"variant_id": variant.ID, "available": available})
+}
+
+// GetVariantRevenueReport returns the revenue per variant of the orders placed in
+// [?from=, ?to=), bundle revenue being allocated to the bundle components
+func GetVariantRevenueReport(c *gin.Context) {
+	from, err := time.Parse(DateFormat, c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, expected YYYY-MM-DD"})
+		return
+	}
+	to, err := time.Parse(DateFormat, c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, expected YYYY-MM-DD"})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	rows, err := services.BuildVariantRevenueReport(config.DB, from, to)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": rows})
+}
+
+// RegisterBundleRoutes registers the bundle component, availability and variant revenue routes
+func RegisterBundleRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	api.GET("/variants/:id/components", GetBundleComponents)
+	api.PUT("/variants/:id/components", SetBundleComponents)
+	api.GET("/variants/:id/availability", GetVariantAvailability)
+	api.GET("/reports/variant-revenue", GetVariantRevenueReport)
+}
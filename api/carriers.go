@@ -0,0 +1,115 @@
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"oms-services/carriers"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/money"
+	"oms-services/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookBytes caps the webhook deliveries read
+const maxWebhookBytes = 1 << 20
+
+// Request DTOs
+type RateQuoteRequest struct {
+	From        carriers.Address `json:"from"`
+	To          carriers.Address `json:"to"`
+	WeightGrams int              `json:"weight_grams" binding:"min=0"`
+	Currency    string           `json:"currency" binding:"required,len=3"`
+}
+
+// ListCarriers returns the carriers labels can be bought from
+func ListCarriers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": config.Carriers.Codes(), "default": config.DefaultCarrier()})
+}
+
+// QuoteCarrierRates prices a parcel with every service of a carrier
+func QuoteCarrierRates(c *gin.Context) {
+	carrier, err := config.Carriers.Get(c.Param("code"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	var input RateQuoteRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	currency := strings.ToUpper(input.Currency)
+	if !money.IsKnownCurrency(currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown currency"})
+		return
+	}
+
+	rates, err := carrier.Rates(c.Request.Context(), carriers.RateRequest{
+		From:        input.From,
+		To:          input.To,
+		WeightGrams: input.WeightGrams,
+		Currency:    currency,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": rates})
+}
+
+// ReceiveCarrierWebhook applies the tracking updates a carrier pushes. Updates of
+// tracking numbers that aren't ours, or no longer, are acknowledged and ignored, so the
+// carrier doesn't retry them.
+func ReceiveCarrierWebhook(c *gin.Context) {
+	carrier, err := config.Carriers.Get(c.Param("code"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	receiver, ok := carrier.(carriers.WebhookReceiver)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Carrier doesn't send webhooks"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxWebhookBytes))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unable to read webhook"})
+		return
+	}
+	trackings, err := receiver.ParseWebhook(c.Request.Header, body)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	shipments := []*models.Shipment{}
+	for _, tracking := range trackings {
+		shipment, err := services.ApplyTracking(config.DB, carrier.Code(), tracking)
+		if errors.Is(err, services.ErrShipmentNotFound) {
+			continue
+		}
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		shipments = append(shipments, shipment)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": shipments})
+}
+
+// RegisterCarrierRoutes registers the carrier routes
+func RegisterCarrierRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	api.GET("/carriers", ListCarriers)
+	api.POST("/carriers/:code/rates", QuoteCarrierRates)
+	api.POST("/carriers/:code/webhook", ReceiveCarrierWebhook)
+}
@@ -3,6 +3,8 @@ package api
 import (
 	"oms-services/config"
 	"oms-services/models"
+	"oms-services/money"
+	"oms-services/services"
 	"oms-services/utils"
 
 	"github.com/gin-gonic/gin"
@@ -19,6 +21,8 @@ type ProductRequest struct {
 	Title       string  `json:"title" binding:"required"`
 	Description *string `json:"description"`
 	IsActive    *bool   `json:"is_active"`
+	TaxClass    string  `json:"tax_class"`
+	Type        string  `json:"type" binding:"omitempty,oneof=simple bundle"`
 }
 
 func ProductRequestToModel(p *ProductRequest) models.Product {
@@ -26,48 +30,55 @@ func ProductRequestToModel(p *ProductRequest) models.Product {
 		Title:       p.Title,
 		Description: p.Description,
 		IsActive:    *p.IsActive,
+		TaxClass:    p.TaxClass,
+		Type:        models.ProductType(p.Type),
 	}
 }
 
 type VariantRequest struct {
-	ProductID  uuid.UUID `json:"product_id" binding:"required"`
-	SKU        string    `json:"sku" binding:"required"`
-	Attributes *string   `json:"attributes"`
-	PriceMinor int       `json:"price_minor" binding:"required,min=0"`
-	Currency   string    `json:"currency" binding:"required,len=3"`
-	IsActive   *bool     `json:"is_active"`
+	ProductID   uuid.UUID                `json:"product_id" binding:"required"`
+	SKU         string                   `json:"sku" binding:"required"`
+	Attributes  models.VariantAttributes `json:"attributes"`
+	PriceMinor  int                      `json:"price_minor" binding:"required,min=0"`
+	Currency    string                   `json:"currency" binding:"required,len=3"`
+	WeightGrams int                      `json:"weight_grams" binding:"min=0"`
+	IsActive    *bool                    `json:"is_active"`
 }
 
 func VariantRequestToModel(v *VariantRequest) models.ProductVariant {
 	return models.ProductVariant{
-		ProductID:  v.ProductID,
-		SKU:        v.SKU,
-		Attributes: v.Attributes,
-		PriceMinor: v.PriceMinor,
-		Currency:   v.Currency,
-		IsActive:   *v.IsActive,
+		ProductID:   v.ProductID,
+		SKU:         v.SKU,
+		Attributes:  v.Attributes,
+		Price:       money.New(int64(v.PriceMinor), v.Currency),
+		Currency:    v.Currency,
+		WeightGrams: v.WeightGrams,
+		IsActive:    *v.IsActive,
 	}
 }
 
 // Response DTOs
 
 type VariantResponse struct {
-	ID         uuid.UUID          `json:"id"`
-	ProductID  uuid.UUID          `json:"product_id"`
-	SKU        string             `json:"sku"`
-	Attributes *string            `json:"attributes"`
-	PriceMinor int                `json:"price_minor"`
-	Currency   string             `json:"currency"`
-	IsActive   bool               `json:"is_active"`
-	CreatedAt  string             `json:"created_at"`
-	UpdatedAt  string             `json:"updated_at"`
-	Inventory  *InventoryResponse `json:"inventory,omitempty"`
+	ID          uuid.UUID                `json:"id"`
+	ProductID   uuid.UUID                `json:"product_id"`
+	SKU         string                   `json:"sku"`
+	Attributes  models.VariantAttributes `json:"attributes"`
+	Price       money.Money              `json:"price"`
+	Currency    string                   `json:"currency"`
+	WeightGrams int                      `json:"weight_grams"`
+	IsActive    bool                     `json:"is_active"`
+	CreatedAt   string                   `json:"created_at"`
+	UpdatedAt   string                   `json:"updated_at"`
+	Inventories []InventoryResponse      `json:"inventories,omitempty"`
 }
 
 type InventoryResponse struct {
 	VariantID   uuid.UUID `json:"variant_id"`
+	LocationID  uuid.UUID `json:"location_id"`
 	QtyOnHand   int       `json:"qty_on_hand"`
 	QtyReserved int       `json:"qty_reserved"`
+	BinLocation *string   `json:"bin_location"`
 	UpdatedAt   string    `json:"updated_at"`
 }
 
@@ -82,6 +93,9 @@ func RegisterCatalogRoutes() {
 		},
 		InputOfCreateToModel: ProductRequestToModel,
 		InputOfUpdateToModel: ProductRequestToModel,
+		Preloads:             []string{"Categories", "Options", "Media"},
+		ListPreloads:         []string{"Media"},
+		FilterFunc:           filterProducts,
 	}
 	// Product routes
 	api.GET("/products", productViewSet.List)
@@ -92,10 +106,27 @@ func RegisterCatalogRoutes() {
 	variantViewSet := utils.ViewSet[models.ProductVariant, VariantRequest, VariantRequest]{
 		DB: config.DB,
 		PerformCreateFunc: func(c *gin.Context, obj *models.ProductVariant) error {
-			return nil
+			return services.ValidateVariantAttributes(config.DB, obj.ProductID, uuid.Nil, obj.Attributes)
+		},
+		ValidateUpdateFunc: func(c *gin.Context, obj *models.ProductVariant, updates *models.ProductVariant) error {
+			attributes := obj.Attributes
+			if len(updates.Attributes) > 0 {
+				attributes = updates.Attributes
+			}
+			if err := services.ValidateVariantAttributes(config.DB, updates.ProductID, obj.ID, attributes); err != nil {
+				return err
+			}
+			return services.CheckManualPriceChange(config.DB, obj, updates.Price)
+		},
+		PerformUpdateFunc: func(c *gin.Context, obj *models.ProductVariant) error {
+			return services.RecordManualPriceChange(config.DB, obj.ID)
 		},
 		InputOfCreateToModel: VariantRequestToModel,
 		InputOfUpdateToModel: VariantRequestToModel,
+		RespondError:         respondError,
+		Preloads:             []string{"Prices", "Components", "Inventories"},
+		ListPreloads:         []string{"Inventories"},
+		FilterFunc:           filterVariants,
 	}
 
 	// Variant routes
@@ -0,0 +1,389 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/services"
+	"oms-services/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Request DTOs
+type CategoryRequest struct {
+	Name        string     `json:"name" binding:"required"`
+	Slug        string     `json:"slug"`
+	Description *string    `json:"description"`
+	ParentID    *uuid.UUID `json:"parent_id"`
+	Position    int        `json:"position"`
+}
+
+func CategoryRequestToModel(c *CategoryRequest) models.Category {
+	return models.Category{
+		Name:        c.Name,
+		Slug:        c.Slug,
+		Description: c.Description,
+		ParentID:    c.ParentID,
+		Position:    c.Position,
+	}
+}
+
+type CategoryUpdateRequest struct {
+	Name        *string `json:"name"`
+	Slug        *string `json:"slug"`
+	Description *string `json:"description"`
+	Position    *int    `json:"position"`
+}
+
+type MoveCategoryRequest struct {
+	ParentID *uuid.UUID `json:"parent_id"` // null moves the category to the root
+}
+
+type ProductCategoriesRequest struct {
+	CategoryIDs []uuid.UUID `json:"category_ids"`
+}
+
+type CollectionRequest struct {
+	Title       string                  `json:"title" binding:"required"`
+	Slug        string                  `json:"slug"`
+	Description *string                 `json:"description"`
+	Type        models.CollectionType   `json:"type" binding:"omitempty,oneof=manual rule_based"`
+	Rules       []models.CollectionRule `json:"rules"`
+	MatchAll    *bool                   `json:"match_all"`
+	IsActive    *bool                   `json:"is_active"`
+}
+
+func CollectionRequestToModel(c *CollectionRequest) models.Collection {
+	collection := models.Collection{
+		Title:       c.Title,
+		Slug:        c.Slug,
+		Description: c.Description,
+		Type:        c.Type,
+		Rules:       c.Rules,
+		MatchAll:    true,
+		IsActive:    true,
+	}
+	if collection.Slug == "" {
+		collection.Slug = utils.Slugify(c.Title)
+	}
+	if collection.Type == "" {
+		collection.Type = models.CollectionTypeManual
+	}
+	if c.MatchAll != nil {
+		collection.MatchAll = *c.MatchAll
+	}
+	if c.IsActive != nil {
+		collection.IsActive = *c.IsActive
+	}
+	return collection
+}
+
+// CollectionUpdateRequest edits a collection. Fields left out are kept, a null
+// description clears it.
+type CollectionUpdateRequest struct {
+	Title       *string                 `json:"title" binding:"omitempty,min=1"`
+	Slug        *string                 `json:"slug" binding:"omitempty,min=1"`
+	Description utils.Nullable[string]  `json:"description"`
+	Type        *models.CollectionType  `json:"type" binding:"omitempty,oneof=manual rule_based"`
+	Rules       *models.CollectionRules `json:"rules"`
+	MatchAll    *bool                   `json:"match_all"`
+	IsActive    *bool                   `json:"is_active"`
+}
+
+type CollectionProductsRequest struct {
+	ProductIDs []uuid.UUID `json:"product_ids" binding:"required,min=1"`
+}
+
+// CreateCategory creates a category below ?parent_id or at the root of the tree
+func CreateCategory(c *gin.Context) {
+	var input CategoryRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category := CategoryRequestToModel(&input)
+	if err := services.CreateCategory(config.DB, &category); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// UpdateCategory renames or reorders a category. Moving it is done with MoveCategory.
+func UpdateCategory(c *gin.Context) {
+	categoryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	var input CategoryUpdateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var category models.Category
+	if err := config.DB.First(&category, categoryID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.Name != nil {
+		updates["name"] = *input.Name
+	}
+	if input.Slug != nil {
+		updates["slug"] = utils.Slugify(*input.Slug)
+	}
+	if input.Description != nil {
+		updates["description"] = *input.Description
+	}
+	if input.Position != nil {
+		updates["position"] = *input.Position
+	}
+	if len(updates) > 0 {
+		if err := config.DB.Model(&category).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to update category"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// MoveCategory moves a category with its subcategories below another parent
+func MoveCategory(c *gin.Context) {
+	categoryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	var input MoveCategoryRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	category, err := services.MoveCategory(config.DB, categoryID, input.ParentID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+// DeleteCategory deletes a category without subcategories
+func DeleteCategory(c *gin.Context) {
+	categoryID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	if err := services.DeleteCategory(config.DB, categoryID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Object deleted"})
+}
+
+// GetCategoryTree returns the nested category tree, or the subtree of ?root=
+func GetCategoryTree(c *gin.Context) {
+	var rootID *uuid.UUID
+	if value := c.Query("root"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid root ID"})
+			return
+		}
+		rootID = &id
+	}
+
+	tree, err := services.CategoryTree(config.DB, rootID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": tree})
+}
+
+// SetProductCategories replaces the categories of a product
+func SetProductCategories(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var input ProductCategoriesRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := services.SetProductCategories(config.DB, productID, input.CategoryIDs)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// AddCollectionProducts adds products to a manual collection
+func AddCollectionProducts(c *gin.Context) {
+	collectionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	var input CollectionProductsRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.AddCollectionProducts(config.DB, collectionID, input.ProductIDs); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Products added"})
+}
+
+// UpdateCollection edits a collection, its rules checked again
+func UpdateCollection(c *gin.Context) {
+	collectionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+
+	var input CollectionUpdateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.Title != nil {
+		updates["title"] = *input.Title
+	}
+	if input.Slug != nil {
+		updates["slug"] = *input.Slug
+	}
+	input.Description.Put(updates, "description")
+	if input.Type != nil {
+		updates["type"] = *input.Type
+	}
+	if input.Rules != nil {
+		updates["rules"] = *input.Rules
+	}
+	if input.MatchAll != nil {
+		updates["match_all"] = *input.MatchAll
+	}
+	if input.IsActive != nil {
+		updates["is_active"] = *input.IsActive
+	}
+
+	collection, err := services.UpdateCollection(config.DB, collectionID, updates)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, collection)
+}
+
+// RemoveCollectionProduct removes a product from a manual collection
+func RemoveCollectionProduct(c *gin.Context) {
+	collectionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid collection ID"})
+		return
+	}
+	productID, err := uuid.Parse(c.Param("product_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	if err := services.RemoveCollectionProduct(config.DB, collectionID, productID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Object deleted"})
+}
+
+// filterProducts narrows the product list to ?category= (id or slug, descendants
+// included) and ?collection= (id or slug)
+func filterProducts(c *gin.Context, query *gorm.DB) *gorm.DB {
+	if category := c.Query("category"); category != "" {
+		query = services.ProductsInCategory(query, category)
+	}
+	if ref := c.Query("collection"); ref != "" {
+		collection, err := services.FindCollection(config.DB, ref)
+		if errors.Is(err, services.ErrCollectionNotFound) {
+			// Unknown collections have no products
+			return query.Where("1 = 0")
+		}
+		if err != nil {
+			query.AddError(err)
+			return query
+		}
+		query = services.ProductsInCollection(query, collection)
+	}
+	return query
+}
+
+// RegisterCategoryRoutes registers the category, product category and collection routes
+func RegisterCategoryRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	categoryViewSet := utils.ViewSet[models.Category, CategoryRequest, CategoryRequest]{
+		DB:           config.DB,
+		SearchFields: []string{"name", "slug"},
+	}
+
+	// Category routes
+	api.GET("/categories", categoryViewSet.List)
+	api.POST("/categories", CreateCategory)
+	api.GET("/categories/tree", GetCategoryTree)
+	api.GET("/categories/:id", categoryViewSet.Retrieve)
+	api.PATCH("/categories/:id", UpdateCategory)
+	api.POST("/categories/:id/move", MoveCategory)
+	api.DELETE("/categories/:id", DeleteCategory)
+	api.PUT("/products/:id/categories", SetProductCategories)
+
+	collectionViewSet := utils.ViewSet[models.Collection, CollectionRequest, CollectionRequest]{
+		DB: config.DB,
+		PerformCreateFunc: func(c *gin.Context, obj *models.Collection) error {
+			return services.ValidateCollection(obj)
+		},
+		InputOfCreateToModel: CollectionRequestToModel,
+		RespondError:         respondError,
+		CreateZeroValues:     true,
+	}
+
+	// Collection routes
+	api.GET("/collections", collectionViewSet.List)
+	api.POST("/collections", collectionViewSet.Create)
+	api.GET("/collections/:id", collectionViewSet.Retrieve)
+	api.PATCH("/collections/:id", UpdateCollection)
+	api.DELETE("/collections/:id", collectionViewSet.Delete)
+	api.POST("/collections/:id/products", AddCollectionProducts)
+	api.DELETE("/collections/:id/products/:product_id", RemoveCollectionProduct)
+}
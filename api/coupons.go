@@ -0,0 +1,150 @@
+package api
+
+import (
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/money"
+	"oms-services/services"
+	"oms-services/utils"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request DTOs
+type CouponRequest struct {
+	Code                  string            `json:"code" binding:"required"`
+	Type                  models.CouponType `json:"type" binding:"required,oneof=percentage fixed_amount free_shipping"`
+	PercentOff            int               `json:"percent_off" binding:"min=0,max=100"`
+	AmountOffMinor        int               `json:"amount_off_minor" binding:"min=0"`
+	Currency              *string           `json:"currency" binding:"omitempty,len=3"`
+	MinSubtotalMinor      int               `json:"min_subtotal_minor" binding:"min=0"`
+	UsageLimit            *int              `json:"usage_limit" binding:"omitempty,min=1"`
+	UsageLimitPerCustomer *int              `json:"usage_limit_per_customer" binding:"omitempty,min=1"`
+	StartsAt              *time.Time        `json:"starts_at"`
+	EndsAt                *time.Time        `json:"ends_at"`
+	IsActive              *bool             `json:"is_active"`
+}
+
+func CouponRequestToModel(c *CouponRequest) models.Coupon {
+	coupon := models.Coupon{
+		Code:                  services.NormalizeCouponCode(c.Code),
+		Type:                  c.Type,
+		PercentOff:            c.PercentOff,
+		Currency:              c.Currency,
+		UsageLimit:            c.UsageLimit,
+		UsageLimitPerCustomer: c.UsageLimitPerCustomer,
+		StartsAt:              c.StartsAt,
+		EndsAt:                c.EndsAt,
+		IsActive:              true,
+	}
+	// Amounts without a currency are kept so the definition check can reject them
+	currency := ""
+	if c.Currency != nil {
+		currency = *c.Currency
+	}
+	coupon.AmountOff = money.New(int64(c.AmountOffMinor), currency)
+	coupon.MinSubtotal = money.New(int64(c.MinSubtotalMinor), currency)
+	if c.IsActive != nil {
+		coupon.IsActive = *c.IsActive
+	}
+	return coupon
+}
+
+// CouponUpdateRequest edits a coupon. Fields left out are kept, null clears them.
+type CouponUpdateRequest struct {
+	Code                  *string                   `json:"code" binding:"omitempty,min=1"`
+	Type                  *models.CouponType        `json:"type" binding:"omitempty,oneof=percentage fixed_amount free_shipping"`
+	PercentOff            *int                      `json:"percent_off" binding:"omitempty,min=0,max=100"`
+	AmountOffMinor        *int                      `json:"amount_off_minor" binding:"omitempty,min=0"`
+	Currency              utils.Nullable[string]    `json:"currency"`
+	MinSubtotalMinor      *int                      `json:"min_subtotal_minor" binding:"omitempty,min=0"`
+	UsageLimit            utils.Nullable[int]       `json:"usage_limit"`
+	UsageLimitPerCustomer utils.Nullable[int]       `json:"usage_limit_per_customer"`
+	StartsAt              utils.Nullable[time.Time] `json:"starts_at"`
+	EndsAt                utils.Nullable[time.Time] `json:"ends_at"`
+	IsActive              *bool                     `json:"is_active"`
+}
+
+// UpdateCoupon edits a coupon, including deactivating it and clearing its limits
+func UpdateCoupon(c *gin.Context) {
+	couponID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+		return
+	}
+
+	var input CouponUpdateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Currency.Value != nil && len(*input.Currency.Value) != 3 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid currency"})
+		return
+	}
+	for _, limit := range []*int{input.UsageLimit.Value, input.UsageLimitPerCustomer.Value} {
+		if limit != nil && *limit < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Usage limits must be at least 1"})
+			return
+		}
+	}
+
+	updates := map[string]interface{}{}
+	if input.Code != nil {
+		updates["code"] = services.NormalizeCouponCode(*input.Code)
+	}
+	if input.Type != nil {
+		updates["type"] = *input.Type
+	}
+	if input.PercentOff != nil {
+		updates["percent_off"] = *input.PercentOff
+	}
+	if input.AmountOffMinor != nil {
+		updates["amount_off_minor"] = *input.AmountOffMinor
+	}
+	input.Currency.Put(updates, "currency")
+	if input.MinSubtotalMinor != nil {
+		updates["min_subtotal_minor"] = *input.MinSubtotalMinor
+	}
+	input.UsageLimit.Put(updates, "usage_limit")
+	input.UsageLimitPerCustomer.Put(updates, "usage_limit_per_customer")
+	input.StartsAt.Put(updates, "starts_at")
+	input.EndsAt.Put(updates, "ends_at")
+	if input.IsActive != nil {
+		updates["is_active"] = *input.IsActive
+	}
+
+	coupon, err := services.UpdateCoupon(config.DB, couponID, updates)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+// RegisterCouponRoutes registers all coupon routes
+func RegisterCouponRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	couponViewSet := utils.ViewSet[models.Coupon, CouponRequest, CouponRequest]{
+		DB: config.DB,
+		PerformCreateFunc: func(c *gin.Context, obj *models.Coupon) error {
+			return services.ValidateCouponDefinition(obj)
+		},
+		InputOfCreateToModel: CouponRequestToModel,
+		SearchFields:         []string{"code"},
+		RespondError:         respondError,
+		CreateZeroValues:     true,
+	}
+
+	// Coupon routes
+	api.GET("/coupons", couponViewSet.List)
+	api.POST("/coupons", couponViewSet.Create)
+	api.GET("/coupons/:id", couponViewSet.Retrieve)
+	api.PATCH("/coupons/:id", UpdateCoupon)
+	api.DELETE("/coupons/:id", couponViewSet.Delete)
+}
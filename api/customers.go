@@ -0,0 +1,454 @@
+package api
+
+import (
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/services"
+	"oms-services/utils"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request DTOs
+type CustomerRequest struct {
+	FirstName string `json:"first_name" binding:"required"`
+	LastName  string `json:"last_name" binding:"required"`
+	Email     string `json:"email" binding:"required,email"`
+	Phone     string `json:"phone" binding:"required"`
+	// Optional, selects group specific prices
+	CustomerGroup *string `json:"customer_group"`
+}
+
+func CustomerRequestToModel(c *CustomerRequest) models.Customer {
+	return models.Customer{
+		FirstName:     c.FirstName,
+		LastName:      c.LastName,
+		Email:         c.Email,
+		Phone:         c.Phone,
+		CustomerGroup: c.CustomerGroup,
+	}
+}
+
+// CustomerUpdateRequest edits a customer. Fields left out are kept, a null
+// customer_group clears it.
+type CustomerUpdateRequest struct {
+	FirstName     *string                `json:"first_name" binding:"omitempty,min=1"`
+	LastName      *string                `json:"last_name" binding:"omitempty,min=1"`
+	Email         *string                `json:"email" binding:"omitempty,email"`
+	Phone         *string                `json:"phone" binding:"omitempty,min=1"`
+	CustomerGroup utils.Nullable[string] `json:"customer_group"`
+}
+
+type AddressRequest struct {
+	FirstName         string  `json:"first_name" binding:"required"`
+	LastName          string  `json:"last_name" binding:"required"`
+	Line1             string  `json:"line1" binding:"required"`
+	Line2             *string `json:"line2"`
+	City              string  `json:"city" binding:"required"`
+	Region            *string `json:"region"`
+	PostalCode        *string `json:"postal_code"`
+	Country           string  `json:"country" binding:"required,len=2"`
+	Phone             *string `json:"phone"`
+	IsDefaultBilling  bool    `json:"is_default_billing"`
+	IsDefaultShipping bool    `json:"is_default_shipping"`
+}
+
+func AddressRequestToModel(a *AddressRequest) models.Address {
+	return models.Address{
+		FirstName:         a.FirstName,
+		LastName:          a.LastName,
+		Line1:             a.Line1,
+		Line2:             a.Line2,
+		City:              a.City,
+		Region:            a.Region,
+		PostalCode:        a.PostalCode,
+		Country:           strings.ToUpper(a.Country),
+		Phone:             a.Phone,
+		IsDefaultBilling:  a.IsDefaultBilling,
+		IsDefaultShipping: a.IsDefaultShipping,
+	}
+}
+
+// ListCustomerAddresses returns the customer's address book
+func ListCustomerAddresses(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var addresses []models.Address
+	if err := config.DB.Where("customer_id = ?", customerID).Order("created_at").Find(&addresses).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch addresses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": addresses})
+}
+
+// CreateCustomerAddress adds an address to the customer's address book
+func CreateCustomerAddress(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var input AddressRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var customer models.Customer
+	if err := config.DB.First(&customer, customerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	address := AddressRequestToModel(&input)
+	address.CustomerID = customer.ID
+	if err := services.SaveAddress(config.DB, &address); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, address)
+}
+
+// UpdateCustomerAddress replaces an address on the customer's address book
+func UpdateCustomerAddress(c *gin.Context) {
+	customerID, addressID, ok := parseAddressParams(c)
+	if !ok {
+		return
+	}
+
+	var input AddressRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	existing, err := services.FindCustomerAddress(config.DB, customerID, addressID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	address := AddressRequestToModel(&input)
+	address.ID = existing.ID
+	address.CustomerID = existing.CustomerID
+	address.CreatedAt = existing.CreatedAt
+	if err := services.SaveAddress(config.DB, &address); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to update address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, address)
+}
+
+// DeleteCustomerAddress removes an address from the customer's address book,
+// orders keep their own snapshot of it
+func DeleteCustomerAddress(c *gin.Context) {
+	customerID, addressID, ok := parseAddressParams(c)
+	if !ok {
+		return
+	}
+
+	address, err := services.FindCustomerAddress(config.DB, customerID, addressID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	if err := config.DB.Delete(address).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Object deleted"})
+}
+
+// ListCustomerOrders returns the customer's orders, newest first
+func ListCustomerOrders(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	status := c.Query("status")
+	offset := (page - 1) * limit
+
+	query := config.DB.Model(&models.Order{}).Where("customer_id = ?", customerID)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var orders []models.Order
+	err = query.Preload("Items").Offset(offset).Limit(limit).Order("created_at DESC").Find(&orders).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": orders,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// GetCustomerSummary returns the customer's lifetime order stats
+func GetCustomerSummary(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var customer models.Customer
+	if err := config.DB.First(&customer, customerID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		return
+	}
+
+	summary, err := services.SummarizeCustomer(config.DB, customer.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to compute customer summary"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type MergeCustomerRequest struct {
+	SourceCustomerID uuid.UUID `json:"source_customer_id" binding:"required"`
+}
+
+// UpdateCustomer edits a customer, a changed email needing to be verified again
+func UpdateCustomer(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var input CustomerUpdateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.FirstName != nil {
+		updates["first_name"] = *input.FirstName
+	}
+	if input.LastName != nil {
+		updates["last_name"] = *input.LastName
+	}
+	if input.Email != nil {
+		updates["email"] = *input.Email
+	}
+	if input.Phone != nil {
+		updates["phone"] = *input.Phone
+	}
+	input.CustomerGroup.Put(updates, "customer_group")
+
+	customer, err := services.UpdateCustomer(config.DB, customerID, updates)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, customer)
+}
+
+// RequestEmailVerification emails the customer the token proving they own their email
+func RequestEmailVerification(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	expiresAt, err := services.RequestEmailVerification(c.Request.Context(), config.DB, config.Mailer, customerID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent", "expires_at": expiresAt})
+}
+
+// VerifyCustomerEmail marks the customer's email as verified with the token sent to it
+func VerifyCustomerEmail(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var input VerifyEmailRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customer, err := services.VerifyCustomerEmail(config.DB, customerID, input.Token)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, customer)
+}
+
+// ClaimGuestOrders links the guest orders placed with the customer's verified email
+func ClaimGuestOrders(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	orderIDs, err := services.ClaimGuestOrders(config.DB, customerID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"claimed_order_ids": orderIDs})
+}
+
+// MergeCustomer folds a duplicate customer record into this one
+func MergeCustomer(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	var input MergeCustomerRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	customer, err := services.MergeCustomers(config.DB, customerID, input.SourceCustomerID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, customer)
+}
+
+// ExportCustomerData returns a JSON bundle of everything stored about the customer
+func ExportCustomerData(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	export, err := services.ExportCustomerData(config.DB, customerID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", "attachment; filename=customer-"+customerID.String()+".json")
+	c.JSON(http.StatusOK, export)
+}
+
+// EraseCustomerData pseudonymises the customer and redacts personal data from their orders
+func EraseCustomerData(c *gin.Context) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	customer, err := services.EraseCustomerData(config.DB, customerID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, customer)
+}
+
+func parseAddressParams(c *gin.Context) (uuid.UUID, uuid.UUID, bool) {
+	customerID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	addressID, err := uuid.Parse(c.Param("address_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return customerID, addressID, true
+}
+
+// RegisterCustomerRoutes registers all customer routes
+func RegisterCustomerRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	customerViewSet := utils.ViewSet[models.Customer, CustomerRequest, CustomerRequest]{
+		DB: config.DB,
+		PerformCreateFunc: func(c *gin.Context, obj *models.Customer) error {
+			return nil
+		},
+		InputOfCreateToModel: CustomerRequestToModel,
+		SearchFields:         []string{"first_name", "last_name", "email", "phone"},
+		Preloads:             []string{"Addresses"},
+	}
+
+	// Customer routes
+	api.GET("/customers", customerViewSet.List)
+	api.POST("/customers", customerViewSet.Create)
+	api.GET("/customers/:id", customerViewSet.Retrieve)
+	api.PATCH("/customers/:id", UpdateCustomer)
+	api.DELETE("/customers/:id", customerViewSet.Delete)
+
+	// Address routes
+	api.GET("/customers/:id/addresses", ListCustomerAddresses)
+	api.POST("/customers/:id/addresses", CreateCustomerAddress)
+	api.PATCH("/customers/:id/addresses/:address_id", UpdateCustomerAddress)
+	api.DELETE("/customers/:id/addresses/:address_id", DeleteCustomerAddress)
+
+	// Order history routes
+	api.GET("/customers/:id/orders", ListCustomerOrders)
+	api.GET("/customers/:id/summary", GetCustomerSummary)
+
+	// Guest orders and duplicates routes
+	api.POST("/customers/:id/email-verification", RequestEmailVerification)
+	api.POST("/customers/:id/verify-email", VerifyCustomerEmail)
+	api.POST("/customers/:id/claim-guest-orders", ClaimGuestOrders)
+	api.POST("/customers/:id/merge", MergeCustomer)
+
+	// Data subject request routes
+	api.GET("/customers/:id/export", ExportCustomerData)
+	api.POST("/customers/:id/erase", EraseCustomerData)
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request DTOs
+type CycleCountRequest struct {
+	LocationID *uuid.UUID  `json:"location_id"` // Default location when omitted
+	VariantIDs []uuid.UUID `json:"variant_ids"` // Every variant stocked at the location when empty
+	Note       *string     `json:"note"`
+}
+
+type CycleCountEntryRequest struct {
+	VariantID  uuid.UUID `json:"variant_id" binding:"required"`
+	CountedQty *int      `json:"counted_qty" binding:"required,min=0"`
+}
+
+type CycleCountSubmitRequest struct {
+	Counts []CycleCountEntryRequest `json:"counts" binding:"required,min=1,dive"`
+}
+
+// ListCycleCounts returns the cycle counts, newest first, optionally filtered by
+// ?status= and ?location_id=
+func ListCycleCounts(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	status := c.Query("status")
+	locationID := c.Query("location_id")
+	offset := (page - 1) * limit
+
+	query := config.DB.Model(&models.CycleCount{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if locationID != "" {
+		if _, err := uuid.Parse(locationID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+			return
+		}
+		query = query.Where("location_id = ?", locationID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var counts []models.CycleCount
+	err := query.Preload("Location").Offset(offset).Limit(limit).Order("created_at DESC").Find(&counts).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch cycle counts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": counts,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// StartCycleCount opens a count of variants at a location
+func StartCycleCount(c *gin.Context) {
+	var input CycleCountRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	count, err := services.StartCycleCount(config.DB, input.LocationID, input.VariantIDs, input.Note, requestActor(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, count)
+}
+
+// GetCycleCount returns a cycle count with its lines
+func GetCycleCount(c *gin.Context) {
+	countID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cycle count ID"})
+		return
+	}
+
+	count, err := services.GetCycleCount(config.DB, countID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, count)
+}
+
+// SubmitCycleCount records counted quantities for variants of an open count
+func SubmitCycleCount(c *gin.Context) {
+	countID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cycle count ID"})
+		return
+	}
+
+	var input CycleCountSubmitRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	entries := make([]services.CycleCountEntry, len(input.Counts))
+	for i, entry := range input.Counts {
+		entries[i] = services.CycleCountEntry{VariantID: entry.VariantID, CountedQty: *entry.CountedQty}
+	}
+
+	count, err := services.SubmitCycleCount(config.DB, countID, entries)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, count)
+}
+
+// GetCycleCountVariances compares the counted quantities with the stock on hand
+func GetCycleCountVariances(c *gin.Context) {
+	countID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cycle count ID"})
+		return
+	}
+
+	variances, err := services.CycleCountVariances(config.DB, countID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": variances})
+}
+
+// ApproveCycleCount corrects the stock by the variances of a fully counted count
+func ApproveCycleCount(c *gin.Context) {
+	countID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cycle count ID"})
+		return
+	}
+
+	count, err := services.ApproveCycleCount(config.DB, countID, requestActor(c))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, count)
+}
+
+// CancelCycleCount drops an open count, leaving the stock as is
+func CancelCycleCount(c *gin.Context) {
+	countID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cycle count ID"})
+		return
+	}
+
+	count, err := services.CancelCycleCount(config.DB, countID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, count)
+}
+
+// RegisterCycleCountRoutes registers the cycle count routes
+func RegisterCycleCountRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	api.GET("/cycle-counts", ListCycleCounts)
+	api.POST("/cycle-counts", StartCycleCount)
+	api.GET("/cycle-counts/:id", GetCycleCount)
+	api.POST("/cycle-counts/:id/counts", SubmitCycleCount)
+	api.GET("/cycle-counts/:id/variances", GetCycleCountVariances)
+	api.POST("/cycle-counts/:id/approve", ApproveCycleCount)
+	api.POST("/cycle-counts/:id/cancel", CancelCycleCount)
+}
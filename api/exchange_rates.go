@@ -0,0 +1,171 @@
+package api
+
+import (
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/money"
+	"oms-services/services"
+	"oms-services/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DateFormat is the layout of calendar dates in query params and payloads
+const DateFormat = "2006-01-02"
+
+// Request DTOs
+type ExchangeRateRequest struct {
+	BaseCurrency  string     `json:"base_currency" binding:"required,len=3"`
+	QuoteCurrency string     `json:"quote_currency" binding:"required,len=3"`
+	EffectiveDate string     `json:"effective_date" binding:"required"` // YYYY-MM-DD
+	Rate          money.Rate `json:"rate"`
+	Source        *string    `json:"source"`
+}
+
+// SaveExchangeRate creates or replaces the rate of a currency pair for a day
+func SaveExchangeRate(c *gin.Context) {
+	var input ExchangeRateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	date, err := time.Parse(DateFormat, input.EffectiveDate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid effective_date, expected YYYY-MM-DD"})
+		return
+	}
+
+	rate := models.ExchangeRate{
+		BaseCurrency:  input.BaseCurrency,
+		QuoteCurrency: input.QuoteCurrency,
+		EffectiveDate: date,
+		Rate:          input.Rate,
+		Source:        input.Source,
+	}
+	if err := services.SaveExchangeRate(config.DB, &rate); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rate)
+}
+
+// ImportExchangeRates loads daily rates from a CSV with a "date,base,quote,rate" header,
+// sent as the "file" form field or as the raw request body
+func ImportExchangeRates(c *gin.Context) {
+	body := c.Request.Body
+	if file, err := c.FormFile("file"); err == nil {
+		opened, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unable to read file"})
+			return
+		}
+		defer opened.Close()
+		body = opened
+	}
+
+	imported, err := services.ImportExchangeRates(config.DB, body, c.DefaultQuery("source", "csv"))
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"imported": imported})
+}
+
+// ConvertAmount converts ?amount_minor= from ?from= into ?to= at the rate of ?date=
+// (YYYY-MM-DD, defaults to today)
+func ConvertAmount(c *gin.Context) {
+	amount, err := strconv.ParseInt(c.Query("amount_minor"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid amount_minor"})
+		return
+	}
+	from, to := strings.ToUpper(c.Query("from")), strings.ToUpper(c.Query("to"))
+	if !money.IsKnownCurrency(from) || !money.IsKnownCurrency(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown currency"})
+		return
+	}
+	date := time.Now()
+	if value := c.Query("date"); value != "" {
+		if date, err = time.Parse(DateFormat, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid date, expected YYYY-MM-DD"})
+			return
+		}
+	}
+
+	rate, err := services.LookupExchangeRate(config.DB, from, to, date)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+	converted, err := money.New(amount, from).Convert(to, rate)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"amount":    money.New(amount, from),
+		"converted": converted,
+		"rate":      rate,
+		"date":      date.Format(DateFormat),
+	})
+}
+
+// GetSalesReport returns the orders, payments and refunds of [?from=, ?to=) expressed in
+// ?currency= (defaults to the reporting currency) with their per currency figures
+func GetSalesReport(c *gin.Context) {
+	from, err := time.Parse(DateFormat, c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, expected YYYY-MM-DD"})
+		return
+	}
+	to, err := time.Parse(DateFormat, c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, expected YYYY-MM-DD"})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+	currency := strings.ToUpper(c.DefaultQuery("currency", services.ReportingCurrency))
+	if !money.IsKnownCurrency(currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown currency"})
+		return
+	}
+
+	report, err := services.BuildSalesReport(config.DB, from, to, currency)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// RegisterExchangeRateRoutes registers the exchange rate and reporting routes
+func RegisterExchangeRateRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	exchangeRateViewSet := utils.ViewSet[models.ExchangeRate, ExchangeRateRequest, ExchangeRateRequest]{
+		DB:           config.DB,
+		SearchFields: []string{"base_currency", "quote_currency", "source"},
+	}
+
+	// Exchange rate routes
+	api.GET("/exchange-rates", exchangeRateViewSet.List)
+	api.POST("/exchange-rates", SaveExchangeRate)
+	api.POST("/exchange-rates/import", ImportExchangeRates)
+	api.GET("/exchange-rates/convert", ConvertAmount)
+	api.GET("/exchange-rates/:id", exchangeRateViewSet.Retrieve)
+	api.DELETE("/exchange-rates/:id", exchangeRateViewSet.Delete)
+
+	// Report routes
+	api.GET("/reports/sales", GetSalesReport)
+}
@@ -0,0 +1,292 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"oms-services/config"
+	"oms-services/documents"
+	"oms-services/models"
+	"oms-services/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request DTOs
+type OrderStatusRequest struct {
+	Status models.OrderStatus `json:"status" binding:"required,oneof=paid fulfillment_in_progress shipped completed cancelled"`
+}
+
+type CreateShipmentsRequest struct {
+	Carrier string `json:"carrier"` // DEFAULT_CARRIER when omitted
+	Service string `json:"service"` // The carrier default service when omitted
+}
+
+type BinLocationRequest struct {
+	LocationID  *uuid.UUID `json:"location_id"`  // Default location when omitted
+	BinLocation *string    `json:"bin_location"` // null clears it
+}
+
+// respondDocument sends a document as JSON, or rendered as HTML or PDF per ?format=, the
+// rendered formats as a download named after filename
+func respondDocument(c *gin.Context, name, filename string, data interface{}) {
+	format := c.DefaultQuery("format", documents.FormatHTML)
+	if format == "json" {
+		c.JSON(http.StatusOK, data)
+		return
+	}
+
+	content, contentType, err := documents.Render(name, format, data)
+	if errors.Is(err, documents.ErrUnknownFormat) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format, expected json, html or pdf"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to render " + name})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, filename, format))
+	c.Data(http.StatusOK, contentType, content)
+}
+
+// TransitionOrder moves a placed order to its next status, e.g. into fulfillment
+func TransitionOrder(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var input OrderStatusRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := services.TransitionOrder(config.DB, orderID, input.Status)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// CreateOrderShipments packs the stock of an order being fulfilled into shipments, one
+// per location it ships from, and buys their labels from the carrier
+func CreateOrderShipments(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var input CreateShipmentsRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if input.Carrier == "" {
+		input.Carrier = config.DefaultCarrier()
+	}
+	if input.Carrier == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "carrier is required, no default carrier is configured"})
+		return
+	}
+	carrier, err := config.Carriers.Get(input.Carrier)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown carrier"})
+		return
+	}
+
+	shipments, err := services.CreateOrderShipments(c.Request.Context(), config.DB, config.Storage, carrier, orderID, input.Service)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": shipments})
+}
+
+// ListOrderShipments returns the shipments of an order
+func ListOrderShipments(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var shipments []models.Shipment
+	err = config.DB.Preload("Location").Preload("Items.Variant").Where("order_id = ?", orderID).Order("created_at").Find(&shipments).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch shipments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": shipments})
+}
+
+// GetShipment returns a shipment with its items
+func GetShipment(c *gin.Context) {
+	shipmentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+
+	shipment, err := services.GetShipment(config.DB, shipmentID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, shipment)
+}
+
+// PackShipment marks a shipment as packed
+func PackShipment(c *gin.Context) {
+	shipmentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+
+	shipment, err := services.PackShipment(config.DB, shipmentID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, shipment)
+}
+
+// CancelShipment voids the label of a shipment not handed over yet and deletes it
+func CancelShipment(c *gin.Context) {
+	shipmentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+
+	if err := services.CancelShipment(c.Request.Context(), config.DB, config.Storage, config.Carriers, shipmentID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Object deleted"})
+}
+
+// RefreshShipmentTracking asks the carrier where a shipment stands now
+func RefreshShipmentTracking(c *gin.Context) {
+	shipmentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+
+	shipment, err := services.RefreshShipmentTracking(c.Request.Context(), config.DB, config.Carriers, shipmentID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, shipment)
+}
+
+// GetPackingSlip downloads the packing slip of a shipment, as ?format=html (default),
+// pdf or json
+func GetPackingSlip(c *gin.Context) {
+	shipmentID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment ID"})
+		return
+	}
+
+	slip, err := services.BuildPackingSlip(config.DB, shipmentID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	respondDocument(c, "packing_slip", "packing-slip-"+shipmentID.String(), slip)
+}
+
+// GetPickList downloads the pick list of the orders being fulfilled at ?location_id=
+// (default location when omitted), or only of the ?order_id= given, as ?format=html
+// (default), pdf or json
+func GetPickList(c *gin.Context) {
+	var locationID *uuid.UUID
+	if value := c.Query("location_id"); value != "" {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+			return
+		}
+		locationID = &id
+	}
+	var orderIDs []uuid.UUID
+	for _, value := range c.QueryArray("order_id") {
+		id, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+			return
+		}
+		orderIDs = append(orderIDs, id)
+	}
+
+	pickList, err := services.BuildPickList(config.DB, locationID, orderIDs)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	respondDocument(c, "pick_list", fmt.Sprintf("pick-list-%s-%s", pickList.Location.Code, pickList.GeneratedAt.UTC().Format("20060102-1504")), pickList)
+}
+
+// SetBinLocation records where a variant is shelved at a location
+func SetBinLocation(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var input BinLocationRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := config.DB.Select("id").First(&models.ProductVariant{}, variantID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+
+	inventory, err := services.SetBinLocation(config.DB, variantID, input.LocationID, input.BinLocation)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, inventory)
+}
+
+// RegisterFulfillmentRoutes registers the order fulfillment, shipment, pick list and
+// packing slip routes
+func RegisterFulfillmentRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	api.POST("/orders/:id/status", TransitionOrder)
+	api.POST("/orders/:id/shipments", CreateOrderShipments)
+	api.GET("/orders/:id/shipments", ListOrderShipments)
+	api.GET("/shipments/:id", GetShipment)
+	api.DELETE("/shipments/:id", CancelShipment)
+	api.POST("/shipments/:id/pack", PackShipment)
+	api.POST("/shipments/:id/tracking", RefreshShipmentTracking)
+	api.GET("/shipments/:id/packing-slip", GetPackingSlip)
+	api.GET("/pick-lists", GetPickList)
+	api.PUT("/variants/:id/bin-location", SetBinLocation)
+}
@@ -0,0 +1,203 @@
+package api
+
+import (
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request DTOs
+type InventoryRequest struct {
+	LocationID *uuid.UUID `json:"location_id"` // Default location when omitted
+	QtyOnHand  *int       `json:"qty_on_hand" binding:"required,min=0"`
+	Note       *string    `json:"note"`
+}
+
+type InventoryAdjustmentRequest struct {
+	LocationID *uuid.UUID `json:"location_id"` // Default location when omitted
+	Delta      int        `json:"delta" binding:"required"`
+	Reason     string     `json:"reason" binding:"required,oneof=receive damage correction"`
+	Note       *string    `json:"note"`
+}
+
+// requestActor returns who made the request, from the X-Actor header, nil when unknown
+func requestActor(c *gin.Context) *string {
+	actor := c.GetHeader("X-Actor")
+	if actor == "" {
+		return nil
+	}
+	return &actor
+}
+
+// GetVariantInventory returns the stock levels of a variant at every location stocking
+// it, or at ?location_id=
+func GetVariantInventory(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+	if err := config.DB.Select("id").First(&models.ProductVariant{}, variantID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+
+	if value := c.Query("location_id"); value != "" {
+		locationID, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+			return
+		}
+		inventory, err := services.GetInventory(config.DB, variantID, &locationID)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, inventory)
+		return
+	}
+
+	inventories, err := services.ListInventories(config.DB, variantID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": inventories})
+}
+
+// UpdateVariantInventory overwrites the quantity on hand of a variant at a location
+func UpdateVariantInventory(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var input InventoryRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := config.DB.Select("id").First(&models.ProductVariant{}, variantID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+
+	inventory, err := services.SetInventory(config.DB, variantID, input.LocationID, *input.QtyOnHand, services.MovementSource{
+		Actor: requestActor(c),
+		Note:  input.Note,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, inventory)
+}
+
+// AdjustVariantInventory moves the quantity on hand of a variant at a location by a
+// delta for a reason (receive, damage or correction)
+func AdjustVariantInventory(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var input InventoryAdjustmentRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := config.DB.Select("id").First(&models.ProductVariant{}, variantID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+
+	inventory, err := services.AdjustInventory(config.DB, variantID, input.LocationID, input.Delta, services.MovementSource{
+		Reason: input.Reason,
+		Actor:  requestActor(c),
+		Note:   input.Note,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, inventory)
+}
+
+// ListVariantStockMovements returns the stock ledger of a variant, newest first,
+// optionally filtered by ?reason= and ?location_id=
+func ListVariantStockMovements(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	reason := c.Query("reason")
+	locationID := c.Query("location_id")
+	offset := (page - 1) * limit
+
+	query := config.DB.Model(&models.StockMovement{}).Where("variant_id = ?", variantID)
+	if reason != "" {
+		query = query.Where("reason = ?", reason)
+	}
+	if locationID != "" {
+		if _, err := uuid.Parse(locationID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+			return
+		}
+		query = query.Where("location_id = ?", locationID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var movements []models.StockMovement
+	err = query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&movements).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch stock movements"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": movements,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// GetStockDrift lists the variants whose inventory doesn't match their stock ledger
+func GetStockDrift(c *gin.Context) {
+	drifts, err := services.DetectStockDrift(config.DB)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": drifts})
+}
+
+// RegisterInventoryRoutes registers the variant inventory and stock ledger routes
+func RegisterInventoryRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	api.GET("/variants/:id/inventory", GetVariantInventory)
+	api.PATCH("/variants/:id/inventory", UpdateVariantInventory)
+	api.POST("/variants/:id/inventory/adjustments", AdjustVariantInventory)
+	api.GET("/variants/:id/stock-movements", ListVariantStockMovements)
+	api.GET("/inventory/drift", GetStockDrift)
+}
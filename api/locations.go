@@ -0,0 +1,163 @@
+package api
+
+import (
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/services"
+	"oms-services/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request DTOs
+type LocationRequest struct {
+	Code       string  `json:"code" binding:"required"`
+	Name       string  `json:"name" binding:"required"`
+	Line1      *string `json:"line1"`
+	City       *string `json:"city"`
+	Region     *string `json:"region"`
+	PostalCode *string `json:"postal_code"`
+	Country    string  `json:"country" binding:"required,len=2"`
+	Priority   int     `json:"priority"`
+	IsActive   *bool   `json:"is_active"`
+}
+
+func LocationRequestToModel(l *LocationRequest) models.Location {
+	location := models.Location{
+		Code:       l.Code,
+		Name:       l.Name,
+		Line1:      l.Line1,
+		City:       l.City,
+		Region:     l.Region,
+		PostalCode: l.PostalCode,
+		Country:    strings.ToUpper(l.Country),
+		Priority:   l.Priority,
+		IsActive:   true,
+	}
+	if l.IsActive != nil {
+		location.IsActive = *l.IsActive
+	}
+	return location
+}
+
+type LocationUpdateRequest struct {
+	Code       *string `json:"code"`
+	Name       *string `json:"name"`
+	Line1      *string `json:"line1"`
+	City       *string `json:"city"`
+	Region     *string `json:"region"`
+	PostalCode *string `json:"postal_code"`
+	Country    *string `json:"country" binding:"omitempty,len=2"`
+	Priority   *int    `json:"priority"`
+	IsActive   *bool   `json:"is_active"`
+}
+
+// UpdateLocation edits a location, including deactivating it
+func UpdateLocation(c *gin.Context) {
+	locationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+
+	var input LocationUpdateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.Code != nil {
+		updates["code"] = *input.Code
+	}
+	if input.Name != nil {
+		updates["name"] = *input.Name
+	}
+	if input.Line1 != nil {
+		updates["line1"] = *input.Line1
+	}
+	if input.City != nil {
+		updates["city"] = *input.City
+	}
+	if input.Region != nil {
+		updates["region"] = *input.Region
+	}
+	if input.PostalCode != nil {
+		updates["postal_code"] = *input.PostalCode
+	}
+	if input.Country != nil {
+		updates["country"] = strings.ToUpper(*input.Country)
+	}
+	if input.Priority != nil {
+		updates["priority"] = *input.Priority
+	}
+	if input.IsActive != nil {
+		updates["is_active"] = *input.IsActive
+	}
+
+	location, err := services.UpdateLocation(config.DB, locationID, updates)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, location)
+}
+
+// SetDefaultLocation makes a location the one new variants are stocked at
+func SetDefaultLocation(c *gin.Context) {
+	locationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+
+	location, err := services.SetDefaultLocation(config.DB, locationID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, location)
+}
+
+// GetOrderAllocations returns the locations the items of an order ship from
+func GetOrderAllocations(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var allocations []models.StockAllocation
+	err = config.DB.Preload("Location").Where("order_id = ?", orderID).Order("created_at").Find(&allocations).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch allocations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": allocations})
+}
+
+// RegisterLocationRoutes registers the location and order allocation routes
+func RegisterLocationRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	locationViewSet := utils.ViewSet[models.Location, LocationRequest, LocationRequest]{
+		DB:                   config.DB,
+		InputOfCreateToModel: LocationRequestToModel,
+		SearchFields:         []string{"code", "name", "city"},
+		CreateZeroValues:     true,
+	}
+
+	// Location routes
+	api.GET("/locations", locationViewSet.List)
+	api.POST("/locations", locationViewSet.Create)
+	api.GET("/locations/:id", locationViewSet.Retrieve)
+	api.PATCH("/locations/:id", UpdateLocation)
+	api.POST("/locations/:id/default", SetDefaultLocation)
+	api.GET("/orders/:id/allocations", GetOrderAllocations)
+}
@@ -0,0 +1,191 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/services"
+	"oms-services/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request DTOs
+type MediaUpdateRequest struct {
+	AltText   utils.Nullable[string]    `json:"alt_text"`
+	VariantID utils.Nullable[uuid.UUID] `json:"variant_id"` // null attaches the image to the whole product
+}
+
+type MediaOrderRequest struct {
+	MediaIDs []uuid.UUID `json:"media_ids" binding:"required"`
+}
+
+// UploadProductMedia stores the image sent as the "file" form field, with optional
+// "alt_text" and "variant_id" fields
+func UploadProductMedia(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	// Let oversized uploads fail while reading instead of buffering them whole
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.MaxMediaBytes+1<<20)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": services.ErrMediaTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "file is required"})
+		return
+	}
+	if file.Size > services.MaxMediaBytes {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": services.ErrMediaTooLarge.Error()})
+		return
+	}
+
+	upload := services.MediaUpload{ProductID: productID}
+	if altText := strings.TrimSpace(c.PostForm("alt_text")); altText != "" {
+		upload.AltText = &altText
+	}
+	if value := c.PostForm("variant_id"); value != "" {
+		variantID, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+			return
+		}
+		upload.VariantID = &variantID
+	}
+
+	opened, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unable to read file"})
+		return
+	}
+	defer opened.Close()
+	upload.Data = opened
+
+	media, err := services.UploadProductMedia(config.DB, config.Storage, upload)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, media)
+}
+
+// ListProductMedia returns the images of a product in display order, or those of
+// ?variant_id= along with the images of the whole product
+func ListProductMedia(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	query := config.DB.Where("product_id = ?", productID)
+	if value := c.Query("variant_id"); value != "" {
+		variantID, err := uuid.Parse(value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+			return
+		}
+		query = query.Where("variant_id IS NULL OR variant_id = ?", variantID)
+	}
+
+	var media []models.ProductMedia
+	if err := query.Order("position").Find(&media).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch media"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": media})
+}
+
+// UpdateProductMedia changes the alt text of an image and the variant it belongs to
+func UpdateProductMedia(c *gin.Context) {
+	mediaID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return
+	}
+
+	var input MediaUpdateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	input.AltText.Put(updates, "alt_text")
+	input.VariantID.Put(updates, "variant_id")
+
+	media, err := services.UpdateProductMedia(config.DB, mediaID, updates)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, media)
+}
+
+// ReorderProductMedia sets the display order of the images of a product
+func ReorderProductMedia(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var input MediaOrderRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	media, err := services.ReorderProductMedia(config.DB, productID, input.MediaIDs)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": media})
+}
+
+// DeleteProductMedia deletes an image and its stored files
+func DeleteProductMedia(c *gin.Context) {
+	mediaID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return
+	}
+
+	if err := services.DeleteProductMedia(config.DB, config.Storage, mediaID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Object deleted"})
+}
+
+// RegisterMediaRoutes registers the product media routes and serves the stored files
+func RegisterMediaRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	api.GET("/products/:id/media", ListProductMedia)
+	api.POST("/products/:id/media", UploadProductMedia)
+	api.PUT("/products/:id/media/order", ReorderProductMedia)
+	api.PATCH("/media/:id", UpdateProductMedia)
+	api.DELETE("/media/:id", DeleteProductMedia)
+
+	// Files of the local storage, unless served from elsewhere
+	if strings.HasPrefix(config.MediaBaseURL(), "/") {
+		config.Server.Static(config.MediaBaseURL(), config.MediaDir())
+	}
+}
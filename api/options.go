@@ -0,0 +1,143 @@
+package api
+
+import (
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/money"
+	"oms-services/services"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Request DTOs
+type ProductOptionRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Values []string `json:"values" binding:"required,min=1"`
+}
+
+func ProductOptionRequestToModel(o *ProductOptionRequest) models.ProductOption {
+	return models.ProductOption{
+		Name:   o.Name,
+		Values: o.Values,
+	}
+}
+
+type ProductOptionsRequest struct {
+	Options []ProductOptionRequest `json:"options" binding:"dive"`
+}
+
+type VariantMatrixRequest struct {
+	SKUPattern  string `json:"sku_pattern" binding:"required"` // e.g. "TEE-{color}-{size}"
+	PriceMinor  int    `json:"price_minor" binding:"min=0"`
+	Currency    string `json:"currency" binding:"required,len=3"`
+	WeightGrams int    `json:"weight_grams" binding:"min=0"`
+	IsActive    *bool  `json:"is_active"`
+}
+
+// GetProductOptions returns the option axes of a product
+func GetProductOptions(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var options []models.ProductOption
+	if err := config.DB.Where("product_id = ?", productID).Order("position").Find(&options).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch options"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": options})
+}
+
+// SetProductOptions replaces the option axes of a product, in the given order
+func SetProductOptions(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var input ProductOptionsRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	options := make([]models.ProductOption, len(input.Options))
+	for i := range input.Options {
+		options[i] = ProductOptionRequestToModel(&input.Options[i])
+	}
+
+	options, err = services.SetProductOptions(config.DB, productID, options)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": options})
+}
+
+// GenerateVariantMatrix creates the missing variants of every option combination of a product
+func GenerateVariantMatrix(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var input VariantMatrixRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	currency := strings.ToUpper(input.Currency)
+	if !money.IsKnownCurrency(currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown currency"})
+		return
+	}
+
+	matrix := services.VariantMatrix{
+		SKUPattern:  input.SKUPattern,
+		Price:       money.New(int64(input.PriceMinor), currency),
+		WeightGrams: input.WeightGrams,
+		IsActive:    input.IsActive == nil || *input.IsActive,
+	}
+	variants, err := services.GenerateVariantMatrix(config.DB, productID, matrix)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": variants})
+}
+
+// filterVariants narrows the variant list to ?product_id= and to attribute values given
+// as ?attr.<option>=<value>, repeated params matching any of the values
+func filterVariants(c *gin.Context, query *gorm.DB) *gorm.DB {
+	if productID := c.Query("product_id"); productID != "" {
+		query = query.Where("product_id = ?", productID)
+	}
+
+	filters := map[string][]string{}
+	for key, values := range c.Request.URL.Query() {
+		if name, ok := strings.CutPrefix(key, "attr."); ok && name != "" {
+			filters[name] = values
+		}
+	}
+	return services.VariantsWithAttributes(query, filters)
+}
+
+// RegisterOptionRoutes registers the product option and variant matrix routes
+func RegisterOptionRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	api.GET("/products/:id/options", GetProductOptions)
+	api.PUT("/products/:id/options", SetProductOptions)
+	api.POST("/products/:id/variants/matrix", GenerateVariantMatrix)
+}
@@ -1,9 +1,14 @@
 package api
 
 import (
+	"net/http"
+	"net/mail"
 	"oms-services/config"
 	"oms-services/models"
+	"oms-services/money"
+	"oms-services/services"
 	"oms-services/utils"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -11,19 +16,75 @@ import (
 
 // Request DTOs
 type OrderRequest struct {
-	CustomerID *uuid.UUID `json:"customer_id"`
-	Currency   string     `json:"currency" binding:"required,len=3"`
-	Status     *string    `json:"status"`
+	CustomerID        *uuid.UUID `json:"customer_id"`
+	Currency          string     `json:"currency" binding:"required,len=3"`
+	Store             *string    `json:"store"`
+	BillingAddressID  *uuid.UUID `json:"billing_address_id"`
+	ShippingAddressID *uuid.UUID `json:"shipping_address_id"`
+	// Guest checkout fields, used when the order has no customer
+	GuestEmail      *string              `json:"guest_email" binding:"omitempty,email"`
+	GuestPhone      *string              `json:"guest_phone"`
+	BillingAddress  *OrderAddressRequest `json:"billing_address"`
+	ShippingAddress *OrderAddressRequest `json:"shipping_address"`
+}
+
+type OrderAddressRequest struct {
+	FirstName  string  `json:"first_name" binding:"required"`
+	LastName   string  `json:"last_name" binding:"required"`
+	Line1      string  `json:"line1" binding:"required"`
+	Line2      *string `json:"line2"`
+	City       string  `json:"city" binding:"required"`
+	Region     *string `json:"region"`
+	PostalCode *string `json:"postal_code"`
+	Country    string  `json:"country" binding:"required,len=2"`
+	Phone      *string `json:"phone"`
+}
+
+func OrderAddressRequestToSnapshot(a *OrderAddressRequest) *models.AddressSnapshot {
+	if a == nil {
+		return nil
+	}
+	return &models.AddressSnapshot{
+		FirstName:  a.FirstName,
+		LastName:   a.LastName,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    strings.ToUpper(a.Country),
+		Phone:      a.Phone,
+	}
 }
 
 func OrderRequestToModel(o *OrderRequest) models.Order {
 	return models.Order{
-		CustomerID: o.CustomerID,
-		Status:     models.OrderStatusDraft,
-		Currency:   o.Currency,
+		CustomerID:              o.CustomerID,
+		GuestEmail:              o.GuestEmail,
+		GuestPhone:              o.GuestPhone,
+		Status:                  models.OrderStatusDraft,
+		Currency:                strings.ToUpper(o.Currency),
+		Store:                   o.Store,
+		BillingAddressID:        o.BillingAddressID,
+		ShippingAddressID:       o.ShippingAddressID,
+		BillingAddressSnapshot:  OrderAddressRequestToSnapshot(o.BillingAddress),
+		ShippingAddressSnapshot: OrderAddressRequestToSnapshot(o.ShippingAddress),
 	}
 }
 
+// OrderUpdateRequest edits a draft order. Fields left out are kept, null clears them.
+type OrderUpdateRequest struct {
+	CustomerID        utils.Nullable[uuid.UUID]           `json:"customer_id"`
+	Currency          *string                             `json:"currency" binding:"omitempty,len=3"`
+	Store             utils.Nullable[string]              `json:"store"`
+	BillingAddressID  utils.Nullable[uuid.UUID]           `json:"billing_address_id"`
+	ShippingAddressID utils.Nullable[uuid.UUID]           `json:"shipping_address_id"`
+	GuestEmail        utils.Nullable[string]              `json:"guest_email"`
+	GuestPhone        utils.Nullable[string]              `json:"guest_phone"`
+	BillingAddress    utils.Nullable[OrderAddressRequest] `json:"billing_address"`
+	ShippingAddress   utils.Nullable[OrderAddressRequest] `json:"shipping_address"`
+}
+
 type OrderItemRequest struct {
 	OrderID   uuid.UUID `json:"order_id" binding:"required"`
 	VariantID uuid.UUID `json:"variant_id" binding:"required"`
@@ -38,6 +99,213 @@ func OrderItemRequestToModel(o *OrderItemRequest) models.OrderItem {
 	}
 }
 
+type OrderItemQuantityRequest struct {
+	Quantity int `json:"quantity" binding:"required,min=1"`
+}
+
+type ApplyCouponRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// CreateOrder creates a draft order
+func CreateOrder(c *gin.Context) {
+	var input OrderRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !money.IsKnownCurrency(strings.ToUpper(input.Currency)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown currency"})
+		return
+	}
+
+	order := OrderRequestToModel(&input)
+	if err := config.DB.Create(&order).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create order"})
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// UpdateOrder edits a draft order and reprices it, the shipping address driving taxes.
+// Placed orders only move along their lifecycle.
+func UpdateOrder(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var input OrderUpdateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.GuestEmail.Value != nil {
+		if _, err := mail.ParseAddress(*input.GuestEmail.Value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid guest email"})
+			return
+		}
+	}
+	if input.Currency != nil && !money.IsKnownCurrency(strings.ToUpper(*input.Currency)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown currency"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	input.CustomerID.Put(updates, "customer_id")
+	if input.Currency != nil {
+		updates["currency"] = strings.ToUpper(*input.Currency)
+	}
+	input.Store.Put(updates, "store")
+	input.BillingAddressID.Put(updates, "billing_address_id")
+	input.ShippingAddressID.Put(updates, "shipping_address_id")
+	input.GuestEmail.Put(updates, "guest_email")
+	input.GuestPhone.Put(updates, "guest_phone")
+	if input.BillingAddress.Set {
+		updates["billing_address_snapshot"] = OrderAddressRequestToSnapshot(input.BillingAddress.Value)
+	}
+	if input.ShippingAddress.Set {
+		updates["shipping_address_snapshot"] = OrderAddressRequestToSnapshot(input.ShippingAddress.Value)
+	}
+
+	order, err := services.UpdateDraftOrder(config.DB, orderID, updates)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// AddOrderItem adds a variant to a draft order and recalculates its totals
+func AddOrderItem(c *gin.Context) {
+	var input OrderItemRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	item, err := services.AddOrderItem(config.DB, input.OrderID, input.VariantID, input.Quantity)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// UpdateOrderItem changes the quantity of a draft order line
+func UpdateOrderItem(c *gin.Context) {
+	itemID, err := uuid.Parse(c.Param("item_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	var input OrderItemQuantityRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	item, err := services.UpdateOrderItemQuantity(config.DB, itemID, input.Quantity)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, item)
+}
+
+// RemoveOrderItem deletes a draft order line
+func RemoveOrderItem(c *gin.Context) {
+	itemID, err := uuid.Parse(c.Param("item_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	order, err := services.RemoveOrderItem(config.DB, itemID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// ApplyCoupon applies a coupon code to a draft order
+func ApplyCoupon(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var input ApplyCouponRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := services.ApplyCoupon(config.DB, orderID, input.Code)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// RemoveCoupon removes the coupon from a draft order
+func RemoveCoupon(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	order, err := services.RemoveCoupon(config.DB, orderID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+type CheckoutConfirmRequest struct {
+	ShippingMethodID *uuid.UUID `json:"shipping_method_id"`
+}
+
+// CheckoutConfirm snapshots the order addresses and moves the draft to pending_payment.
+// A shipping method can be chosen in the same call.
+func CheckoutConfirm(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var input CheckoutConfirmRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	order, err := services.ConfirmCheckout(config.DB, orderID, input.ShippingMethodID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
 // RegisterOrderRoutes registers all order routes
 func RegisterOrderRoutes() {
 	api := config.Server.Group("/api/v1")
@@ -45,16 +313,11 @@ func RegisterOrderRoutes() {
 	// Order routes
 	orderViewSet := utils.ViewSet[models.Order, OrderRequest, OrderRequest]{
 		DB: config.DB,
-		PerformCreateFunc: func(c *gin.Context, obj *models.Order) error {
-			return nil
-		},
-		InputOfCreateToModel: OrderRequestToModel,
-		InputOfUpdateToModel: OrderRequestToModel,
 	}
-	api.POST("/orders", orderViewSet.Create)
+	api.POST("/orders", CreateOrder)
 	api.GET("/orders", orderViewSet.List)
 	api.GET("/orders/:id", orderViewSet.Retrieve)
-	api.PATCH("/orders/:id", orderViewSet.Update)
+	api.PATCH("/orders/:id", UpdateOrder)
 
 	// Order items routes
 	orderItemViewSet := utils.ViewSet[models.OrderItem, OrderItemRequest, OrderItemRequest]{
@@ -66,13 +329,17 @@ func RegisterOrderRoutes() {
 		InputOfUpdateToModel: OrderItemRequestToModel,
 	}
 	api.GET("/orders/items", orderItemViewSet.List)
-	api.POST("/orders/items", orderItemViewSet.Create)
-	api.PATCH("/orders/items/:item_id", orderItemViewSet.Update)
-	api.DELETE("/orders/items/:item_id", orderItemViewSet.Delete)
+	api.POST("/orders/items", AddOrderItem)
+	api.PATCH("/orders/items/:item_id", UpdateOrderItem)
+	api.DELETE("/orders/items/:item_id", RemoveOrderItem)
+
+	// Coupon routes
+	api.POST("/orders/:id/coupon", ApplyCoupon)
+	api.DELETE("/orders/:id/coupon", RemoveCoupon)
 
 	// Checkout routes
 	// api.POST("/orders/:id/checkout/preview", CheckoutPreview)
-	// api.POST("/orders/:id/checkout/confirm", CheckoutConfirm)
+	api.POST("/orders/:id/checkout/confirm", CheckoutConfirm)
 
 	// Refunds routes
 	// api.POST("/orders/:id/refunds", CreateRefund)
@@ -0,0 +1,291 @@
+package api
+
+import (
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/money"
+	"oms-services/services"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request DTOs
+type VariantPriceRequest struct {
+	Currency      string     `json:"currency" binding:"required,len=3"`
+	AmountMinor   int        `json:"amount_minor" binding:"min=0"`
+	Store         *string    `json:"store"`
+	CustomerGroup *string    `json:"customer_group"`
+	StartsAt      *time.Time `json:"starts_at"`
+	EndsAt        *time.Time `json:"ends_at"`
+}
+
+func VariantPriceRequestToModel(p *VariantPriceRequest) models.VariantPrice {
+	currency := strings.ToUpper(p.Currency)
+	return models.VariantPrice{
+		Currency:      currency,
+		Amount:        money.New(int64(p.AmountMinor), currency),
+		Store:         p.Store,
+		CustomerGroup: p.CustomerGroup,
+		StartsAt:      p.StartsAt,
+		EndsAt:        p.EndsAt,
+	}
+}
+
+type ScheduledPriceRequest struct {
+	SalePriceMinor int        `json:"sale_price_minor" binding:"min=0"`
+	StartsAt       time.Time  `json:"starts_at" binding:"required"`
+	EndsAt         *time.Time `json:"ends_at"`
+}
+
+// ListVariantPrices returns the price list of a variant
+func ListVariantPrices(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var prices []models.VariantPrice
+	err = config.DB.Where("variant_id = ?", variantID).
+		Order("currency, starts_at NULLS FIRST").
+		Find(&prices).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch prices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": prices})
+}
+
+// AddVariantPrice adds an entry to the price list of a variant
+func AddVariantPrice(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var input VariantPriceRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !money.IsKnownCurrency(input.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown currency"})
+		return
+	}
+	if input.StartsAt != nil && input.EndsAt != nil && !input.StartsAt.Before(*input.EndsAt) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "starts_at must be before ends_at"})
+		return
+	}
+
+	var variant models.ProductVariant
+	if err := config.DB.First(&variant, variantID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+
+	price := VariantPriceRequestToModel(&input)
+	if err := services.AddVariantPrice(config.DB, &variant, &price); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create price"})
+		return
+	}
+
+	c.JSON(http.StatusOK, price)
+}
+
+// DeleteVariantPrice removes an entry from the price list of a variant
+func DeleteVariantPrice(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+	priceID, err := uuid.Parse(c.Param("price_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price ID"})
+		return
+	}
+
+	if err := services.DeleteVariantPrice(config.DB, variantID, priceID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Object deleted"})
+}
+
+// ResolveVariantPrice returns the price a variant would be sold at for the
+// ?currency=, ?store=, ?customer_group= and ?at= (RFC 3339, defaults to now) query
+func ResolveVariantPrice(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	pc := services.PriceContext{Currency: strings.ToUpper(c.Query("currency")), At: time.Now()}
+	if pc.Currency == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currency is required"})
+		return
+	}
+	if store := c.Query("store"); store != "" {
+		pc.Store = &store
+	}
+	if group := c.Query("customer_group"); group != "" {
+		pc.CustomerGroup = &group
+	}
+	if at := c.Query("at"); at != "" {
+		if pc.At, err = time.Parse(TimeFormat, at); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid at, expected RFC 3339"})
+			return
+		}
+	}
+
+	var variant models.ProductVariant
+	if err := config.DB.First(&variant, variantID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+
+	price, err := services.ResolveVariantPrice(config.DB, &variant, pc)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"variant_id": variant.ID, "price": price})
+}
+
+// ScheduleVariantPrice plans a sale on the base price of a variant
+func ScheduleVariantPrice(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var input ScheduledPriceRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sale, err := services.CreateScheduledPrice(config.DB, variantID, int64(input.SalePriceMinor), input.StartsAt, input.EndsAt)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, sale)
+}
+
+// ListScheduledPrices returns the sales planned, running and past of a variant
+func ListScheduledPrices(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	query := config.DB.Where("variant_id = ?", variantID)
+	if status := c.Query("status"); status != "" {
+		switch models.ScheduledPriceStatus(status) {
+		case models.ScheduledPriceStatusScheduled, models.ScheduledPriceStatusActive,
+			models.ScheduledPriceStatusExpired, models.ScheduledPriceStatusCancelled:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+			return
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	var sales []models.ScheduledPrice
+	if err := query.Order("starts_at DESC").Find(&sales).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch scheduled prices"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": sales})
+}
+
+// CancelScheduledPrice cancels a planned or running sale
+func CancelScheduledPrice(c *gin.Context) {
+	saleID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scheduled price ID"})
+		return
+	}
+
+	sale, err := services.CancelScheduledPrice(config.DB, saleID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, sale)
+}
+
+// GetVariantPriceHistory lists the base and price list prices a variant had, optionally
+// in a ?currency=. With ?at= (RFC 3339) it returns the price it had at that time, for
+// the ?currency=, ?store= and ?customer_group= when given.
+func GetVariantPriceHistory(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+	currency := strings.ToUpper(c.Query("currency"))
+
+	if value := c.Query("at"); value != "" {
+		pc := services.PriceContext{Currency: currency}
+		if pc.At, err = time.Parse(TimeFormat, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid at, expected RFC 3339"})
+			return
+		}
+		if store := c.Query("store"); store != "" {
+			pc.Store = &store
+		}
+		if group := c.Query("customer_group"); group != "" {
+			pc.CustomerGroup = &group
+		}
+		entry, err := services.VariantPriceAt(config.DB, variantID, pc)
+		if err != nil {
+			respondError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, entry)
+		return
+	}
+
+	query := config.DB.Where("variant_id = ?", variantID)
+	if currency != "" {
+		query = query.Where("currency = ?", currency)
+	}
+	var entries []models.VariantPriceHistory
+	err = query.Order("effective_from DESC, created_at DESC").Find(&entries).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch price history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": entries})
+}
+
+// RegisterPriceRoutes registers the variant price list, sale and price history routes
+func RegisterPriceRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	api.GET("/variants/:id/prices", ListVariantPrices)
+	api.POST("/variants/:id/prices", AddVariantPrice)
+	api.DELETE("/variants/:id/prices/:price_id", DeleteVariantPrice)
+	api.GET("/variants/:id/price", ResolveVariantPrice)
+	api.GET("/variants/:id/price-history", GetVariantPriceHistory)
+	api.GET("/variants/:id/scheduled-prices", ListScheduledPrices)
+	api.POST("/variants/:id/scheduled-prices", ScheduleVariantPrice)
+	api.POST("/scheduled-prices/:id/cancel", CancelScheduledPrice)
+}
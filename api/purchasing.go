@@ -0,0 +1,463 @@
+package api
+
+import (
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/money"
+	"oms-services/services"
+	"oms-services/utils"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request DTOs
+type SupplierRequest struct {
+	Code         string  `json:"code" binding:"required"`
+	Name         string  `json:"name" binding:"required"`
+	Email        *string `json:"email" binding:"omitempty,email"`
+	Phone        *string `json:"phone"`
+	Currency     string  `json:"currency" binding:"required,len=3"`
+	LeadTimeDays *int    `json:"lead_time_days" binding:"omitempty,min=0"`
+	Notes        *string `json:"notes"`
+	IsActive     *bool   `json:"is_active"`
+}
+
+func SupplierRequestToModel(s *SupplierRequest) models.Supplier {
+	supplier := models.Supplier{
+		Code:         s.Code,
+		Name:         s.Name,
+		Email:        s.Email,
+		Phone:        s.Phone,
+		Currency:     strings.ToUpper(s.Currency),
+		LeadTimeDays: s.LeadTimeDays,
+		Notes:        s.Notes,
+		IsActive:     true,
+	}
+	if s.IsActive != nil {
+		supplier.IsActive = *s.IsActive
+	}
+	return supplier
+}
+
+type SupplierUpdateRequest struct {
+	Code         *string `json:"code"`
+	Name         *string `json:"name"`
+	Email        *string `json:"email" binding:"omitempty,email"`
+	Phone        *string `json:"phone"`
+	Currency     *string `json:"currency" binding:"omitempty,len=3"`
+	LeadTimeDays *int    `json:"lead_time_days" binding:"omitempty,min=0"`
+	Notes        *string `json:"notes"`
+	IsActive     *bool   `json:"is_active"`
+}
+
+type PurchaseOrderLineRequest struct {
+	VariantID     uuid.UUID `json:"variant_id" binding:"required"`
+	QtyOrdered    int       `json:"qty_ordered" binding:"required,min=1"`
+	UnitCostMinor int       `json:"unit_cost_minor" binding:"min=0"` // In the purchase order currency
+}
+
+func PurchaseOrderLineRequestToModel(l *PurchaseOrderLineRequest) models.PurchaseOrderLine {
+	return models.PurchaseOrderLine{
+		VariantID:  l.VariantID,
+		QtyOrdered: l.QtyOrdered,
+		UnitCost:   money.New(int64(l.UnitCostMinor), ""),
+	}
+}
+
+type PurchaseOrderRequest struct {
+	SupplierID  uuid.UUID                  `json:"supplier_id" binding:"required"`
+	LocationID  *uuid.UUID                 `json:"location_id"`                        // Default location when omitted
+	Currency    *string                    `json:"currency" binding:"omitempty,len=3"` // Supplier currency when omitted
+	SupplierRef *string                    `json:"supplier_ref"`
+	ExpectedAt  *time.Time                 `json:"expected_at"`
+	Notes       *string                    `json:"notes"`
+	Lines       []PurchaseOrderLineRequest `json:"lines" binding:"dive"`
+}
+
+type PurchaseOrderUpdateRequest struct {
+	LocationID  *uuid.UUID `json:"location_id"` // Drafts only
+	SupplierRef *string    `json:"supplier_ref"`
+	ExpectedAt  *time.Time `json:"expected_at"`
+	Notes       *string    `json:"notes"`
+}
+
+type PurchaseOrderLinesRequest struct {
+	Lines []PurchaseOrderLineRequest `json:"lines" binding:"dive"`
+}
+
+type PurchaseOrderReceiptRequest struct {
+	LineID   uuid.UUID `json:"line_id" binding:"required"`
+	Quantity int       `json:"quantity" binding:"required,min=1"`
+}
+
+type PurchaseOrderReceiveRequest struct {
+	LocationID *uuid.UUID                    `json:"location_id"` // Purchase order location when omitted
+	Lines      []PurchaseOrderReceiptRequest `json:"lines" binding:"required,min=1,dive"`
+	Note       *string                       `json:"note"`
+}
+
+// UpdateSupplier edits a supplier, including deactivating it
+func UpdateSupplier(c *gin.Context) {
+	supplierID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
+		return
+	}
+
+	var input SupplierUpdateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Currency != nil && !money.IsKnownCurrency(*input.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown currency"})
+		return
+	}
+
+	var supplier models.Supplier
+	if err := config.DB.First(&supplier, supplierID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Supplier not found"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.Code != nil {
+		updates["code"] = *input.Code
+	}
+	if input.Name != nil {
+		updates["name"] = *input.Name
+	}
+	if input.Email != nil {
+		updates["email"] = *input.Email
+	}
+	if input.Phone != nil {
+		updates["phone"] = *input.Phone
+	}
+	if input.Currency != nil {
+		updates["currency"] = strings.ToUpper(*input.Currency)
+	}
+	if input.LeadTimeDays != nil {
+		updates["lead_time_days"] = *input.LeadTimeDays
+	}
+	if input.Notes != nil {
+		updates["notes"] = *input.Notes
+	}
+	if input.IsActive != nil {
+		updates["is_active"] = *input.IsActive
+	}
+
+	if len(updates) > 0 {
+		if err := config.DB.Model(&supplier).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to update supplier"})
+			return
+		}
+		config.DB.First(&supplier, supplier.ID)
+	}
+
+	c.JSON(http.StatusOK, supplier)
+}
+
+// ListPurchaseOrders returns the purchase orders, newest first, optionally filtered by
+// ?status= and ?supplier_id=
+func ListPurchaseOrders(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	status := c.Query("status")
+	supplierID := c.Query("supplier_id")
+	offset := (page - 1) * limit
+
+	query := config.DB.Model(&models.PurchaseOrder{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if supplierID != "" {
+		if _, err := uuid.Parse(supplierID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid supplier ID"})
+			return
+		}
+		query = query.Where("supplier_id = ?", supplierID)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var orders []models.PurchaseOrder
+	err := query.Preload("Supplier").Offset(offset).Limit(limit).Order("created_at DESC").Find(&orders).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch purchase orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": orders,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// CreatePurchaseOrder creates a draft purchase order with its lines
+func CreatePurchaseOrder(c *gin.Context) {
+	var input PurchaseOrderRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.Currency != nil && !money.IsKnownCurrency(*input.Currency) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown currency"})
+		return
+	}
+
+	order := models.PurchaseOrder{
+		SupplierID:  input.SupplierID,
+		SupplierRef: input.SupplierRef,
+		ExpectedAt:  input.ExpectedAt,
+		Notes:       input.Notes,
+	}
+	if input.LocationID != nil {
+		order.LocationID = *input.LocationID
+	}
+	if input.Currency != nil {
+		order.Currency = *input.Currency
+	}
+	lines := make([]models.PurchaseOrderLine, len(input.Lines))
+	for i := range input.Lines {
+		lines[i] = PurchaseOrderLineRequestToModel(&input.Lines[i])
+	}
+
+	created, err := services.CreatePurchaseOrder(config.DB, &order, lines)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, created)
+}
+
+// GetPurchaseOrder returns a purchase order with its lines
+func GetPurchaseOrder(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	order, err := services.GetPurchaseOrder(config.DB, orderID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// UpdatePurchaseOrder edits the details of a purchase order
+func UpdatePurchaseOrder(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	var input PurchaseOrderUpdateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.LocationID != nil {
+		updates["location_id"] = *input.LocationID
+	}
+	if input.SupplierRef != nil {
+		updates["supplier_ref"] = *input.SupplierRef
+	}
+	if input.ExpectedAt != nil {
+		updates["expected_at"] = *input.ExpectedAt
+	}
+	if input.Notes != nil {
+		updates["notes"] = *input.Notes
+	}
+
+	order, err := services.UpdatePurchaseOrder(config.DB, orderID, updates)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// DeletePurchaseOrder deletes a draft purchase order
+func DeletePurchaseOrder(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	if err := services.DeletePurchaseOrder(config.DB, orderID); err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Object deleted"})
+}
+
+// SetPurchaseOrderLines replaces the lines of a draft purchase order
+func SetPurchaseOrderLines(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	var input PurchaseOrderLinesRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	lines := make([]models.PurchaseOrderLine, len(input.Lines))
+	for i := range input.Lines {
+		lines[i] = PurchaseOrderLineRequestToModel(&input.Lines[i])
+	}
+
+	order, err := services.SetPurchaseOrderLines(config.DB, orderID, lines)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// SendPurchaseOrder marks a draft purchase order as sent to its supplier
+func SendPurchaseOrder(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	order, err := services.SendPurchaseOrder(config.DB, orderID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// ReceivePurchaseOrder books the delivered units of purchase order lines into the stock
+func ReceivePurchaseOrder(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	var input PurchaseOrderReceiveRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	receipts := make([]services.PurchaseOrderReceipt, len(input.Lines))
+	for i, line := range input.Lines {
+		receipts[i] = services.PurchaseOrderReceipt{LineID: line.LineID, Quantity: line.Quantity}
+	}
+
+	order, err := services.ReceivePurchaseOrder(config.DB, orderID, input.LocationID, receipts, services.MovementSource{
+		Actor: requestActor(c),
+		Note:  input.Note,
+	})
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// ClosePurchaseOrder closes a sent purchase order, no more stock being expected
+func ClosePurchaseOrder(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid purchase order ID"})
+		return
+	}
+
+	order, err := services.ClosePurchaseOrder(config.DB, orderID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// GetVariantMarginReport returns the revenue, cost and margin per variant of the orders
+// placed in [?from=, ?to=)
+func GetVariantMarginReport(c *gin.Context) {
+	from, err := time.Parse(DateFormat, c.Query("from"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from, expected YYYY-MM-DD"})
+		return
+	}
+	to, err := time.Parse(DateFormat, c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to, expected YYYY-MM-DD"})
+		return
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	rows, err := services.BuildVariantMarginReport(config.DB, from, to)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": rows})
+}
+
+// RegisterPurchasingRoutes registers the supplier, purchase order and margin report routes
+func RegisterPurchasingRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	supplierViewSet := utils.ViewSet[models.Supplier, SupplierRequest, SupplierRequest]{
+		DB:                   config.DB,
+		InputOfCreateToModel: SupplierRequestToModel,
+		SearchFields:         []string{"code", "name"},
+		CreateZeroValues:     true,
+	}
+
+	// Supplier routes
+	api.GET("/suppliers", supplierViewSet.List)
+	api.POST("/suppliers", supplierViewSet.Create)
+	api.GET("/suppliers/:id", supplierViewSet.Retrieve)
+	api.PATCH("/suppliers/:id", UpdateSupplier)
+
+	// Purchase order routes
+	api.GET("/purchase-orders", ListPurchaseOrders)
+	api.POST("/purchase-orders", CreatePurchaseOrder)
+	api.GET("/purchase-orders/:id", GetPurchaseOrder)
+	api.PATCH("/purchase-orders/:id", UpdatePurchaseOrder)
+	api.DELETE("/purchase-orders/:id", DeletePurchaseOrder)
+	api.PUT("/purchase-orders/:id/lines", SetPurchaseOrderLines)
+	api.POST("/purchase-orders/:id/send", SendPurchaseOrder)
+	api.POST("/purchase-orders/:id/receipts", ReceivePurchaseOrder)
+	api.POST("/purchase-orders/:id/close", ClosePurchaseOrder)
+
+	api.GET("/reports/variant-margin", GetVariantMarginReport)
+}
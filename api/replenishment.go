@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/services"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request DTOs
+type ReorderPolicyRequest struct {
+	ReorderPoint *int `json:"reorder_point" binding:"omitempty,min=0"` // null turns the stock alerts off
+	ReorderQty   *int `json:"reorder_qty" binding:"omitempty,min=1"`
+}
+
+// SetVariantReorderPolicy sets the reorder point and quantity of a variant
+func SetVariantReorderPolicy(c *gin.Context) {
+	variantID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var input ReorderPolicyRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := config.DB.Select("id").First(&models.ProductVariant{}, variantID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		return
+	}
+
+	variant, err := services.SetReorderPolicy(config.DB, variantID, input.ReorderPoint, input.ReorderQty)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, variant)
+}
+
+// GetReplenishmentNeeds lists the variants at or below their reorder point with the
+// quantity to order
+func GetReplenishmentNeeds(c *gin.Context) {
+	levels, err := services.ReplenishmentNeeds(config.DB)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": levels})
+}
+
+// ListNotifications returns the notifications, newest first, optionally filtered by
+// ?type= and ?unread=true
+func ListNotifications(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "10"))
+	notificationType := c.Query("type")
+	unread := c.Query("unread") == "true"
+	offset := (page - 1) * limit
+
+	query := config.DB.Model(&models.Notification{})
+	if notificationType != "" {
+		query = query.Where("type = ?", notificationType)
+	}
+	if unread {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var notifications []models.Notification
+	err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&notifications).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to fetch notifications"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": notifications,
+		"pagination": gin.H{
+			"page":  page,
+			"limit": limit,
+			"total": total,
+		},
+	})
+}
+
+// MarkNotificationRead acknowledges a notification
+func MarkNotificationRead(c *gin.Context) {
+	notificationID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		return
+	}
+
+	notification, err := services.MarkNotificationRead(config.DB, notificationID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, notification)
+}
+
+// RegisterReplenishmentRoutes registers the reorder policy, replenishment and notification routes
+func RegisterReplenishmentRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	api.PUT("/variants/:id/reorder-policy", SetVariantReorderPolicy)
+	api.GET("/inventory/replenishment", GetReplenishmentNeeds)
+	api.GET("/notifications", ListNotifications)
+	api.POST("/notifications/:id/read", MarkNotificationRead)
+}
@@ -0,0 +1,281 @@
+package api
+
+import (
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/money"
+	"oms-services/services"
+	"oms-services/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request DTOs
+type ShippingMethodRequest struct {
+	Name          string                    `json:"name" binding:"required"`
+	Type          models.ShippingRateType   `json:"type" binding:"required,oneof=flat_rate weight_based free_over_threshold"`
+	Currency      string                    `json:"currency" binding:"required,len=3"`
+	RateMinor     int                       `json:"rate_minor" binding:"min=0"`
+	FreeOverMinor *int                      `json:"free_over_minor" binding:"omitempty,min=0"`
+	Countries     []string                  `json:"countries" binding:"dive,len=2"`
+	IsActive      *bool                     `json:"is_active"`
+	Tiers         []ShippingRateTierRequest `json:"tiers" binding:"dive"`
+}
+
+func ShippingMethodRequestToModel(s *ShippingMethodRequest) models.ShippingMethod {
+	method := models.ShippingMethod{
+		Name:      s.Name,
+		Type:      s.Type,
+		Currency:  s.Currency,
+		Rate:      money.New(int64(s.RateMinor), s.Currency),
+		Countries: models.StringList{},
+		IsActive:  true,
+	}
+	if s.FreeOverMinor != nil {
+		freeOver := money.New(int64(*s.FreeOverMinor), s.Currency)
+		method.FreeOver = &freeOver
+	}
+	for _, country := range s.Countries {
+		method.Countries = append(method.Countries, strings.ToUpper(country))
+	}
+	for i := range s.Tiers {
+		tier := ShippingRateTierRequestToModel(&s.Tiers[i])
+		tier.Rate = tier.Rate.WithCurrency(s.Currency)
+		method.Tiers = append(method.Tiers, tier)
+	}
+	if s.IsActive != nil {
+		method.IsActive = *s.IsActive
+	}
+	return method
+}
+
+// ShippingMethodUpdateRequest only carries the fields to change, tiers are managed
+// through their own routes
+type ShippingMethodUpdateRequest struct {
+	Name          *string                  `json:"name" binding:"omitempty,min=1"`
+	Type          *models.ShippingRateType `json:"type" binding:"omitempty,oneof=flat_rate weight_based free_over_threshold"`
+	Currency      *string                  `json:"currency" binding:"omitempty,len=3"`
+	RateMinor     *int                     `json:"rate_minor" binding:"omitempty,min=0"`
+	FreeOverMinor utils.Nullable[int]      `json:"free_over_minor"`
+	Countries     *[]string                `json:"countries"`
+	IsActive      *bool                    `json:"is_active"`
+}
+
+type ShippingRateTierRequest struct {
+	MinWeightGrams int  `json:"min_weight_grams" binding:"min=0"`
+	MaxWeightGrams *int `json:"max_weight_grams" binding:"omitempty,min=0"`
+	RateMinor      int  `json:"rate_minor" binding:"min=0"`
+}
+
+func ShippingRateTierRequestToModel(t *ShippingRateTierRequest) models.ShippingRateTier {
+	return models.ShippingRateTier{
+		MinWeightGrams: t.MinWeightGrams,
+		MaxWeightGrams: t.MaxWeightGrams,
+		Rate:           money.New(int64(t.RateMinor), ""), // Currency of the method
+	}
+}
+
+type ShippingQuoteRequest struct {
+	Country string  `json:"country" binding:"required,len=2"`
+	Region  *string `json:"region"`
+}
+
+type SelectShippingMethodRequest struct {
+	ShippingMethodID uuid.UUID `json:"shipping_method_id" binding:"required"`
+}
+
+// AddShippingRateTier adds a weight bracket to a shipping method
+func AddShippingRateTier(c *gin.Context) {
+	methodID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipping method ID"})
+		return
+	}
+
+	var input ShippingRateTierRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var method models.ShippingMethod
+	if err := config.DB.First(&method, methodID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipping method not found"})
+		return
+	}
+
+	tier := ShippingRateTierRequestToModel(&input)
+	tier.ShippingMethodID = method.ID
+	tier.Rate = tier.Rate.WithCurrency(method.Currency)
+	if err := config.DB.Create(&tier).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create tier"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tier)
+}
+
+// DeleteShippingRateTier removes a weight bracket from a shipping method
+func DeleteShippingRateTier(c *gin.Context) {
+	methodID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipping method ID"})
+		return
+	}
+	tierID, err := uuid.Parse(c.Param("tier_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tier ID"})
+		return
+	}
+
+	result := config.DB.Where("id = ? AND shipping_method_id = ?", tierID, methodID).Delete(&models.ShippingRateTier{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete tier"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Object not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Object deleted"})
+}
+
+// QuoteShipping lists the shipping methods available for a draft order with their rate.
+// The destination can be given in the body, the order's shipping address is used otherwise.
+func QuoteShipping(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var destination *models.AddressSnapshot
+	if c.Request.ContentLength > 0 {
+		var input ShippingQuoteRequest
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		destination = &models.AddressSnapshot{Country: strings.ToUpper(input.Country), Region: input.Region}
+	}
+
+	quotes, err := services.QuoteShipping(config.DB, orderID, destination)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": quotes})
+}
+
+// UpdateShippingMethod applies a partial update to a shipping method
+func UpdateShippingMethod(c *gin.Context) {
+	methodID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipping method ID"})
+		return
+	}
+
+	var input ShippingMethodUpdateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.FreeOverMinor.Value != nil && *input.FreeOverMinor.Value < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "free_over_minor must be positive"})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.Name != nil {
+		updates["name"] = *input.Name
+	}
+	if input.Type != nil {
+		updates["type"] = *input.Type
+	}
+	if input.Currency != nil {
+		updates["currency"] = strings.ToUpper(*input.Currency)
+	}
+	if input.RateMinor != nil {
+		updates["rate_minor"] = *input.RateMinor
+	}
+	input.FreeOverMinor.Put(updates, "free_over_minor")
+	if input.Countries != nil {
+		countries := models.StringList{}
+		for _, country := range *input.Countries {
+			if len(country) != 2 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "countries must be ISO-3166 alpha-2 codes"})
+				return
+			}
+			countries = append(countries, strings.ToUpper(country))
+		}
+		updates["countries"] = countries
+	}
+	if input.IsActive != nil {
+		updates["is_active"] = *input.IsActive
+	}
+
+	method, err := services.UpdateShippingMethod(config.DB, methodID, updates)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, method)
+}
+
+// SelectShippingMethod sets the shipping method of a draft order
+func SelectShippingMethod(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var input SelectShippingMethodRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := services.SelectShippingMethod(config.DB, orderID, input.ShippingMethodID)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// RegisterShippingRoutes registers all shipping routes
+func RegisterShippingRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	shippingMethodViewSet := utils.ViewSet[models.ShippingMethod, ShippingMethodRequest, ShippingMethodRequest]{
+		DB: config.DB,
+		PerformCreateFunc: func(c *gin.Context, obj *models.ShippingMethod) error {
+			return nil
+		},
+		InputOfCreateToModel: ShippingMethodRequestToModel,
+		SearchFields:         []string{"name"},
+		Preloads:             []string{"Tiers"},
+		CreateZeroValues:     true,
+	}
+
+	// Shipping method routes
+	api.GET("/shipping-methods", shippingMethodViewSet.List)
+	api.POST("/shipping-methods", shippingMethodViewSet.Create)
+	api.GET("/shipping-methods/:id", shippingMethodViewSet.Retrieve)
+	api.PATCH("/shipping-methods/:id", UpdateShippingMethod)
+	api.DELETE("/shipping-methods/:id", shippingMethodViewSet.Delete)
+	api.POST("/shipping-methods/:id/tiers", AddShippingRateTier)
+	api.DELETE("/shipping-methods/:id/tiers/:tier_id", DeleteShippingRateTier)
+
+	// Order shipping routes
+	api.POST("/orders/:id/shipping/quote", QuoteShipping)
+	api.PUT("/orders/:id/shipping-method", SelectShippingMethod)
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"oms-services/config"
+	"oms-services/models"
+	"oms-services/services"
+	"oms-services/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Request DTOs
+type TaxRateRequest struct {
+	Name            string  `json:"name" binding:"required"`
+	Country         string  `json:"country" binding:"required,len=2"`
+	Region          *string `json:"region"`
+	TaxClass        string  `json:"tax_class"`
+	RateBasisPoints int     `json:"rate_basis_points" binding:"min=0"`
+	IsInclusive     bool    `json:"is_inclusive"`
+	IsActive        *bool   `json:"is_active"`
+}
+
+func TaxRateRequestToModel(t *TaxRateRequest) models.TaxRate {
+	rate := models.TaxRate{
+		Name:            t.Name,
+		Country:         strings.ToUpper(t.Country),
+		Region:          t.Region,
+		TaxClass:        t.TaxClass,
+		RateBasisPoints: t.RateBasisPoints,
+		IsInclusive:     t.IsInclusive,
+		IsActive:        true,
+	}
+	if rate.TaxClass == "" {
+		rate.TaxClass = "standard"
+	}
+	if t.IsActive != nil {
+		rate.IsActive = *t.IsActive
+	}
+	return rate
+}
+
+// TaxRateUpdateRequest edits a tax rate. Fields left out are kept, a null region
+// applies the rate to the whole country.
+type TaxRateUpdateRequest struct {
+	Name            *string                `json:"name" binding:"omitempty,min=1"`
+	Country         *string                `json:"country" binding:"omitempty,len=2"`
+	Region          utils.Nullable[string] `json:"region"`
+	TaxClass        *string                `json:"tax_class" binding:"omitempty,min=1"`
+	RateBasisPoints *int                   `json:"rate_basis_points" binding:"omitempty,min=0"`
+	IsInclusive     *bool                  `json:"is_inclusive"`
+	IsActive        *bool                  `json:"is_active"`
+}
+
+// UpdateTaxRate edits a tax rate, including switching it off
+func UpdateTaxRate(c *gin.Context) {
+	rateID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tax rate ID"})
+		return
+	}
+
+	var input TaxRateUpdateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if input.Name != nil {
+		updates["name"] = *input.Name
+	}
+	if input.Country != nil {
+		updates["country"] = strings.ToUpper(*input.Country)
+	}
+	input.Region.Put(updates, "region")
+	if input.TaxClass != nil {
+		updates["tax_class"] = *input.TaxClass
+	}
+	if input.RateBasisPoints != nil {
+		updates["rate_basis_points"] = *input.RateBasisPoints
+	}
+	if input.IsInclusive != nil {
+		updates["is_inclusive"] = *input.IsInclusive
+	}
+	if input.IsActive != nil {
+		updates["is_active"] = *input.IsActive
+	}
+
+	rate, err := services.UpdateTaxRate(config.DB, rateID, updates)
+	if err != nil {
+		respondError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rate)
+}
+
+// RegisterTaxRoutes registers all tax rate routes
+func RegisterTaxRoutes() {
+	api := config.Server.Group("/api/v1")
+
+	taxRateViewSet := utils.ViewSet[models.TaxRate, TaxRateRequest, TaxRateRequest]{
+		DB: config.DB,
+		PerformCreateFunc: func(c *gin.Context, obj *models.TaxRate) error {
+			return nil
+		},
+		InputOfCreateToModel: TaxRateRequestToModel,
+		SearchFields:         []string{"name", "country", "tax_class"},
+		CreateZeroValues:     true,
+	}
+
+	// Tax rate routes
+	api.GET("/tax-rates", taxRateViewSet.List)
+	api.POST("/tax-rates", taxRateViewSet.Create)
+	api.GET("/tax-rates/:id", taxRateViewSet.Retrieve)
+	api.PATCH("/tax-rates/:id", UpdateTaxRate)
+	api.DELETE("/tax-rates/:id", taxRateViewSet.Delete)
+}
@@ -0,0 +1,166 @@
+package carriers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"oms-services/money"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownCarrier   = errors.New("unknown carrier")
+	ErrUnknownService   = errors.New("carrier doesn't offer this service")
+	ErrTrackingNotFound = errors.New("tracking number not found")
+	ErrLabelVoided      = errors.New("label was voided")
+	ErrLabelInUse       = errors.New("label can't be voided once the parcel was handed over")
+	ErrInvalidWebhook   = errors.New("invalid webhook payload")
+)
+
+// Status is where a parcel stands, as carriers report it
+type Status string
+
+const (
+	StatusPreTransit     Status = "pre_transit" // Label created, parcel not handed over yet
+	StatusInTransit      Status = "in_transit"
+	StatusOutForDelivery Status = "out_for_delivery"
+	StatusDelivered      Status = "delivered"
+	StatusFailure        Status = "failure" // Undeliverable, returned to sender or lost
+)
+
+// Valid tells whether the status is one of the statuses above
+func (s Status) Valid() bool {
+	switch s {
+	case StatusPreTransit, StatusInTransit, StatusOutForDelivery, StatusDelivered, StatusFailure:
+		return true
+	}
+	return false
+}
+
+// Carrier quotes, labels and tracks parcels with a shipping company
+type Carrier interface {
+	// Code names the carrier in the registry and on shipments
+	Code() string
+	Rates(ctx context.Context, request RateRequest) ([]Rate, error)
+	CreateLabel(ctx context.Context, request LabelRequest) (*Label, error)
+	VoidLabel(ctx context.Context, trackingNumber string) error
+	Track(ctx context.Context, trackingNumber string) (*Tracking, error)
+}
+
+// WebhookReceiver is a carrier pushing tracking updates instead of, or on top of, being
+// polled
+type WebhookReceiver interface {
+	// ParseWebhook checks a webhook delivery came from the carrier and decodes the
+	// tracking updates it carries
+	ParseWebhook(header http.Header, body []byte) ([]Tracking, error)
+}
+
+// Address is a parcel origin or destination
+type Address struct {
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	Region     string `json:"region,omitempty"`
+	PostalCode string `json:"postal_code,omitempty"`
+	Country    string `json:"country"` // ISO-3166 alpha-2
+	Phone      string `json:"phone,omitempty"`
+}
+
+// RateRequest asks the price of shipping a parcel, in a currency
+type RateRequest struct {
+	From        Address
+	To          Address
+	WeightGrams int
+	Currency    string
+}
+
+// Rate is the price of a carrier service
+type Rate struct {
+	Service       string      `json:"service"`
+	Amount        money.Money `json:"amount"`
+	EstimatedDays int         `json:"estimated_days"`
+}
+
+// LabelRequest buys the label of a parcel. Reference identifies the parcel on our side,
+// e.g. the shipment ID, and is printed on the label.
+type LabelRequest struct {
+	Reference   string
+	Service     string // The carrier default service when empty
+	From        Address
+	To          Address
+	WeightGrams int
+	Currency    string // Currency of the label cost
+}
+
+// Label is a bought shipping label
+type Label struct {
+	TrackingNumber string
+	Service        string
+	Cost           money.Money
+	PDF            []byte
+}
+
+// Tracking is the journey of a parcel so far, oldest event first
+type Tracking struct {
+	TrackingNumber string          `json:"tracking_number"`
+	Status         Status          `json:"status"`
+	Events         []TrackingEvent `json:"events"`
+}
+
+// TrackingEvent is a checkpoint of a parcel. Code is the carrier own event code,
+// Status its meaning.
+type TrackingEvent struct {
+	Code        string    `json:"code"`
+	Status      Status    `json:"status"`
+	Description string    `json:"description"`
+	Location    string    `json:"location"`
+	OccurredAt  time.Time `json:"occurred_at"`
+}
+
+// Registry holds the carriers shipments can be sent with, by code
+type Registry struct {
+	mu       sync.RWMutex
+	carriers map[string]Carrier
+}
+
+// NewRegistry returns a registry of the carriers
+func NewRegistry(carriers ...Carrier) *Registry {
+	registry := &Registry{carriers: map[string]Carrier{}}
+	for _, carrier := range carriers {
+		registry.Register(carrier)
+	}
+	return registry
+}
+
+// Register adds a carrier, replacing any carrier registered under the same code
+func (r *Registry) Register(carrier Carrier) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.carriers[carrier.Code()] = carrier
+}
+
+// Get returns the carrier registered under a code
+func (r *Registry) Get(code string) (Carrier, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	carrier, ok := r.carriers[code]
+	if !ok {
+		return nil, ErrUnknownCarrier
+	}
+	return carrier, nil
+}
+
+// Codes lists the registered carriers, sorted
+func (r *Registry) Codes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	codes := make([]string, 0, len(r.carriers))
+	for code := range r.carriers {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	return codes
+}
@@ -0,0 +1,220 @@
+package carriers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"oms-services/documents"
+	"oms-services/money"
+	"strings"
+	"sync"
+	"time"
+)
+
+// localServices are the services of the local carrier, priced per started kilogram
+var localServices = []struct {
+	Name          string
+	Base, PerKilo int64 // Major units
+	EstimatedDays int
+}{
+	{Name: "standard", Base: 5, PerKilo: 1, EstimatedDays: 3},
+	{Name: "express", Base: 12, PerKilo: 2, EstimatedDays: 1},
+}
+
+// Local is a fake carrier for development and tests, answering without any network call.
+// Tracking numbers derive from the label reference, so the same shipment always gets the
+// same one, and parcels move along on a fixed schedule from the label creation: picked up
+// after TransitAfter, delivered after DeliverAfter. Parcels to an address line holding
+// "UNDELIVERABLE" fail instead. Labels live in memory and are forgotten on restart.
+type Local struct {
+	TransitAfter time.Duration
+	DeliverAfter time.Duration
+	Now          func() time.Time
+
+	mu     sync.Mutex
+	labels map[string]*localLabel
+}
+
+type localLabel struct {
+	createdAt     time.Time
+	from          string
+	to            string
+	undeliverable bool
+	voided        bool
+}
+
+// NewLocal returns a local carrier delivering parcels a day after their label is created
+func NewLocal() *Local {
+	return &Local{
+		TransitAfter: time.Hour,
+		DeliverAfter: 24 * time.Hour,
+		Now:          time.Now,
+		labels:       map[string]*localLabel{},
+	}
+}
+
+func (l *Local) Code() string {
+	return "local"
+}
+
+// Rates prices every service of the carrier
+func (l *Local) Rates(ctx context.Context, request RateRequest) ([]Rate, error) {
+	exponent, err := money.Exponent(request.Currency)
+	if err != nil {
+		return nil, err
+	}
+	unit := int64(1)
+	for range exponent {
+		unit *= 10
+	}
+	kilos := int64((max(request.WeightGrams, 0) + 999) / 1000)
+
+	rates := make([]Rate, len(localServices))
+	for i, service := range localServices {
+		rates[i] = Rate{
+			Service:       service.Name,
+			Amount:        money.New((service.Base+service.PerKilo*kilos)*unit, strings.ToUpper(request.Currency)),
+			EstimatedDays: service.EstimatedDays,
+		}
+	}
+	return rates, nil
+}
+
+// CreateLabel returns a label PDF with a tracking number derived from the reference.
+// Creating the label of a reference again returns the same tracking number.
+func (l *Local) CreateLabel(ctx context.Context, request LabelRequest) (*Label, error) {
+	if request.Service == "" {
+		request.Service = localServices[0].Name
+	}
+	rates, err := l.Rates(ctx, RateRequest{From: request.From, To: request.To, WeightGrams: request.WeightGrams, Currency: request.Currency})
+	if err != nil {
+		return nil, err
+	}
+	var cost *money.Money
+	for _, rate := range rates {
+		if rate.Service == request.Service {
+			cost = &rate.Amount
+		}
+	}
+	if cost == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownService, request.Service)
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(request.Reference))
+	trackingNumber := fmt.Sprintf("LC%010d", hash.Sum64()%10_000_000_000)
+	now := l.Now()
+
+	pdf, _, err := documents.Render("shipping_label", documents.FormatPDF, map[string]interface{}{
+		"Carrier":        l.Code(),
+		"Service":        request.Service,
+		"TrackingNumber": trackingNumber,
+		"Reference":      request.Reference,
+		"From":           request.From,
+		"To":             request.To,
+		"WeightGrams":    request.WeightGrams,
+		"CreatedAt":      now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.labels[trackingNumber] = &localLabel{
+		createdAt:     now,
+		from:          request.From.City,
+		to:            request.To.City,
+		undeliverable: strings.Contains(strings.ToUpper(request.To.Line1+" "+request.To.Line2), "UNDELIVERABLE"),
+	}
+	return &Label{TrackingNumber: trackingNumber, Service: request.Service, Cost: *cost, PDF: pdf}, nil
+}
+
+// VoidLabel cancels a label until the parcel is picked up
+func (l *Local) VoidLabel(ctx context.Context, trackingNumber string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	label, ok := l.labels[trackingNumber]
+	if !ok {
+		return ErrTrackingNotFound
+	}
+	if l.Now().Sub(label.createdAt) >= l.TransitAfter {
+		return ErrLabelInUse
+	}
+	label.voided = true
+	return nil
+}
+
+// Track replays the schedule of a parcel up to now
+func (l *Local) Track(ctx context.Context, trackingNumber string) (*Tracking, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	label, ok := l.labels[trackingNumber]
+	if !ok {
+		return nil, ErrTrackingNotFound
+	}
+	if label.voided {
+		return nil, ErrLabelVoided
+	}
+
+	elapsed := l.Now().Sub(label.createdAt)
+	events := []TrackingEvent{{
+		Code:        "LABEL_CREATED",
+		Status:      StatusPreTransit,
+		Description: "Shipping label created",
+		Location:    label.from,
+		OccurredAt:  label.createdAt,
+	}}
+	if elapsed >= l.TransitAfter {
+		events = append(events, TrackingEvent{
+			Code:        "PICKED_UP",
+			Status:      StatusInTransit,
+			Description: "Parcel picked up",
+			Location:    label.from,
+			OccurredAt:  label.createdAt.Add(l.TransitAfter),
+		})
+	}
+	if elapsed >= l.DeliverAfter {
+		event := TrackingEvent{
+			Code:        "DELIVERED",
+			Status:      StatusDelivered,
+			Description: "Parcel delivered",
+			Location:    label.to,
+			OccurredAt:  label.createdAt.Add(l.DeliverAfter),
+		}
+		if label.undeliverable {
+			event.Code, event.Status, event.Description = "DELIVERY_FAILED", StatusFailure, "Address not found, parcel returned to sender"
+		}
+		events = append(events, event)
+	}
+	return &Tracking{TrackingNumber: trackingNumber, Status: events[len(events)-1].Status, Events: events}, nil
+}
+
+// ParseWebhook decodes a tracking update in the carrier-neutral Tracking JSON, which lets
+// tracking events be simulated in development. Deliveries aren't signed.
+func (l *Local) ParseWebhook(header http.Header, body []byte) ([]Tracking, error) {
+	var tracking Tracking
+	if err := json.Unmarshal(body, &tracking); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	if tracking.TrackingNumber == "" || len(tracking.Events) == 0 {
+		return nil, fmt.Errorf("%w: tracking_number and events are required", ErrInvalidWebhook)
+	}
+	if tracking.Status == "" {
+		tracking.Status = tracking.Events[len(tracking.Events)-1].Status
+	}
+	if !tracking.Status.Valid() {
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidWebhook, tracking.Status)
+	}
+	for _, event := range tracking.Events {
+		if event.Code == "" || event.OccurredAt.IsZero() {
+			return nil, fmt.Errorf("%w: events need a code and occurred_at", ErrInvalidWebhook)
+		}
+		if !event.Status.Valid() {
+			return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidWebhook, event.Status)
+		}
+	}
+	return []Tracking{tracking}, nil
+}
@@ -1,16 +1,22 @@
 package main
 
 import (
+	"context"
 	"log"
 	"oms-services/api"
 	"oms-services/config"
 	"oms-services/models"
+	"oms-services/services"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
 	db := config.ConnectDatabase()
+	config.ConnectStorage()
+	config.ConnectCarriers()
+	config.ConnectMailer()
 
 	// Auto migrate all models
 	err := models.AutoMigrate(db)
@@ -24,10 +30,63 @@ func main() {
 		log.Fatal("Index creation failed:", err)
 	}
 
+	// Create triggers
+	err = models.CreateTriggers(db)
+	if err != nil {
+		log.Fatal("Trigger creation failed:", err)
+	}
+
+	// Record the stock levels that predate the stock ledger
+	opened, err := services.OpenStockLedger(db)
+	if err != nil {
+		log.Fatal("Stock ledger opening failed:", err)
+	}
+	if opened > 0 {
+		log.Printf("stock ledger: opening balance recorded for %d inventories", opened)
+	}
+
+	services.ReportingCurrency = config.ReportingCurrency()
+	services.FulfillmentRouting, err = services.ParseRoutingStrategy(config.FulfillmentRouting())
+	if err != nil {
+		log.Fatal("Invalid FULFILLMENT_ROUTING:", err)
+	}
+	if carrier := config.DefaultCarrier(); carrier != "" {
+		if _, err := config.Carriers.Get(carrier); err != nil {
+			log.Fatal("Invalid DEFAULT_CARRIER:", err)
+		}
+	}
+
+	// Start and end the scheduled sales in the background
+	go services.RunPriceScheduler(context.Background(), db, time.Minute)
+
+	// Notify the variants running low on stock in the background
+	go services.RunStockAlertChecker(context.Background(), db, time.Minute)
+
+	// Follow the shipments with their carrier in the background
+	go services.RunTrackingPoller(context.Background(), db, config.Carriers, time.Minute)
+
 	// Register API routes
 	api.RegisterHealthRoutes()
 	api.RegisterCatalogRoutes()
+	api.RegisterCategoryRoutes()
+	api.RegisterOptionRoutes()
+	api.RegisterMediaRoutes()
+	api.RegisterBundleRoutes()
+	api.RegisterInventoryRoutes()
+	api.RegisterLocationRoutes()
+	api.RegisterBackorderRoutes()
+	api.RegisterReplenishmentRoutes()
+	api.RegisterPurchasingRoutes()
+	api.RegisterCycleCountRoutes()
+	api.RegisterPriceRoutes()
 	api.RegisterOrderRoutes()
+	api.RegisterFulfillmentRoutes()
+	api.RegisterCarrierRoutes()
+	api.RegisterCustomerRoutes()
+	api.RegisterCouponRoutes()
+	api.RegisterTaxRoutes()
+	api.RegisterShippingRoutes()
+	api.RegisterExchangeRateRoutes()
 
 	// Start the Gin server
 	gin.SetMode(gin.DebugMode)
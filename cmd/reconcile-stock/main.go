@@ -0,0 +1,48 @@
+// Command reconcile-stock replays the stock ledger and reports the variants whose
+// inventory drifted from it. With -fix the inventory rows are rewritten from the
+// ledger. It exits with status 1 when drift is left unrepaired.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"oms-services/config"
+	"oms-services/services"
+	"os"
+)
+
+func main() {
+	fix := flag.Bool("fix", false, "rewrite the drifted inventory rows from the ledger")
+	flag.Parse()
+
+	db := config.ConnectDatabase()
+
+	drifts, err := services.DetectStockDrift(db)
+	if err != nil {
+		log.Fatal("Stock drift detection failed:", err)
+	}
+	if len(drifts) == 0 {
+		fmt.Println("stock ledger and inventory agree")
+		return
+	}
+
+	for _, drift := range drifts {
+		fmt.Printf("%s at %s: on hand %d, ledger %d; reserved %d, ledger %d\n",
+			drift.SKU, drift.LocationCode,
+			drift.QtyOnHand, drift.LedgerQtyOnHand,
+			drift.QtyReserved, drift.LedgerQtyReserved,
+		)
+	}
+	if !*fix {
+		fmt.Printf("%d inventories drifted, run with -fix to repair them\n", len(drifts))
+		os.Exit(1)
+	}
+
+	for _, drift := range drifts {
+		if err := services.RepairStockDrift(db, drift.VariantID, drift.LocationID); err != nil {
+			log.Fatalf("Repairing %s at %s failed: %v", drift.SKU, drift.LocationCode, err)
+		}
+	}
+	fmt.Printf("%d inventories repaired\n", len(drifts))
+}
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"oms-services/carriers"
+	"os"
+)
+
+var Carriers *carriers.Registry
+
+// DefaultCarrier is the carrier labels are bought from when a request names none, set
+// with DEFAULT_CARRIER. It is local in development and empty otherwise.
+func DefaultCarrier() string {
+	if carrier := os.Getenv("DEFAULT_CARRIER"); carrier != "" {
+		return carrier
+	}
+	if DevMode() {
+		return "local"
+	}
+	return ""
+}
+
+// ConnectCarriers registers the carriers shipments can be sent with. The local carrier
+// fakes labels and accepts unsigned webhooks, it is only registered in development.
+func ConnectCarriers() *carriers.Registry {
+	Carriers = carriers.NewRegistry()
+	if DevMode() {
+		Carriers.Register(carriers.NewLocal())
+	}
+	return Carriers
+}
@@ -0,0 +1,15 @@
+package config
+
+import (
+	"os"
+	"strings"
+)
+
+// ReportingCurrency is the currency finance reports are expressed in, EGP unless
+// REPORTING_CURRENCY is set
+func ReportingCurrency() string {
+	if currency := os.Getenv("REPORTING_CURRENCY"); currency != "" {
+		return strings.ToUpper(currency)
+	}
+	return "EGP"
+}
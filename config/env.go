@@ -0,0 +1,13 @@
+package config
+
+import "os"
+
+// DevMode reports whether APP_ENV is development or test. Fakes that must never run in
+// production, like the local carrier or the logging mailer, are only enabled then.
+func DevMode() bool {
+	switch os.Getenv("APP_ENV") {
+	case "development", "test":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,12 @@
+package config
+
+import "os"
+
+// FulfillmentRouting is the strategy picking the locations orders ship from:
+// closest, single_location or split. single_location unless FULFILLMENT_ROUTING is set.
+func FulfillmentRouting() string {
+	if routing := os.Getenv("FULFILLMENT_ROUTING"); routing != "" {
+		return routing
+	}
+	return "single_location"
+}
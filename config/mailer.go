@@ -0,0 +1,23 @@
+package config
+
+import (
+	"oms-services/mailer"
+	"os"
+)
+
+var Mailer mailer.Mailer
+
+// ConnectMailer sends emails through the SMTP relay at SMTP_ADDR, from MAIL_FROM and
+// authenticated with SMTP_USERNAME/SMTP_PASSWORD when set. Without a relay emails are
+// logged in dev mode and refused otherwise.
+func ConnectMailer() mailer.Mailer {
+	switch {
+	case os.Getenv("SMTP_ADDR") != "":
+		Mailer = mailer.NewSMTP(os.Getenv("SMTP_ADDR"), os.Getenv("MAIL_FROM"), os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"))
+	case DevMode():
+		Mailer = mailer.Log{}
+	default:
+		Mailer = mailer.Disabled{}
+	}
+	return Mailer
+}
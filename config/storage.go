@@ -0,0 +1,34 @@
+package config
+
+import (
+	"oms-services/storage"
+	"oms-services/utils"
+	"os"
+)
+
+var Storage storage.Storage
+
+// MediaDir is where uploaded media is kept, ./media unless MEDIA_DIR is set
+func MediaDir() string {
+	if dir := os.Getenv("MEDIA_DIR"); dir != "" {
+		return dir
+	}
+	return "./media"
+}
+
+// MediaBaseURL is the URL prefix media is served under, /media unless MEDIA_BASE_URL is set
+func MediaBaseURL() string {
+	if url := os.Getenv("MEDIA_BASE_URL"); url != "" {
+		return url
+	}
+	return "/media"
+}
+
+// ConnectStorage opens the media storage on the local filesystem
+func ConnectStorage() storage.Storage {
+	local, err := storage.NewLocal(MediaDir(), MediaBaseURL())
+	utils.FailOnError(err, "Cannot open media storage")
+
+	Storage = local
+	return Storage
+}
@@ -0,0 +1,70 @@
+package documents
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	htmltemplate "html/template"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var ErrUnknownFormat = errors.New("unknown document format")
+
+// Formats documents render to
+const (
+	FormatHTML = "html"
+	FormatPDF  = "pdf"
+)
+
+//go:embed templates
+var templateFiles embed.FS
+
+// Each document has an HTML template, templates/<name>.html, and a plain text one laid
+// out on the PDF pages, templates/<name>.txt
+var (
+	htmlTemplates = htmltemplate.Must(htmltemplate.New("").Funcs(templateFuncs).ParseFS(templateFiles, "templates/*.html"))
+	textTemplates = texttemplate.Must(texttemplate.New("").Funcs(templateFuncs).ParseFS(templateFiles, "templates/*.txt"))
+)
+
+var templateFuncs = map[string]interface{}{
+	// value prints an optional text, or a dash when missing
+	"value": func(s *string) string {
+		if s == nil || *s == "" {
+			return "-"
+		}
+		return *s
+	},
+	"datetime": func(t time.Time) string { return t.UTC().Format("2006-01-02 15:04 UTC") },
+	// ref shortens an ID to the reference staff read out, its first 8 characters
+	"ref": func(id uuid.UUID) string { return strings.ToUpper(id.String()[:8]) },
+	// cell pads or cuts a text to a column width of the plain text layouts
+	"cell": func(width int, s string) string {
+		runes := []rune(s)
+		if len(runes) > width {
+			return string(runes[:width-1]) + "~"
+		}
+		return s + strings.Repeat(" ", width-len(runes))
+	},
+}
+
+// Render renders a document in a format, returning its content and content type
+func Render(name, format string, data interface{}) ([]byte, string, error) {
+	var out bytes.Buffer
+	switch format {
+	case FormatHTML:
+		if err := htmlTemplates.ExecuteTemplate(&out, name+".html", data); err != nil {
+			return nil, "", err
+		}
+		return out.Bytes(), "text/html; charset=utf-8", nil
+	case FormatPDF:
+		if err := textTemplates.ExecuteTemplate(&out, name+".txt", data); err != nil {
+			return nil, "", err
+		}
+		return textPDF(out.String()), "application/pdf", nil
+	}
+	return nil, "", ErrUnknownFormat
+}
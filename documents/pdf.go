@@ -0,0 +1,113 @@
+package documents
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Page layout of the PDFs, A4 in points with a monospaced font so text templates can
+// align columns with spaces
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	pageMargin   = 40
+	fontSize     = 9
+	lineHeight   = 12
+	linesPerPage = (pageHeight - 2*pageMargin) / lineHeight
+	lineWidth    = 94 // Courier characters fitting between the margins
+)
+
+// textPDF lays out plain text on A4 pages in Courier. Form feeds start a new page, long
+// lines wrap. The standard PDF fonts only cover Latin-1, other characters print as "?".
+func textPDF(text string) []byte {
+	var pages [][]string
+	var page []string
+	text = strings.TrimRight(strings.ReplaceAll(text, "\r\n", "\n"), "\n\f")
+	for _, block := range strings.Split(text, "\f") {
+		for _, line := range strings.Split(block, "\n") {
+			for _, wrapped := range wrapLine(line) {
+				if len(page) == linesPerPage {
+					pages = append(pages, page)
+					page = nil
+				}
+				page = append(page, wrapped)
+			}
+		}
+		pages = append(pages, page)
+		page = nil
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	// Objects 1 to 3 are the catalog, the page tree and the font, each page then takes
+	// a page object followed by its content stream
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	for i, lines := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, 5+2*i))
+
+		var content bytes.Buffer
+		fmt.Fprintf(&content, "BT /F1 %d Tf %d TL %d %d Td\n", fontSize, lineHeight, pageMargin, pageHeight-pageMargin)
+		for _, line := range lines {
+			fmt.Fprintf(&content, "(%s) '\n", escapePDFText(line))
+		}
+		content.WriteString("ET")
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// wrapLine splits a line longer than the page width
+func wrapLine(line string) []string {
+	line = strings.TrimRight(line, " \t")
+	runes := []rune(strings.ReplaceAll(line, "\t", "    "))
+	if len(runes) <= lineWidth {
+		return []string{string(runes)}
+	}
+	var lines []string
+	for len(runes) > lineWidth {
+		lines = append(lines, string(runes[:lineWidth]))
+		runes = runes[lineWidth:]
+	}
+	return append(lines, string(runes))
+}
+
+// escapePDFText encodes a line as a PDF string in Latin-1
+func escapePDFText(line string) string {
+	var out strings.Builder
+	for _, r := range line {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r < 0x20 || r == utf8.RuneError || r > 0xff:
+			out.WriteByte('?')
+		case r < 0x80:
+			out.WriteRune(r)
+		default:
+			fmt.Fprintf(&out, "\\%03o", r)
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,70 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+)
+
+var ErrNotConfigured = errors.New("no mailer is configured")
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails to customers, e.g. the tokens proving they own their address
+type Mailer interface {
+	Send(ctx context.Context, message Message) error
+}
+
+// SMTP sends emails through an SMTP relay
+type SMTP struct {
+	Addr string // host:port of the relay
+	From string
+	Auth smtp.Auth // nil when the relay needs no authentication
+}
+
+// NewSMTP returns a mailer sending from the given address through the relay, with
+// PLAIN authentication when a username is given
+func NewSMTP(addr, from, username, password string) *SMTP {
+	mailer := &SMTP{Addr: addr, From: from}
+	if username != "" {
+		host, _, _ := strings.Cut(addr, ":")
+		mailer.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return mailer
+}
+
+func (s *SMTP) Send(ctx context.Context, message Message) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if strings.ContainsAny(message.To+message.Subject, "\r\n") {
+		return fmt.Errorf("invalid email header in message to %q", message.To)
+	}
+
+	body := fmt.Sprintf("From: %s\r\nTo: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s",
+		s.From, message.To, message.Subject, message.Body)
+	return smtp.SendMail(s.Addr, s.Auth, s.From, []string{message.To}, []byte(body))
+}
+
+// Log writes emails to the log instead of sending them, for development only
+type Log struct{}
+
+func (Log) Send(ctx context.Context, message Message) error {
+	log.Printf("mailer: to %s: %s\n%s", message.To, message.Subject, message.Body)
+	return nil
+}
+
+// Disabled refuses to send, used when no mailer is configured
+type Disabled struct{}
+
+func (Disabled) Send(ctx context.Context, message Message) error {
+	return ErrNotConfigured
+}
@@ -50,6 +50,127 @@ const (
 	RefundStatusProcessed RefundStatus = "processed"
 )
 
+type CouponType string
+
+const (
+	CouponTypePercentage   CouponType = "percentage"
+	CouponTypeFixedAmount  CouponType = "fixed_amount"
+	CouponTypeFreeShipping CouponType = "free_shipping"
+)
+
+type ShippingRateType string
+
+const (
+	ShippingRateTypeFlatRate          ShippingRateType = "flat_rate"
+	ShippingRateTypeWeightBased       ShippingRateType = "weight_based"
+	ShippingRateTypeFreeOverThreshold ShippingRateType = "free_over_threshold"
+)
+
+type ScheduledPriceStatus string
+
+const (
+	ScheduledPriceStatusScheduled ScheduledPriceStatus = "scheduled"
+	ScheduledPriceStatusActive    ScheduledPriceStatus = "active"
+	ScheduledPriceStatusExpired   ScheduledPriceStatus = "expired"
+	ScheduledPriceStatusCancelled ScheduledPriceStatus = "cancelled"
+)
+
+type CollectionType string
+
+const (
+	CollectionTypeManual    CollectionType = "manual"
+	CollectionTypeRuleBased CollectionType = "rule_based"
+)
+
+type ProductType string
+
+const (
+	ProductTypeSimple ProductType = "simple"
+	ProductTypeBundle ProductType = "bundle"
+)
+
+type InventoryPolicy string
+
+const (
+	InventoryPolicyDeny      InventoryPolicy = "deny"
+	InventoryPolicyBackorder InventoryPolicy = "backorder"
+	InventoryPolicyPreorder  InventoryPolicy = "preorder"
+)
+
+type PurchaseOrderStatus string
+
+const (
+	PurchaseOrderStatusDraft             PurchaseOrderStatus = "draft"
+	PurchaseOrderStatusSent              PurchaseOrderStatus = "sent"
+	PurchaseOrderStatusPartiallyReceived PurchaseOrderStatus = "partially_received"
+	PurchaseOrderStatusReceived          PurchaseOrderStatus = "received"
+	PurchaseOrderStatusClosed            PurchaseOrderStatus = "closed"
+)
+
+type CycleCountStatus string
+
+const (
+	CycleCountStatusOpen      CycleCountStatus = "open"
+	CycleCountStatusApproved  CycleCountStatus = "approved"
+	CycleCountStatusCancelled CycleCountStatus = "cancelled"
+)
+
+// Price change reasons stored in VariantPriceHistory.Reason
+const (
+	PriceChangeCreated     = "created"
+	PriceChangeManual      = "manual"
+	PriceChangeSaleStarted = "sale_started"
+	PriceChangeSaleEnded   = "sale_ended"
+	PriceChangePriceList   = "price_list" // A price list entry was added
+)
+
+// Stock movement reasons stored in StockMovement.Reason. Receive, damage and
+// correction are the reasons of manual adjustments.
+const (
+	MovementReceive        = "receive"
+	MovementDamage         = "damage"
+	MovementCorrection     = "correction"
+	MovementReservation    = "reservation"
+	MovementRelease        = "release"
+	MovementShipment       = "shipment"
+	MovementOpeningBalance = "opening_balance"
+)
+
+// Stock movement reference types stored in StockMovement.ReferenceType
+const (
+	ReferenceOrder         = "order"
+	ReferenceAdjustment    = "adjustment"
+	ReferencePurchaseOrder = "purchase_order"
+	ReferenceCycleCount    = "cycle_count"
+)
+
+// Notification types stored in Notification.Type, also the stock alert levels stored
+// in ProductVariant.StockAlert
+const (
+	NotificationLowStock   = "low_stock"
+	NotificationOutOfStock = "out_of_stock"
+)
+
+// Order event types stored in OrderEvent.EventType
+const (
+	EventStatusChanged          = "status_changed"
+	EventItemAdded              = "item_added"
+	EventItemUpdated            = "item_updated"
+	EventItemRemoved            = "item_removed"
+	EventCouponApplied          = "coupon_applied"
+	EventCouponRemoved          = "coupon_removed"
+	EventCouponRedeemed         = "coupon_redeemed"
+	EventShippingMethodSelected = "shipping_method_selected"
+	EventCustomerLinked         = "customer_linked"
+	EventCustomerMerged         = "customer_merged"
+	EventCustomerErased         = "customer_erased"
+	EventItemBackordered        = "item_backordered"
+	EventBackorderAllocated     = "backorder_allocated"
+	EventShipmentCreated        = "shipment_created"
+	EventShipmentCancelled      = "shipment_cancelled"
+	EventShipmentStatusChanged  = "shipment_status_changed"
+)
+
 func CreateEnumSQLQuery(typeName string, fields []string) string {
 	query := fmt.Sprintf(`
 		DO $$ BEGIN
@@ -64,6 +185,15 @@ func CreateEnums(db *gorm.DB) error {
 	orderStatusFields := []string{"draft", "pending_payment", "paid", "fulfillment_in_progress", "shipped", "completed", "cancelled"}
 	paymentStatusFields := []string{"pending", "authorized", "captured", "failed", "refunded", "partial_refunded"}
 	refundStatusFields := []string{"pending", "approved", "rejected", "processed"}
+	shipmentStatusFields := []string{"pending", "packed", "in_transit", "delivered", "failed"}
+	couponTypeFields := []string{"percentage", "fixed_amount", "free_shipping"}
+	shippingRateTypeFields := []string{"flat_rate", "weight_based", "free_over_threshold"}
+	scheduledPriceStatusFields := []string{"scheduled", "active", "expired", "cancelled"}
+	collectionTypeFields := []string{"manual", "rule_based"}
+	productTypeFields := []string{"simple", "bundle"}
+	inventoryPolicyFields := []string{"deny", "backorder", "preorder"}
+	purchaseOrderStatusFields := []string{"draft", "sent", "partially_received", "received", "closed"}
+	cycleCountStatusFields := []string{"open", "approved", "cancelled"}
 
 	// Create custom types
 	if err := db.Exec(CreateEnumSQLQuery("order_status", orderStatusFields)).Error; err != nil {
@@ -78,5 +208,41 @@ func CreateEnums(db *gorm.DB) error {
 		return err
 	}
 
+	if err := db.Exec(CreateEnumSQLQuery("shipment_status", shipmentStatusFields)).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec(CreateEnumSQLQuery("coupon_type", couponTypeFields)).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec(CreateEnumSQLQuery("shipping_rate_type", shippingRateTypeFields)).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec(CreateEnumSQLQuery("scheduled_price_status", scheduledPriceStatusFields)).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec(CreateEnumSQLQuery("collection_type", collectionTypeFields)).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec(CreateEnumSQLQuery("product_type", productTypeFields)).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec(CreateEnumSQLQuery("inventory_policy", inventoryPolicyFields)).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec(CreateEnumSQLQuery("purchase_order_status", purchaseOrderStatusFields)).Error; err != nil {
+		return err
+	}
+
+	if err := db.Exec(CreateEnumSQLQuery("cycle_count_status", cycleCountStatusFields)).Error; err != nil {
+		return err
+	}
+
 	return nil
 }
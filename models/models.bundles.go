@@ -0,0 +1,69 @@
+package models
+
+import (
+	"oms-services/money"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// BundleComponent is a variant contained in a variant of a bundle product, e.g. the
+// mug and the tea box of a gift box. Bundles are sold from their components stock.
+type BundleComponent struct {
+	ID                 uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	BundleVariantID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_bundle_components_pair" json:"bundle_variant_id"`
+	ComponentVariantID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_bundle_components_pair" json:"component_variant_id"`
+	Quantity           int       `gorm:"not null;check:quantity > 0" json:"quantity" validate:"min=1"` // Units per bundle
+	CreatedAt          time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt          time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+
+	// Relationships
+	ComponentVariant *ProductVariant `gorm:"foreignKey:ComponentVariantID;constraint:OnDelete:RESTRICT" json:"component_variant,omitempty"`
+}
+
+// OrderItemComponent freezes, at checkout, the components of a bundle order item with
+// the share of the item revenue allocated to each of them
+type OrderItemComponent struct {
+	ID          uuid.UUID   `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	OrderItemID uuid.UUID   `gorm:"type:uuid;not null" json:"order_item_id"`
+	VariantID   uuid.UUID   `gorm:"type:uuid;not null" json:"variant_id"`
+	Quantity    int         `gorm:"not null;check:quantity > 0" json:"quantity"` // Units for the whole item quantity
+	Currency    string      `gorm:"type:char(3);not null" json:"currency"`
+	Revenue     money.Money `gorm:"column:revenue_minor;type:bigint;not null;check:revenue_minor >= 0" json:"revenue"` // Share of the item line total
+	// Cost of all the units, frozen at checkout for margin reporting, nil when unknown
+	Cost      *money.Money `gorm:"column:cost_minor;type:bigint;check:cost_minor >= 0" json:"cost"`
+	CreatedAt time.Time    `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+
+	// Relationships
+	Variant *ProductVariant `gorm:"foreignKey:VariantID;constraint:OnDelete:RESTRICT" json:"-"`
+}
+
+func (bc *BundleComponent) BeforeCreate(tx *gorm.DB) error {
+	if bc.ID == uuid.Nil {
+		bc.ID = uuid.New()
+	}
+	return nil
+}
+
+func (bc *BundleComponent) BeforeUpdate(tx *gorm.DB) error {
+	bc.UpdatedAt = time.Now()
+	return nil
+}
+
+func (oc *OrderItemComponent) BeforeCreate(tx *gorm.DB) error {
+	if oc.ID == uuid.Nil {
+		oc.ID = uuid.New()
+	}
+	return nil
+}
+
+// AfterFind stamps the component currency on its revenue and cost
+func (oc *OrderItemComponent) AfterFind(tx *gorm.DB) error {
+	oc.Revenue = oc.Revenue.WithCurrency(oc.Currency)
+	if oc.Cost != nil {
+		cost := oc.Cost.WithCurrency(oc.Currency)
+		oc.Cost = &cost
+	}
+	return nil
+}
@@ -1,6 +1,11 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"oms-services/money"
+	"slices"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,39 +14,86 @@ import (
 
 // Product represents a product in the system
 type Product struct {
-	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	Title       string    `gorm:"type:text;not null" json:"title" validate:"required"`
-	Description *string   `gorm:"type:text" json:"description"`
-	IsActive    bool      `gorm:"not null;default:true" json:"is_active"`
-	CreatedAt   time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
-	UpdatedAt   time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+	ID          uuid.UUID   `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Title       string      `gorm:"type:text;not null" json:"title" validate:"required"`
+	Description *string     `gorm:"type:text" json:"description"`
+	TaxClass    string      `gorm:"type:text;not null;default:'standard'" json:"tax_class"`
+	Type        ProductType `gorm:"type:product_type;not null;default:'simple'" json:"type"` // Variants of bundles are made of other variants
+	IsActive    bool        `gorm:"not null;default:true" json:"is_active"`
+	CreatedAt   time.Time   `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt   time.Time   `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
 
 	// Relationships
-	Variants []ProductVariant `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"variants,omitempty"`
+	Variants   []ProductVariant `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"variants,omitempty"`
+	Categories []Category       `gorm:"many2many:product_categories;constraint:OnDelete:CASCADE" json:"categories,omitempty"`
+	Options    []ProductOption  `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"options,omitempty"`
+	Media      []ProductMedia   `gorm:"foreignKey:ProductID;constraint:OnDelete:CASCADE" json:"media,omitempty"`
 }
 
+// ProductOption is an option axis of a product (e.g. color or size) with the values its
+// variants may take. Once a product declares options, each variant must set exactly
+// one allowed value per option in its attributes.
+type ProductOption struct {
+	ID        uuid.UUID    `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ProductID uuid.UUID    `gorm:"type:uuid;not null;uniqueIndex:idx_product_options_name" json:"product_id"`
+	Name      string       `gorm:"type:text;not null;uniqueIndex:idx_product_options_name" json:"name" validate:"required"`
+	Values    OptionValues `gorm:"type:jsonb;not null;default:'[]'" json:"values"`
+	Position  int          `gorm:"not null;default:0" json:"position"`
+	CreatedAt time.Time    `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt time.Time    `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+}
+
+// OptionValues are the allowed values of a product option stored as a jsonb array
+type OptionValues []string
+
+// VariantAttributes maps option names to the variant's value, e.g. {"color":"red","size":"M"}
+type VariantAttributes map[string]string
+
 // ProductVariant represents a specific variant of a product
 type ProductVariant struct {
-	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	ProductID  uuid.UUID `gorm:"type:uuid;not null" json:"product_id"`
-	SKU        string    `gorm:"type:text;uniqueIndex;not null" json:"sku" validate:"required"`
-	Attributes *string   `gorm:"type:jsonb" json:"attributes"` // JSON for color, size, etc.
-	PriceMinor int       `gorm:"not null;check:price_minor >= 0" json:"price_minor" validate:"min=0"`
-	Currency   string    `gorm:"type:char(3);not null" json:"currency" validate:"required,len=3"`
-	IsActive   bool      `gorm:"not null;default:true" json:"is_active"`
-	CreatedAt  time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
-	UpdatedAt  time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+	ID         uuid.UUID         `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ProductID  uuid.UUID         `gorm:"type:uuid;not null" json:"product_id"`
+	SKU        string            `gorm:"type:text;uniqueIndex;not null" json:"sku" validate:"required"`
+	Attributes VariantAttributes `gorm:"type:jsonb" json:"attributes"` // Option values, validated against the product options
+	Price      money.Money       `gorm:"column:price_minor;type:bigint;not null;check:price_minor >= 0" json:"price"`
+	// Regular price shown struck through while a sale is running, nil otherwise
+	CompareAtPrice *money.Money `gorm:"column:compare_at_price_minor;type:bigint;check:compare_at_price_minor >= 0" json:"compare_at_price"`
+	Currency       string       `gorm:"type:char(3);not null" json:"currency" validate:"required,len=3"`
+	WeightGrams    int          `gorm:"not null;default:0;check:weight_grams >= 0" json:"weight_grams" validate:"min=0"`
+	IsActive       bool         `gorm:"not null;default:true" json:"is_active"`
+	// What checkout does when the stock runs out: refuse, backorder or pre-order the units
+	InventoryPolicy    InventoryPolicy `gorm:"type:inventory_policy;not null;default:'deny'" json:"inventory_policy"`
+	BackorderLimit     *int            `gorm:"check:backorder_limit >= 0" json:"backorder_limit"` // Units that may wait for stock at once, nil for no limit
+	PreorderExpectedAt *time.Time      `gorm:"type:timestamptz" json:"preorder_expected_at"`      // When pre-ordered stock is expected
+	// Available-to-sell at or below which the variant needs replenishing, nil for no alerts
+	ReorderPoint *int    `gorm:"check:reorder_point >= 0" json:"reorder_point"`
+	ReorderQty   *int    `gorm:"check:reorder_qty > 0" json:"reorder_qty"` // Units usually ordered from the supplier
+	StockAlert   *string `gorm:"type:text" json:"stock_alert"`             // Last alert sent: low_stock, out_of_stock or nil
+	// Weighted average cost of the units received from suppliers, in the variant currency
+	CostPrice *money.Money `gorm:"column:cost_price_minor;type:bigint;check:cost_price_minor >= 0" json:"cost_price"`
+	CreatedAt time.Time    `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt time.Time    `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
 
 	// Relationships
-	Inventory Inventory `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"inventory,omitempty"`
+	Inventories []Inventory       `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"inventories,omitempty"` // One per location, none when stock is not tracked
+	Prices      []VariantPrice    `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"prices,omitempty"`
+	Components  []BundleComponent `gorm:"foreignKey:BundleVariantID;constraint:OnDelete:CASCADE" json:"components,omitempty"` // Bundle variants only
 }
 
-// Inventory represents stock levels for a product variant
+// Inventory represents stock levels for a product variant at a location
 type Inventory struct {
 	VariantID   uuid.UUID `gorm:"type:uuid;primary_key" json:"variant_id"`
+	LocationID  uuid.UUID `gorm:"type:uuid;primary_key" json:"location_id"`
 	QtyOnHand   int       `gorm:"not null;default:0;check:qty_on_hand >= 0" json:"qty_on_hand" validate:"min=0"`
 	QtyReserved int       `gorm:"not null;default:0;check:qty_reserved >= 0" json:"qty_reserved" validate:"min=0"`
-	UpdatedAt   time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+	// AvailableToSell is QtyOnHand - QtyReserved, computed when loaded
+	AvailableToSell int       `gorm:"-" json:"available_to_sell"`
+	Tracked         bool      `gorm:"-" json:"tracked"`              // False when the variant has no inventory row at the location yet
+	BinLocation     *string   `gorm:"type:text" json:"bin_location"` // Shelf position at the location, pick lists follow it
+	UpdatedAt       time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+
+	// Relationships
+	Location *Location `gorm:"foreignKey:LocationID;constraint:OnDelete:RESTRICT" json:"location,omitempty"`
 }
 
 // BeforeCreate hooks for setting default values
@@ -52,6 +104,13 @@ func (p *Product) BeforeCreate(tx *gorm.DB) error {
 	return nil
 }
 
+func (po *ProductOption) BeforeCreate(tx *gorm.DB) error {
+	if po.ID == uuid.Nil {
+		po.ID = uuid.New()
+	}
+	return nil
+}
+
 func (pv *ProductVariant) BeforeCreate(tx *gorm.DB) error {
 	if pv.ID == uuid.Nil {
 		pv.ID = uuid.New()
@@ -65,12 +124,117 @@ func (p *Product) BeforeUpdate(tx *gorm.DB) error {
 	return nil
 }
 
+func (po *ProductOption) BeforeUpdate(tx *gorm.DB) error {
+	po.UpdatedAt = time.Now()
+	return nil
+}
+
 func (pv *ProductVariant) BeforeUpdate(tx *gorm.DB) error {
 	pv.UpdatedAt = time.Now()
 	return nil
 }
 
+// AfterFind keeps the preloaded options and media in their display order
+func (p *Product) AfterFind(tx *gorm.DB) error {
+	slices.SortStableFunc(p.Options, func(a, b ProductOption) int { return a.Position - b.Position })
+	slices.SortStableFunc(p.Media, func(a, b ProductMedia) int { return a.Position - b.Position })
+	return nil
+}
+
+// AfterFind stamps the variant currency on its prices and cost
+func (pv *ProductVariant) AfterFind(tx *gorm.DB) error {
+	pv.Price = pv.Price.WithCurrency(pv.Currency)
+	if pv.CompareAtPrice != nil {
+		compareAt := pv.CompareAtPrice.WithCurrency(pv.Currency)
+		pv.CompareAtPrice = &compareAt
+	}
+	if pv.CostPrice != nil {
+		cost := pv.CostPrice.WithCurrency(pv.Currency)
+		pv.CostPrice = &cost
+	}
+	return nil
+}
+
+// AfterCreate opens the price history of a new variant and provisions its inventory at
+// the default location. Bundle variants are stocked through their components and get
+// no inventory.
+func (pv *ProductVariant) AfterCreate(tx *gorm.DB) error {
+	if err := tx.Create(&VariantPriceHistory{
+		VariantID:     pv.ID,
+		Currency:      pv.Currency,
+		Price:         pv.Price,
+		Reason:        PriceChangeCreated,
+		EffectiveFrom: pv.CreatedAt,
+	}).Error; err != nil {
+		return err
+	}
+
+	var product Product
+	if err := tx.Select("type").First(&product, pv.ProductID).Error; err != nil {
+		return err
+	}
+	if product.Type == ProductTypeBundle {
+		return nil
+	}
+
+	var location Location
+	if err := tx.Select("id").Where("is_default").First(&location).Error; err != nil {
+		return err
+	}
+	return tx.Create(&Inventory{VariantID: pv.ID, LocationID: location.ID}).Error
+}
+
 func (i *Inventory) BeforeUpdate(tx *gorm.DB) error {
 	i.UpdatedAt = time.Now()
 	return nil
 }
+
+func (i *Inventory) AfterFind(tx *gorm.DB) error {
+	i.AvailableToSell = i.QtyOnHand - i.QtyReserved
+	i.Tracked = true
+	return nil
+}
+
+// Value stores the option values as jsonb
+func (v OptionValues) Value() (driver.Value, error) {
+	if v == nil {
+		return "[]", nil
+	}
+	return json.Marshal(v)
+}
+
+// Scan loads the option values from a jsonb column
+func (v *OptionValues) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case []byte:
+		return json.Unmarshal(data, v)
+	case string:
+		return json.Unmarshal([]byte(data), v)
+	case nil:
+		*v = OptionValues{}
+		return nil
+	}
+	return errors.New("unsupported type for OptionValues")
+}
+
+// Value stores the attributes as jsonb, NULL when the variant has none
+func (a VariantAttributes) Value() (driver.Value, error) {
+	if len(a) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(a)
+}
+
+// Scan loads the attributes from a jsonb column
+func (a *VariantAttributes) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case []byte:
+		return json.Unmarshal(data, a)
+	case string:
+		return json.Unmarshal([]byte(data), a)
+	case nil:
+		*a = nil
+		return nil
+	}
+	return errors.New("unsupported type for VariantAttributes")
+}
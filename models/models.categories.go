@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Category is a node of the product category tree. Path is the materialised path of
+// category ids from the root down to the category itself ("/<root id>/<id>/"), so
+// a subtree is every category whose path starts with the path of its root.
+type Category struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ParentID    *uuid.UUID `gorm:"type:uuid" json:"parent_id"`
+	Name        string     `gorm:"type:text;not null" json:"name" validate:"required"`
+	Slug        string     `gorm:"type:text;not null;uniqueIndex" json:"slug"`
+	Description *string    `gorm:"type:text" json:"description"`
+	Path        string     `gorm:"type:text;not null" json:"path"`
+	Depth       int        `gorm:"not null;default:0" json:"depth"` // 0 for root categories
+	Position    int        `gorm:"not null;default:0" json:"position"`
+	CreatedAt   time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+
+	// Relationships
+	Parent   *Category  `gorm:"foreignKey:ParentID;constraint:OnDelete:RESTRICT" json:"-"`
+	Children []Category `gorm:"-" json:"children,omitempty"` // Filled when building the tree
+}
+
+// Collection groups products for merchandising. Manual collections list their products
+// explicitly, rule based ones select every product matching their rules.
+type Collection struct {
+	ID          uuid.UUID       `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Title       string          `gorm:"type:text;not null" json:"title" validate:"required"`
+	Slug        string          `gorm:"type:text;not null;uniqueIndex" json:"slug"`
+	Description *string         `gorm:"type:text" json:"description"`
+	Type        CollectionType  `gorm:"type:collection_type;not null;default:'manual'" json:"type"`
+	Rules       CollectionRules `gorm:"type:jsonb;not null;default:'[]'" json:"rules"`
+	MatchAll    bool            `gorm:"not null;default:true" json:"match_all"` // false matches products satisfying any rule
+	IsActive    bool            `gorm:"not null;default:true" json:"is_active"`
+	CreatedAt   time.Time       `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt   time.Time       `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+
+	// Relationships
+	Products []Product `gorm:"many2many:collection_products;constraint:OnDelete:CASCADE" json:"products,omitempty"` // Manual collections only
+}
+
+// CollectionRule is a condition on products, e.g. {"field":"category","operator":"equals","value":"shoes"}
+type CollectionRule struct {
+	Field    string `json:"field"`    // title, tax_class, category, price_minor
+	Operator string `json:"operator"` // equals, not_equals, contains, greater_than, less_than
+	Value    string `json:"value"`
+}
+
+// CollectionRules is the rule list of a collection stored as jsonb
+type CollectionRules []CollectionRule
+
+// Value stores the rules as jsonb
+func (r CollectionRules) Value() (driver.Value, error) {
+	if r == nil {
+		return "[]", nil
+	}
+	return json.Marshal(r)
+}
+
+// Scan loads the rules from a jsonb column
+func (r *CollectionRules) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, r)
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	case nil:
+		*r = CollectionRules{}
+		return nil
+	}
+	return errors.New("unsupported type for CollectionRules")
+}
+
+func (c *Category) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+func (c *Category) BeforeUpdate(tx *gorm.DB) error {
+	c.UpdatedAt = time.Now()
+	return nil
+}
+
+func (c *Collection) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+func (c *Collection) BeforeUpdate(tx *gorm.DB) error {
+	c.UpdatedAt = time.Now()
+	return nil
+}
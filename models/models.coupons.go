@@ -0,0 +1,77 @@
+package models
+
+import (
+	"oms-services/money"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Coupon represents a promotion code that can be applied to a draft order
+type Coupon struct {
+	ID                    uuid.UUID   `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Code                  string      `gorm:"type:text;not null;uniqueIndex" json:"code" validate:"required"` // Stored upper-cased
+	Type                  CouponType  `gorm:"type:coupon_type;not null" json:"type" validate:"required"`
+	PercentOff            int         `gorm:"not null;default:0;check:percent_off >= 0 AND percent_off <= 100" json:"percent_off" validate:"min=0,max=100"`
+	AmountOff             money.Money `gorm:"column:amount_off_minor;type:bigint;not null;default:0;check:amount_off_minor >= 0" json:"amount_off"`
+	Currency              *string     `gorm:"type:char(3)" json:"currency"` // Required for fixed amounts and minimum subtotals
+	MinSubtotal           money.Money `gorm:"column:min_subtotal_minor;type:bigint;not null;default:0;check:min_subtotal_minor >= 0" json:"min_subtotal"`
+	UsageLimit            *int        `gorm:"check:usage_limit > 0" json:"usage_limit"`                           // Global redemptions, nil for unlimited
+	UsageLimitPerCustomer *int        `gorm:"check:usage_limit_per_customer > 0" json:"usage_limit_per_customer"` // nil for unlimited
+	TimesUsed             int         `gorm:"not null;default:0;check:times_used >= 0" json:"times_used"`
+	StartsAt              *time.Time  `gorm:"type:timestamptz" json:"starts_at"`
+	EndsAt                *time.Time  `gorm:"type:timestamptz" json:"ends_at"`
+	IsActive              bool        `gorm:"not null;default:true" json:"is_active"`
+	CreatedAt             time.Time   `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt             time.Time   `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+}
+
+// CouponRedemption records a coupon used by a placed order, used to enforce usage limits
+type CouponRedemption struct {
+	ID         uuid.UUID   `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	CouponID   uuid.UUID   `gorm:"type:uuid;not null;uniqueIndex:idx_coupon_redemptions_order" json:"coupon_id"`
+	OrderID    uuid.UUID   `gorm:"type:uuid;not null;uniqueIndex:idx_coupon_redemptions_order" json:"order_id"`
+	CustomerID *uuid.UUID  `gorm:"type:uuid" json:"customer_id"`
+	Email      *string     `gorm:"type:text" json:"email"` // Guest email when the order has no customer
+	Discount   money.Money `gorm:"column:discount_minor;type:bigint;not null;default:0;check:discount_minor >= 0" json:"discount"`
+	Currency   string      `gorm:"type:char(3);not null" json:"currency"`
+	CreatedAt  time.Time   `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+
+	// Relationships
+	Coupon Coupon `gorm:"foreignKey:CouponID;constraint:OnDelete:CASCADE" json:"-"`
+	Order  Order  `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (c *Coupon) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+func (cr *CouponRedemption) BeforeCreate(tx *gorm.DB) error {
+	if cr.ID == uuid.Nil {
+		cr.ID = uuid.New()
+	}
+	return nil
+}
+
+// AfterFind hooks stamping the currency on the loaded amounts
+func (c *Coupon) AfterFind(tx *gorm.DB) error {
+	if c.Currency != nil {
+		c.AmountOff = c.AmountOff.WithCurrency(*c.Currency)
+		c.MinSubtotal = c.MinSubtotal.WithCurrency(*c.Currency)
+	}
+	return nil
+}
+
+func (cr *CouponRedemption) AfterFind(tx *gorm.DB) error {
+	cr.Discount = cr.Discount.WithCurrency(cr.Currency)
+	return nil
+}
+
+func (c *Coupon) BeforeUpdate(tx *gorm.DB) error {
+	c.UpdatedAt = time.Now()
+	return nil
+}
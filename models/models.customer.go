@@ -1,9 +1,13 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type Customer struct {
@@ -12,5 +16,111 @@ type Customer struct {
 	LastName  string    `gorm:"type:text;not null" json:"last_name" validate:"required"`
 	Email     string    `gorm:"type:text;not null;unique" json:"email" validate:"required,email"`
 	Phone     string    `gorm:"type:text;not null" json:"phone" validate:"required"`
-	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	// Selects group specific prices from the variant price lists (e.g. "wholesale")
+	CustomerGroup *string `gorm:"type:text" json:"customer_group"`
+	// Set once the customer proved ownership of the email, required to claim guest orders
+	EmailVerifiedAt *time.Time `gorm:"type:timestamptz" json:"email_verified_at"`
+	// Hash of the pending verification token sent to the email, cleared once used
+	EmailVerificationHash      *string    `gorm:"type:text" json:"-"`
+	EmailVerificationExpiresAt *time.Time `gorm:"type:timestamptz" json:"-"`
+	// Set when the customer's personal data was pseudonymised on request
+	ErasedAt  *time.Time `gorm:"type:timestamptz" json:"erased_at"`
+	CreatedAt time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+
+	// Relationships
+	Addresses []Address `gorm:"foreignKey:CustomerID;constraint:OnDelete:CASCADE" json:"addresses,omitempty"`
+}
+
+// Address represents a postal address saved on a customer's address book
+type Address struct {
+	ID                uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	CustomerID        uuid.UUID `gorm:"type:uuid;not null" json:"customer_id"`
+	FirstName         string    `gorm:"type:text;not null" json:"first_name" validate:"required"`
+	LastName          string    `gorm:"type:text;not null" json:"last_name" validate:"required"`
+	Line1             string    `gorm:"type:text;not null" json:"line1" validate:"required"`
+	Line2             *string   `gorm:"type:text" json:"line2"`
+	City              string    `gorm:"type:text;not null" json:"city" validate:"required"`
+	Region            *string   `gorm:"type:text" json:"region"` // State / governorate
+	PostalCode        *string   `gorm:"type:text" json:"postal_code"`
+	Country           string    `gorm:"type:char(2);not null" json:"country" validate:"required,len=2"` // ISO-3166 alpha-2
+	Phone             *string   `gorm:"type:text" json:"phone"`
+	IsDefaultBilling  bool      `gorm:"not null;default:false" json:"is_default_billing"`
+	IsDefaultShipping bool      `gorm:"not null;default:false" json:"is_default_shipping"`
+	CreatedAt         time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt         time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+}
+
+// AddressSnapshot is an immutable copy of an Address stored on an order at checkout,
+// so editing the customer's address book never rewrites historical orders.
+type AddressSnapshot struct {
+	AddressID  *uuid.UUID `json:"address_id,omitempty"`
+	FirstName  string     `json:"first_name"`
+	LastName   string     `json:"last_name"`
+	Line1      string     `json:"line1"`
+	Line2      *string    `json:"line2,omitempty"`
+	City       string     `json:"city"`
+	Region     *string    `json:"region,omitempty"`
+	PostalCode *string    `json:"postal_code,omitempty"`
+	Country    string     `json:"country"`
+	Phone      *string    `json:"phone,omitempty"`
+}
+
+// Snapshot copies the address into a value that can be stored on an order
+func (a *Address) Snapshot() AddressSnapshot {
+	id := a.ID
+	return AddressSnapshot{
+		AddressID:  &id,
+		FirstName:  a.FirstName,
+		LastName:   a.LastName,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+		Phone:      a.Phone,
+	}
+}
+
+// Value stores the snapshot as jsonb
+func (s AddressSnapshot) Value() (driver.Value, error) {
+	return json.Marshal(s)
+}
+
+// Scan loads the snapshot from a jsonb column
+func (s *AddressSnapshot) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, s)
+	case string:
+		return json.Unmarshal([]byte(v), s)
+	case nil:
+		return nil
+	}
+	return errors.New("unsupported type for AddressSnapshot")
+}
+
+func (c *Customer) BeforeCreate(tx *gorm.DB) error {
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	return nil
+}
+
+func (a *Address) BeforeCreate(tx *gorm.DB) error {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	return nil
+}
+
+func (c *Customer) BeforeUpdate(tx *gorm.DB) error {
+	c.UpdatedAt = time.Now()
+	return nil
+}
+
+func (a *Address) BeforeUpdate(tx *gorm.DB) error {
+	a.UpdatedAt = time.Now()
+	return nil
 }
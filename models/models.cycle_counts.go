@@ -0,0 +1,82 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CycleCount is a count of the shelves of a location for a set of variants. Counted
+// quantities are compared with the stock on hand when they were counted, approving the
+// count corrects the stock by the variances.
+type CycleCount struct {
+	ID          uuid.UUID        `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	LocationID  uuid.UUID        `gorm:"type:uuid;not null" json:"location_id"`
+	Status      CycleCountStatus `gorm:"type:cycle_count_status;not null;default:'open'" json:"status"`
+	Note        *string          `gorm:"type:text" json:"note"`
+	StartedBy   *string          `gorm:"type:text" json:"started_by"`
+	ApprovedBy  *string          `gorm:"type:text" json:"approved_by"`
+	CreatedAt   time.Time        `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt   time.Time        `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+	ApprovedAt  *time.Time       `gorm:"type:timestamptz" json:"approved_at"`
+	CancelledAt *time.Time       `gorm:"type:timestamptz" json:"cancelled_at"`
+
+	// Relationships
+	Location *Location        `gorm:"foreignKey:LocationID;constraint:OnDelete:RESTRICT" json:"location,omitempty"`
+	Lines    []CycleCountLine `gorm:"foreignKey:CycleCountID;constraint:OnDelete:CASCADE" json:"lines,omitempty"`
+}
+
+// CycleCountLine is a variant to count in a cycle count
+type CycleCountLine struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	CycleCountID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_cycle_count_lines_variant" json:"cycle_count_id"`
+	VariantID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_cycle_count_lines_variant" json:"variant_id"`
+	ExpectedQty  int       `gorm:"not null" json:"expected_qty"` // On hand when the count started
+	// CountedQty is the quantity found on the shelf, nil until counted. QtyOnHandAtCount is
+	// the stock on hand at that moment, what the counted quantity is compared with.
+	CountedQty       *int       `gorm:"check:counted_qty >= 0" json:"counted_qty"`
+	QtyOnHandAtCount *int       `json:"qty_on_hand_at_count"`
+	CountedAt        *time.Time `gorm:"type:timestamptz" json:"counted_at"`
+	// Variance is CountedQty - QtyOnHandAtCount, computed when loaded
+	Variance  *int      `gorm:"-" json:"variance"`
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+
+	// Relationships
+	Variant *ProductVariant `gorm:"foreignKey:VariantID;constraint:OnDelete:RESTRICT" json:"variant,omitempty"`
+}
+
+func (cc *CycleCount) BeforeCreate(tx *gorm.DB) error {
+	if cc.ID == uuid.Nil {
+		cc.ID = uuid.New()
+	}
+	return nil
+}
+
+func (cc *CycleCount) BeforeUpdate(tx *gorm.DB) error {
+	cc.UpdatedAt = time.Now()
+	return nil
+}
+
+func (cl *CycleCountLine) BeforeCreate(tx *gorm.DB) error {
+	if cl.ID == uuid.Nil {
+		cl.ID = uuid.New()
+	}
+	return nil
+}
+
+func (cl *CycleCountLine) BeforeUpdate(tx *gorm.DB) error {
+	cl.UpdatedAt = time.Now()
+	return nil
+}
+
+// AfterFind computes the variance of counted lines
+func (cl *CycleCountLine) AfterFind(tx *gorm.DB) error {
+	cl.Variance = nil
+	if cl.CountedQty != nil && cl.QtyOnHandAtCount != nil {
+		variance := *cl.CountedQty - *cl.QtyOnHandAtCount
+		cl.Variance = &variance
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"oms-services/money"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ExchangeRate is the daily rate converting one major unit of BaseCurrency into
+// QuoteCurrency. The rate of a day stays in effect until a newer one is loaded.
+type ExchangeRate struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	BaseCurrency  string     `gorm:"type:char(3);not null;uniqueIndex:idx_exchange_rates_pair_date" json:"base_currency" validate:"required,len=3"`
+	QuoteCurrency string     `gorm:"type:char(3);not null;uniqueIndex:idx_exchange_rates_pair_date" json:"quote_currency" validate:"required,len=3"`
+	EffectiveDate time.Time  `gorm:"type:date;not null;uniqueIndex:idx_exchange_rates_pair_date" json:"effective_date"`
+	Rate          money.Rate `gorm:"type:numeric(20,10);not null;check:rate > 0" json:"rate"`
+	Source        *string    `gorm:"type:text" json:"source"` // e.g. "csv", "api", "central-bank"
+	CreatedAt     time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt     time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+}
+
+func (er *ExchangeRate) BeforeCreate(tx *gorm.DB) error {
+	if er.ID == uuid.Nil {
+		er.ID = uuid.New()
+	}
+	return nil
+}
+
+func (er *ExchangeRate) BeforeUpdate(tx *gorm.DB) error {
+	er.UpdatedAt = time.Now()
+	return nil
+}
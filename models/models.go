@@ -1,6 +1,10 @@
 package models
 
 import (
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -16,18 +20,305 @@ func AutoMigrate(db *gorm.DB) error {
 		return err
 	}
 
+	// Stock is kept per location
+	if err := migrateLocations(db); err != nil {
+		return err
+	}
+
+	// Refunds and redemptions carry the currency of their order
+	if err := migrateCurrencies(db); err != nil {
+		return err
+	}
+
+	// Variant attributes are string maps, unique per product
+	if err := migrateVariantAttributes(db); err != nil {
+		return err
+	}
+
 	// Auto migrate all models
-	return db.AutoMigrate(
+	err := db.AutoMigrate(
 		&Product{},
 		&ProductVariant{},
+		&ProductOption{},
+		&ProductMedia{},
 		&Inventory{},
+		&BundleComponent{},
+		&StockMovement{},
+		&StockAllocation{},
+		&Backorder{},
+		&Supplier{},
+		&PurchaseOrder{},
+		&PurchaseOrderLine{},
+		&CycleCount{},
+		&CycleCountLine{},
+		&Shipment{},
+		&ShipmentItem{},
+		&TrackingCheckpoint{},
 		&Order{},
 		&OrderItem{},
+		&OrderItemComponent{},
 		&Payment{},
 		&Refund{},
 		&OrderEvent{},
 		&Customer{},
+		&Address{},
+		&Coupon{},
+		&CouponRedemption{},
+		&TaxRate{},
+		&ShippingMethod{},
+		&ShippingRateTier{},
+		&VariantPrice{},
+		&ExchangeRate{},
+		&ScheduledPrice{},
+		&VariantPriceHistory{},
+		&Category{},
+		&Collection{},
 	)
+	if err != nil {
+		return err
+	}
+
+	// Lines are unique per order and variant
+	if err := mergeDuplicateOrderItems(db); err != nil {
+		return err
+	}
+
+	if err := backfillPlacedAt(db); err != nil {
+		return err
+	}
+	if err := backfillInventories(db); err != nil {
+		return err
+	}
+
+	return backfillPriceHistory(db)
+}
+
+// backfillInventories provisions the default location inventory of the variants created
+// before ProductVariant.AfterCreate did it. Bundle variants are stocked through their
+// components and get none.
+func backfillInventories(db *gorm.DB) error {
+	result := db.Exec(`INSERT INTO inventories (variant_id, location_id)
+		SELECT product_variants.id, locations.id
+		FROM product_variants
+		JOIN products ON products.id = product_variants.product_id
+		JOIN locations ON locations.is_default
+		WHERE products.type <> ?
+		ON CONFLICT (variant_id, location_id) DO NOTHING;`, ProductTypeBundle)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("%d variants had no inventory, it was created at the default location", result.RowsAffected)
+	}
+	return nil
+}
+
+// backfillPriceHistory opens the price history of the variants and price list entries
+// created before it was recorded, from their creation
+func backfillPriceHistory(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`INSERT INTO variant_price_histories
+				(variant_id, currency, price_minor, compare_at_price_minor, reason, effective_from, created_at)
+			SELECT id, currency, price_minor, compare_at_price_minor, ?, created_at, created_at FROM product_variants
+			WHERE NOT EXISTS (
+				SELECT 1 FROM variant_price_histories history
+				WHERE history.variant_id = product_variants.id AND history.variant_price_id IS NULL
+			);`, PriceChangeCreated).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(`INSERT INTO variant_price_histories
+				(variant_id, currency, price_minor, reason, variant_price_id, store, customer_group, starts_at, ends_at, effective_from, created_at)
+			SELECT variant_id, currency, amount_minor, ?, id, store, customer_group, starts_at, ends_at, created_at, created_at FROM variant_prices
+			WHERE NOT EXISTS (
+				SELECT 1 FROM variant_price_histories history WHERE history.variant_price_id = variant_prices.id
+			);`, PriceChangePriceList).Error
+	})
+}
+
+// mergeDuplicateOrderItems folds the lines repeating a variant of their order into the
+// first of them so the unique index can be created. Quantities and amounts are summed,
+// and the allocations, backorders, components and shipment items of the merged lines
+// are moved to the line kept.
+func mergeDuplicateOrderItems(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var duplicates []struct {
+			OrderID   uuid.UUID
+			VariantID uuid.UUID
+			Lines     int
+		}
+		err := tx.Raw(`SELECT order_id, variant_id, count(*) AS lines FROM order_items
+			GROUP BY order_id, variant_id HAVING count(*) > 1;`).Scan(&duplicates).Error
+		if err != nil || len(duplicates) == 0 {
+			return err
+		}
+
+		statements := []string{
+			`CREATE TEMPORARY TABLE merged_order_items ON COMMIT DROP AS
+			SELECT id, keep_id FROM (
+				SELECT id, first_value(id) OVER (PARTITION BY order_id, variant_id ORDER BY id) AS keep_id
+				FROM order_items
+			) ranked WHERE id <> keep_id;`,
+		}
+		for _, table := range []string{"stock_allocations", "backorders", "order_item_components", "shipment_items"} {
+			statements = append(statements, fmt.Sprintf(`UPDATE %s SET order_item_id = merged.keep_id
+				FROM merged_order_items merged WHERE %s.order_item_id = merged.id;`, table, table))
+		}
+		statements = append(statements,
+			`UPDATE order_items SET
+				quantity = order_items.quantity + merged.quantity,
+				tax_minor = order_items.tax_minor + merged.tax_minor,
+				discount_minor = order_items.discount_minor + merged.discount_minor,
+				line_total_minor = order_items.line_total_minor + merged.line_total_minor,
+				backordered = order_items.backordered OR merged.backordered
+			FROM (
+				SELECT merged_order_items.keep_id, sum(quantity) AS quantity, sum(tax_minor) AS tax_minor,
+					sum(discount_minor) AS discount_minor, sum(line_total_minor) AS line_total_minor,
+					bool_or(backordered) AS backordered
+				FROM order_items JOIN merged_order_items ON merged_order_items.id = order_items.id
+				GROUP BY merged_order_items.keep_id
+			) merged
+			WHERE order_items.id = merged.keep_id;`,
+			`DELETE FROM order_items USING merged_order_items WHERE order_items.id = merged_order_items.id;`,
+		)
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, duplicate := range duplicates {
+			log.Printf("order %s had %d lines of variant %s, they were merged", duplicate.OrderID, duplicate.Lines, duplicate.VariantID)
+		}
+		return nil
+	})
+}
+
+// backfillPlacedAt dates the orders placed before placed_at was recorded with the
+// time they left draft, or their creation when the event is missing. Drafts that were
+// cancelled were never placed and keep no date.
+func backfillPlacedAt(db *gorm.DB) error {
+	return db.Exec(`UPDATE orders SET placed_at = COALESCE((
+			SELECT MIN(order_events.created_at) FROM order_events
+			WHERE order_events.order_id = orders.id AND order_events.event_type = 'status_changed'
+				AND order_events.payload->>'from' = 'draft' AND order_events.payload->>'to' <> 'cancelled'
+		), CASE WHEN orders.status <> 'cancelled' THEN orders.created_at END)
+		WHERE placed_at IS NULL AND status <> 'draft';`).Error
+}
+
+// migrateLocations creates the locations with a default one, and moves the stock of
+// databases predating locations to the default location
+func migrateLocations(db *gorm.DB) error {
+	if err := db.AutoMigrate(&Location{}); err != nil {
+		return err
+	}
+
+	var location Location
+	if err := db.Where("is_default").Limit(1).Find(&location).Error; err != nil {
+		return err
+	}
+	if location.ID == uuid.Nil {
+		location = Location{Code: "main", Name: "Main warehouse", Country: "EG", IsDefault: true, IsActive: true}
+		if err := db.Create(&location).Error; err != nil {
+			return err
+		}
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range []string{"inventories", "stock_movements"} {
+			if !tx.Migrator().HasTable(table) || tx.Migrator().HasColumn(table, "location_id") {
+				continue
+			}
+			// A column default fills the existing rows without firing the append-only trigger
+			statements := []string{
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN location_id uuid NOT NULL DEFAULT '%s';", table, location.ID),
+				fmt.Sprintf("ALTER TABLE %s ALTER COLUMN location_id DROP DEFAULT;", table),
+			}
+			if table == "inventories" {
+				statements = append(statements,
+					"ALTER TABLE inventories DROP CONSTRAINT inventories_pkey;",
+					"ALTER TABLE inventories ADD PRIMARY KEY (variant_id, location_id);",
+				)
+			}
+			for _, statement := range statements {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// migrateCurrencies adds the currency column to refunds and coupon redemptions of
+// databases predating it, backfilled from their order
+func migrateCurrencies(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, table := range []string{"refunds", "coupon_redemptions"} {
+			if !tx.Migrator().HasTable(table) || tx.Migrator().HasColumn(table, "currency") {
+				continue
+			}
+			statements := []string{
+				fmt.Sprintf("ALTER TABLE %s ADD COLUMN currency char(3);", table),
+				fmt.Sprintf("UPDATE %s SET currency = orders.currency FROM orders WHERE orders.id = %s.order_id;", table, table),
+				fmt.Sprintf("ALTER TABLE %s ALTER COLUMN currency SET NOT NULL;", table),
+			}
+			for _, statement := range statements {
+				if err := tx.Exec(statement).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// migrateVariantAttributes rewrites the free-form attributes of databases predating
+// product options into string maps, and clears the attributes of variants repeating
+// another variant of their product so the unique index can be created. The oldest
+// variant keeps the combination, the others have to be given theirs again.
+func migrateVariantAttributes(db *gorm.DB) error {
+	if !db.Migrator().HasTable("product_variants") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			`UPDATE product_variants SET attributes = NULL
+			WHERE attributes IS NOT NULL AND jsonb_typeof(attributes) <> 'object';`,
+			`UPDATE product_variants SET attributes = (
+				SELECT jsonb_object_agg(key, CASE WHEN jsonb_typeof(value) = 'string' THEN value ELSE to_jsonb(value::text) END)
+				FROM jsonb_each(attributes) WHERE jsonb_typeof(value) <> 'null'
+			)
+			WHERE jsonb_typeof(attributes) = 'object'
+			AND EXISTS (SELECT 1 FROM jsonb_each(attributes) WHERE jsonb_typeof(value) <> 'string');`,
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+
+		var duplicates []struct {
+			ID  uuid.UUID
+			SKU string
+		}
+		err := tx.Raw(`UPDATE product_variants SET attributes = NULL
+			WHERE id IN (
+				SELECT id FROM (
+					SELECT id, row_number() OVER (PARTITION BY product_id, attributes ORDER BY created_at, id) AS n
+					FROM product_variants WHERE attributes IS NOT NULL
+				) ranked WHERE n > 1
+			)
+			RETURNING id, sku;`).Scan(&duplicates).Error
+		if err != nil {
+			return err
+		}
+		for _, variant := range duplicates {
+			log.Printf("variant %s (%s) repeated the options of another variant, its attributes were cleared", variant.SKU, variant.ID)
+		}
+		return nil
+	})
 }
 
 // CreateIndexes creates additional indexes for better performance
@@ -36,10 +327,50 @@ func CreateIndexes(db *gorm.DB) error {
 		"CREATE INDEX IF NOT EXISTS idx_orders_status ON orders(status);",
 		"CREATE INDEX IF NOT EXISTS idx_payments_order ON payments(order_id);",
 		"CREATE INDEX IF NOT EXISTS idx_order_items_order ON order_items(order_id);",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_order_items_order_variant ON order_items(order_id, variant_id);",
 		"CREATE INDEX IF NOT EXISTS idx_orders_open ON orders(status) WHERE status IN ('pending_payment','paid','fulfillment_in_progress');",
 		"CREATE INDEX IF NOT EXISTS idx_product_variants_sku ON product_variants(sku);",
 		"CREATE INDEX IF NOT EXISTS idx_orders_customer ON orders(customer_id);",
 		"CREATE INDEX IF NOT EXISTS idx_order_events_order ON order_events(order_id);",
+		"CREATE INDEX IF NOT EXISTS idx_orders_customer_created ON orders(customer_id, created_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_refunds_order ON refunds(order_id);",
+		"CREATE INDEX IF NOT EXISTS idx_orders_guest_email ON orders(lower(guest_email)) WHERE customer_id IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_coupon_redemptions_customer ON coupon_redemptions(coupon_id, customer_id);",
+		"CREATE INDEX IF NOT EXISTS idx_coupon_redemptions_email ON coupon_redemptions(coupon_id, lower(email));",
+		"CREATE INDEX IF NOT EXISTS idx_tax_rates_lookup ON tax_rates(country, tax_class, region) WHERE is_active;",
+		"CREATE INDEX IF NOT EXISTS idx_shipping_rate_tiers_method ON shipping_rate_tiers(shipping_method_id, min_weight_grams);",
+		"CREATE INDEX IF NOT EXISTS idx_addresses_customer ON addresses(customer_id);",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_addresses_default_billing ON addresses(customer_id) WHERE is_default_billing;",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_addresses_default_shipping ON addresses(customer_id) WHERE is_default_shipping;",
+		"CREATE INDEX IF NOT EXISTS idx_variant_prices_lookup ON variant_prices(variant_id, currency);",
+		"CREATE INDEX IF NOT EXISTS idx_orders_created ON orders(created_at);",
+		"CREATE INDEX IF NOT EXISTS idx_orders_placed ON orders(placed_at) WHERE placed_at IS NOT NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_scheduled_prices_due ON scheduled_prices(status, starts_at, ends_at) WHERE status IN ('scheduled','active');",
+		"CREATE INDEX IF NOT EXISTS idx_scheduled_prices_variant ON scheduled_prices(variant_id);",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_variants_product_attributes ON product_variants(product_id, attributes) WHERE attributes IS NOT NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_variants_attributes ON product_variants USING gin (attributes jsonb_path_ops);",
+		"CREATE INDEX IF NOT EXISTS idx_product_media_product ON product_media(product_id, position);",
+		"CREATE INDEX IF NOT EXISTS idx_bundle_components_component ON bundle_components(component_variant_id);",
+		"CREATE INDEX IF NOT EXISTS idx_order_item_components_item ON order_item_components(order_item_id);",
+		"CREATE INDEX IF NOT EXISTS idx_stock_movements_variant ON stock_movements(variant_id, created_at);",
+		"CREATE INDEX IF NOT EXISTS idx_stock_movements_reference ON stock_movements(reference_type, reference_id);",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_locations_default ON locations(is_default) WHERE is_default;",
+		"CREATE INDEX IF NOT EXISTS idx_inventories_location ON inventories(location_id);",
+		"CREATE INDEX IF NOT EXISTS idx_stock_allocations_order ON stock_allocations(order_id);",
+		"CREATE INDEX IF NOT EXISTS idx_stock_allocations_item ON stock_allocations(order_item_id);",
+		"CREATE INDEX IF NOT EXISTS idx_backorders_open ON backorders(variant_id, created_at) WHERE fulfilled_at IS NULL AND cancelled_at IS NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_backorders_order ON backorders(order_id);",
+		"CREATE INDEX IF NOT EXISTS idx_purchase_orders_supplier ON purchase_orders(supplier_id, created_at DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_purchase_orders_open ON purchase_orders(status) WHERE status IN ('sent','partially_received');",
+		"CREATE INDEX IF NOT EXISTS idx_cycle_counts_open ON cycle_counts(location_id) WHERE status = 'open';",
+		"CREATE INDEX IF NOT EXISTS idx_shipments_order ON shipments(order_id);",
+		"CREATE INDEX IF NOT EXISTS idx_shipment_items_shipment ON shipment_items(shipment_id);",
+		"CREATE INDEX IF NOT EXISTS idx_shipments_tracked ON shipments(tracked_at NULLS FIRST) WHERE status IN ('pending', 'packed', 'in_transit') AND tracking_number IS NOT NULL;",
+		"CREATE INDEX IF NOT EXISTS idx_categories_path ON categories(path text_pattern_ops);",
+		"CREATE INDEX IF NOT EXISTS idx_categories_parent ON categories(parent_id, position);",
+		"CREATE INDEX IF NOT EXISTS idx_product_categories_category ON product_categories(category_id);",
+		"CREATE INDEX IF NOT EXISTS idx_variant_price_histories_lookup ON variant_price_histories(variant_id, effective_from DESC);",
+		"CREATE INDEX IF NOT EXISTS idx_payments_created ON payments(created_at);",
 	}
 
 	for _, indexSQL := range indexes {
@@ -50,3 +381,24 @@ func CreateIndexes(db *gorm.DB) error {
 
 	return nil
 }
+
+// CreateTriggers installs the triggers keeping append-only tables append-only
+func CreateTriggers(db *gorm.DB) error {
+	triggers := []string{
+		`CREATE OR REPLACE FUNCTION reject_append_only_change() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION '% is append-only', TG_TABLE_NAME;
+		END;
+		$$ LANGUAGE plpgsql;`,
+		"DROP TRIGGER IF EXISTS stock_movements_append_only ON stock_movements;",
+		"CREATE TRIGGER stock_movements_append_only BEFORE UPDATE OR DELETE ON stock_movements FOR EACH ROW EXECUTE FUNCTION reject_append_only_change();",
+	}
+
+	for _, triggerSQL := range triggers {
+		if err := db.Exec(triggerSQL).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Location is a warehouse or store holding stock that orders can ship from
+type Location struct {
+	ID         uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Code       string    `gorm:"type:text;uniqueIndex;not null" json:"code" validate:"required"`
+	Name       string    `gorm:"type:text;not null" json:"name" validate:"required"`
+	Line1      *string   `gorm:"type:text" json:"line1"`
+	City       *string   `gorm:"type:text" json:"city"`
+	Region     *string   `gorm:"type:text" json:"region"` // State / governorate
+	PostalCode *string   `gorm:"type:text" json:"postal_code"`
+	Country    string    `gorm:"type:char(2);not null" json:"country" validate:"required,len=2"` // ISO-3166 alpha-2
+	Priority   int       `gorm:"not null;default:0" json:"priority"`                             // Lower ships first between equally close locations
+	// The default location receives the stock of new variants and of requests naming no location
+	IsDefault bool      `gorm:"not null;default:false" json:"is_default"`
+	IsActive  bool      `gorm:"not null;default:true" json:"is_active"` // Inactive locations don't fulfill orders
+	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+}
+
+func (l *Location) BeforeCreate(tx *gorm.DB) error {
+	if l.ID == uuid.Nil {
+		l.ID = uuid.New()
+	}
+	return nil
+}
+
+func (l *Location) BeforeUpdate(tx *gorm.DB) error {
+	l.UpdatedAt = time.Now()
+	return nil
+}
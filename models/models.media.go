@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ProductMedia is an image of a product, optionally specific to one of its variants.
+// The file and its thumbnail live in the media storage under their keys.
+type ProductMedia struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ProductID    uuid.UUID  `gorm:"type:uuid;not null" json:"product_id"`
+	VariantID    *uuid.UUID `gorm:"type:uuid" json:"variant_id"` // nil for images of the whole product
+	StorageKey   string     `gorm:"type:text;not null" json:"-"`
+	URL          string     `gorm:"type:text;not null" json:"url"`
+	ThumbnailKey string     `gorm:"type:text;not null" json:"-"`
+	ThumbnailURL string     `gorm:"type:text;not null" json:"thumbnail_url"`
+	ContentType  string     `gorm:"type:text;not null" json:"content_type"`
+	SizeBytes    int64      `gorm:"not null;check:size_bytes >= 0" json:"size_bytes"`
+	Width        int        `gorm:"not null" json:"width"`
+	Height       int        `gorm:"not null" json:"height"`
+	AltText      *string    `gorm:"type:text" json:"alt_text"`
+	Position     int        `gorm:"not null;default:0" json:"position"`
+	CreatedAt    time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt    time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+
+	// Relationships
+	Variant *ProductVariant `gorm:"foreignKey:VariantID;constraint:OnDelete:SET NULL" json:"-"`
+}
+
+func (pm *ProductMedia) BeforeCreate(tx *gorm.DB) error {
+	if pm.ID == uuid.Nil {
+		pm.ID = uuid.New()
+	}
+	return nil
+}
+
+func (pm *ProductMedia) BeforeUpdate(tx *gorm.DB) error {
+	pm.UpdatedAt = time.Now()
+	return nil
+}
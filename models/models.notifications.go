@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Notification is an alert for the back office, e.g. a variant running low on stock
+type Notification struct {
+	ID        uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Type      string     `gorm:"type:text;not null" json:"type"`
+	VariantID *uuid.UUID `gorm:"type:uuid" json:"variant_id"`
+	Message   string     `gorm:"type:text;not null" json:"message"`
+	Payload   *string    `gorm:"type:jsonb" json:"payload"` // JSON payload
+	CreatedAt time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	ReadAt    *time.Time `gorm:"type:timestamptz" json:"read_at"`
+
+	// Relationships
+	Variant *ProductVariant `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (n *Notification) BeforeCreate(tx *gorm.DB) error {
+	if n.ID == uuid.Nil {
+		n.ID = uuid.New()
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"oms-services/money"
 	"time"
 
 	"github.com/google/uuid"
@@ -9,43 +10,70 @@ import (
 
 // Order represents a customer order
 type Order struct {
-	ID            uuid.UUID   `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	CustomerID    *uuid.UUID  `gorm:"type:uuid" json:"customer_id"`
-	Status        OrderStatus `gorm:"type:order_status;not null;default:'draft'" json:"status"`
-	SubtotalMinor int         `gorm:"not null;default:0;check:subtotal_minor >= 0" json:"subtotal_minor" validate:"min=0"`
-	// DiscountMinor     int         `gorm:"not null;default:0;check:discount_minor >= 0" json:"discount_minor" validate:"min=0"`
-	// ShippingMinor     int         `gorm:"not null;default:0;check:shipping_minor >= 0" json:"shipping_minor" validate:"min=0"`
-	// TaxMinor          int         `gorm:"not null;default:0;check:tax_minor >= 0" json:"tax_minor" validate:"min=0"`
-	TotalMinor int    `gorm:"not null;default:0;check:total_minor >= 0" json:"total_minor" validate:"min=0"`
-	Currency   string `gorm:"type:char(3);not null" json:"currency" validate:"required,len=3"`
-	// BillingAddressID  *uuid.UUID  `gorm:"type:uuid" json:"billing_address_id"`
-	// ShippingAddressID *uuid.UUID  `gorm:"type:uuid" json:"shipping_address_id"`
-	CreatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
-	UpdatedAt time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
-	Version   int       `gorm:"not null;default:1" json:"version"` // Optimistic locking
+	ID               uuid.UUID    `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	CustomerID       *uuid.UUID   `gorm:"type:uuid" json:"customer_id"`
+	GuestEmail       *string      `gorm:"type:text" json:"guest_email" validate:"omitempty,email"` // Contact for orders without a customer
+	GuestPhone       *string      `gorm:"type:text" json:"guest_phone"`
+	CouponID         *uuid.UUID   `gorm:"type:uuid" json:"coupon_id"`
+	CouponCode       *string      `gorm:"type:text" json:"coupon_code"`
+	Status           OrderStatus  `gorm:"type:order_status;not null;default:'draft'" json:"status"`
+	Subtotal         money.Money  `gorm:"column:subtotal_minor;type:bigint;not null;default:0;check:subtotal_minor >= 0" json:"subtotal"`
+	Discount         money.Money  `gorm:"column:discount_minor;type:bigint;not null;default:0;check:discount_minor >= 0" json:"discount"`
+	ShippingMethodID *uuid.UUID   `gorm:"type:uuid" json:"shipping_method_id"`
+	Shipping         money.Money  `gorm:"column:shipping_minor;type:bigint;not null;default:0;check:shipping_minor >= 0" json:"shipping"`
+	Tax              money.Money  `gorm:"column:tax_minor;type:bigint;not null;default:0;check:tax_minor >= 0" json:"tax"` // Includes inclusive taxes
+	TaxBreakdown     TaxBreakdown `gorm:"type:jsonb;not null;default:'[]'" json:"tax_breakdown"`
+	Total            money.Money  `gorm:"column:total_minor;type:bigint;not null;default:0;check:total_minor >= 0" json:"total"`
+	Currency         string       `gorm:"type:char(3);not null" json:"currency" validate:"required,len=3"`
+	Store            *string      `gorm:"type:text" json:"store"` // Selects store specific prices
+	// Rate from Currency to ReportingCurrency frozen at checkout, for auditable reporting
+	ReportingCurrency *string     `gorm:"type:char(3)" json:"reporting_currency"`
+	ExchangeRate      *money.Rate `gorm:"type:numeric(20,10)" json:"exchange_rate"`
+	BillingAddressID  *uuid.UUID  `gorm:"type:uuid" json:"billing_address_id"`
+	ShippingAddressID *uuid.UUID  `gorm:"type:uuid" json:"shipping_address_id"`
+	// Address snapshots copied at checkout, never rewritten by address book edits
+	BillingAddressSnapshot  *AddressSnapshot `gorm:"type:jsonb" json:"billing_address_snapshot"`
+	ShippingAddressSnapshot *AddressSnapshot `gorm:"type:jsonb" json:"shipping_address_snapshot"`
+	PlacedAt                *time.Time       `gorm:"type:timestamptz" json:"placed_at"` // When the draft was checked out, nil for drafts
+	CreatedAt               time.Time        `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt               time.Time        `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+	Version                 int              `gorm:"not null;default:1" json:"version"` // Optimistic locking
 
 	// Relationships
-	Items    []OrderItem  `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
-	Payments []Payment    `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"payments,omitempty"`
-	Refunds  []Refund     `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"refunds,omitempty"`
-	Events   []OrderEvent `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"events,omitempty"`
+	Customer        *Customer       `gorm:"foreignKey:CustomerID;constraint:OnDelete:SET NULL" json:"customer,omitempty"`
+	Coupon          *Coupon         `gorm:"foreignKey:CouponID;constraint:OnDelete:SET NULL" json:"-"`
+	ShippingMethod  *ShippingMethod `gorm:"foreignKey:ShippingMethodID;constraint:OnDelete:SET NULL" json:"-"`
+	BillingAddress  *Address        `gorm:"foreignKey:BillingAddressID;constraint:OnDelete:SET NULL" json:"-"`
+	ShippingAddress *Address        `gorm:"foreignKey:ShippingAddressID;constraint:OnDelete:SET NULL" json:"-"`
+	Items           []OrderItem     `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+	Payments        []Payment       `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"payments,omitempty"`
+	Refunds         []Refund        `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"refunds,omitempty"`
+	Events          []OrderEvent    `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"events,omitempty"`
+	Shipments       []Shipment      `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"shipments,omitempty"`
 }
 
 // OrderItem represents an item within an order
 type OrderItem struct {
-	ID             uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
-	OrderID        uuid.UUID `gorm:"type:uuid;not null" json:"order_id"`
-	VariantID      uuid.UUID `gorm:"type:uuid;not null" json:"variant_id"`
-	Quantity       int       `gorm:"not null;check:quantity > 0" json:"quantity" validate:"min=1"`
-	UnitPriceMinor int       `gorm:"not null;check:unit_price_minor >= 0" json:"unit_price_minor" validate:"min=0"`
-	Currency       string    `gorm:"type:char(3);not null" json:"currency" validate:"required,len=3"`
-	// TaxMinor       int       `gorm:"not null;default:0;check:tax_minor >= 0" json:"tax_minor" validate:"min=0"`
-	// DiscountMinor  int       `gorm:"not null;default:0;check:discount_minor >= 0" json:"discount_minor" validate:"min=0"`
-	LineTotalMinor int `gorm:"not null;check:line_total_minor >= 0" json:"line_total_minor" validate:"min=0"`
+	ID        uuid.UUID   `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	OrderID   uuid.UUID   `gorm:"type:uuid;not null" json:"order_id"`
+	VariantID uuid.UUID   `gorm:"type:uuid;not null" json:"variant_id"`
+	Quantity  int         `gorm:"not null;check:quantity > 0" json:"quantity" validate:"min=1"`
+	UnitPrice money.Money `gorm:"column:unit_price_minor;type:bigint;not null;check:unit_price_minor >= 0" json:"unit_price"`
+	Currency  string      `gorm:"type:char(3);not null" json:"currency" validate:"required,len=3"`
+	Tax       money.Money `gorm:"column:tax_minor;type:bigint;not null;default:0;check:tax_minor >= 0" json:"tax"`
+	Discount  money.Money `gorm:"column:discount_minor;type:bigint;not null;default:0;check:discount_minor >= 0" json:"discount"`
+	LineTotal money.Money `gorm:"column:line_total_minor;type:bigint;not null;check:line_total_minor >= 0" json:"line_total"` // After discount, before exclusive tax
+	// UnitCost is the variant cost frozen at checkout for margin reporting, nil when unknown
+	UnitCost *money.Money `gorm:"column:unit_cost_minor;type:bigint;check:unit_cost_minor >= 0" json:"unit_cost"`
+	// Backordered is set while some units of the item wait for stock to arrive
+	Backordered bool `gorm:"not null;default:false" json:"backordered"`
 
 	// Relationships
-	Order   Order          `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"order,omitempty"`
-	Variant ProductVariant `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+	Order       Order                `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"order,omitempty"`
+	Variant     ProductVariant       `gorm:"foreignKey:VariantID" json:"variant,omitempty"`
+	Components  []OrderItemComponent `gorm:"foreignKey:OrderItemID;constraint:OnDelete:CASCADE" json:"components,omitempty"` // Bundle items only
+	Allocations []StockAllocation    `gorm:"foreignKey:OrderItemID;constraint:OnDelete:CASCADE" json:"allocations,omitempty"`
+	Backorders  []Backorder          `gorm:"foreignKey:OrderItemID;constraint:OnDelete:CASCADE" json:"backorders,omitempty"`
 }
 
 // Payment represents a payment for an order
@@ -54,7 +82,7 @@ type Payment struct {
 	OrderID     uuid.UUID     `gorm:"type:uuid;not null" json:"order_id"`
 	Provider    string        `gorm:"type:text;not null" json:"provider" validate:"required"`
 	Status      PaymentStatus `gorm:"type:payment_status;not null;default:'pending'" json:"status"`
-	AmountMinor int           `gorm:"not null;check:amount_minor >= 0" json:"amount_minor" validate:"min=0"`
+	Amount      money.Money   `gorm:"column:amount_minor;type:bigint;not null;check:amount_minor >= 0" json:"amount"`
 	Currency    string        `gorm:"type:char(3);not null" json:"currency" validate:"required,len=3"`
 	ExternalRef *string       `gorm:"type:text" json:"external_ref"` // Gateway payment_intent id
 	CreatedAt   time.Time     `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
@@ -71,7 +99,8 @@ type Refund struct {
 	OrderID     uuid.UUID    `gorm:"type:uuid;not null" json:"order_id"`
 	PaymentID   *uuid.UUID   `gorm:"type:uuid" json:"payment_id"`
 	Status      RefundStatus `gorm:"type:refund_status;not null;default:'pending'" json:"status"`
-	AmountMinor int          `gorm:"not null;check:amount_minor >= 0" json:"amount_minor" validate:"min=0"`
+	Amount      money.Money  `gorm:"column:amount_minor;type:bigint;not null;check:amount_minor >= 0" json:"amount"`
+	Currency    string       `gorm:"type:char(3);not null" json:"currency" validate:"required,len=3"`
 	Reason      *string      `gorm:"type:text" json:"reason"`
 	CreatedAt   time.Time    `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
 	ProcessedAt *time.Time   `gorm:"type:timestamptz" json:"processed_at"`
@@ -137,3 +166,35 @@ func (p *Payment) BeforeUpdate(tx *gorm.DB) error {
 	p.UpdatedAt = time.Now()
 	return nil
 }
+
+// AfterFind hooks stamping the row currency on the loaded amounts
+func (o *Order) AfterFind(tx *gorm.DB) error {
+	o.Subtotal = o.Subtotal.WithCurrency(o.Currency)
+	o.Discount = o.Discount.WithCurrency(o.Currency)
+	o.Shipping = o.Shipping.WithCurrency(o.Currency)
+	o.Tax = o.Tax.WithCurrency(o.Currency)
+	o.Total = o.Total.WithCurrency(o.Currency)
+	return nil
+}
+
+func (oi *OrderItem) AfterFind(tx *gorm.DB) error {
+	oi.UnitPrice = oi.UnitPrice.WithCurrency(oi.Currency)
+	oi.Tax = oi.Tax.WithCurrency(oi.Currency)
+	oi.Discount = oi.Discount.WithCurrency(oi.Currency)
+	oi.LineTotal = oi.LineTotal.WithCurrency(oi.Currency)
+	if oi.UnitCost != nil {
+		cost := oi.UnitCost.WithCurrency(oi.Currency)
+		oi.UnitCost = &cost
+	}
+	return nil
+}
+
+func (p *Payment) AfterFind(tx *gorm.DB) error {
+	p.Amount = p.Amount.WithCurrency(p.Currency)
+	return nil
+}
+
+func (r *Refund) AfterFind(tx *gorm.DB) error {
+	r.Amount = r.Amount.WithCurrency(r.Currency)
+	return nil
+}
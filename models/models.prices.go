@@ -0,0 +1,132 @@
+package models
+
+import (
+	"oms-services/money"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// VariantPrice is an entry of a variant's price list. A price applies to orders in its
+// currency, optionally restricted to a store or customer group and to a validity window.
+// The variant's own Price/Currency is the fallback when no entry matches.
+type VariantPrice struct {
+	ID            uuid.UUID   `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	VariantID     uuid.UUID   `gorm:"type:uuid;not null" json:"variant_id"`
+	Currency      string      `gorm:"type:char(3);not null" json:"currency" validate:"required,len=3"`
+	Amount        money.Money `gorm:"column:amount_minor;type:bigint;not null;check:amount_minor >= 0" json:"amount"`
+	Store         *string     `gorm:"type:text" json:"store"`          // nil applies to every store
+	CustomerGroup *string     `gorm:"type:text" json:"customer_group"` // nil applies to every customer
+	StartsAt      *time.Time  `gorm:"type:timestamptz" json:"starts_at"`
+	EndsAt        *time.Time  `gorm:"type:timestamptz" json:"ends_at"` // Exclusive
+	CreatedAt     time.Time   `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt     time.Time   `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+
+	// Relationships
+	Variant ProductVariant `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// ScheduledPrice is a sale planned on a variant's base price. The price scheduler
+// swaps the variant price for SalePrice when the sale starts, keeping the regular
+// price as compare-at price, and restores it when the sale ends.
+type ScheduledPrice struct {
+	ID           uuid.UUID            `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	VariantID    uuid.UUID            `gorm:"type:uuid;not null" json:"variant_id"`
+	Currency     string               `gorm:"type:char(3);not null" json:"currency"` // Always the variant currency
+	SalePrice    money.Money          `gorm:"column:sale_price_minor;type:bigint;not null;check:sale_price_minor >= 0" json:"sale_price"`
+	RegularPrice *money.Money         `gorm:"column:regular_price_minor;type:bigint" json:"regular_price"` // Variant price replaced by the sale, set on activation
+	StartsAt     time.Time            `gorm:"type:timestamptz;not null" json:"starts_at"`
+	EndsAt       *time.Time           `gorm:"type:timestamptz" json:"ends_at"` // nil keeps the sale price until cancelled
+	Status       ScheduledPriceStatus `gorm:"type:scheduled_price_status;not null;default:'scheduled'" json:"status"`
+	ActivatedAt  *time.Time           `gorm:"type:timestamptz" json:"activated_at"`
+	EndedAt      *time.Time           `gorm:"type:timestamptz" json:"ended_at"`
+	CreatedAt    time.Time            `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt    time.Time            `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+
+	// Relationships
+	Variant ProductVariant `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+// VariantPriceHistory records every base price a variant had and every entry of its
+// price list, so the price of a SKU in a currency at any date can be audited against
+// order item snapshots
+type VariantPriceHistory struct {
+	ID               uuid.UUID    `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	VariantID        uuid.UUID    `gorm:"type:uuid;not null" json:"variant_id"`
+	Currency         string       `gorm:"type:char(3);not null" json:"currency"`
+	Price            money.Money  `gorm:"column:price_minor;type:bigint;not null" json:"price"`
+	CompareAtPrice   *money.Money `gorm:"column:compare_at_price_minor;type:bigint" json:"compare_at_price"`
+	Reason           string       `gorm:"type:text;not null" json:"reason"`
+	ScheduledPriceID *uuid.UUID   `gorm:"type:uuid" json:"scheduled_price_id"`
+	EffectiveFrom    time.Time    `gorm:"type:timestamptz;not null" json:"effective_from"`
+	CreatedAt        time.Time    `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	// Price list entries are recorded with their restrictions, nil for the base price
+	VariantPriceID *uuid.UUID `gorm:"type:uuid" json:"variant_price_id"`
+	Store          *string    `gorm:"type:text" json:"store"`
+	CustomerGroup  *string    `gorm:"type:text" json:"customer_group"`
+	StartsAt       *time.Time `gorm:"type:timestamptz" json:"starts_at"`
+	EndsAt         *time.Time `gorm:"type:timestamptz" json:"ends_at"`
+	RemovedAt      *time.Time `gorm:"type:timestamptz" json:"removed_at"` // When the entry left the price list
+
+	// Relationships
+	Variant ProductVariant `gorm:"foreignKey:VariantID;constraint:OnDelete:CASCADE" json:"-"`
+}
+
+func (vp *VariantPrice) BeforeCreate(tx *gorm.DB) error {
+	if vp.ID == uuid.Nil {
+		vp.ID = uuid.New()
+	}
+	return nil
+}
+
+func (vp *VariantPrice) BeforeUpdate(tx *gorm.DB) error {
+	vp.UpdatedAt = time.Now()
+	return nil
+}
+
+// AfterFind stamps the entry currency on its amount
+func (vp *VariantPrice) AfterFind(tx *gorm.DB) error {
+	vp.Amount = vp.Amount.WithCurrency(vp.Currency)
+	return nil
+}
+
+func (sp *ScheduledPrice) BeforeCreate(tx *gorm.DB) error {
+	if sp.ID == uuid.Nil {
+		sp.ID = uuid.New()
+	}
+	return nil
+}
+
+func (sp *ScheduledPrice) BeforeUpdate(tx *gorm.DB) error {
+	sp.UpdatedAt = time.Now()
+	return nil
+}
+
+func (sp *ScheduledPrice) AfterFind(tx *gorm.DB) error {
+	sp.SalePrice = sp.SalePrice.WithCurrency(sp.Currency)
+	if sp.RegularPrice != nil {
+		regular := sp.RegularPrice.WithCurrency(sp.Currency)
+		sp.RegularPrice = &regular
+	}
+	return nil
+}
+
+func (ph *VariantPriceHistory) BeforeCreate(tx *gorm.DB) error {
+	if ph.ID == uuid.Nil {
+		ph.ID = uuid.New()
+	}
+	if ph.EffectiveFrom.IsZero() {
+		ph.EffectiveFrom = time.Now()
+	}
+	return nil
+}
+
+func (ph *VariantPriceHistory) AfterFind(tx *gorm.DB) error {
+	ph.Price = ph.Price.WithCurrency(ph.Currency)
+	if ph.CompareAtPrice != nil {
+		compareAt := ph.CompareAtPrice.WithCurrency(ph.Currency)
+		ph.CompareAtPrice = &compareAt
+	}
+	return nil
+}
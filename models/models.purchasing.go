@@ -0,0 +1,112 @@
+package models
+
+import (
+	"oms-services/money"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Supplier is a vendor the stock is bought from
+type Supplier struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Code         string    `gorm:"type:text;uniqueIndex;not null" json:"code" validate:"required"`
+	Name         string    `gorm:"type:text;not null" json:"name" validate:"required"`
+	Email        *string   `gorm:"type:text" json:"email"`
+	Phone        *string   `gorm:"type:text" json:"phone"`
+	Currency     string    `gorm:"type:char(3);not null" json:"currency" validate:"required,len=3"` // Purchase orders default to it
+	LeadTimeDays *int      `gorm:"check:lead_time_days >= 0" json:"lead_time_days"`
+	Notes        *string   `gorm:"type:text" json:"notes"`
+	IsActive     bool      `gorm:"not null;default:true" json:"is_active"` // Inactive suppliers take no new purchase orders
+	CreatedAt    time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+}
+
+// PurchaseOrder is stock ordered from a supplier, to be received at a location. Lines are
+// edited while it is a draft, stock is received once it was sent.
+type PurchaseOrder struct {
+	ID          uuid.UUID           `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	SupplierID  uuid.UUID           `gorm:"type:uuid;not null" json:"supplier_id"`
+	LocationID  uuid.UUID           `gorm:"type:uuid;not null" json:"location_id"` // Where the stock is delivered by default
+	Status      PurchaseOrderStatus `gorm:"type:purchase_order_status;not null;default:'draft'" json:"status"`
+	Currency    string              `gorm:"type:char(3);not null" json:"currency" validate:"required,len=3"`
+	Total       money.Money         `gorm:"column:total_minor;type:bigint;not null;default:0;check:total_minor >= 0" json:"total"` // Sum of the lines ordered cost
+	SupplierRef *string             `gorm:"type:text" json:"supplier_ref"`                                                         // The supplier's order or invoice number
+	ExpectedAt  *time.Time          `gorm:"type:timestamptz" json:"expected_at"`
+	Notes       *string             `gorm:"type:text" json:"notes"`
+	SentAt      *time.Time          `gorm:"type:timestamptz" json:"sent_at"`
+	ReceivedAt  *time.Time          `gorm:"type:timestamptz" json:"received_at"` // When the last line was received in full
+	ClosedAt    *time.Time          `gorm:"type:timestamptz" json:"closed_at"`
+	CreatedAt   time.Time           `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt   time.Time           `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+
+	// Relationships
+	Supplier *Supplier           `gorm:"foreignKey:SupplierID;constraint:OnDelete:RESTRICT" json:"supplier,omitempty"`
+	Location *Location           `gorm:"foreignKey:LocationID;constraint:OnDelete:RESTRICT" json:"location,omitempty"`
+	Lines    []PurchaseOrderLine `gorm:"foreignKey:PurchaseOrderID;constraint:OnDelete:CASCADE" json:"lines,omitempty"`
+}
+
+// PurchaseOrderLine is a variant ordered on a purchase order at a unit cost
+type PurchaseOrderLine struct {
+	ID              uuid.UUID   `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	PurchaseOrderID uuid.UUID   `gorm:"type:uuid;not null;uniqueIndex:idx_purchase_order_lines_variant" json:"purchase_order_id"`
+	VariantID       uuid.UUID   `gorm:"type:uuid;not null;uniqueIndex:idx_purchase_order_lines_variant" json:"variant_id"`
+	QtyOrdered      int         `gorm:"not null;check:qty_ordered > 0" json:"qty_ordered"`
+	QtyReceived     int         `gorm:"not null;default:0;check:qty_received >= 0" json:"qty_received"`
+	UnitCost        money.Money `gorm:"column:unit_cost_minor;type:bigint;not null;check:unit_cost_minor >= 0" json:"unit_cost"`
+	Currency        string      `gorm:"type:char(3);not null" json:"currency"` // The purchase order currency
+	CreatedAt       time.Time   `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt       time.Time   `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+
+	// Relationships
+	Variant *ProductVariant `gorm:"foreignKey:VariantID;constraint:OnDelete:RESTRICT" json:"variant,omitempty"`
+}
+
+func (s *Supplier) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+func (s *Supplier) BeforeUpdate(tx *gorm.DB) error {
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+func (po *PurchaseOrder) BeforeCreate(tx *gorm.DB) error {
+	if po.ID == uuid.Nil {
+		po.ID = uuid.New()
+	}
+	return nil
+}
+
+func (po *PurchaseOrder) BeforeUpdate(tx *gorm.DB) error {
+	po.UpdatedAt = time.Now()
+	return nil
+}
+
+func (pl *PurchaseOrderLine) BeforeCreate(tx *gorm.DB) error {
+	if pl.ID == uuid.Nil {
+		pl.ID = uuid.New()
+	}
+	return nil
+}
+
+func (pl *PurchaseOrderLine) BeforeUpdate(tx *gorm.DB) error {
+	pl.UpdatedAt = time.Now()
+	return nil
+}
+
+// AfterFind stamps the purchase order currency on its total
+func (po *PurchaseOrder) AfterFind(tx *gorm.DB) error {
+	po.Total = po.Total.WithCurrency(po.Currency)
+	return nil
+}
+
+// AfterFind stamps the line currency on its unit cost
+func (pl *PurchaseOrderLine) AfterFind(tx *gorm.DB) error {
+	pl.UnitCost = pl.UnitCost.WithCurrency(pl.Currency)
+	return nil
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"oms-services/money"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Shipment is a parcel of an order leaving a location. Orders stocked at several
+// locations ship in one shipment per location.
+type Shipment struct {
+	ID         uuid.UUID      `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	OrderID    uuid.UUID      `gorm:"type:uuid;not null" json:"order_id"`
+	LocationID uuid.UUID      `gorm:"type:uuid;not null" json:"location_id"`
+	Status     ShipmentStatus `gorm:"type:shipment_status;not null;default:'pending'" json:"status"`
+	PackedAt   *time.Time     `gorm:"type:timestamptz" json:"packed_at"`
+	// Shipping label bought from the carrier when the shipment is created
+	Carrier        *string      `gorm:"type:text" json:"carrier"`
+	Service        *string      `gorm:"type:text" json:"service"`
+	TrackingNumber *string      `gorm:"type:text;index" json:"tracking_number"`
+	LabelKey       *string      `gorm:"type:text" json:"-"` // Storage key of the label PDF
+	LabelURL       *string      `gorm:"type:text" json:"label_url"`
+	LabelCost      *money.Money `gorm:"column:label_cost_minor;type:bigint;check:label_cost_minor >= 0" json:"label_cost"`
+	LabelCurrency  *string      `gorm:"type:char(3)" json:"label_currency"`
+	// Carrier tracking
+	ShippedAt   *time.Time `gorm:"type:timestamptz" json:"shipped_at"` // Handed over to the carrier
+	DeliveredAt *time.Time `gorm:"type:timestamptz" json:"delivered_at"`
+	TrackedAt   *time.Time `gorm:"type:timestamptz" json:"tracked_at"` // Last tracking update, polled oldest first
+	CreatedAt   time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+
+	// Relationships
+	Location    *Location            `gorm:"foreignKey:LocationID;constraint:OnDelete:RESTRICT" json:"location,omitempty"`
+	Items       []ShipmentItem       `gorm:"foreignKey:ShipmentID;constraint:OnDelete:CASCADE" json:"items,omitempty"`
+	Checkpoints []TrackingCheckpoint `gorm:"foreignKey:ShipmentID;constraint:OnDelete:CASCADE" json:"checkpoints,omitempty"`
+}
+
+// ShipmentItem is a stock allocation of an order packed in a shipment
+type ShipmentItem struct {
+	ID           uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ShipmentID   uuid.UUID `gorm:"type:uuid;not null" json:"shipment_id"`
+	AllocationID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex" json:"allocation_id"` // Allocations ship once
+	OrderItemID  uuid.UUID `gorm:"type:uuid;not null" json:"order_item_id"`
+	VariantID    uuid.UUID `gorm:"type:uuid;not null" json:"variant_id"` // The item variant, or a component of a bundle item
+	Quantity     int       `gorm:"not null;check:quantity > 0" json:"quantity"`
+	CreatedAt    time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+
+	// Relationships
+	Allocation StockAllocation `gorm:"foreignKey:AllocationID;constraint:OnDelete:CASCADE" json:"-"`
+	Variant    *ProductVariant `gorm:"foreignKey:VariantID;constraint:OnDelete:RESTRICT" json:"variant,omitempty"`
+}
+
+// TrackingCheckpoint is an event the carrier reported on a shipment. Carriers report the
+// same events again, so an event is stored once per code and time.
+type TrackingCheckpoint struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ShipmentID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_tracking_checkpoints_event" json:"shipment_id"`
+	Code        string    `gorm:"type:text;not null;uniqueIndex:idx_tracking_checkpoints_event" json:"code"` // Carrier event code
+	Status      string    `gorm:"type:text;not null" json:"status"`                                          // Carrier status, e.g. in_transit
+	Description string    `gorm:"type:text;not null;default:''" json:"description"`
+	Location    *string   `gorm:"type:text" json:"location"`
+	OccurredAt  time.Time `gorm:"type:timestamptz;not null;uniqueIndex:idx_tracking_checkpoints_event" json:"occurred_at"`
+	CreatedAt   time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+}
+
+func (s *Shipment) BeforeCreate(tx *gorm.DB) error {
+	if s.ID == uuid.Nil {
+		s.ID = uuid.New()
+	}
+	return nil
+}
+
+func (s *Shipment) BeforeUpdate(tx *gorm.DB) error {
+	s.UpdatedAt = time.Now()
+	return nil
+}
+
+// AfterFind stamps the label currency on its cost
+func (s *Shipment) AfterFind(tx *gorm.DB) error {
+	if s.LabelCost != nil && s.LabelCurrency != nil {
+		cost := s.LabelCost.WithCurrency(*s.LabelCurrency)
+		s.LabelCost = &cost
+	}
+	return nil
+}
+
+func (si *ShipmentItem) BeforeCreate(tx *gorm.DB) error {
+	if si.ID == uuid.Nil {
+		si.ID = uuid.New()
+	}
+	return nil
+}
+
+func (tc *TrackingCheckpoint) BeforeCreate(tx *gorm.DB) error {
+	if tc.ID == uuid.Nil {
+		tc.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"oms-services/money"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ShippingMethod is a way of shipping an order with its pricing rule
+type ShippingMethod struct {
+	ID        uuid.UUID        `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Name      string           `gorm:"type:text;not null" json:"name" validate:"required"`
+	Type      ShippingRateType `gorm:"type:shipping_rate_type;not null" json:"type" validate:"required"`
+	Currency  string           `gorm:"type:char(3);not null" json:"currency" validate:"required,len=3"`
+	Rate      money.Money      `gorm:"column:rate_minor;type:bigint;not null;default:0;check:rate_minor >= 0" json:"rate"` // Flat rate, or the rate below the free threshold
+	FreeOver  *money.Money     `gorm:"column:free_over_minor;type:bigint;check:free_over_minor >= 0" json:"free_over"`     // Discounted subtotal from which shipping is free
+	Countries StringList       `gorm:"type:jsonb;not null;default:'[]'" json:"countries"`                                  // ISO-3166 alpha-2 destinations, empty ships everywhere
+	IsActive  bool             `gorm:"not null;default:true" json:"is_active"`
+	CreatedAt time.Time        `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt time.Time        `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+
+	// Relationships
+	Tiers []ShippingRateTier `gorm:"foreignKey:ShippingMethodID;constraint:OnDelete:CASCADE" json:"tiers,omitempty"`
+}
+
+// ShippingRateTier is a weight bracket of a weight based shipping method
+type ShippingRateTier struct {
+	ID               uuid.UUID   `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	ShippingMethodID uuid.UUID   `gorm:"type:uuid;not null" json:"shipping_method_id"`
+	MinWeightGrams   int         `gorm:"not null;default:0;check:min_weight_grams >= 0" json:"min_weight_grams" validate:"min=0"`
+	MaxWeightGrams   *int        `gorm:"check:max_weight_grams >= 0" json:"max_weight_grams"`                      // Inclusive, nil for no upper bound
+	Rate             money.Money `gorm:"column:rate_minor;type:bigint;not null;check:rate_minor >= 0" json:"rate"` // In the method currency
+}
+
+// StringList is a list of strings stored as a jsonb array
+type StringList []string
+
+// Contains reports whether the list holds the value
+func (l StringList) Contains(value string) bool {
+	for _, v := range l {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Value stores the list as jsonb
+func (l StringList) Value() (driver.Value, error) {
+	if l == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(l)
+}
+
+// Scan loads the list from a jsonb column
+func (l *StringList) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, l)
+	case string:
+		return json.Unmarshal([]byte(v), l)
+	case nil:
+		*l = nil
+		return nil
+	}
+	return errors.New("unsupported type for StringList")
+}
+
+func (sm *ShippingMethod) BeforeCreate(tx *gorm.DB) error {
+	if sm.ID == uuid.Nil {
+		sm.ID = uuid.New()
+	}
+	return nil
+}
+
+func (st *ShippingRateTier) BeforeCreate(tx *gorm.DB) error {
+	if st.ID == uuid.Nil {
+		st.ID = uuid.New()
+	}
+	return nil
+}
+
+// AfterFind stamps the method currency on its rates, including preloaded tiers
+func (sm *ShippingMethod) AfterFind(tx *gorm.DB) error {
+	sm.Rate = sm.Rate.WithCurrency(sm.Currency)
+	if sm.FreeOver != nil {
+		freeOver := sm.FreeOver.WithCurrency(sm.Currency)
+		sm.FreeOver = &freeOver
+	}
+	for i := range sm.Tiers {
+		sm.Tiers[i].Rate = sm.Tiers[i].Rate.WithCurrency(sm.Currency)
+	}
+	return nil
+}
+
+func (sm *ShippingMethod) BeforeUpdate(tx *gorm.DB) error {
+	sm.UpdatedAt = time.Now()
+	return nil
+}
@@ -0,0 +1,89 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// StockMovement is an entry of the append-only stock ledger. Every change to an
+// inventory row is recorded with its deltas, so replaying the movements of a variant
+// gives back its quantities on hand and reserved.
+type StockMovement struct {
+	ID               uuid.UUID  `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	VariantID        uuid.UUID  `gorm:"type:uuid;not null" json:"variant_id"`
+	LocationID       uuid.UUID  `gorm:"type:uuid;not null" json:"location_id"`
+	QtyOnHandDelta   int        `gorm:"not null;default:0" json:"qty_on_hand_delta"`
+	QtyReservedDelta int        `gorm:"not null;default:0" json:"qty_reserved_delta"`
+	Reason           string     `gorm:"type:text;not null" json:"reason"`
+	ReferenceType    *string    `gorm:"type:text" json:"reference_type"` // order, return, adjustment...
+	ReferenceID      *uuid.UUID `gorm:"type:uuid" json:"reference_id"`
+	Actor            *string    `gorm:"type:text" json:"actor"` // nil for changes made by the system
+	Note             *string    `gorm:"type:text" json:"note"`
+	CreatedAt        time.Time  `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+
+	// Relationships
+	Variant  ProductVariant `gorm:"foreignKey:VariantID;constraint:OnDelete:RESTRICT" json:"-"`
+	Location Location       `gorm:"foreignKey:LocationID;constraint:OnDelete:RESTRICT" json:"-"`
+}
+
+// StockAllocation records, at checkout, the location an order item ships from. Items
+// split across locations get one allocation per location, bundle items one per
+// component variant.
+type StockAllocation struct {
+	ID          uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	OrderID     uuid.UUID `gorm:"type:uuid;not null" json:"order_id"`
+	OrderItemID uuid.UUID `gorm:"type:uuid;not null" json:"order_item_id"`
+	VariantID   uuid.UUID `gorm:"type:uuid;not null" json:"variant_id"` // The item variant, or a component of a bundle item
+	LocationID  uuid.UUID `gorm:"type:uuid;not null" json:"location_id"`
+	Quantity    int       `gorm:"not null;check:quantity > 0" json:"quantity"`
+	CreatedAt   time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+
+	// Relationships
+	Order    Order          `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"-"`
+	Variant  ProductVariant `gorm:"foreignKey:VariantID;constraint:OnDelete:RESTRICT" json:"-"`
+	Location *Location      `gorm:"foreignKey:LocationID;constraint:OnDelete:RESTRICT" json:"location,omitempty"`
+}
+
+// Backorder is a quantity of an order item sold while out of stock, waiting for incoming
+// stock. Stock received at a location is allocated to the open backorders of the variant
+// oldest first.
+type Backorder struct {
+	ID           uuid.UUID       `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	OrderID      uuid.UUID       `gorm:"type:uuid;not null" json:"order_id"`
+	OrderItemID  uuid.UUID       `gorm:"type:uuid;not null" json:"order_item_id"`
+	VariantID    uuid.UUID       `gorm:"type:uuid;not null" json:"variant_id"` // The item variant, or a component of a bundle item
+	Quantity     int             `gorm:"not null;check:quantity > 0" json:"quantity"`
+	QtyAllocated int             `gorm:"not null;default:0;check:qty_allocated >= 0 AND qty_allocated <= quantity" json:"qty_allocated"`
+	Policy       InventoryPolicy `gorm:"type:inventory_policy;not null" json:"policy"` // backorder or preorder, as sold
+	ExpectedAt   *time.Time      `gorm:"type:timestamptz" json:"expected_at"`          // Pre-orders only
+	CreatedAt    time.Time       `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	FulfilledAt  *time.Time      `gorm:"type:timestamptz" json:"fulfilled_at"`
+	CancelledAt  *time.Time      `gorm:"type:timestamptz" json:"cancelled_at"`
+
+	// Relationships
+	Order   Order          `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"-"`
+	Variant ProductVariant `gorm:"foreignKey:VariantID;constraint:OnDelete:RESTRICT" json:"-"`
+}
+
+func (sm *StockMovement) BeforeCreate(tx *gorm.DB) error {
+	if sm.ID == uuid.Nil {
+		sm.ID = uuid.New()
+	}
+	return nil
+}
+
+func (sa *StockAllocation) BeforeCreate(tx *gorm.DB) error {
+	if sa.ID == uuid.Nil {
+		sa.ID = uuid.New()
+	}
+	return nil
+}
+
+func (b *Backorder) BeforeCreate(tx *gorm.DB) error {
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"oms-services/money"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// DefaultTaxClass is the tax class of products that don't declare one
+const DefaultTaxClass = "standard"
+
+// TaxRate is a tax rule for a country (optionally narrowed to a region) and product tax class
+type TaxRate struct {
+	ID              uuid.UUID `gorm:"type:uuid;primary_key;default:uuid_generate_v4()" json:"id"`
+	Name            string    `gorm:"type:text;not null" json:"name" validate:"required"` // e.g. "VAT"
+	Country         string    `gorm:"type:char(2);not null" json:"country" validate:"required,len=2"`
+	Region          *string   `gorm:"type:text" json:"region"` // nil applies to the whole country
+	TaxClass        string    `gorm:"type:text;not null;default:'standard'" json:"tax_class"`
+	RateBasisPoints int       `gorm:"not null;check:rate_basis_points >= 0" json:"rate_basis_points" validate:"min=0"` // 1400 = 14%
+	IsInclusive     bool      `gorm:"not null;default:false" json:"is_inclusive"`                                      // Prices already include the tax
+	IsActive        bool      `gorm:"not null;default:true" json:"is_active"`
+	CreatedAt       time.Time `gorm:"type:timestamptz;not null;default:now()" json:"created_at"`
+	UpdatedAt       time.Time `gorm:"type:timestamptz;not null;default:now()" json:"updated_at"`
+}
+
+// TaxBreakdownLine is the tax collected on an order for a single tax rate
+type TaxBreakdownLine struct {
+	TaxRateID       uuid.UUID   `json:"tax_rate_id"`
+	Name            string      `json:"name"`
+	TaxClass        string      `json:"tax_class"`
+	RateBasisPoints int         `json:"rate_basis_points"`
+	IsInclusive     bool        `json:"is_inclusive"`
+	Taxable         money.Money `json:"taxable"`
+	Tax             money.Money `json:"tax"`
+}
+
+// TaxBreakdown is the order-level tax summary stored as jsonb
+type TaxBreakdown []TaxBreakdownLine
+
+// Value stores the breakdown as jsonb
+func (b TaxBreakdown) Value() (driver.Value, error) {
+	if b == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(b)
+}
+
+// Scan loads the breakdown from a jsonb column
+func (b *TaxBreakdown) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case []byte:
+		return json.Unmarshal(v, b)
+	case string:
+		return json.Unmarshal([]byte(v), b)
+	case nil:
+		*b = nil
+		return nil
+	}
+	return errors.New("unsupported type for TaxBreakdown")
+}
+
+func (t *TaxRate) BeforeCreate(tx *gorm.DB) error {
+	if t.ID == uuid.Nil {
+		t.ID = uuid.New()
+	}
+	return nil
+}
+
+func (t *TaxRate) BeforeUpdate(tx *gorm.DB) error {
+	t.UpdatedAt = time.Now()
+	return nil
+}
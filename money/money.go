@@ -0,0 +1,314 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrInvalidWeights   = errors.New("allocation weights must be positive")
+	ErrInvalidAmount    = errors.New("invalid amount")
+)
+
+// Money is an amount in the minor units of a currency (cents, piastres, fils...).
+// In the database only the amount is stored, the currency comes from the
+// currency column of the row and is set back by the models after loading.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// New returns an amount of minor units in the currency
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+// Zero returns no money in the currency
+func Zero(currency string) Money {
+	return New(0, currency)
+}
+
+// WithCurrency returns the same amount in the given currency, used to stamp
+// amounts loaded from the database
+func (m Money) WithCurrency(currency string) Money {
+	return New(m.Amount, currency)
+}
+
+func (m Money) sameCurrency(other Money) error {
+	if m.Currency != other.Currency {
+		return fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, other.Currency)
+	}
+	return nil
+}
+
+// Add returns m + other
+func (m Money) Add(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount + other.Amount, Currency: m.Currency}, nil
+}
+
+// Sub returns m - other
+func (m Money) Sub(other Money) (Money, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount - other.Amount, Currency: m.Currency}, nil
+}
+
+// Mul returns m * n, e.g. a unit price times a quantity
+func (m Money) Mul(n int64) Money {
+	return Money{Amount: m.Amount * n, Currency: m.Currency}
+}
+
+// MulRate returns m * basisPoints / 10000 rounded half away from zero
+// (1400 basis points = 14%)
+func (m Money) MulRate(basisPoints int64) Money {
+	return m.MulFraction(basisPoints, 10000)
+}
+
+// MulFraction returns m * numerator / denominator rounded half away from zero
+func (m Money) MulFraction(numerator, denominator int64) Money {
+	return Money{Amount: divRound(m.Amount*numerator, denominator), Currency: m.Currency}
+}
+
+// Cmp compares two amounts of the same currency, returning -1, 0 or 1
+func (m Money) Cmp(other Money) (int, error) {
+	if err := m.sameCurrency(other); err != nil {
+		return 0, err
+	}
+	switch {
+	case m.Amount < other.Amount:
+		return -1, nil
+	case m.Amount > other.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Min returns the smallest of two amounts of the same currency
+func (m Money) Min(other Money) (Money, error) {
+	cmp, err := m.Cmp(other)
+	if err != nil {
+		return Money{}, err
+	}
+	if cmp > 0 {
+		return other, nil
+	}
+	return m, nil
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Allocate splits the amount proportionally to the weights using the largest
+// remainder method, so the parts always add up to the amount. Used to spread
+// discounts over lines and partial refunds over payments.
+func (m Money) Allocate(weights []int64) ([]Money, error) {
+	parts := make([]Money, len(weights))
+	var total int64
+	for i, w := range weights {
+		if w < 0 {
+			return nil, ErrInvalidWeights
+		}
+		total += w
+		parts[i] = Zero(m.Currency)
+	}
+	if m.Amount == 0 || len(weights) == 0 {
+		return parts, nil
+	}
+	if total == 0 {
+		return nil, ErrInvalidWeights
+	}
+
+	sign := int64(1)
+	amount := m.Amount
+	if amount < 0 {
+		sign, amount = -1, -amount
+	}
+
+	var allocated int64
+	remainders := make([]int64, len(weights))
+	for i, w := range weights {
+		parts[i].Amount = amount * w / total
+		remainders[i] = amount * w % total
+		allocated += parts[i].Amount
+	}
+
+	for ; allocated < amount; allocated++ {
+		largest := 0
+		for i := range remainders {
+			if remainders[i] > remainders[largest] {
+				largest = i
+			}
+		}
+		parts[largest].Amount++
+		remainders[largest] = -1
+	}
+
+	for i := range parts {
+		parts[i].Amount *= sign
+	}
+	return parts, nil
+}
+
+// Sum adds up amounts of the given currency
+func Sum(currency string, amounts ...Money) (Money, error) {
+	total := Zero(currency)
+	for _, amount := range amounts {
+		var err error
+		if total, err = total.Add(amount); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// Format renders the amount in major units, e.g. "12.50 EGP", "1250 JPY", "1.250 KWD"
+func (m Money) Format() (string, error) {
+	exponent, err := Exponent(m.Currency)
+	if err != nil {
+		return "", err
+	}
+
+	sign := ""
+	amount := m.Amount
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	if exponent == 0 {
+		return fmt.Sprintf("%s%d %s", sign, amount, m.Currency), nil
+	}
+
+	scale := pow10(exponent)
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/scale, exponent, amount%scale, m.Currency), nil
+}
+
+// String renders the amount for logs, falling back to minor units for unknown currencies
+func (m Money) String() string {
+	formatted, err := m.Format()
+	if err != nil {
+		return fmt.Sprintf("%d %s", m.Amount, m.Currency)
+	}
+	return formatted
+}
+
+// ParseMajor reads an amount written in major units ("12.5") into minor units,
+// rejecting more decimals than the currency has
+func ParseMajor(value, currency string) (Money, error) {
+	exponent, err := Exponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	value = strings.TrimSpace(value)
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+
+	whole, fraction, hasPoint := strings.Cut(value, ".")
+	if !isDigits(whole) || (hasPoint && !isDigits(fraction)) {
+		return Money{}, ErrInvalidAmount
+	}
+	if len(fraction) > exponent {
+		return Money{}, fmt.Errorf("%s has at most %d decimals", strings.ToUpper(currency), exponent)
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, err
+	}
+	if negative {
+		amount = -amount
+	}
+	return New(amount, currency), nil
+}
+
+type moneyJSON struct {
+	AmountMinor int64  `json:"amount_minor"`
+	Currency    string `json:"currency"`
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{AmountMinor: m.Amount, Currency: m.Currency})
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var raw moneyJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = New(raw.AmountMinor, raw.Currency)
+	return nil
+}
+
+// Value stores the amount in the *_minor column
+func (m Money) Value() (driver.Value, error) {
+	return m.Amount, nil
+}
+
+// Scan loads the amount from the *_minor column, the currency has to be set by the model
+func (m *Money) Scan(value interface{}) error {
+	switch v := value.(type) {
+	case int64:
+		m.Amount = v
+	case int32:
+		m.Amount = int64(v)
+	case []byte:
+		amount, err := strconv.ParseInt(string(v), 10, 64)
+		if err != nil {
+			return err
+		}
+		m.Amount = amount
+	case string:
+		amount, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return err
+		}
+		m.Amount = amount
+	case nil:
+		m.Amount = 0
+	default:
+		return fmt.Errorf("unsupported type for Money: %T", value)
+	}
+	return nil
+}
+
+// isDigits reports whether the string is a non-empty run of ASCII digits
+func isDigits(value string) bool {
+	if value == "" {
+		return false
+	}
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func divRound(numerator, denominator int64) int64 {
+	if (numerator < 0) != (denominator < 0) {
+		return (numerator - denominator/2) / denominator
+	}
+	return (numerator + denominator/2) / denominator
+}
+
+func pow10(exponent int) int64 {
+	result := int64(1)
+	for i := 0; i < exponent; i++ {
+		result *= 10
+	}
+	return result
+}
@@ -0,0 +1,131 @@
+package money
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  int64
+		weights []int64
+		want    []int64
+		err     error
+	}{
+		{name: "even split", amount: 100, weights: []int64{1, 1, 1}, want: []int64{34, 33, 33}},
+		{name: "largest remainder", amount: 10, weights: []int64{1, 2}, want: []int64{3, 7}},
+		{name: "negative amount", amount: -100, weights: []int64{1, 1, 1}, want: []int64{-34, -33, -33}},
+		{name: "zero weight", amount: 5, weights: []int64{0, 1}, want: []int64{0, 5}},
+		{name: "zero amount", amount: 0, weights: []int64{1, 2}, want: []int64{0, 0}},
+		{name: "no weights", amount: 100, weights: []int64{}, want: []int64{}},
+		{name: "negative weight", amount: 100, weights: []int64{1, -1}, err: ErrInvalidWeights},
+		{name: "all weights zero", amount: 100, weights: []int64{0, 0}, err: ErrInvalidWeights},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parts, err := New(tt.amount, "EGP").Allocate(tt.weights)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Allocate() error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+
+			amounts := make([]int64, len(parts))
+			var total int64
+			for i, part := range parts {
+				if part.Currency != "EGP" {
+					t.Errorf("part %d currency = %q, want EGP", i, part.Currency)
+				}
+				amounts[i] = part.Amount
+				total += part.Amount
+			}
+			if !slices.Equal(amounts, tt.want) {
+				t.Errorf("Allocate() = %v, want %v", amounts, tt.want)
+			}
+			if len(parts) > 0 && total != tt.amount {
+				t.Errorf("parts add up to %d, want %d", total, tt.amount)
+			}
+		})
+	}
+}
+
+func TestMulRate(t *testing.T) {
+	tests := []struct {
+		name        string
+		amount      int64
+		basisPoints int64
+		want        int64
+	}{
+		{name: "exact", amount: 1000, basisPoints: 1400, want: 140},
+		{name: "rounds up", amount: 1005, basisPoints: 1400, want: 141},
+		{name: "rounds down", amount: 14, basisPoints: 1000, want: 1},
+		{name: "half away from zero", amount: 5, basisPoints: 1000, want: 1},
+		{name: "negative half away from zero", amount: -5, basisPoints: 1000, want: -1},
+		{name: "zero rate", amount: 1000, basisPoints: 0, want: 0},
+		{name: "full rate", amount: 1234, basisPoints: 10000, want: 1234},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := New(tt.amount, "EGP").MulRate(tt.basisPoints)
+			if got.Amount != tt.want || got.Currency != "EGP" {
+				t.Errorf("MulRate(%d) = %v, want %d EGP", tt.basisPoints, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMajor(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		want     int64
+		wantErr  bool
+		err      error
+	}{
+		{value: "12.5", currency: "EGP", want: 1250},
+		{value: "12", currency: "EGP", want: 1200},
+		{value: "0.01", currency: "EGP", want: 1},
+		{value: "-3.25", currency: "EGP", want: -325},
+		{value: " 7 ", currency: "egp", want: 700},
+		{value: "1250", currency: "JPY", want: 1250},
+		{value: "1.250", currency: "KWD", want: 1250},
+		{value: "1.5", currency: "JPY", wantErr: true},
+		{value: "12.345", currency: "EGP", wantErr: true},
+		{value: "", currency: "EGP", err: ErrInvalidAmount},
+		{value: "  ", currency: "EGP", err: ErrInvalidAmount},
+		{value: ".", currency: "EGP", err: ErrInvalidAmount},
+		{value: "-", currency: "EGP", err: ErrInvalidAmount},
+		{value: "--5", currency: "EGP", err: ErrInvalidAmount},
+		{value: "1.", currency: "EGP", err: ErrInvalidAmount},
+		{value: ".5", currency: "EGP", err: ErrInvalidAmount},
+		{value: "+5", currency: "EGP", err: ErrInvalidAmount},
+		{value: "1e3", currency: "EGP", err: ErrInvalidAmount},
+		{value: "12", currency: "XXX", err: ErrUnknownCurrency},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value+" "+tt.currency, func(t *testing.T) {
+			got, err := ParseMajor(tt.value, tt.currency)
+			if tt.err != nil || tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseMajor(%q, %q) = %v, want an error", tt.value, tt.currency, got)
+				}
+				if tt.err != nil && !errors.Is(err, tt.err) {
+					t.Fatalf("ParseMajor(%q, %q) error = %v, want %v", tt.value, tt.currency, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseMajor(%q, %q) error = %v", tt.value, tt.currency, err)
+			}
+			if got.Amount != tt.want {
+				t.Errorf("ParseMajor(%q, %q) = %d, want %d", tt.value, tt.currency, got.Amount, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package money
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var ErrInvalidRate = errors.New("rate must be a positive decimal")
+
+// rateDecimals is the precision rates are stored and rendered with, matching numeric(20,10)
+const rateDecimals = 10
+
+// Rate is an exact decimal exchange rate: one major unit of a base currency buys
+// Rate major units of a quote currency. It is kept as a fraction so conversions
+// only round once, on the converted amount.
+type Rate struct {
+	value *big.Rat
+}
+
+// ParseRate reads a decimal rate such as "48.9125"
+func ParseRate(value string) (Rate, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+	if !ok || r.Sign() <= 0 {
+		return Rate{}, fmt.Errorf("%w: %q", ErrInvalidRate, value)
+	}
+	return Rate{value: r}, nil
+}
+
+// IdentityRate converts a currency into itself
+func IdentityRate() Rate {
+	return Rate{value: big.NewRat(1, 1)}
+}
+
+func (r Rate) IsZero() bool {
+	return r.value == nil || r.value.Sign() == 0
+}
+
+// Inverse returns the rate of the opposite direction (EGP->USD from USD->EGP)
+func (r Rate) Inverse() Rate {
+	if r.IsZero() {
+		return Rate{}
+	}
+	return Rate{value: new(big.Rat).Inv(r.value)}
+}
+
+// String renders the rate with up to 10 decimals, without trailing zeros
+func (r Rate) String() string {
+	if r.value == nil {
+		return "0"
+	}
+	s := r.value.FloatString(rateDecimals)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	}
+	return s
+}
+
+// Convert expresses the amount in another currency, taking both currency exponents
+// into account (100 JPY minor units at 0.0067 USD/JPY is 67 USD minor units) and
+// rounding half away from zero
+func (m Money) Convert(currency string, rate Rate) (Money, error) {
+	if rate.IsZero() {
+		return Money{}, ErrInvalidRate
+	}
+	from, err := Exponent(m.Currency)
+	if err != nil {
+		return Money{}, err
+	}
+	to, err := Exponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	converted := new(big.Rat).Mul(new(big.Rat).SetInt64(m.Amount), rate.value)
+	scale := new(big.Rat).SetFrac(big.NewInt(pow10(to)), big.NewInt(pow10(from)))
+	converted.Mul(converted, scale)
+
+	return New(roundRat(converted), currency), nil
+}
+
+// roundRat rounds a fraction half away from zero
+func roundRat(r *big.Rat) int64 {
+	num, den := new(big.Int).Set(r.Num()), r.Denom()
+	negative := num.Sign() < 0
+	num.Abs(num)
+
+	quotient, remainder := new(big.Int).QuoRem(num, den, new(big.Int))
+	if remainder.Mul(remainder, big.NewInt(2)).Cmp(den) >= 0 {
+		quotient.Add(quotient, big.NewInt(1))
+	}
+	if negative {
+		quotient.Neg(quotient)
+	}
+	return quotient.Int64()
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// UnmarshalJSON accepts the rate as a string ("48.91") or a plain JSON number
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		raw = string(data)
+	}
+	rate, err := ParseRate(raw)
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
+
+// Value stores the rate in a numeric column
+func (r Rate) Value() (driver.Value, error) {
+	if r.value == nil {
+		return nil, nil
+	}
+	return r.value.FloatString(rateDecimals), nil
+}
+
+// Scan loads the rate from a numeric column
+func (r *Rate) Scan(value interface{}) error {
+	var raw string
+	switch v := value.(type) {
+	case []byte:
+		raw = string(v)
+	case string:
+		raw = v
+	case float64:
+		raw = fmt.Sprintf("%v", v)
+	case nil:
+		*r = Rate{}
+		return nil
+	default:
+		return fmt.Errorf("unsupported type for Rate: %T", value)
+	}
+	rate, err := ParseRate(raw)
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
@@ -0,0 +1,374 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"oms-services/models"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInventoryPolicy  = errors.New("inventory policy is invalid")
+	ErrBackorderLimit   = errors.New("backorder limit reached")
+	ErrOrderBackordered = errors.New("order has items waiting for stock")
+)
+
+// SetInventoryPolicy sets what checkout does when a variant runs out of stock. Pre-orders
+// need the date the stock is expected, the backorder limit is optional.
+func SetInventoryPolicy(db *gorm.DB, variantID uuid.UUID, policy models.InventoryPolicy, backorderLimit *int, expectedAt *time.Time) (*models.ProductVariant, error) {
+	switch {
+	case policy != models.InventoryPolicyDeny && policy != models.InventoryPolicyBackorder && policy != models.InventoryPolicyPreorder:
+		return nil, fmt.Errorf("%w: unknown policy %q", ErrInventoryPolicy, policy)
+	case policy == models.InventoryPolicyPreorder && expectedAt == nil:
+		return nil, fmt.Errorf("%w: pre-orders need preorder_expected_at", ErrInventoryPolicy)
+	case policy != models.InventoryPolicyPreorder && expectedAt != nil:
+		return nil, fmt.Errorf("%w: preorder_expected_at is for pre-orders only", ErrInventoryPolicy)
+	case backorderLimit != nil && *backorderLimit < 0:
+		return nil, fmt.Errorf("%w: backorder_limit can't be negative", ErrInventoryPolicy)
+	}
+
+	var variant *models.ProductVariant
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		variant, err = lockVariant(tx, variantID)
+		if err != nil {
+			return err
+		}
+		if isBundle, err := isBundleVariant(tx, variant); err != nil {
+			return err
+		} else if isBundle {
+			return ErrBundleInventory
+		}
+
+		return tx.Model(variant).Updates(map[string]interface{}{
+			"inventory_policy":     policy,
+			"backorder_limit":      backorderLimit,
+			"preorder_expected_at": expectedAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	variant.InventoryPolicy = policy
+	variant.BackorderLimit = backorderLimit
+	variant.PreorderExpectedAt = expectedAt
+	return variant, nil
+}
+
+// stockPolicies loads the SKU and inventory policy of the lines' variants
+func stockPolicies(tx *gorm.DB, lines []stockLine) (map[uuid.UUID]models.ProductVariant, error) {
+	policies := map[uuid.UUID]models.ProductVariant{}
+	if len(lines) == 0 {
+		return policies, nil
+	}
+
+	variantIDs := make([]uuid.UUID, len(lines))
+	for i, line := range lines {
+		variantIDs[i] = line.VariantID
+	}
+	var variants []models.ProductVariant
+	err := tx.Select("id", "sku", "inventory_policy", "backorder_limit", "preorder_expected_at").
+		Where("id IN ?", variantIDs).
+		Find(&variants).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, variant := range variants {
+		policies[variant.ID] = variant
+	}
+	return policies, nil
+}
+
+// splitShortfall takes the units the active locations don't hold off the lines of the
+// variants sold out of stock, last lines first, and returns them as backordered lines
+func splitShortfall(lines []stockLine, router *stockRouter, policies map[uuid.UUID]models.ProductVariant) ([]stockLine, []stockLine) {
+	demand := map[uuid.UUID]int{}
+	for _, line := range lines {
+		demand[line.VariantID] += line.Quantity
+	}
+	shortfall := map[uuid.UUID]int{}
+	for variantID, quantity := range demand {
+		if policies[variantID].InventoryPolicy != models.InventoryPolicyDeny {
+			shortfall[variantID] = max(quantity-router.availableAnywhere(variantID), 0)
+		}
+	}
+
+	var backordered []stockLine
+	for i := len(lines) - 1; i >= 0; i-- {
+		quantity := min(lines[i].Quantity, shortfall[lines[i].VariantID])
+		if quantity == 0 {
+			continue
+		}
+		backordered = append(backordered, stockLine{OrderItemID: lines[i].OrderItemID, VariantID: lines[i].VariantID, Quantity: quantity})
+		shortfall[lines[i].VariantID] -= quantity
+		lines[i].Quantity -= quantity
+	}
+	lines = slices.DeleteFunc(lines, func(line stockLine) bool { return line.Quantity == 0 })
+	return lines, backordered
+}
+
+// createBackorders records the backordered lines of an order and flags their items,
+// within the backorder limits of the variants
+func createBackorders(tx *gorm.DB, order *models.Order, lines []stockLine, policies map[uuid.UUID]models.ProductVariant) error {
+	type backorderKey struct {
+		OrderItemID uuid.UUID
+		VariantID   uuid.UUID
+	}
+	var keys []backorderKey
+	quantities := map[backorderKey]int{}
+	perVariant := map[uuid.UUID]int{}
+	for _, line := range lines {
+		key := backorderKey{line.OrderItemID, line.VariantID}
+		if _, ok := quantities[key]; !ok {
+			keys = append(keys, key)
+		}
+		quantities[key] += line.Quantity
+		perVariant[line.VariantID] += line.Quantity
+	}
+
+	for variantID, quantity := range perVariant {
+		variant := policies[variantID]
+		if variant.BackorderLimit == nil {
+			continue
+		}
+		var waiting int
+		err := tx.Model(&models.Backorder{}).
+			Select("COALESCE(SUM(quantity - qty_allocated), 0)").
+			Where("variant_id = ? AND fulfilled_at IS NULL AND cancelled_at IS NULL", variantID).
+			Scan(&waiting).Error
+		if err != nil {
+			return err
+		}
+		if waiting+quantity > *variant.BackorderLimit {
+			return fmt.Errorf("%w: %s", ErrBackorderLimit, variant.SKU)
+		}
+	}
+
+	for _, key := range keys {
+		variant := policies[key.VariantID]
+		backorder := models.Backorder{
+			OrderID:     order.ID,
+			OrderItemID: key.OrderItemID,
+			VariantID:   key.VariantID,
+			Quantity:    quantities[key],
+			Policy:      variant.InventoryPolicy,
+		}
+		if variant.InventoryPolicy == models.InventoryPolicyPreorder {
+			backorder.ExpectedAt = variant.PreorderExpectedAt
+		}
+		if err := tx.Create(&backorder).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.OrderItem{}).Where("id = ?", key.OrderItemID).Update("backordered", true).Error; err != nil {
+			return err
+		}
+		for i := range order.Items {
+			if order.Items[i].ID == key.OrderItemID {
+				order.Items[i].Backordered = true
+			}
+		}
+
+		if err := RecordOrderEvent(tx, order.ID, models.EventItemBackordered, map[string]interface{}{
+			"order_item_id": backorder.OrderItemID,
+			"variant_id":    backorder.VariantID,
+			"quantity":      backorder.Quantity,
+			"policy":        backorder.Policy,
+			"expected_at":   backorder.ExpectedAt,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fillBackorders allocates the units available at a locked inventory to the open
+// backorders of its variant, oldest first, reserving them for the waiting orders
+func fillBackorders(tx *gorm.DB, inventory *models.Inventory) error {
+	available := inventory.QtyOnHand - inventory.QtyReserved
+	if available <= 0 {
+		return nil
+	}
+	var location models.Location
+	if err := tx.Select("is_active").First(&location, inventory.LocationID).Error; err != nil {
+		return err
+	}
+	if !location.IsActive {
+		return nil
+	}
+
+	var backorders []models.Backorder
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("variant_id = ? AND fulfilled_at IS NULL AND cancelled_at IS NULL", inventory.VariantID).
+		Order("created_at, id").
+		Find(&backorders).Error
+	if err != nil {
+		return err
+	}
+
+	fills := backorderFills(backorders, available)
+	for i, backorder := range backorders {
+		quantity := fills[i]
+		if quantity == 0 {
+			continue
+		}
+
+		allocation := models.StockAllocation{
+			OrderID:     backorder.OrderID,
+			OrderItemID: backorder.OrderItemID,
+			VariantID:   backorder.VariantID,
+			LocationID:  inventory.LocationID,
+			Quantity:    quantity,
+		}
+		if err := tx.Create(&allocation).Error; err != nil {
+			return err
+		}
+		referenceType := models.ReferenceOrder
+		source := MovementSource{Reason: models.MovementReservation, ReferenceType: &referenceType, ReferenceID: &backorder.OrderID}
+		if err := moveStock(tx, inventory, 0, quantity, source); err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"qty_allocated": backorder.QtyAllocated + quantity}
+		if backorder.QtyAllocated+quantity == backorder.Quantity {
+			updates["fulfilled_at"] = time.Now()
+		}
+		if err := tx.Model(&backorder).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec(`UPDATE order_items SET backordered = false WHERE id = ? AND NOT EXISTS (
+			SELECT 1 FROM backorders WHERE order_item_id = ? AND fulfilled_at IS NULL AND cancelled_at IS NULL
+		)`, backorder.OrderItemID, backorder.OrderItemID).Error; err != nil {
+			return err
+		}
+
+		if err := RecordOrderEvent(tx, backorder.OrderID, models.EventBackorderAllocated, map[string]interface{}{
+			"order_item_id": backorder.OrderItemID,
+			"variant_id":    backorder.VariantID,
+			"location_id":   inventory.LocationID,
+			"quantity":      quantity,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backorderFills spreads the available units over backorders in order, returning the
+// units each of them gets. A backorder only gets units once the previous ones are filled.
+func backorderFills(backorders []models.Backorder, available int) []int {
+	fills := make([]int, len(backorders))
+	for i, backorder := range backorders {
+		fills[i] = max(min(backorder.Quantity-backorder.QtyAllocated, available), 0)
+		available -= fills[i]
+		if available <= 0 {
+			break
+		}
+	}
+	return fills
+}
+
+// backorderShortage moves the reservations a locked inventory no longer covers back to
+// backorder, taking the units from the most recent allocations first so the oldest
+// orders keep their stock. Units packed in a shipment stay allocated, the shortage they
+// would have to cover is refused.
+func backorderShortage(tx *gorm.DB, inventory *models.Inventory, shortage int) error {
+	var allocations []models.StockAllocation
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("variant_id = ? AND location_id = ?", inventory.VariantID, inventory.LocationID).
+		Where("order_id IN (SELECT id FROM orders WHERE status IN ?)", reservedOrderStatuses).
+		Where("NOT EXISTS (SELECT 1 FROM shipment_items WHERE shipment_items.allocation_id = stock_allocations.id)").
+		Order("created_at DESC, id DESC").
+		Find(&allocations).Error
+	if err != nil {
+		return err
+	}
+	taken, uncovered := shortAllocations(allocations, shortage)
+	if uncovered > 0 {
+		return ErrStockBelowReserved
+	}
+
+	for i, allocation := range allocations {
+		if taken[i] == 0 {
+			break
+		}
+
+		if taken[i] == allocation.Quantity {
+			err = tx.Delete(&allocation).Error
+		} else {
+			err = tx.Model(&allocation).Update("quantity", allocation.Quantity-taken[i]).Error
+		}
+		if err != nil {
+			return err
+		}
+		referenceType := models.ReferenceOrder
+		source := MovementSource{Reason: models.MovementRelease, ReferenceType: &referenceType, ReferenceID: &allocation.OrderID}
+		if err := moveStock(tx, inventory, 0, -taken[i], source); err != nil {
+			return err
+		}
+
+		backorder := models.Backorder{
+			OrderID:     allocation.OrderID,
+			OrderItemID: allocation.OrderItemID,
+			VariantID:   allocation.VariantID,
+			Quantity:    taken[i],
+			Policy:      models.InventoryPolicyBackorder,
+		}
+		if err := tx.Create(&backorder).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.OrderItem{}).Where("id = ?", allocation.OrderItemID).Update("backordered", true).Error; err != nil {
+			return err
+		}
+
+		if err := RecordOrderEvent(tx, allocation.OrderID, models.EventItemBackordered, map[string]interface{}{
+			"order_item_id": backorder.OrderItemID,
+			"variant_id":    backorder.VariantID,
+			"location_id":   allocation.LocationID,
+			"quantity":      backorder.Quantity,
+			"policy":        backorder.Policy,
+			"reason":        "stock_shortage",
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shortAllocations spreads a shortage over allocations in order, returning the units
+// taken back from each of them and the units they couldn't cover
+func shortAllocations(allocations []models.StockAllocation, shortage int) ([]int, int) {
+	taken := make([]int, len(allocations))
+	for i, allocation := range allocations {
+		if shortage == 0 {
+			break
+		}
+		taken[i] = min(allocation.Quantity, shortage)
+		shortage -= taken[i]
+	}
+	return taken, shortage
+}
+
+// cancelOrderBackorders closes the open backorders of a cancelled order
+func cancelOrderBackorders(tx *gorm.DB, order *models.Order) error {
+	if err := tx.Model(&models.Backorder{}).
+		Where("order_id = ? AND fulfilled_at IS NULL AND cancelled_at IS NULL", order.ID).
+		Update("cancelled_at", time.Now()).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.OrderItem{}).Where("order_id = ? AND backordered", order.ID).Update("backordered", false).Error
+}
+
+// orderHasOpenBackorders tells whether some units of an order still wait for stock
+func orderHasOpenBackorders(tx *gorm.DB, order *models.Order) (bool, error) {
+	var open int64
+	err := tx.Model(&models.Backorder{}).
+		Where("order_id = ? AND fulfilled_at IS NULL AND cancelled_at IS NULL", order.ID).
+		Count(&open).Error
+	return open > 0, err
+}
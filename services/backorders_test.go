@@ -0,0 +1,137 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"oms-services/models"
+
+	"github.com/google/uuid"
+)
+
+func TestBackorderFills(t *testing.T) {
+	tests := []struct {
+		name      string
+		waiting   [][2]int // quantity and units already allocated, oldest first
+		available int
+		want      []int
+	}{
+		{name: "oldest first", waiting: [][2]int{{3, 0}, {2, 0}}, available: 4, want: []int{3, 1}},
+		{name: "all filled", waiting: [][2]int{{3, 0}, {2, 0}}, available: 10, want: []int{3, 2}},
+		{name: "partly allocated", waiting: [][2]int{{3, 2}, {2, 0}}, available: 2, want: []int{1, 1}},
+		{name: "oldest takes everything", waiting: [][2]int{{5, 0}, {2, 0}}, available: 3, want: []int{3, 0}},
+		{name: "nothing available", waiting: [][2]int{{3, 0}}, available: 0, want: []int{0}},
+		{name: "no backorders", available: 5, want: []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backorders := make([]models.Backorder, len(tt.waiting))
+			for i, waiting := range tt.waiting {
+				backorders[i] = models.Backorder{Quantity: waiting[0], QtyAllocated: waiting[1]}
+			}
+			if got := backorderFills(backorders, tt.available); !slices.Equal(got, tt.want) {
+				t.Errorf("backorderFills() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitShortfall(t *testing.T) {
+	location := models.Location{ID: uuid.New(), Country: "EG", IsActive: true}
+	deny, backorder := uuid.New(), uuid.New()
+	policies := map[uuid.UUID]models.ProductVariant{
+		deny:      {ID: deny, InventoryPolicy: models.InventoryPolicyDeny},
+		backorder: {ID: backorder, InventoryPolicy: models.InventoryPolicyBackorder},
+	}
+	names := map[uuid.UUID]string{deny: "deny", backorder: "backorder"}
+
+	tests := []struct {
+		name        string
+		stock       map[uuid.UUID]int
+		lines       [][2]int // index of the variant (0 deny, 1 backorder) and quantity
+		kept        []int
+		backordered []int
+	}{
+		{
+			name:  "in stock",
+			stock: map[uuid.UUID]int{backorder: 5},
+			lines: [][2]int{{1, 3}},
+			kept:  []int{3},
+		},
+		{
+			name:        "shortfall backordered",
+			stock:       map[uuid.UUID]int{backorder: 2},
+			lines:       [][2]int{{1, 3}},
+			kept:        []int{2},
+			backordered: []int{1},
+		},
+		{
+			name:        "last lines first",
+			stock:       map[uuid.UUID]int{backorder: 2},
+			lines:       [][2]int{{1, 2}, {1, 2}},
+			kept:        []int{2},
+			backordered: []int{2},
+		},
+		{
+			name:        "shortfall across lines",
+			stock:       map[uuid.UUID]int{backorder: 1},
+			lines:       [][2]int{{1, 2}, {1, 2}},
+			kept:        []int{1},
+			backordered: []int{2, 1},
+		},
+		{
+			name:  "deny variants are left to fail routing",
+			stock: map[uuid.UUID]int{deny: 1},
+			lines: [][2]int{{0, 3}},
+			kept:  []int{3},
+		},
+		{
+			name:        "out of stock",
+			lines:       [][2]int{{1, 2}},
+			kept:        []int{},
+			backordered: []int{2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var inventories []models.Inventory
+			for variantID, quantity := range tt.stock {
+				inventories = append(inventories, models.Inventory{VariantID: variantID, LocationID: location.ID, QtyOnHand: quantity})
+			}
+			variants := []uuid.UUID{deny, backorder}
+			lines := make([]stockLine, len(tt.lines))
+			for i, line := range tt.lines {
+				lines[i] = stockLine{OrderItemID: uuid.New(), VariantID: variants[line[0]], Quantity: line[1]}
+			}
+			total := map[uuid.UUID]int{}
+			for _, line := range lines {
+				total[line.VariantID] += line.Quantity
+			}
+
+			router := newStockRouter([]models.Location{location}, inventories, nil)
+			kept, backordered := splitShortfall(lines, router, policies)
+
+			quantities := func(lines []stockLine) []int {
+				got := make([]int, len(lines))
+				for i, line := range lines {
+					got[i] = line.Quantity
+					total[line.VariantID] -= line.Quantity
+				}
+				return got
+			}
+			if got := quantities(kept); !slices.Equal(got, tt.kept) {
+				t.Errorf("kept = %v, want %v", got, tt.kept)
+			}
+			if got := quantities(backordered); !slices.Equal(got, tt.backordered) {
+				t.Errorf("backordered = %v, want %v", got, tt.backordered)
+			}
+			for variantID, left := range total {
+				if left != 0 {
+					t.Errorf("%s lines lost %d units", names[variantID], left)
+				}
+			}
+		})
+	}
+}
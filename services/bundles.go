@@ -0,0 +1,215 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"oms-services/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotBundle       = errors.New("variant does not belong to a bundle product")
+	ErrBundleComponent = errors.New("bundle component is invalid")
+)
+
+// SetBundleComponents replaces the components of a bundle variant. Components must be
+// variants of simple products, bundles can't be nested.
+func SetBundleComponents(db *gorm.DB, bundleVariantID uuid.UUID, components []models.BundleComponent) ([]models.BundleComponent, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		bundle, err := lockVariant(tx, bundleVariantID)
+		if err != nil {
+			return err
+		}
+		if isBundle, err := isBundleVariant(tx, bundle); err != nil {
+			return err
+		} else if !isBundle {
+			return ErrNotBundle
+		}
+
+		seen := map[uuid.UUID]bool{}
+		for i := range components {
+			component := &components[i]
+			switch {
+			case component.Quantity < 1:
+				return fmt.Errorf("%w: quantity must be at least 1", ErrBundleComponent)
+			case component.ComponentVariantID == bundle.ID:
+				return fmt.Errorf("%w: a bundle can't contain itself", ErrBundleComponent)
+			case seen[component.ComponentVariantID]:
+				return fmt.Errorf("%w: variant %s is listed twice", ErrBundleComponent, component.ComponentVariantID)
+			}
+			seen[component.ComponentVariantID] = true
+
+			var variant models.ProductVariant
+			err := tx.First(&variant, component.ComponentVariantID).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: variant %s not found", ErrBundleComponent, component.ComponentVariantID)
+			}
+			if err != nil {
+				return err
+			}
+			if isBundle, err := isBundleVariant(tx, &variant); err != nil {
+				return err
+			} else if isBundle {
+				return fmt.Errorf("%w: %s is itself a bundle", ErrBundleComponent, variant.SKU)
+			}
+
+			component.ID = uuid.Nil
+			component.BundleVariantID = bundle.ID
+			component.ComponentVariant = &variant
+		}
+
+		if err := tx.Where("bundle_variant_id = ?", bundle.ID).Delete(&models.BundleComponent{}).Error; err != nil {
+			return err
+		}
+		if len(components) == 0 {
+			return nil
+		}
+		return tx.Omit("ComponentVariant").Create(&components).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return components, nil
+}
+
+// VariantAvailability returns how many units of a variant can be sold right now. A
+// bundle is available as many times as its scarcest component allows. nil means the
+// stock of the variant is not tracked.
+func VariantAvailability(db *gorm.DB, variantID uuid.UUID) (*int, error) {
+	var components []models.BundleComponent
+	if err := db.Where("bundle_variant_id = ?", variantID).Find(&components).Error; err != nil {
+		return nil, err
+	}
+	if len(components) == 0 {
+		return variantStockAvailable(db, variantID)
+	}
+
+	var available *int
+	for _, component := range components {
+		stock, err := variantStockAvailable(db, component.ComponentVariantID)
+		if err != nil {
+			return nil, err
+		}
+		if stock == nil {
+			continue
+		}
+		bundles := max(*stock, 0) / component.Quantity
+		if available == nil || bundles < *available {
+			available = &bundles
+		}
+	}
+	return available, nil
+}
+
+// allocateBundleItems freezes the components of the order's bundle items and spreads
+// each item line total over them, weighted by the components list price
+func allocateBundleItems(tx *gorm.DB, order *models.Order) error {
+	for i := range order.Items {
+		item := &order.Items[i]
+
+		var components []models.BundleComponent
+		err := tx.Preload("ComponentVariant").Where("bundle_variant_id = ?", item.VariantID).Order("created_at").Find(&components).Error
+		if err != nil {
+			return err
+		}
+		if len(components) == 0 {
+			continue
+		}
+
+		if err := tx.Where("order_item_id = ?", item.ID).Delete(&models.OrderItemComponent{}).Error; err != nil {
+			return err
+		}
+		if item.Components, err = bundleItemComponents(item, components); err != nil {
+			return err
+		}
+		if err := tx.Create(&item.Components).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bundleItemComponents lists the components of a bundle item for its whole quantity,
+// the item line total spread over them by their list price. Components without a list
+// price share the revenue by quantity.
+func bundleItemComponents(item *models.OrderItem, components []models.BundleComponent) ([]models.OrderItemComponent, error) {
+	weights := make([]int64, len(components))
+	var total int64
+	for i, component := range components {
+		weights[i] = component.ComponentVariant.Price.Amount * int64(component.Quantity)
+		total += weights[i]
+	}
+	if total == 0 {
+		for i, component := range components {
+			weights[i] = int64(component.Quantity)
+		}
+	}
+	revenues, err := item.LineTotal.Allocate(weights)
+	if err != nil {
+		return nil, err
+	}
+
+	itemComponents := make([]models.OrderItemComponent, len(components))
+	for i, component := range components {
+		itemComponents[i] = models.OrderItemComponent{
+			OrderItemID: item.ID,
+			VariantID:   component.ComponentVariantID,
+			Quantity:    component.Quantity * item.Quantity,
+			Currency:    item.Currency,
+			Revenue:     revenues[i],
+		}
+	}
+	return itemComponents, nil
+}
+
+// VariantRevenue is the revenue a variant brought in a currency, sold on its own or
+// as a bundle component
+type VariantRevenue struct {
+	VariantID    uuid.UUID `json:"variant_id"`
+	SKU          string    `json:"sku"`
+	Currency     string    `json:"currency"`
+	Quantity     int       `json:"quantity"`
+	RevenueMinor int64     `json:"revenue_minor"`
+}
+
+// BuildVariantRevenueReport sums the revenue per variant and currency of the orders placed
+// in [from, to). Bundle items count towards their components by their allocated revenue.
+func BuildVariantRevenueReport(db *gorm.DB, from, to time.Time) ([]VariantRevenue, error) {
+	rows := []VariantRevenue{}
+	err := db.Raw(`
+		SELECT lines.variant_id, product_variants.sku, lines.currency,
+			SUM(lines.quantity) AS quantity, SUM(lines.revenue_minor) AS revenue_minor
+		FROM (
+			SELECT order_items.variant_id, order_items.currency, order_items.quantity, order_items.line_total_minor AS revenue_minor
+			FROM order_items JOIN orders ON orders.id = order_items.order_id
+			WHERE orders.status IN @statuses AND orders.created_at >= @from AND orders.created_at < @to
+				AND NOT EXISTS (SELECT 1 FROM order_item_components c WHERE c.order_item_id = order_items.id)
+			UNION ALL
+			SELECT c.variant_id, c.currency, c.quantity, c.revenue_minor
+			FROM order_item_components c
+			JOIN order_items ON order_items.id = c.order_item_id
+			JOIN orders ON orders.id = order_items.order_id
+			WHERE orders.status IN @statuses AND orders.created_at >= @from AND orders.created_at < @to
+		) lines
+		JOIN product_variants ON product_variants.id = lines.variant_id
+		GROUP BY lines.variant_id, product_variants.sku, lines.currency
+		ORDER BY revenue_minor DESC`,
+		map[string]interface{}{"statuses": placedOrderStatuses, "from": from, "to": to},
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func isBundleVariant(tx *gorm.DB, variant *models.ProductVariant) (bool, error) {
+	var product models.Product
+	if err := tx.Select("type").First(&product, variant.ProductID).Error; err != nil {
+		return false, err
+	}
+	return product.Type == models.ProductTypeBundle, nil
+}
@@ -0,0 +1,108 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"oms-services/models"
+	"oms-services/money"
+
+	"github.com/google/uuid"
+)
+
+func TestBundleItemComponents(t *testing.T) {
+	type component struct {
+		price    int64
+		quantity int
+	}
+
+	tests := []struct {
+		name       string
+		lineTotal  int64
+		quantity   int
+		components []component
+		revenues   []int64
+		quantities []int
+	}{
+		{
+			name:       "weighted by list price",
+			lineTotal:  900,
+			quantity:   1,
+			components: []component{{price: 1000, quantity: 1}, {price: 500, quantity: 1}},
+			revenues:   []int64{600, 300},
+			quantities: []int{1, 1},
+		},
+		{
+			name:       "component quantities weigh in",
+			lineTotal:  1000,
+			quantity:   1,
+			components: []component{{price: 100, quantity: 3}, {price: 200, quantity: 1}},
+			revenues:   []int64{600, 400},
+			quantities: []int{3, 1},
+		},
+		{
+			name:       "item quantity multiplies the units",
+			lineTotal:  2000,
+			quantity:   2,
+			components: []component{{price: 500, quantity: 2}, {price: 1000, quantity: 1}},
+			revenues:   []int64{1000, 1000},
+			quantities: []int{4, 2},
+		},
+		{
+			name:       "remainder goes to the largest share",
+			lineTotal:  100,
+			quantity:   1,
+			components: []component{{price: 100, quantity: 1}, {price: 100, quantity: 1}, {price: 100, quantity: 1}},
+			revenues:   []int64{34, 33, 33},
+			quantities: []int{1, 1, 1},
+		},
+		{
+			name:       "no list prices share by quantity",
+			lineTotal:  900,
+			quantity:   1,
+			components: []component{{price: 0, quantity: 2}, {price: 0, quantity: 1}},
+			revenues:   []int64{600, 300},
+			quantities: []int{2, 1},
+		},
+		{
+			name:       "free bundle",
+			lineTotal:  0,
+			quantity:   1,
+			components: []component{{price: 1000, quantity: 1}, {price: 500, quantity: 1}},
+			revenues:   []int64{0, 0},
+			quantities: []int{1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			item := &models.OrderItem{ID: uuid.New(), Quantity: tt.quantity, Currency: "EGP", LineTotal: money.New(tt.lineTotal, "EGP")}
+			components := make([]models.BundleComponent, len(tt.components))
+			for i, c := range tt.components {
+				variant := &models.ProductVariant{ID: uuid.New(), Price: money.New(c.price, "EGP")}
+				components[i] = models.BundleComponent{ComponentVariantID: variant.ID, ComponentVariant: variant, Quantity: c.quantity}
+			}
+
+			got, err := bundleItemComponents(item, components)
+			if err != nil {
+				t.Fatalf("bundleItemComponents() error = %v", err)
+			}
+
+			revenues := make([]int64, len(got))
+			quantities := make([]int, len(got))
+			for i, c := range got {
+				revenues[i] = c.Revenue.Amount
+				quantities[i] = c.Quantity
+				if c.OrderItemID != item.ID || c.VariantID != components[i].ComponentVariantID || c.Currency != "EGP" {
+					t.Errorf("component %d = %+v, want item %s variant %s in EGP", i, c, item.ID, components[i].ComponentVariantID)
+				}
+			}
+			if !slices.Equal(revenues, tt.revenues) {
+				t.Errorf("revenues = %v, want %v", revenues, tt.revenues)
+			}
+			if !slices.Equal(quantities, tt.quantities) {
+				t.Errorf("quantities = %v, want %v", quantities, tt.quantities)
+			}
+		})
+	}
+}
@@ -0,0 +1,454 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"oms-services/models"
+	"oms-services/utils"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCategoryNotFound       = errors.New("category not found")
+	ErrCategoryParentNotFound = errors.New("parent category not found")
+	ErrCategoryCycle          = errors.New("a category can't be moved below itself or its descendants")
+	ErrCategoryHasChildren    = errors.New("category has subcategories")
+	ErrCollectionNotFound     = errors.New("collection not found")
+	ErrCollectionNotManual    = errors.New("products can only be added to manual collections")
+	ErrCollectionRule         = errors.New("collection rule is invalid")
+	ErrProductNotFound        = errors.New("product not found")
+)
+
+// categorySubtreeProducts selects the products of a category, given by id or slug,
+// and of all its descendants
+const categorySubtreeProducts = `SELECT pc.product_id FROM product_categories pc
+	JOIN categories c ON c.id = pc.category_id
+	JOIN categories root ON c.path LIKE root.path || '%'
+	WHERE root.id::text = ? OR root.slug = ?`
+
+// CreateCategory saves a category below its parent, or as a root category when it
+// has none, computing its materialised path
+func CreateCategory(db *gorm.DB, category *models.Category) error {
+	if category.Slug == "" {
+		category.Slug = utils.Slugify(category.Name)
+	}
+	if category.ID == uuid.Nil {
+		category.ID = uuid.New()
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		category.Path = "/" + category.ID.String() + "/"
+		category.Depth = 0
+		if category.ParentID != nil {
+			parent, err := lockCategory(tx, *category.ParentID)
+			if errors.Is(err, ErrCategoryNotFound) {
+				return ErrCategoryParentNotFound
+			}
+			if err != nil {
+				return err
+			}
+			category.Path = parent.Path + category.ID.String() + "/"
+			category.Depth = parent.Depth + 1
+		}
+		return tx.Create(category).Error
+	})
+}
+
+// MoveCategory moves a category and its subtree below a new parent, or to the root
+// when parentID is nil
+func MoveCategory(db *gorm.DB, categoryID uuid.UUID, parentID *uuid.UUID) (*models.Category, error) {
+	var category *models.Category
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		category, err = lockCategory(tx, categoryID)
+		if err != nil {
+			return err
+		}
+
+		path, depth := "/"+category.ID.String()+"/", 0
+		if parentID != nil {
+			parent, err := lockCategory(tx, *parentID)
+			if errors.Is(err, ErrCategoryNotFound) {
+				return ErrCategoryParentNotFound
+			}
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(parent.Path, category.Path) {
+				return ErrCategoryCycle
+			}
+			path, depth = parent.Path+category.ID.String()+"/", parent.Depth+1
+		}
+
+		// Rewrite the path prefix of the whole subtree, the category included
+		err = tx.Exec(
+			"UPDATE categories SET path = ? || substr(path, ?), depth = depth + ?, updated_at = now() WHERE path LIKE ?",
+			path, len(category.Path)+1, depth-category.Depth, category.Path+"%",
+		).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(category).Update("parent_id", parentID).Error; err != nil {
+			return err
+		}
+
+		category.ParentID = parentID
+		category.Path = path
+		category.Depth = depth
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return category, nil
+}
+
+// DeleteCategory deletes a leaf category, removing its products from it
+func DeleteCategory(db *gorm.DB, categoryID uuid.UUID) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		category, err := lockCategory(tx, categoryID)
+		if err != nil {
+			return err
+		}
+
+		var children int64
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return ErrCategoryHasChildren
+		}
+
+		if err := tx.Exec("DELETE FROM product_categories WHERE category_id = ?", category.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(category).Error
+	})
+}
+
+// CategoryTree returns the root categories with their nested children, or the subtree
+// of rootID when given
+func CategoryTree(db *gorm.DB, rootID *uuid.UUID) ([]models.Category, error) {
+	query := db.Order("depth, position, name")
+	parentKey := uuid.Nil
+	if rootID != nil {
+		var root models.Category
+		err := db.First(&root, *rootID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCategoryNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("path LIKE ?", root.Path+"%")
+		if root.ParentID != nil {
+			parentKey = *root.ParentID
+		}
+	}
+
+	var categories []models.Category
+	if err := query.Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	byParent := map[uuid.UUID][]models.Category{}
+	for _, category := range categories {
+		key := uuid.Nil
+		if category.ParentID != nil {
+			key = *category.ParentID
+		}
+		byParent[key] = append(byParent[key], category)
+	}
+
+	var build func(parent uuid.UUID) []models.Category
+	build = func(parent uuid.UUID) []models.Category {
+		children := byParent[parent]
+		for i := range children {
+			children[i].Children = build(children[i].ID)
+		}
+		return children
+	}
+
+	tree := build(parentKey)
+	if rootID != nil {
+		// Siblings of the root share its parent but are outside the subtree
+		for _, category := range tree {
+			if category.ID == *rootID {
+				return []models.Category{category}, nil
+			}
+		}
+	}
+	return tree, nil
+}
+
+// FindCategory looks a category up by id or slug
+func FindCategory(db *gorm.DB, ref string) (*models.Category, error) {
+	var category models.Category
+	query := db.Where("slug = ?", ref)
+	if id, err := uuid.Parse(ref); err == nil {
+		query = db.Where("id = ?", id)
+	}
+	err := query.First(&category).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// SetProductCategories replaces the categories a product belongs to
+func SetProductCategories(db *gorm.DB, productID uuid.UUID, categoryIDs []uuid.UUID) (*models.Product, error) {
+	var product models.Product
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&product, productID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrProductNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		categories := []models.Category{}
+		if len(categoryIDs) > 0 {
+			if err := tx.Where("id IN ?", categoryIDs).Find(&categories).Error; err != nil {
+				return err
+			}
+		}
+		if len(categories) != len(uniqueIDs(categoryIDs)) {
+			return ErrCategoryNotFound
+		}
+
+		product.Categories = categories
+		return tx.Model(&product).Association("Categories").Replace(categories)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// ProductsInCategory narrows a products query to the products of a category, given
+// by id or slug, and of its descendants
+func ProductsInCategory(query *gorm.DB, ref string) *gorm.DB {
+	return query.Where("products.id IN ("+categorySubtreeProducts+")", ref, ref)
+}
+
+// ValidateCollection checks the collection rules are well formed. Manual collections
+// can't have rules.
+func ValidateCollection(collection *models.Collection) error {
+	if collection.Type == models.CollectionTypeManual {
+		if len(collection.Rules) > 0 {
+			return fmt.Errorf("%w: manual collections can't have rules", ErrCollectionRule)
+		}
+		return nil
+	}
+	if len(collection.Rules) == 0 {
+		return fmt.Errorf("%w: rule based collections need at least one rule", ErrCollectionRule)
+	}
+
+	for _, rule := range collection.Rules {
+		if rule.Value == "" {
+			return fmt.Errorf("%w: %s rule needs a value", ErrCollectionRule, rule.Field)
+		}
+		switch rule.Field {
+		case "title", "tax_class":
+			if rule.Operator != "equals" && rule.Operator != "not_equals" && rule.Operator != "contains" {
+				return fmt.Errorf("%w: unsupported operator %q for %s", ErrCollectionRule, rule.Operator, rule.Field)
+			}
+		case "category":
+			if rule.Operator != "equals" && rule.Operator != "not_equals" {
+				return fmt.Errorf("%w: unsupported operator %q for %s", ErrCollectionRule, rule.Operator, rule.Field)
+			}
+		case "price_minor":
+			if rule.Operator != "greater_than" && rule.Operator != "less_than" {
+				return fmt.Errorf("%w: unsupported operator %q for %s", ErrCollectionRule, rule.Operator, rule.Field)
+			}
+			if _, err := strconv.ParseInt(rule.Value, 10, 64); err != nil {
+				return fmt.Errorf("%w: price_minor must be an integer", ErrCollectionRule)
+			}
+		default:
+			return fmt.Errorf("%w: unsupported field %q", ErrCollectionRule, rule.Field)
+		}
+	}
+	return nil
+}
+
+// UpdateCollection edits a collection, rejecting changes that leave its rules invalid
+func UpdateCollection(db *gorm.DB, collectionID uuid.UUID, updates map[string]interface{}) (*models.Collection, error) {
+	var collection models.Collection
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&collection, collectionID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCollectionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&collection).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&collection, collectionID).Error; err != nil {
+			return err
+		}
+		return ValidateCollection(&collection)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// FindCollection looks a collection up by id or slug
+func FindCollection(db *gorm.DB, ref string) (*models.Collection, error) {
+	var collection models.Collection
+	query := db.Where("slug = ?", ref)
+	if id, err := uuid.Parse(ref); err == nil {
+		query = db.Where("id = ?", id)
+	}
+	err := query.First(&collection).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCollectionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &collection, nil
+}
+
+// ProductsInCollection narrows a products query to the products of a collection:
+// its listed products for manual collections, the products matching its rules otherwise
+func ProductsInCollection(query *gorm.DB, collection *models.Collection) *gorm.DB {
+	if collection.Type == models.CollectionTypeManual {
+		return query.Where("products.id IN (SELECT product_id FROM collection_products WHERE collection_id = ?)", collection.ID)
+	}
+
+	conditions := make([]string, 0, len(collection.Rules))
+	args := []interface{}{}
+	for _, rule := range collection.Rules {
+		switch rule.Field {
+		case "title", "tax_class":
+			column := "products." + rule.Field
+			switch rule.Operator {
+			case "equals":
+				conditions = append(conditions, column+" = ?")
+				args = append(args, rule.Value)
+			case "not_equals":
+				conditions = append(conditions, column+" <> ?")
+				args = append(args, rule.Value)
+			case "contains":
+				conditions = append(conditions, column+" ILIKE ?")
+				args = append(args, "%"+rule.Value+"%")
+			}
+		case "category":
+			operator := "IN"
+			if rule.Operator == "not_equals" {
+				operator = "NOT IN"
+			}
+			conditions = append(conditions, "products.id "+operator+" ("+categorySubtreeProducts+")")
+			args = append(args, rule.Value, rule.Value)
+		case "price_minor":
+			// A product matches when any of its variants is priced accordingly
+			operator := ">"
+			if rule.Operator == "less_than" {
+				operator = "<"
+			}
+			price, _ := strconv.ParseInt(rule.Value, 10, 64)
+			conditions = append(conditions, "EXISTS (SELECT 1 FROM product_variants pv WHERE pv.product_id = products.id AND pv.price_minor "+operator+" ?)")
+			args = append(args, price)
+		}
+	}
+	if len(conditions) == 0 {
+		return query.Where("1 = 0")
+	}
+
+	separator := " OR "
+	if collection.MatchAll {
+		separator = " AND "
+	}
+	return query.Where("("+strings.Join(conditions, separator)+")", args...)
+}
+
+// AddCollectionProducts adds products to a manual collection
+func AddCollectionProducts(db *gorm.DB, collectionID uuid.UUID, productIDs []uuid.UUID) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var collection models.Collection
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&collection, collectionID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCollectionNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if collection.Type != models.CollectionTypeManual {
+			return ErrCollectionNotManual
+		}
+
+		var products []models.Product
+		if err := tx.Where("id IN ?", productIDs).Find(&products).Error; err != nil {
+			return err
+		}
+		if len(products) != len(uniqueIDs(productIDs)) {
+			return ErrProductNotFound
+		}
+		return tx.Model(&collection).Association("Products").Append(products)
+	})
+}
+
+// RemoveCollectionProduct removes a product from a manual collection
+func RemoveCollectionProduct(db *gorm.DB, collectionID, productID uuid.UUID) error {
+	var collection models.Collection
+	err := db.First(&collection, collectionID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrCollectionNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if collection.Type != models.CollectionTypeManual {
+		return ErrCollectionNotManual
+	}
+
+	result := db.Exec("DELETE FROM collection_products WHERE collection_id = ? AND product_id = ?", collection.ID, productID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrProductNotFound
+	}
+	return nil
+}
+
+func lockCategory(tx *gorm.DB, categoryID uuid.UUID) (*models.Category, error) {
+	var category models.Category
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&category, categoryID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCategoryNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+func uniqueIDs(ids []uuid.UUID) map[uuid.UUID]struct{} {
+	unique := make(map[uuid.UUID]struct{}, len(ids))
+	for _, id := range ids {
+		unique[id] = struct{}{}
+	}
+	return unique
+}
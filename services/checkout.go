@@ -0,0 +1,188 @@
+package services
+
+import (
+	"errors"
+	"oms-services/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOrderNotFound           = errors.New("order not found")
+	ErrOrderNotDraft           = errors.New("order is not a draft")
+	ErrOrderEmpty              = errors.New("order has no items")
+	ErrShippingAddressRequired = errors.New("shipping address is required")
+	ErrGuestEmailRequired      = errors.New("guest orders require an email")
+)
+
+// LockOrder loads an order with its items under a row lock
+func LockOrder(tx *gorm.DB, orderID uuid.UUID) (*models.Order, error) {
+	var order models.Order
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Where("order_id = ?", order.ID).Find(&order.Items).Error; err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// ConfirmCheckout freezes a draft order and moves it to pending_payment. When a
+// shipping method is given it is selected in the same transaction.
+func ConfirmCheckout(db *gorm.DB, orderID uuid.UUID, shippingMethodID *uuid.UUID) (*models.Order, error) {
+	var order *models.Order
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = LockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+
+		if order.Status != models.OrderStatusDraft {
+			return ErrOrderNotDraft
+		}
+		if shippingMethodID != nil {
+			if err := selectShippingMethod(tx, order, *shippingMethodID); err != nil {
+				return err
+			}
+		}
+		if len(order.Items) == 0 {
+			return ErrOrderEmpty
+		}
+		if order.CustomerID == nil && (order.GuestEmail == nil || *order.GuestEmail == "") {
+			return ErrGuestEmailRequired
+		}
+
+		if err := snapshotOrderAddresses(tx, order); err != nil {
+			return err
+		}
+		if err := tx.Model(order).Updates(map[string]interface{}{
+			"billing_address_id":        order.BillingAddressID,
+			"shipping_address_id":       order.ShippingAddressID,
+			"billing_address_snapshot":  order.BillingAddressSnapshot,
+			"shipping_address_snapshot": order.ShippingAddressSnapshot,
+		}).Error; err != nil {
+			return err
+		}
+
+		if err := validateOrderShipping(tx, order); err != nil {
+			return err
+		}
+
+		// Coupons are validated strictly here, a recalculation would silently drop them
+		coupon, err := lockRedeemableCoupon(tx, order)
+		if err != nil {
+			return err
+		}
+		// Taxes are recomputed against the address snapshot
+		if err := RecalculateOrder(tx, order); err != nil {
+			return err
+		}
+		// The redemption records the final discount
+		if err := redeemCoupon(tx, order, coupon); err != nil {
+			return err
+		}
+		if err := freezeOrderExchangeRate(tx, order); err != nil {
+			return err
+		}
+		// Bundles are reserved and reported through their components
+		if err := allocateBundleItems(tx, order); err != nil {
+			return err
+		}
+		if err := freezeOrderCosts(tx, order); err != nil {
+			return err
+		}
+
+		return ChangeOrderStatus(tx, order, models.OrderStatusPendingPayment)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// snapshotOrderAddresses resolves the order's billing and shipping addresses
+// (falling back to the customer's defaults) and copies them onto the order.
+// Addresses given inline on the draft, as guests do, are kept as they are.
+func snapshotOrderAddresses(tx *gorm.DB, order *models.Order) error {
+	if order.CustomerID != nil && (order.ShippingAddressID != nil || order.ShippingAddressSnapshot == nil) {
+		shipping, err := resolveAddress(tx, *order.CustomerID, order.ShippingAddressID, "is_default_shipping")
+		if err != nil {
+			return err
+		}
+		if shipping != nil {
+			snapshot := shipping.Snapshot()
+			order.ShippingAddressID = &shipping.ID
+			order.ShippingAddressSnapshot = &snapshot
+		}
+	}
+
+	if order.CustomerID != nil && (order.BillingAddressID != nil || order.BillingAddressSnapshot == nil) {
+		billing, err := resolveAddress(tx, *order.CustomerID, order.BillingAddressID, "is_default_billing")
+		if err != nil {
+			return err
+		}
+		if billing != nil {
+			snapshot := billing.Snapshot()
+			order.BillingAddressID = &billing.ID
+			order.BillingAddressSnapshot = &snapshot
+		}
+	}
+
+	if order.ShippingAddressSnapshot == nil {
+		return ErrShippingAddressRequired
+	}
+	if order.BillingAddressSnapshot == nil {
+		order.BillingAddressSnapshot = order.ShippingAddressSnapshot
+	}
+	return nil
+}
+
+// resolveAddress returns the explicitly chosen address, or the customer's default
+// for the given flag column when none was chosen
+func resolveAddress(tx *gorm.DB, customerID uuid.UUID, addressID *uuid.UUID, defaultColumn string) (*models.Address, error) {
+	if addressID != nil {
+		return FindCustomerAddress(tx, customerID, *addressID)
+	}
+
+	var address models.Address
+	err := tx.Where("customer_id = ? AND "+defaultColumn, customerID).First(&address).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+// orderDestination resolves where a draft order ships to: the address chosen from the
+// address book, the inline snapshot, or the customer's default shipping address
+func orderDestination(tx *gorm.DB, order *models.Order) (*models.AddressSnapshot, error) {
+	if order.ShippingAddressSnapshot != nil && (order.ShippingAddressID == nil || order.Status != models.OrderStatusDraft) {
+		return order.ShippingAddressSnapshot, nil
+	}
+	if order.CustomerID == nil {
+		return nil, nil
+	}
+
+	address, err := resolveAddress(tx, *order.CustomerID, order.ShippingAddressID, "is_default_shipping")
+	if errors.Is(err, ErrAddressNotFound) {
+		// Reported at checkout, the draft is just left untaxed meanwhile
+		return nil, nil
+	}
+	if err != nil || address == nil {
+		return nil, err
+	}
+	snapshot := address.Snapshot()
+	return &snapshot, nil
+}
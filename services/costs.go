@@ -0,0 +1,166 @@
+package services
+
+import (
+	"errors"
+	"log"
+	"oms-services/models"
+	"oms-services/money"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// VariantMargin is the revenue and cost of the units of a variant sold in a currency, on
+// its own or as a bundle component. Units sold before their cost was known are left out
+// of the cost and margin and counted apart.
+type VariantMargin struct {
+	VariantID        uuid.UUID `json:"variant_id"`
+	SKU              string    `json:"sku"`
+	Currency         string    `json:"currency"`
+	Quantity         int       `json:"quantity"`
+	RevenueMinor     int64     `json:"revenue_minor"`
+	CostMinor        int64     `json:"cost_minor"`
+	MarginMinor      int64     `json:"margin_minor"` // Revenue of the costed units minus their cost
+	UncostedQuantity int       `json:"uncosted_quantity"`
+}
+
+// updateVariantCost folds units received at a unit cost into the weighted average cost
+// of a variant, before they are added to its stock. Costs in another currency than the
+// variant are converted at the rate of the day, the cost is left as is when none was
+// loaded.
+func updateVariantCost(tx *gorm.DB, variantID uuid.UUID, quantity int, unitCost money.Money, at time.Time) error {
+	variant, err := lockVariant(tx, variantID)
+	if err != nil {
+		return err
+	}
+	cost, err := ConvertAmount(tx, unitCost, variant.Currency, at)
+	if errors.Is(err, ErrExchangeRateNotFound) {
+		log.Printf("variant %s cost not updated: %v", variant.SKU, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var onHand int
+	if variant.CostPrice != nil {
+		err := tx.Model(&models.Inventory{}).
+			Select("COALESCE(SUM(qty_on_hand), 0)").
+			Where("variant_id = ?", variant.ID).
+			Scan(&onHand).Error
+		if err != nil {
+			return err
+		}
+	}
+	if cost, err = averageCost(variant.CostPrice, onHand, cost, quantity); err != nil {
+		return err
+	}
+	return tx.Model(variant).Update("cost_price_minor", cost).Error
+}
+
+// averageCost weighs the cost of the units on hand and of the units received, the cost
+// received when the current one is unknown
+func averageCost(current *money.Money, onHand int, received money.Money, quantity int) (money.Money, error) {
+	if current == nil || onHand+quantity <= 0 {
+		return received, nil
+	}
+	value, err := current.Mul(int64(onHand)).Add(received.Mul(int64(quantity)))
+	if err != nil {
+		return money.Money{}, err
+	}
+	return value.MulFraction(1, int64(onHand+quantity)), nil
+}
+
+// freezeOrderCosts copies the variants cost onto the order items at checkout, converted
+// to the order currency, and onto the components of bundle items. Costs stay unknown for
+// variants never received or without an exchange rate.
+func freezeOrderCosts(tx *gorm.DB, order *models.Order) error {
+	now := time.Now()
+	for i := range order.Items {
+		item := &order.Items[i]
+
+		if len(item.Components) == 0 {
+			cost, err := variantUnitCost(tx, item.VariantID, item.Currency, now)
+			if err != nil || cost == nil {
+				return err
+			}
+			item.UnitCost = cost
+			if err := tx.Model(item).Update("unit_cost_minor", item.UnitCost).Error; err != nil {
+				return err
+			}
+			continue
+		}
+
+		for j := range item.Components {
+			component := &item.Components[j]
+			cost, err := variantUnitCost(tx, component.VariantID, component.Currency, now)
+			if err != nil {
+				return err
+			}
+			if cost == nil {
+				continue
+			}
+			total := cost.Mul(int64(component.Quantity))
+			component.Cost = &total
+			if err := tx.Model(component).Update("cost_minor", component.Cost).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// variantUnitCost returns the cost of a variant in a currency, nil when unknown
+func variantUnitCost(tx *gorm.DB, variantID uuid.UUID, currency string, at time.Time) (*money.Money, error) {
+	var variant models.ProductVariant
+	if err := tx.Select("id", "currency", "cost_price_minor").First(&variant, variantID).Error; err != nil {
+		return nil, err
+	}
+	if variant.CostPrice == nil {
+		return nil, nil
+	}
+	cost, err := ConvertAmount(tx, *variant.CostPrice, currency, at)
+	if errors.Is(err, ErrExchangeRateNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cost, nil
+}
+
+// BuildVariantMarginReport sums the revenue and cost per variant and currency of the
+// orders placed in [from, to), with the costs frozen at checkout. Bundle items count
+// towards their components.
+func BuildVariantMarginReport(db *gorm.DB, from, to time.Time) ([]VariantMargin, error) {
+	rows := []VariantMargin{}
+	err := db.Raw(`
+		SELECT lines.variant_id, product_variants.sku, lines.currency,
+			SUM(lines.quantity) AS quantity, SUM(lines.revenue_minor) AS revenue_minor,
+			COALESCE(SUM(lines.cost_minor), 0) AS cost_minor,
+			COALESCE(SUM(lines.revenue_minor - lines.cost_minor), 0) AS margin_minor,
+			COALESCE(SUM(lines.quantity) FILTER (WHERE lines.cost_minor IS NULL), 0) AS uncosted_quantity
+		FROM (
+			SELECT order_items.variant_id, order_items.currency, order_items.quantity, order_items.line_total_minor AS revenue_minor,
+				order_items.unit_cost_minor * order_items.quantity AS cost_minor
+			FROM order_items JOIN orders ON orders.id = order_items.order_id
+			WHERE orders.status IN @statuses AND orders.placed_at >= @from AND orders.placed_at < @to
+				AND NOT EXISTS (SELECT 1 FROM order_item_components c WHERE c.order_item_id = order_items.id)
+			UNION ALL
+			SELECT c.variant_id, c.currency, c.quantity, c.revenue_minor, c.cost_minor
+			FROM order_item_components c
+			JOIN order_items ON order_items.id = c.order_item_id
+			JOIN orders ON orders.id = order_items.order_id
+			WHERE orders.status IN @statuses AND orders.placed_at >= @from AND orders.placed_at < @to
+		) lines
+		JOIN product_variants ON product_variants.id = lines.variant_id
+		GROUP BY lines.variant_id, product_variants.sku, lines.currency
+		ORDER BY margin_minor DESC`,
+		map[string]interface{}{"statuses": placedOrderStatuses, "from": from, "to": to},
+	).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
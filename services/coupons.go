@@ -0,0 +1,291 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"oms-services/models"
+	"oms-services/money"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCouponNotFound       = errors.New("coupon not found")
+	ErrCouponInactive       = errors.New("coupon is not active")
+	ErrCouponNotStarted     = errors.New("coupon is not valid yet")
+	ErrCouponExpired        = errors.New("coupon has expired")
+	ErrCouponCurrency       = errors.New("coupon does not apply to the order currency")
+	ErrCouponMinSubtotal    = errors.New("order subtotal is below the coupon minimum")
+	ErrCouponUsageLimit     = errors.New("coupon usage limit reached")
+	ErrCouponCustomerLimit  = errors.New("coupon usage limit reached for this customer")
+	ErrCouponAlreadyApplied = errors.New("a coupon is already applied to the order")
+	ErrCouponNotApplied     = errors.New("no coupon is applied to the order")
+	ErrCouponDefinition     = errors.New("coupon definition is invalid")
+)
+
+// ValidateCouponDefinition checks the coupon fields are consistent with its type
+func ValidateCouponDefinition(coupon *models.Coupon) error {
+	switch {
+	case coupon.Type == models.CouponTypePercentage && coupon.PercentOff == 0:
+		return fmt.Errorf("%w: percentage coupons need percent_off", ErrCouponDefinition)
+	case coupon.Type == models.CouponTypeFixedAmount && (coupon.AmountOff.IsZero() || coupon.Currency == nil):
+		return fmt.Errorf("%w: fixed amount coupons need amount_off and currency", ErrCouponDefinition)
+	case !coupon.MinSubtotal.IsZero() && coupon.Currency == nil:
+		return fmt.Errorf("%w: a minimum subtotal needs a currency", ErrCouponDefinition)
+	case coupon.StartsAt != nil && coupon.EndsAt != nil && !coupon.StartsAt.Before(*coupon.EndsAt):
+		return fmt.Errorf("%w: starts_at must be before ends_at", ErrCouponDefinition)
+	}
+	return nil
+}
+
+// NormalizeCouponCode is the canonical form coupon codes are stored and looked up in
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// UpdateCoupon edits a coupon, rejecting changes that leave its definition inconsistent
+func UpdateCoupon(db *gorm.DB, couponID uuid.UUID, updates map[string]interface{}) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, couponID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCouponNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(&coupon).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.First(&coupon, couponID).Error; err != nil {
+			return err
+		}
+		return ValidateCouponDefinition(&coupon)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// validateCoupon checks whether the coupon can discount the order right now. Usage
+// limits are left to checkCouponUsage, run when the coupon is applied and redeemed:
+// the order using the last allowed redemption must keep its discount when recalculated.
+func validateCoupon(coupon *models.Coupon, order *models.Order, subtotal money.Money, now time.Time) error {
+	if !coupon.IsActive {
+		return ErrCouponInactive
+	}
+	if coupon.StartsAt != nil && now.Before(*coupon.StartsAt) {
+		return ErrCouponNotStarted
+	}
+	if coupon.EndsAt != nil && !now.Before(*coupon.EndsAt) {
+		return ErrCouponExpired
+	}
+	if coupon.Currency != nil && *coupon.Currency != order.Currency {
+		return ErrCouponCurrency
+	}
+	if coupon.Currency != nil {
+		cmp, err := subtotal.Cmp(coupon.MinSubtotal)
+		if err != nil {
+			return err
+		}
+		if cmp < 0 {
+			return ErrCouponMinSubtotal
+		}
+	}
+	return nil
+}
+
+// checkCouponUsage checks the order can still use the coupon, against its global and
+// per-customer limits
+func checkCouponUsage(tx *gorm.DB, coupon *models.Coupon, order *models.Order) error {
+	if coupon.UsageLimit != nil && coupon.TimesUsed >= *coupon.UsageLimit {
+		return ErrCouponUsageLimit
+	}
+	if coupon.UsageLimitPerCustomer != nil {
+		used, err := customerRedemptions(tx, coupon, order)
+		if err != nil {
+			return err
+		}
+		if used >= int64(*coupon.UsageLimitPerCustomer) {
+			return ErrCouponCustomerLimit
+		}
+	}
+	return nil
+}
+
+// customerRedemptions counts the coupon redemptions of the order's customer,
+// falling back to the guest email for guest orders
+func customerRedemptions(tx *gorm.DB, coupon *models.Coupon, order *models.Order) (int64, error) {
+	query := tx.Model(&models.CouponRedemption{}).Where("coupon_id = ?", coupon.ID)
+	switch {
+	case order.CustomerID != nil:
+		query = query.Where("customer_id = ?", *order.CustomerID)
+	case order.GuestEmail != nil:
+		query = query.Where("lower(email) = lower(?)", *order.GuestEmail)
+	default:
+		return 0, nil
+	}
+
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// ApplyCoupon attaches a coupon code to a draft order and reallocates the discount
+func ApplyCoupon(db *gorm.DB, orderID uuid.UUID, code string) (*models.Order, error) {
+	var order *models.Order
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = LockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusDraft {
+			return ErrOrderNotDraft
+		}
+		if order.CouponID != nil {
+			return ErrCouponAlreadyApplied
+		}
+
+		var coupon models.Coupon
+		err = tx.Where("code = ?", NormalizeCouponCode(code)).First(&coupon).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrCouponNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		subtotal := money.Zero(order.Currency)
+		for _, item := range order.Items {
+			if subtotal, err = subtotal.Add(item.UnitPrice.Mul(int64(item.Quantity))); err != nil {
+				return err
+			}
+		}
+		if err := validateCoupon(&coupon, order, subtotal, time.Now()); err != nil {
+			return err
+		}
+		if err := checkCouponUsage(tx, &coupon, order); err != nil {
+			return err
+		}
+
+		order.CouponID = &coupon.ID
+		order.CouponCode = &coupon.Code
+		if err := RecalculateOrder(tx, order); err != nil {
+			return err
+		}
+
+		return RecordOrderEvent(tx, order.ID, models.EventCouponApplied, map[string]interface{}{
+			"code":           coupon.Code,
+			"discount_minor": order.Discount.Amount,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// RemoveCoupon detaches the coupon from a draft order
+func RemoveCoupon(db *gorm.DB, orderID uuid.UUID) (*models.Order, error) {
+	var order *models.Order
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = LockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusDraft {
+			return ErrOrderNotDraft
+		}
+		if order.CouponID == nil {
+			return ErrCouponNotApplied
+		}
+
+		code := order.CouponCode
+		order.CouponID = nil
+		order.CouponCode = nil
+		if err := RecalculateOrder(tx, order); err != nil {
+			return err
+		}
+
+		return RecordOrderEvent(tx, order.ID, models.EventCouponRemoved, map[string]interface{}{
+			"code":   code,
+			"reason": "removed",
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// lockRedeemableCoupon locks the order's coupon at checkout and checks strictly that it
+// still applies, nil when the order has none. The lock is held until the checkout commits
+// so concurrent checkouts can't exceed the global or per-customer limits.
+func lockRedeemableCoupon(tx *gorm.DB, order *models.Order) (*models.Coupon, error) {
+	if order.CouponID == nil {
+		return nil, nil
+	}
+
+	var coupon models.Coupon
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&coupon, *order.CouponID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCouponNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateCoupon(&coupon, order, order.Subtotal, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := checkCouponUsage(tx, &coupon, order); err != nil {
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// redeemCoupon consumes one use of the coupon locked by lockRedeemableCoupon, once the
+// order was recalculated so the redemption records the final discount
+func redeemCoupon(tx *gorm.DB, order *models.Order, coupon *models.Coupon) error {
+	if coupon == nil || order.CouponID == nil {
+		return nil
+	}
+
+	if err := tx.Model(coupon).Update("times_used", gorm.Expr("times_used + 1")).Error; err != nil {
+		return err
+	}
+
+	redemption := models.CouponRedemption{
+		CouponID:   coupon.ID,
+		OrderID:    order.ID,
+		CustomerID: order.CustomerID,
+		Discount:   order.Discount,
+		Currency:   order.Currency,
+	}
+	if order.CustomerID == nil {
+		redemption.Email = order.GuestEmail
+	}
+	if err := tx.Create(&redemption).Error; err != nil {
+		return err
+	}
+
+	return RecordOrderEvent(tx, order.ID, models.EventCouponRedeemed, map[string]interface{}{
+		"code":           coupon.Code,
+		"discount_minor": order.Discount.Amount,
+	})
+}
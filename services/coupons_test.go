@@ -0,0 +1,128 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"oms-services/models"
+	"oms-services/money"
+)
+
+func TestValidateCoupon(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+	egp, usd := "EGP", "USD"
+	one := 1
+
+	tests := []struct {
+		name     string
+		coupon   models.Coupon
+		subtotal int64
+		err      error
+	}{
+		{name: "active", coupon: models.Coupon{IsActive: true}, subtotal: 1000},
+		{name: "inactive", coupon: models.Coupon{}, subtotal: 1000, err: ErrCouponInactive},
+		{name: "not started", coupon: models.Coupon{IsActive: true, StartsAt: &after}, subtotal: 1000, err: ErrCouponNotStarted},
+		{name: "started", coupon: models.Coupon{IsActive: true, StartsAt: &before}, subtotal: 1000},
+		{name: "expired", coupon: models.Coupon{IsActive: true, EndsAt: &before}, subtotal: 1000, err: ErrCouponExpired},
+		{name: "ends now", coupon: models.Coupon{IsActive: true, EndsAt: &now}, subtotal: 1000, err: ErrCouponExpired},
+		{name: "other currency", coupon: models.Coupon{IsActive: true, Currency: &usd}, subtotal: 1000, err: ErrCouponCurrency},
+		{name: "below minimum", coupon: models.Coupon{IsActive: true, Currency: &egp, MinSubtotal: money.New(1001, "EGP")}, subtotal: 1000, err: ErrCouponMinSubtotal},
+		{name: "at minimum", coupon: models.Coupon{IsActive: true, Currency: &egp, MinSubtotal: money.New(1000, "EGP")}, subtotal: 1000},
+		// The order redeeming the last use is recalculated after the redemption
+		{name: "usage limit reached", coupon: models.Coupon{IsActive: true, UsageLimit: &one, TimesUsed: 1}, subtotal: 1000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &models.Order{Currency: "EGP"}
+			err := validateCoupon(&tt.coupon, order, money.New(tt.subtotal, "EGP"), now)
+			if !errors.Is(err, tt.err) {
+				t.Errorf("validateCoupon() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheckCouponUsage(t *testing.T) {
+	one, two := 1, 2
+
+	tests := []struct {
+		name   string
+		coupon models.Coupon
+		err    error
+	}{
+		{name: "unlimited", coupon: models.Coupon{TimesUsed: 10}},
+		{name: "below limit", coupon: models.Coupon{UsageLimit: &two, TimesUsed: 1}},
+		{name: "last use", coupon: models.Coupon{UsageLimit: &one, TimesUsed: 0}},
+		{name: "limit reached", coupon: models.Coupon{UsageLimit: &one, TimesUsed: 1}, err: ErrCouponUsageLimit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Without a per-customer limit the redemptions are never queried
+			err := checkCouponUsage(nil, &tt.coupon, &models.Order{Currency: "EGP"})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("checkCouponUsage() error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCouponDiscount(t *testing.T) {
+	tests := []struct {
+		name     string
+		coupon   models.Coupon
+		subtotal int64
+		want     int64
+	}{
+		{name: "percentage", coupon: models.Coupon{Type: models.CouponTypePercentage, PercentOff: 15}, subtotal: 1000, want: 150},
+		{name: "percentage rounds", coupon: models.Coupon{Type: models.CouponTypePercentage, PercentOff: 15}, subtotal: 1005, want: 151},
+		{name: "full percentage", coupon: models.Coupon{Type: models.CouponTypePercentage, PercentOff: 100}, subtotal: 1000, want: 1000},
+		{name: "fixed amount", coupon: models.Coupon{Type: models.CouponTypeFixedAmount, AmountOff: money.New(300, "EGP")}, subtotal: 1000, want: 300},
+		{name: "fixed amount capped", coupon: models.Coupon{Type: models.CouponTypeFixedAmount, AmountOff: money.New(3000, "EGP")}, subtotal: 1000, want: 1000},
+		{name: "free shipping", coupon: models.Coupon{Type: models.CouponTypeFreeShipping}, subtotal: 1000, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := couponDiscount(&tt.coupon, money.New(tt.subtotal, "EGP"))
+			if err != nil {
+				t.Fatalf("couponDiscount() error = %v", err)
+			}
+			if got.Amount != tt.want || got.Currency != "EGP" {
+				t.Errorf("couponDiscount() = %v, want %d EGP", got, tt.want)
+			}
+		})
+	}
+}
+
+// An order holding the last use of a coupon keeps its discount when recalculated, only
+// other orders are refused the coupon.
+func TestLastCouponUseKeepsDiscount(t *testing.T) {
+	one := 1
+	now := time.Now()
+	coupon := models.Coupon{Type: models.CouponTypePercentage, PercentOff: 10, UsageLimit: &one, IsActive: true}
+	order := &models.Order{Currency: "EGP"}
+	subtotal := money.New(2000, "EGP")
+
+	if err := checkCouponUsage(nil, &coupon, order); err != nil {
+		t.Fatalf("checkCouponUsage() before redemption error = %v", err)
+	}
+	coupon.TimesUsed++
+
+	if err := validateCoupon(&coupon, order, subtotal, now); err != nil {
+		t.Fatalf("validateCoupon() after redemption error = %v, the coupon would be dropped", err)
+	}
+	discount, err := couponDiscount(&coupon, subtotal)
+	if err != nil {
+		t.Fatalf("couponDiscount() error = %v", err)
+	}
+	if discount.Amount != 200 {
+		t.Errorf("discount = %d, want 200", discount.Amount)
+	}
+	if err := checkCouponUsage(nil, &coupon, order); !errors.Is(err, ErrCouponUsageLimit) {
+		t.Errorf("checkCouponUsage() after redemption error = %v, want %v", err, ErrCouponUsageLimit)
+	}
+}
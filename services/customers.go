@@ -0,0 +1,467 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"oms-services/mailer"
+	"oms-services/models"
+	"oms-services/money"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrAddressNotFound = errors.New("address not found")
+
+// SaveAddress creates or updates a customer address, making sure a customer
+// keeps at most one default billing and one default shipping address
+func SaveAddress(tx *gorm.DB, address *models.Address) error {
+	return tx.Transaction(func(tx *gorm.DB) error {
+		if err := clearDefaultAddresses(tx, address); err != nil {
+			return err
+		}
+
+		if address.ID == uuid.Nil {
+			return tx.Create(address).Error
+		}
+		return tx.Select("*").Omit("id", "customer_id", "created_at").Updates(address).Error
+	})
+}
+
+// clearDefaultAddresses unsets the default flags on the customer's other addresses
+// when the given address is about to take them over
+func clearDefaultAddresses(tx *gorm.DB, address *models.Address) error {
+	others := tx.Model(&models.Address{}).
+		Where("customer_id = ? AND id <> ?", address.CustomerID, address.ID).
+		Session(&gorm.Session{})
+
+	if address.IsDefaultBilling {
+		if err := others.Update("is_default_billing", false).Error; err != nil {
+			return err
+		}
+	}
+	if address.IsDefaultShipping {
+		if err := others.Update("is_default_shipping", false).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindCustomerAddress loads an address making sure it belongs to the customer
+func FindCustomerAddress(tx *gorm.DB, customerID, addressID uuid.UUID) (*models.Address, error) {
+	var address models.Address
+	err := tx.Where("id = ? AND customer_id = ?", addressID, customerID).First(&address).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAddressNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &address, nil
+}
+
+// CustomerSummary is the lifetime view of a customer used by support agents
+type CustomerSummary struct {
+	CustomerID         uuid.UUID                 `json:"customer_id"`
+	OrderCount         int                       `json:"order_count"`
+	RefundedOrderCount int                       `json:"refunded_order_count"`
+	RefundRate         float64                   `json:"refund_rate"` // Share of placed orders with a processed refund
+	FirstOrderAt       *time.Time                `json:"first_order_at"`
+	LastOrderAt        *time.Time                `json:"last_order_at"`
+	Currencies         []CustomerCurrencySummary `json:"currencies"`
+}
+
+// CustomerCurrencySummary holds the money figures of a customer in a single currency
+type CustomerCurrencySummary struct {
+	Currency          string      `json:"currency"`
+	OrderCount        int         `json:"order_count"`
+	Ordered           money.Money `json:"ordered"`
+	Paid              money.Money `json:"paid"`
+	Refunded          money.Money `json:"refunded"`
+	LifetimeValue     money.Money `json:"lifetime_value"` // Paid minus refunded
+	AverageOrderValue money.Money `json:"average_order_value"`
+}
+
+// placedOrderStatuses are the statuses of orders that went through checkout
+var placedOrderStatuses = []models.OrderStatus{
+	models.OrderStatusPendingPayment,
+	models.OrderStatusPaid,
+	models.OrderStatusFulfillmentInProgress,
+	models.OrderStatusShipped,
+	models.OrderStatusCompleted,
+}
+
+// settledPaymentStatuses are the statuses of payments that moved money
+var settledPaymentStatuses = []models.PaymentStatus{
+	models.PaymentStatusCaptured,
+	models.PaymentStatusPartialRefunded,
+	models.PaymentStatusRefunded,
+}
+
+// SummarizeCustomer computes the customer's order count, lifetime value per currency,
+// refund rate, first/last order dates and average order value
+func SummarizeCustomer(db *gorm.DB, customerID uuid.UUID) (*CustomerSummary, error) {
+	summary := &CustomerSummary{CustomerID: customerID, Currencies: []CustomerCurrencySummary{}}
+
+	var orderRows []struct {
+		Currency     string
+		OrderCount   int
+		OrderedMinor int64
+		FirstOrderAt time.Time
+		LastOrderAt  time.Time
+	}
+	err := db.Model(&models.Order{}).
+		Select("currency, COUNT(*) AS order_count, COALESCE(SUM(total_minor), 0) AS ordered_minor, MIN(created_at) AS first_order_at, MAX(created_at) AS last_order_at").
+		Where("customer_id = ? AND status IN ?", customerID, placedOrderStatuses).
+		Group("currency").
+		Order("currency").
+		Scan(&orderRows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var paymentRows []struct {
+		Currency  string
+		PaidMinor int64
+	}
+	err = db.Model(&models.Payment{}).
+		Select("payments.currency, COALESCE(SUM(payments.amount_minor), 0) AS paid_minor").
+		Joins("JOIN orders ON orders.id = payments.order_id").
+		Where("orders.customer_id = ? AND payments.status IN ?", customerID, settledPaymentStatuses).
+		Group("payments.currency").
+		Scan(&paymentRows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var refundRows []struct {
+		Currency      string
+		RefundedMinor int64
+		OrderCount    int
+	}
+	err = db.Model(&models.Refund{}).
+		Select("orders.currency, COALESCE(SUM(refunds.amount_minor), 0) AS refunded_minor, COUNT(DISTINCT refunds.order_id) FILTER (WHERE orders.status IN ?) AS order_count", placedOrderStatuses).
+		Joins("JOIN orders ON orders.id = refunds.order_id").
+		Where("orders.customer_id = ? AND refunds.status = ?", customerID, models.RefundStatusProcessed).
+		Group("orders.currency").
+		Scan(&refundRows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	paid := map[string]int64{}
+	for _, row := range paymentRows {
+		paid[row.Currency] = row.PaidMinor
+	}
+	refunded := map[string]int64{}
+	for _, row := range refundRows {
+		refunded[row.Currency] = row.RefundedMinor
+		summary.RefundedOrderCount += row.OrderCount
+	}
+
+	for _, row := range orderRows {
+		first, last := row.FirstOrderAt, row.LastOrderAt
+		if summary.FirstOrderAt == nil || first.Before(*summary.FirstOrderAt) {
+			summary.FirstOrderAt = &first
+		}
+		if summary.LastOrderAt == nil || last.After(*summary.LastOrderAt) {
+			summary.LastOrderAt = &last
+		}
+		summary.OrderCount += row.OrderCount
+
+		currency := CustomerCurrencySummary{
+			Currency:          row.Currency,
+			OrderCount:        row.OrderCount,
+			Ordered:           money.New(row.OrderedMinor, row.Currency),
+			Paid:              money.New(paid[row.Currency], row.Currency),
+			Refunded:          money.New(refunded[row.Currency], row.Currency),
+			LifetimeValue:     money.New(paid[row.Currency]-refunded[row.Currency], row.Currency),
+			AverageOrderValue: money.Zero(row.Currency),
+		}
+		if row.OrderCount > 0 {
+			currency.AverageOrderValue = money.New(row.OrderedMinor, row.Currency).MulFraction(1, int64(row.OrderCount))
+		}
+		summary.Currencies = append(summary.Currencies, currency)
+	}
+
+	if summary.OrderCount > 0 {
+		summary.RefundRate = float64(summary.RefundedOrderCount) / float64(summary.OrderCount)
+	}
+
+	return summary, nil
+}
+
+var (
+	ErrCustomerNotFound   = errors.New("customer not found")
+	ErrEmailNotVerified   = errors.New("customer email is not verified")
+	ErrMergeSameCustomer  = errors.New("cannot merge a customer into itself")
+	ErrCustomerEmailTaken = errors.New("another customer uses this email")
+	ErrVerificationToken  = errors.New("invalid or expired verification token")
+)
+
+// emailVerificationTTL is how long a verification token sent to a customer stays valid
+const emailVerificationTTL = 24 * time.Hour
+
+func lockCustomer(tx *gorm.DB, customerID uuid.UUID) (*models.Customer, error) {
+	var customer models.Customer
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&customer, customerID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCustomerNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &customer, nil
+}
+
+// UpdateCustomer edits a customer. A new email is unverified until the customer proves
+// owning it again, so it can't be used to claim the guest orders of someone else.
+func UpdateCustomer(db *gorm.DB, customerID uuid.UUID, updates map[string]interface{}) (*models.Customer, error) {
+	var customer *models.Customer
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		customer, err = lockCustomer(tx, customerID)
+		if err != nil {
+			return err
+		}
+
+		if email, ok := updates["email"].(string); ok && !strings.EqualFold(email, customer.Email) {
+			var taken int64
+			err := tx.Model(&models.Customer{}).Where("lower(email) = lower(?) AND id <> ?", email, customer.ID).Count(&taken).Error
+			if err != nil {
+				return err
+			}
+			if taken > 0 {
+				return ErrCustomerEmailTaken
+			}
+			updates["email_verified_at"] = nil
+			updates["email_verification_hash"] = nil
+			updates["email_verification_expires_at"] = nil
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(customer).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.First(customer, customer.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return customer, nil
+}
+
+// RequestEmailVerification emails the customer a token proving they own their email.
+// Only its hash is kept, and a new token replaces the previous one. The token never
+// leaves through the API, whoever verifies must have read the email.
+func RequestEmailVerification(ctx context.Context, db *gorm.DB, sender mailer.Mailer, customerID uuid.UUID) (time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return time.Time{}, err
+	}
+	token := hex.EncodeToString(raw)
+	expiresAt := time.Now().Add(emailVerificationTTL)
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		customer, err := lockCustomer(tx, customerID)
+		if err != nil {
+			return err
+		}
+		err = tx.Model(customer).Updates(map[string]interface{}{
+			"email_verification_hash":       verificationHash(token),
+			"email_verification_expires_at": expiresAt,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		// Sent last, the token is only stored when the email went out
+		return sender.Send(ctx, mailer.Message{
+			To:      customer.Email,
+			Subject: "Verify your email address",
+			Body: fmt.Sprintf("Hello %s,\n\nYour email verification code is:\n\n%s\n\nIt expires on %s.\n",
+				customer.FirstName, token, expiresAt.UTC().Format(time.RFC1123)),
+		})
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return expiresAt, nil
+}
+
+// VerifyCustomerEmail marks the customer's email as verified with the token sent to it
+func VerifyCustomerEmail(db *gorm.DB, customerID uuid.UUID, token string) (*models.Customer, error) {
+	var customer *models.Customer
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		customer, err = lockCustomer(tx, customerID)
+		if err != nil {
+			return err
+		}
+		if customer.EmailVerificationHash == nil || customer.EmailVerificationExpiresAt == nil ||
+			!time.Now().Before(*customer.EmailVerificationExpiresAt) ||
+			subtle.ConstantTimeCompare([]byte(*customer.EmailVerificationHash), []byte(verificationHash(token))) != 1 {
+			return ErrVerificationToken
+		}
+
+		now := time.Now()
+		customer.EmailVerifiedAt = &now
+		customer.EmailVerificationHash = nil
+		customer.EmailVerificationExpiresAt = nil
+		return tx.Model(customer).Updates(map[string]interface{}{
+			"email_verified_at":             now,
+			"email_verification_hash":       nil,
+			"email_verification_expires_at": nil,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return customer, nil
+}
+
+// ClaimGuestOrders attaches every guest order placed with the customer's verified
+// email to the customer and returns the IDs of the claimed orders
+func ClaimGuestOrders(db *gorm.DB, customerID uuid.UUID) ([]uuid.UUID, error) {
+	claimed := []uuid.UUID{}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		customer, err := lockCustomer(tx, customerID)
+		if err != nil {
+			return err
+		}
+		if customer.EmailVerifiedAt == nil {
+			return ErrEmailNotVerified
+		}
+
+		var orders []models.Order
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("customer_id IS NULL AND lower(guest_email) = lower(?)", customer.Email).
+			Find(&orders).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range orders {
+			order := &orders[i]
+			if err := tx.Model(order).Updates(map[string]interface{}{
+				"customer_id": customer.ID,
+				"version":     gorm.Expr("version + 1"),
+			}).Error; err != nil {
+				return err
+			}
+			if err := RecordOrderEvent(tx, order.ID, models.EventCustomerLinked, map[string]interface{}{
+				"customer_id": customer.ID,
+				"guest_email": order.GuestEmail,
+			}); err != nil {
+				return err
+			}
+			claimed = append(claimed, order.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return claimed, nil
+}
+
+// MergeCustomers folds a duplicate customer into the target one: orders and
+// addresses are re-pointed to the target, every moved order gets a
+// customer_merged event and the duplicate is deleted
+func MergeCustomers(db *gorm.DB, targetID, sourceID uuid.UUID) (*models.Customer, error) {
+	if targetID == sourceID {
+		return nil, ErrMergeSameCustomer
+	}
+
+	var target *models.Customer
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		target, err = lockCustomer(tx, targetID)
+		if err != nil {
+			return err
+		}
+		source, err := lockCustomer(tx, sourceID)
+		if err != nil {
+			return err
+		}
+
+		var orders []models.Order
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("customer_id = ?", source.ID).
+			Find(&orders).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range orders {
+			order := &orders[i]
+			if err := tx.Model(order).Updates(map[string]interface{}{
+				"customer_id": target.ID,
+				"version":     gorm.Expr("version + 1"),
+			}).Error; err != nil {
+				return err
+			}
+			if err := RecordOrderEvent(tx, order.ID, models.EventCustomerMerged, map[string]interface{}{
+				"from_customer_id": source.ID,
+				"to_customer_id":   target.ID,
+			}); err != nil {
+				return err
+			}
+		}
+
+		// Addresses move too so drafts still reference a valid address book entry.
+		// The target keeps its own defaults, the duplicate's addresses join as regular entries
+		var targetDefaults struct {
+			Billing  bool
+			Shipping bool
+		}
+		err = tx.Model(&models.Address{}).
+			Select("COALESCE(bool_or(is_default_billing), false) AS billing, COALESCE(bool_or(is_default_shipping), false) AS shipping").
+			Where("customer_id = ?", target.ID).
+			Scan(&targetDefaults).Error
+		if err != nil {
+			return err
+		}
+
+		updates := map[string]interface{}{"customer_id": target.ID}
+		if targetDefaults.Billing {
+			updates["is_default_billing"] = false
+		}
+		if targetDefaults.Shipping {
+			updates["is_default_shipping"] = false
+		}
+		if err := tx.Model(&models.Address{}).Where("customer_id = ?", source.ID).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(source).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return target, nil
+}
+
+func verificationHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
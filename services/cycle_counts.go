@@ -0,0 +1,360 @@
+package services
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"oms-services/models"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCycleCountNotFound   = errors.New("cycle count not found")
+	ErrCycleCountNotOpen    = errors.New("cycle count is not open")
+	ErrCycleCountOverlap    = errors.New("variant is already being counted at the location")
+	ErrCycleCountEmpty      = errors.New("cycle count has no variants to count")
+	ErrCycleCountIncomplete = errors.New("cycle count has uncounted variants")
+	ErrCycleCountLine       = errors.New("cycle count entry is invalid")
+)
+
+// CycleCountVariance is a counted variant compared with its stock at the location
+type CycleCountVariance struct {
+	VariantID        uuid.UUID `json:"variant_id"`
+	SKU              string    `json:"sku"`
+	ExpectedQty      int       `json:"expected_qty"` // On hand when the count started
+	CountedQty       *int      `json:"counted_qty"`
+	QtyOnHandAtCount *int      `json:"qty_on_hand_at_count"`
+	Variance         *int      `json:"variance"` // nil until counted
+	QtyOnHand        int       `json:"qty_on_hand"`
+	QtyReserved      int       `json:"qty_reserved"`
+}
+
+// CycleCountEntry is the quantity of a variant found on the shelf
+type CycleCountEntry struct {
+	VariantID  uuid.UUID
+	CountedQty int
+}
+
+// StartCycleCount opens a count of variants at a location, the default one when
+// locationID is nil. Without variants, every variant stocked at the location is counted.
+// A variant can only be in one open count per location.
+func StartCycleCount(db *gorm.DB, locationID *uuid.UUID, variantIDs []uuid.UUID, note *string, actor *string) (*models.CycleCount, error) {
+	var count models.CycleCount
+	err := db.Transaction(func(tx *gorm.DB) error {
+		location, err := resolveLocation(tx, locationID)
+		if err != nil {
+			return err
+		}
+		// Counts of a location start one at a time so they can't overlap
+		if _, err := lockLocation(tx, location.ID); err != nil {
+			return err
+		}
+
+		if len(variantIDs) == 0 {
+			err := tx.Model(&models.Inventory{}).Where("location_id = ?", location.ID).Pluck("variant_id", &variantIDs).Error
+			if err != nil {
+				return err
+			}
+		}
+		slices.SortFunc(variantIDs, func(a, b uuid.UUID) int { return slices.Compare(a[:], b[:]) })
+		variantIDs = slices.Compact(variantIDs)
+		if len(variantIDs) == 0 {
+			return ErrCycleCountEmpty
+		}
+
+		var counting []string
+		err = tx.Model(&models.CycleCountLine{}).
+			Joins("JOIN cycle_counts ON cycle_counts.id = cycle_count_lines.cycle_count_id").
+			Joins("JOIN product_variants ON product_variants.id = cycle_count_lines.variant_id").
+			Where("cycle_counts.status = ? AND cycle_counts.location_id = ? AND cycle_count_lines.variant_id IN ?",
+				models.CycleCountStatusOpen, location.ID, variantIDs).
+			Pluck("product_variants.sku", &counting).Error
+		if err != nil {
+			return err
+		}
+		if len(counting) > 0 {
+			return fmt.Errorf("%w: %s", ErrCycleCountOverlap, counting[0])
+		}
+
+		count = models.CycleCount{
+			LocationID: location.ID,
+			Status:     models.CycleCountStatusOpen,
+			Note:       note,
+			StartedBy:  actor,
+		}
+		if err := tx.Create(&count).Error; err != nil {
+			return err
+		}
+
+		for _, variantID := range variantIDs {
+			inventory, err := lockInventory(tx, variantID, &location.ID)
+			if err != nil {
+				return err
+			}
+			line := models.CycleCountLine{
+				CycleCountID: count.ID,
+				VariantID:    variantID,
+				ExpectedQty:  inventory.QtyOnHand,
+			}
+			if err := tx.Create(&line).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetCycleCount(db, count.ID)
+}
+
+// GetCycleCount loads a cycle count with its lines
+func GetCycleCount(db *gorm.DB, countID uuid.UUID) (*models.CycleCount, error) {
+	var count models.CycleCount
+	err := db.Preload("Location").
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		Preload("Lines.Variant").
+		First(&count, countID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCycleCountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &count, nil
+}
+
+// SubmitCycleCount records the quantities counted for variants of an open count, along
+// with the stock on hand at that moment. Variants can be counted again until approval.
+func SubmitCycleCount(db *gorm.DB, countID uuid.UUID, entries []CycleCountEntry) (*models.CycleCount, error) {
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("%w: nothing counted", ErrCycleCountLine)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		count, err := lockCycleCount(tx, countID)
+		if err != nil {
+			return err
+		}
+		if count.Status != models.CycleCountStatusOpen {
+			return ErrCycleCountNotOpen
+		}
+
+		lines, err := cycleCountLines(tx, count)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		for _, entry := range entries {
+			if entry.CountedQty < 0 {
+				return fmt.Errorf("%w: counted quantity can't be negative", ErrCycleCountLine)
+			}
+			i := slices.IndexFunc(lines, func(line models.CycleCountLine) bool { return line.VariantID == entry.VariantID })
+			if i < 0 {
+				return fmt.Errorf("%w: variant %s is not in the count", ErrCycleCountLine, entry.VariantID)
+			}
+
+			var inventory models.Inventory
+			err := tx.Where("variant_id = ? AND location_id = ?", entry.VariantID, count.LocationID).First(&inventory).Error
+			if err != nil {
+				return err
+			}
+
+			err = tx.Model(&lines[i]).Updates(map[string]interface{}{
+				"counted_qty":          entry.CountedQty,
+				"qty_on_hand_at_count": inventory.QtyOnHand,
+				"counted_at":           now,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetCycleCount(db, countID)
+}
+
+// ApproveCycleCount corrects the stock of the counted variants by their variances, all
+// at once, each correction recorded in the stock ledger. Corrections apply to the stock
+// on hand at approval, so units received or shipped since a variant was counted are
+// kept. Reservations don't change the stock on hand and are not counted against the
+// variances, those the corrected stock no longer covers go back to backorder.
+func ApproveCycleCount(db *gorm.DB, countID uuid.UUID, actor *string) (*models.CycleCount, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		count, err := lockCycleCount(tx, countID)
+		if err != nil {
+			return err
+		}
+		if count.Status != models.CycleCountStatusOpen {
+			return ErrCycleCountNotOpen
+		}
+
+		lines, err := cycleCountLines(tx, count)
+		if err != nil {
+			return err
+		}
+		for _, line := range lines {
+			if line.Variance == nil {
+				return fmt.Errorf("%w: variant %s", ErrCycleCountIncomplete, line.VariantID)
+			}
+		}
+
+		referenceType := models.ReferenceCycleCount
+		source := MovementSource{
+			Reason:        models.MovementCorrection,
+			ReferenceType: &referenceType,
+			ReferenceID:   &count.ID,
+			Actor:         actor,
+			Note:          count.Note,
+		}
+		for _, line := range lines {
+			if *line.Variance == 0 {
+				continue
+			}
+			inventory, err := lockInventory(tx, line.VariantID, &count.LocationID)
+			if err != nil {
+				return err
+			}
+			qtyOnHand, shortage := cycleCountCorrection(inventory, *line.Variance)
+			if shortage > 0 {
+				err = backorderShortage(tx, inventory, shortage)
+			}
+			if err == nil {
+				err = setQtyOnHand(tx, inventory, qtyOnHand, source)
+			}
+			if errors.Is(err, ErrStockBelowReserved) {
+				var variant models.ProductVariant
+				if err := tx.Select("sku").First(&variant, line.VariantID).Error; err != nil {
+					return err
+				}
+				return fmt.Errorf("%w: %s", ErrStockBelowReserved, variant.SKU)
+			}
+			if err != nil {
+				return err
+			}
+			if err := fillBackorders(tx, inventory); err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(count).Updates(map[string]interface{}{
+			"status":      models.CycleCountStatusApproved,
+			"approved_by": actor,
+			"approved_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetCycleCount(db, countID)
+}
+
+// CycleCountVariances compares the lines of a count with the stock of their variants,
+// the largest variances first and the variants not counted yet last
+func CycleCountVariances(db *gorm.DB, countID uuid.UUID) ([]CycleCountVariance, error) {
+	count, err := GetCycleCount(db, countID)
+	if err != nil {
+		return nil, err
+	}
+
+	var inventories []models.Inventory
+	err = db.Where("location_id = ? AND variant_id IN (SELECT variant_id FROM cycle_count_lines WHERE cycle_count_id = ?)", count.LocationID, count.ID).
+		Find(&inventories).Error
+	if err != nil {
+		return nil, err
+	}
+	byKey := indexInventories(inventories)
+
+	variances := make([]CycleCountVariance, len(count.Lines))
+	for i, line := range count.Lines {
+		variances[i] = CycleCountVariance{
+			VariantID:        line.VariantID,
+			ExpectedQty:      line.ExpectedQty,
+			CountedQty:       line.CountedQty,
+			QtyOnHandAtCount: line.QtyOnHandAtCount,
+			Variance:         line.Variance,
+		}
+		if line.Variant != nil {
+			variances[i].SKU = line.Variant.SKU
+		}
+		if inventory, ok := byKey[inventoryKey{line.VariantID, count.LocationID}]; ok {
+			variances[i].QtyOnHand = inventory.QtyOnHand
+			variances[i].QtyReserved = inventory.QtyReserved
+		}
+	}
+	sortCycleCountVariances(variances)
+	return variances, nil
+}
+
+// cycleCountCorrection returns the stock on hand of an inventory corrected by a variance
+// and the reserved units it no longer covers
+func cycleCountCorrection(inventory *models.Inventory, variance int) (int, int) {
+	qtyOnHand := inventory.QtyOnHand + variance
+	return qtyOnHand, max(inventory.QtyReserved-qtyOnHand, 0)
+}
+
+// sortCycleCountVariances puts the largest variances, gains or losses, first and the
+// variants not counted yet last
+func sortCycleCountVariances(variances []CycleCountVariance) {
+	slices.SortStableFunc(variances, func(a, b CycleCountVariance) int {
+		switch {
+		case a.Variance == nil && b.Variance == nil:
+			return 0
+		case a.Variance == nil:
+			return 1
+		case b.Variance == nil:
+			return -1
+		}
+		return cmp.Compare(max(*b.Variance, -*b.Variance), max(*a.Variance, -*a.Variance))
+	})
+}
+
+// CancelCycleCount drops an open count without touching the stock
+func CancelCycleCount(db *gorm.DB, countID uuid.UUID) (*models.CycleCount, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		count, err := lockCycleCount(tx, countID)
+		if err != nil {
+			return err
+		}
+		if count.Status != models.CycleCountStatusOpen {
+			return ErrCycleCountNotOpen
+		}
+		return tx.Model(count).Updates(map[string]interface{}{
+			"status":       models.CycleCountStatusCancelled,
+			"cancelled_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetCycleCount(db, countID)
+}
+
+// cycleCountLines loads the lines of a count in variant order, the order their
+// inventories are locked in
+func cycleCountLines(tx *gorm.DB, count *models.CycleCount) ([]models.CycleCountLine, error) {
+	var lines []models.CycleCountLine
+	err := tx.Where("cycle_count_id = ?", count.ID).Order("variant_id").Find(&lines).Error
+	return lines, err
+}
+
+func lockCycleCount(tx *gorm.DB, countID uuid.UUID) (*models.CycleCount, error) {
+	var count models.CycleCount
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&count, countID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCycleCountNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &count, nil
+}
@@ -0,0 +1,115 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"oms-services/models"
+)
+
+func TestCycleCountCorrection(t *testing.T) {
+	tests := []struct {
+		name         string
+		onHand       int
+		reserved     int
+		variance     int
+		wantOnHand   int
+		wantShortage int
+	}{
+		{name: "gain", onHand: 10, reserved: 4, variance: 3, wantOnHand: 13},
+		{name: "loss still covers reservations", onHand: 10, reserved: 4, variance: -6, wantOnHand: 4},
+		{name: "loss below reservations", onHand: 10, reserved: 4, variance: -8, wantOnHand: 2, wantShortage: 2},
+		{name: "everything lost", onHand: 5, reserved: 5, variance: -5, wantOnHand: 0, wantShortage: 5},
+		{name: "nothing reserved", onHand: 5, reserved: 0, variance: -5, wantOnHand: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inventory := &models.Inventory{QtyOnHand: tt.onHand, QtyReserved: tt.reserved}
+			onHand, shortage := cycleCountCorrection(inventory, tt.variance)
+			if onHand != tt.wantOnHand || shortage != tt.wantShortage {
+				t.Errorf("cycleCountCorrection() = %d, %d, want %d, %d", onHand, shortage, tt.wantOnHand, tt.wantShortage)
+			}
+		})
+	}
+}
+
+func TestShortAllocations(t *testing.T) {
+	tests := []struct {
+		name          string
+		allocated     []int // newest first
+		shortage      int
+		want          []int
+		wantUncovered int
+	}{
+		{name: "newest first", allocated: []int{2, 3, 4}, shortage: 4, want: []int{2, 2, 0}},
+		{name: "exact cover", allocated: []int{2, 3}, shortage: 5, want: []int{2, 3}},
+		{name: "uncovered remainder", allocated: []int{2, 3}, shortage: 7, want: []int{2, 3}, wantUncovered: 2},
+		{name: "no allocations", allocated: []int{}, shortage: 3, want: []int{}, wantUncovered: 3},
+		{name: "no shortage", allocated: []int{2, 3}, shortage: 0, want: []int{0, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			allocations := make([]models.StockAllocation, len(tt.allocated))
+			for i, quantity := range tt.allocated {
+				allocations[i].Quantity = quantity
+			}
+			taken, uncovered := shortAllocations(allocations, tt.shortage)
+			if !slices.Equal(taken, tt.want) || uncovered != tt.wantUncovered {
+				t.Errorf("shortAllocations() = %v, %d, want %v, %d", taken, uncovered, tt.want, tt.wantUncovered)
+			}
+		})
+	}
+}
+
+func TestSortCycleCountVariances(t *testing.T) {
+	variance := func(v int) *int { return &v }
+	tests := []struct {
+		name      string
+		variances []CycleCountVariance
+		want      []string
+	}{
+		{
+			name: "largest absolute variance first",
+			variances: []CycleCountVariance{
+				{SKU: "A", Variance: variance(2)},
+				{SKU: "B", Variance: variance(-5)},
+				{SKU: "C", Variance: variance(3)},
+			},
+			want: []string{"B", "C", "A"},
+		},
+		{
+			name: "not counted last",
+			variances: []CycleCountVariance{
+				{SKU: "A"},
+				{SKU: "B", Variance: variance(0)},
+				{SKU: "C"},
+				{SKU: "D", Variance: variance(-1)},
+			},
+			want: []string{"D", "B", "A", "C"},
+		},
+		{
+			name: "ties keep their order",
+			variances: []CycleCountVariance{
+				{SKU: "A", Variance: variance(-4)},
+				{SKU: "B", Variance: variance(4)},
+				{SKU: "C", Variance: variance(-4)},
+			},
+			want: []string{"A", "B", "C"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sortCycleCountVariances(tt.variances)
+			skus := make([]string, len(tt.variances))
+			for i, v := range tt.variances {
+				skus[i] = v.SKU
+			}
+			if !slices.Equal(skus, tt.want) {
+				t.Errorf("sortCycleCountVariances() = %v, want %v", skus, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package services
+
+import (
+	"encoding/json"
+	"oms-services/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RecordOrderEvent appends an event with a JSON payload to the order timeline
+func RecordOrderEvent(tx *gorm.DB, orderID uuid.UUID, eventType string, payload interface{}) error {
+	event := models.OrderEvent{
+		OrderID:   orderID,
+		EventType: eventType,
+	}
+
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body := string(raw)
+		event.Payload = &body
+	}
+
+	return tx.Create(&event).Error
+}
+
+// ChangeOrderStatus moves the order to a new status, reserving, consuming or releasing
+// its stock accordingly, and records a status_changed event. The order items must be loaded.
+func ChangeOrderStatus(tx *gorm.DB, order *models.Order, to models.OrderStatus) error {
+	from := order.Status
+	if from == to {
+		return nil
+	}
+
+	if err := updateOrderStock(tx, order, from, to); err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"status":  to,
+		"version": gorm.Expr("version + 1"),
+	}
+	var placedAt *time.Time
+	if from == models.OrderStatusDraft && to != models.OrderStatusCancelled {
+		now := time.Now()
+		placedAt = &now
+		updates["placed_at"] = now
+	}
+	if err := tx.Model(order).Updates(updates).Error; err != nil {
+		return err
+	}
+	order.Status = to
+	order.Version++
+	if placedAt != nil {
+		order.PlacedAt = placedAt
+	}
+
+	return RecordOrderEvent(tx, order.ID, models.EventStatusChanged, map[string]interface{}{
+		"from": from,
+		"to":   to,
+	})
+}
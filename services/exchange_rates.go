@@ -0,0 +1,171 @@
+package services
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"oms-services/models"
+	"oms-services/money"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrExchangeRateNotFound = errors.New("no exchange rate for the currency pair and date")
+	ErrInvalidExchangeRate  = errors.New("exchange rate is invalid")
+)
+
+// ReportingCurrency is the base currency reports are expressed in and order rates are
+// frozen to, set from the REPORTING_CURRENCY env variable at startup
+var ReportingCurrency = "EGP"
+
+// rateDateLayout is the layout of effective dates in APIs and CSV files
+const rateDateLayout = "2006-01-02"
+
+// SaveExchangeRate validates and upserts the rate of a currency pair for a day
+func SaveExchangeRate(db *gorm.DB, rate *models.ExchangeRate) error {
+	rate.BaseCurrency = strings.ToUpper(rate.BaseCurrency)
+	rate.QuoteCurrency = strings.ToUpper(rate.QuoteCurrency)
+	rate.EffectiveDate = truncateToDate(rate.EffectiveDate)
+
+	switch {
+	case !money.IsKnownCurrency(rate.BaseCurrency) || !money.IsKnownCurrency(rate.QuoteCurrency):
+		return fmt.Errorf("%w: unknown currency", ErrInvalidExchangeRate)
+	case rate.BaseCurrency == rate.QuoteCurrency:
+		return fmt.Errorf("%w: base and quote currencies must differ", ErrInvalidExchangeRate)
+	case rate.Rate.IsZero():
+		return fmt.Errorf("%w: rate must be positive", ErrInvalidExchangeRate)
+	}
+
+	return db.Clauses(clause.Returning{}, clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base_currency"}, {Name: "quote_currency"}, {Name: "effective_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "source", "updated_at"}),
+	}).Create(rate).Error
+}
+
+// ImportExchangeRates loads a CSV of daily rates with a "date,base,quote,rate" header,
+// all rows or none
+func ImportExchangeRates(db *gorm.DB, r io.Reader, source string) (int, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, fmt.Errorf("%w: missing header", ErrInvalidExchangeRate)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range []string{"date", "base", "quote", "rate"} {
+		if _, ok := columns[name]; !ok {
+			return 0, fmt.Errorf("%w: missing %q column", ErrInvalidExchangeRate, name)
+		}
+	}
+
+	imported := 0
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for line := 2; ; line++ {
+			record, err := reader.Read()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("%w: line %d: %v", ErrInvalidExchangeRate, line, err)
+			}
+
+			date, err := time.Parse(rateDateLayout, record[columns["date"]])
+			if err != nil {
+				return fmt.Errorf("%w: line %d: date must be YYYY-MM-DD", ErrInvalidExchangeRate, line)
+			}
+			value, err := money.ParseRate(record[columns["rate"]])
+			if err != nil {
+				return fmt.Errorf("%w: line %d: %v", ErrInvalidExchangeRate, line, err)
+			}
+
+			rate := models.ExchangeRate{
+				BaseCurrency:  record[columns["base"]],
+				QuoteCurrency: record[columns["quote"]],
+				EffectiveDate: date,
+				Rate:          value,
+				Source:        &source,
+			}
+			if err := SaveExchangeRate(tx, &rate); err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			imported++
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return imported, nil
+}
+
+// LookupExchangeRate returns the rate converting from into to in effect on the date,
+// i.e. the latest one loaded on or before it. The inverse pair is used when only the
+// opposite direction was loaded.
+func LookupExchangeRate(tx *gorm.DB, from, to string, date time.Time) (money.Rate, error) {
+	from, to = strings.ToUpper(from), strings.ToUpper(to)
+	if from == to {
+		return money.IdentityRate(), nil
+	}
+
+	var rates []models.ExchangeRate
+	err := tx.Where("((base_currency = ? AND quote_currency = ?) OR (base_currency = ? AND quote_currency = ?)) AND effective_date <= ?",
+		from, to, to, from, truncateToDate(date)).
+		Order("effective_date DESC").
+		Order(clause.Expr{SQL: "base_currency = ? DESC", Vars: []interface{}{from}}).
+		Limit(1).
+		Find(&rates).Error
+	if err != nil {
+		return money.Rate{}, err
+	}
+	if len(rates) == 0 {
+		return money.Rate{}, fmt.Errorf("%w: %s to %s on %s", ErrExchangeRateNotFound, from, to, date.Format(rateDateLayout))
+	}
+
+	if rates[0].BaseCurrency == from {
+		return rates[0].Rate, nil
+	}
+	return rates[0].Rate.Inverse(), nil
+}
+
+// ConvertAmount expresses an amount in another currency at the rate of the date
+func ConvertAmount(tx *gorm.DB, amount money.Money, to string, date time.Time) (money.Money, error) {
+	rate, err := LookupExchangeRate(tx, amount.Currency, to, date)
+	if err != nil {
+		return money.Money{}, err
+	}
+	return amount.Convert(strings.ToUpper(to), rate)
+}
+
+// freezeOrderExchangeRate stores the rate to the reporting currency on the order at
+// checkout. Orders are still placed when no rate was loaded yet, reports then fall
+// back to the rate table.
+func freezeOrderExchangeRate(tx *gorm.DB, order *models.Order) error {
+	rate, err := LookupExchangeRate(tx, order.Currency, ReportingCurrency, time.Now())
+	if errors.Is(err, ErrExchangeRateNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	currency := ReportingCurrency
+	order.ReportingCurrency = &currency
+	order.ExchangeRate = &rate
+	return tx.Model(order).Updates(map[string]interface{}{
+		"reporting_currency": order.ReportingCurrency,
+		"exchange_rate":      order.ExchangeRate,
+	}).Error
+}
+
+func truncateToDate(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
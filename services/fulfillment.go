@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"oms-services/carriers"
+	"oms-services/models"
+	"oms-services/storage"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOrderTransition    = errors.New("order can't move to this status")
+	ErrOrderNotFulfilling = errors.New("order is not being fulfilled")
+	ErrNothingToShip      = errors.New("order has nothing left to ship")
+	ErrShipmentNotFound   = errors.New("shipment not found")
+	ErrShipmentStatus     = errors.New("shipment status doesn't allow this")
+	ErrShipmentAddress    = errors.New("order has no shipping address")
+)
+
+// orderTransitions are the statuses a placed order can move to from each status
+var orderTransitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderStatusPendingPayment:        {models.OrderStatusPaid, models.OrderStatusCancelled},
+	models.OrderStatusPaid:                  {models.OrderStatusFulfillmentInProgress, models.OrderStatusCancelled},
+	models.OrderStatusFulfillmentInProgress: {models.OrderStatusShipped, models.OrderStatusCancelled},
+	models.OrderStatusShipped:               {models.OrderStatusCompleted},
+}
+
+// TransitionOrder moves a placed order along its lifecycle, e.g. into fulfillment once
+// paid. Drafts are placed through checkout.
+func TransitionOrder(db *gorm.DB, orderID uuid.UUID, to models.OrderStatus) (*models.Order, error) {
+	var order *models.Order
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = LockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if !slices.Contains(orderTransitions[order.Status], to) {
+			return fmt.Errorf("%w: %s to %s", ErrOrderTransition, order.Status, to)
+		}
+		return ChangeOrderStatus(tx, order, to)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// CreateOrderShipments packs the stock allocated to an order being fulfilled, and not
+// shipped yet, into one shipment per location, buying the label of each shipment from
+// the carrier. Service is the carrier service, its default one when empty. The shipments
+// are committed first, holding their allocations, so the carrier is called without the
+// order locked; when a label can't be bought or recorded the shipments are deleted and
+// the labels bought are voided again.
+func CreateOrderShipments(ctx context.Context, db *gorm.DB, store storage.Storage, carrier carriers.Carrier, orderID uuid.UUID, service string) ([]models.Shipment, error) {
+	order, shipments, err := packOrderShipments(db, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	var labels []shippingLabel
+	for i := range shipments {
+		label, err := buyShipmentLabel(ctx, db, store, carrier, order, &shipments[i], service)
+		if err != nil {
+			discardOrderShipments(ctx, db, store, carrier, shipments, labels)
+			return nil, err
+		}
+		labels = append(labels, *label)
+	}
+
+	shipmentIDs := make([]uuid.UUID, len(shipments))
+	err = db.Transaction(func(tx *gorm.DB) error {
+		for i, shipment := range shipments {
+			// A shipment cancelled meanwhile is gone, its label is voided with the others
+			result := tx.Model(&models.Shipment{}).Where("id = ? AND carrier IS NULL", shipment.ID).Updates(map[string]interface{}{
+				"carrier":          shipment.Carrier,
+				"service":          shipment.Service,
+				"tracking_number":  shipment.TrackingNumber,
+				"label_key":        shipment.LabelKey,
+				"label_url":        shipment.LabelURL,
+				"label_cost_minor": shipment.LabelCost,
+				"label_currency":   shipment.LabelCurrency,
+			})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("%w: shipment %s was cancelled while its label was bought", ErrShipmentStatus, shipment.ID)
+			}
+
+			err := RecordOrderEvent(tx, order.ID, models.EventShipmentCreated, map[string]interface{}{
+				"shipment_id":     shipment.ID,
+				"location_id":     shipment.LocationID,
+				"carrier":         shipment.Carrier,
+				"service":         shipment.Service,
+				"tracking_number": shipment.TrackingNumber,
+			})
+			if err != nil {
+				return err
+			}
+			shipmentIDs[i] = shipment.ID
+		}
+		return nil
+	})
+	if err != nil {
+		discardOrderShipments(ctx, db, store, carrier, shipments, labels)
+		return nil, err
+	}
+
+	shipments = []models.Shipment{}
+	err = db.Preload("Location").Preload("Items.Variant").Where("id IN ?", shipmentIDs).Order("created_at").Find(&shipments).Error
+	if err != nil {
+		return nil, err
+	}
+	return shipments, nil
+}
+
+// packOrderShipments creates, without labels, the shipments of the stock allocated to
+// an order being fulfilled and not shipped yet, one per location
+func packOrderShipments(db *gorm.DB, orderID uuid.UUID) (*models.Order, []models.Shipment, error) {
+	var order *models.Order
+	var shipments []models.Shipment
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = LockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusFulfillmentInProgress {
+			return ErrOrderNotFulfilling
+		}
+		if order.ShippingAddressSnapshot == nil {
+			return ErrShipmentAddress
+		}
+
+		var allocations []models.StockAllocation
+		err = tx.Where("order_id = ? AND NOT EXISTS (SELECT 1 FROM shipment_items WHERE shipment_items.allocation_id = stock_allocations.id)", order.ID).
+			Order("created_at").
+			Find(&allocations).Error
+		if err != nil {
+			return err
+		}
+		if len(allocations) == 0 {
+			return ErrNothingToShip
+		}
+
+		byLocation := map[uuid.UUID]int{}
+		for _, allocation := range allocations {
+			i, ok := byLocation[allocation.LocationID]
+			if !ok {
+				i = len(shipments)
+				byLocation[allocation.LocationID] = i
+				shipments = append(shipments, models.Shipment{
+					ID:         uuid.New(),
+					OrderID:    order.ID,
+					LocationID: allocation.LocationID,
+					Status:     models.ShipmentStatusPending,
+				})
+			}
+			shipments[i].Items = append(shipments[i].Items, models.ShipmentItem{
+				AllocationID: allocation.ID,
+				OrderItemID:  allocation.OrderItemID,
+				VariantID:    allocation.VariantID,
+				Quantity:     allocation.Quantity,
+			})
+		}
+		return tx.Create(&shipments).Error
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return order, shipments, nil
+}
+
+// discardOrderShipments deletes the shipments of a failed CreateOrderShipments that
+// didn't get their label recorded, releasing their allocations, and voids the labels
+// bought for them. Failures are logged, like label voids.
+func discardOrderShipments(ctx context.Context, db *gorm.DB, store storage.Storage, carrier carriers.Carrier, shipments []models.Shipment, labels []shippingLabel) {
+	for _, label := range labels {
+		voidShippingLabel(ctx, store, carrier, label)
+	}
+
+	shipmentIDs := make([]uuid.UUID, len(shipments))
+	for i, shipment := range shipments {
+		shipmentIDs[i] = shipment.ID
+	}
+	if err := db.Where("id IN ? AND carrier IS NULL", shipmentIDs).Delete(&models.Shipment{}).Error; err != nil {
+		log.Printf("shipments: unable to delete the unlabelled shipments %v: %v", shipmentIDs, err)
+	}
+}
+
+// GetShipment loads a shipment with its location, items and tracking checkpoints
+func GetShipment(db *gorm.DB, shipmentID uuid.UUID) (*models.Shipment, error) {
+	var shipment models.Shipment
+	err := db.Preload("Location").
+		Preload("Items", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		Preload("Items.Variant").
+		Preload("Checkpoints", func(db *gorm.DB) *gorm.DB { return db.Order("occurred_at") }).
+		First(&shipment, shipmentID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShipmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &shipment, nil
+}
+
+// PackShipment marks a pending shipment as packed, its items being picked
+func PackShipment(db *gorm.DB, shipmentID uuid.UUID) (*models.Shipment, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		shipment, err := lockShipment(tx, shipmentID)
+		if err != nil {
+			return err
+		}
+		if shipment.Status != models.ShipmentStatusPending {
+			return fmt.Errorf("%w: only pending shipments can be packed", ErrShipmentStatus)
+		}
+		return tx.Model(shipment).Updates(map[string]interface{}{
+			"status":    models.ShipmentStatusPacked,
+			"packed_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetShipment(db, shipmentID)
+}
+
+func lockShipment(tx *gorm.DB, shipmentID uuid.UUID) (*models.Shipment, error) {
+	var shipment models.Shipment
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&shipment, shipmentID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShipmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &shipment, nil
+}
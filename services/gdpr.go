@@ -0,0 +1,325 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"oms-services/models"
+	"oms-services/money"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RedactedValue replaces personal data removed by an erasure request
+const RedactedValue = "[redacted]"
+
+// piiPayloadKeys are the OrderEvent payload keys that may hold personal data
+var piiPayloadKeys = map[string]bool{
+	"email":       true,
+	"guest_email": true,
+	"phone":       true,
+	"guest_phone": true,
+	"first_name":  true,
+	"last_name":   true,
+	"name":        true,
+	"line1":       true,
+	"line2":       true,
+	"postal_code": true,
+}
+
+// CustomerExport is the machine-readable bundle returned for a data subject access request
+type CustomerExport struct {
+	ExportedAt time.Time        `json:"exported_at"`
+	Customer   models.Customer  `json:"customer"`
+	Addresses  []models.Address `json:"addresses"`
+	Orders     []OrderExport    `json:"orders"`
+}
+
+type OrderExport struct {
+	ID                      uuid.UUID               `json:"id"`
+	Status                  models.OrderStatus      `json:"status"`
+	Currency                string                  `json:"currency"`
+	Subtotal                money.Money             `json:"subtotal"`
+	Total                   money.Money             `json:"total"`
+	GuestEmail              *string                 `json:"guest_email,omitempty"`
+	GuestPhone              *string                 `json:"guest_phone,omitempty"`
+	BillingAddressSnapshot  *models.AddressSnapshot `json:"billing_address,omitempty"`
+	ShippingAddressSnapshot *models.AddressSnapshot `json:"shipping_address,omitempty"`
+	CreatedAt               time.Time               `json:"created_at"`
+	Items                   []OrderItemExport       `json:"items"`
+	Payments                []PaymentExport         `json:"payments"`
+	Refunds                 []RefundExport          `json:"refunds"`
+	Events                  []OrderEventExport      `json:"events"`
+}
+
+type OrderItemExport struct {
+	VariantID uuid.UUID   `json:"variant_id"`
+	Quantity  int         `json:"quantity"`
+	UnitPrice money.Money `json:"unit_price"`
+	LineTotal money.Money `json:"line_total"`
+	Currency  string      `json:"currency"`
+}
+
+type PaymentExport struct {
+	ID        uuid.UUID            `json:"id"`
+	Provider  string               `json:"provider"`
+	Status    models.PaymentStatus `json:"status"`
+	Amount    money.Money          `json:"amount"`
+	Currency  string               `json:"currency"`
+	CreatedAt time.Time            `json:"created_at"`
+}
+
+type RefundExport struct {
+	ID        uuid.UUID           `json:"id"`
+	Status    models.RefundStatus `json:"status"`
+	Amount    money.Money         `json:"amount"`
+	Reason    *string             `json:"reason"`
+	CreatedAt time.Time           `json:"created_at"`
+}
+
+type OrderEventExport struct {
+	EventType string           `json:"event_type"`
+	Payload   *json.RawMessage `json:"payload"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// ExportCustomerData collects everything stored about a customer
+func ExportCustomerData(db *gorm.DB, customerID uuid.UUID) (*CustomerExport, error) {
+	var customer models.Customer
+	if err := db.First(&customer, customerID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCustomerNotFound
+		}
+		return nil, err
+	}
+
+	export := &CustomerExport{
+		ExportedAt: time.Now().UTC(),
+		Customer:   customer,
+		Addresses:  []models.Address{},
+		Orders:     []OrderExport{},
+	}
+
+	if err := db.Where("customer_id = ?", customer.ID).Order("created_at").Find(&export.Addresses).Error; err != nil {
+		return nil, err
+	}
+
+	var orders []models.Order
+	err := customerOrdersQuery(db, &customer).
+		Preload("Items").
+		Preload("Payments").
+		Preload("Refunds").
+		Preload("Events", func(tx *gorm.DB) *gorm.DB { return tx.Order("created_at") }).
+		Order("created_at").
+		Find(&orders).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, order := range orders {
+		export.Orders = append(export.Orders, exportOrder(order))
+	}
+
+	return export, nil
+}
+
+// customerOrdersQuery selects the customer's orders along with the guest orders
+// placed with their email that were never claimed. Guest orders are only included
+// once the customer verified the email, as ClaimGuestOrders requires, so nobody gets
+// at a stranger's orders by signing up with their address.
+func customerOrdersQuery(db *gorm.DB, customer *models.Customer) *gorm.DB {
+	if customer.EmailVerifiedAt == nil {
+		return db.Where("customer_id = ?", customer.ID)
+	}
+	return db.Where("customer_id = ? OR (customer_id IS NULL AND lower(guest_email) = lower(?))", customer.ID, customer.Email)
+}
+
+func exportOrder(order models.Order) OrderExport {
+	export := OrderExport{
+		ID:                      order.ID,
+		Status:                  order.Status,
+		Currency:                order.Currency,
+		Subtotal:                order.Subtotal,
+		Total:                   order.Total,
+		GuestEmail:              order.GuestEmail,
+		GuestPhone:              order.GuestPhone,
+		BillingAddressSnapshot:  order.BillingAddressSnapshot,
+		ShippingAddressSnapshot: order.ShippingAddressSnapshot,
+		CreatedAt:               order.CreatedAt,
+		Items:                   []OrderItemExport{},
+		Payments:                []PaymentExport{},
+		Refunds:                 []RefundExport{},
+		Events:                  []OrderEventExport{},
+	}
+
+	for _, item := range order.Items {
+		export.Items = append(export.Items, OrderItemExport{
+			VariantID: item.VariantID,
+			Quantity:  item.Quantity,
+			UnitPrice: item.UnitPrice,
+			LineTotal: item.LineTotal,
+			Currency:  item.Currency,
+		})
+	}
+	for _, payment := range order.Payments {
+		export.Payments = append(export.Payments, PaymentExport{
+			ID:        payment.ID,
+			Provider:  payment.Provider,
+			Status:    payment.Status,
+			Amount:    payment.Amount,
+			Currency:  payment.Currency,
+			CreatedAt: payment.CreatedAt,
+		})
+	}
+	for _, refund := range order.Refunds {
+		export.Refunds = append(export.Refunds, RefundExport{
+			ID:        refund.ID,
+			Status:    refund.Status,
+			Amount:    refund.Amount,
+			Reason:    refund.Reason,
+			CreatedAt: refund.CreatedAt,
+		})
+	}
+	for _, event := range order.Events {
+		var payload *json.RawMessage
+		if event.Payload != nil {
+			raw := json.RawMessage(*event.Payload)
+			payload = &raw
+		}
+		export.Events = append(export.Events, OrderEventExport{
+			EventType: event.EventType,
+			Payload:   payload,
+			CreatedAt: event.CreatedAt,
+		})
+	}
+
+	return export
+}
+
+// EraseCustomerData pseudonymises the customer's personal data. Orders, payments
+// and refunds are kept for accounting, but the personal data they carry
+// (guest contacts, address snapshots, event payloads) is redacted.
+func EraseCustomerData(db *gorm.DB, customerID uuid.UUID) (*models.Customer, error) {
+	var customer *models.Customer
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		customer, err = lockCustomer(tx, customerID)
+		if err != nil {
+			return err
+		}
+
+		var orders []models.Order
+		if err := customerOrdersQuery(tx, customer).Find(&orders).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		customer.FirstName = RedactedValue
+		customer.LastName = RedactedValue
+		customer.Email = fmt.Sprintf("erased+%s@invalid", customer.ID)
+		customer.Phone = RedactedValue
+		customer.EmailVerifiedAt = nil
+		customer.EmailVerificationHash = nil
+		customer.EmailVerificationExpiresAt = nil
+		customer.ErasedAt = &now
+		if err := tx.Model(customer).Select("first_name", "last_name", "email", "phone", "email_verified_at", "email_verification_hash", "email_verification_expires_at", "erased_at").Updates(customer).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("customer_id = ?", customer.ID).Delete(&models.Address{}).Error; err != nil {
+			return err
+		}
+
+		for i := range orders {
+			if err := redactOrder(tx, &orders[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return customer, nil
+}
+
+// redactOrder strips personal data from an order while keeping its financial figures
+func redactOrder(tx *gorm.DB, order *models.Order) error {
+	updates := map[string]interface{}{
+		"guest_email":               nil,
+		"guest_phone":               nil,
+		"billing_address_snapshot":  redactSnapshot(order.BillingAddressSnapshot),
+		"shipping_address_snapshot": redactSnapshot(order.ShippingAddressSnapshot),
+	}
+	if err := tx.Model(order).Updates(updates).Error; err != nil {
+		return err
+	}
+	if err := tx.Model(&models.CouponRedemption{}).Where("order_id = ?", order.ID).Update("email", nil).Error; err != nil {
+		return err
+	}
+
+	var events []models.OrderEvent
+	if err := tx.Where("order_id = ? AND payload IS NOT NULL", order.ID).Find(&events).Error; err != nil {
+		return err
+	}
+
+	for _, event := range events {
+		var payload interface{}
+		if err := json.Unmarshal([]byte(*event.Payload), &payload); err != nil {
+			return err
+		}
+		raw, err := json.Marshal(redactPayload(payload))
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&event).Update("payload", string(raw)).Error; err != nil {
+			return err
+		}
+	}
+
+	return RecordOrderEvent(tx, order.ID, models.EventCustomerErased, map[string]interface{}{
+		"customer_id": order.CustomerID,
+	})
+}
+
+// redactSnapshot keeps the location fields needed for tax and shipping reports
+func redactSnapshot(snapshot *models.AddressSnapshot) *models.AddressSnapshot {
+	if snapshot == nil {
+		return nil
+	}
+	return &models.AddressSnapshot{
+		FirstName: RedactedValue,
+		LastName:  RedactedValue,
+		Line1:     RedactedValue,
+		City:      snapshot.City,
+		Region:    snapshot.Region,
+		Country:   snapshot.Country,
+	}
+}
+
+// redactPayload walks a decoded JSON payload replacing personal data values
+func redactPayload(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			if piiPayloadKeys[key] {
+				if inner != nil {
+					v[key] = RedactedValue
+				}
+				continue
+			}
+			v[key] = redactPayload(inner)
+		}
+		return v
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = redactPayload(inner)
+		}
+		return v
+	}
+	return value
+}
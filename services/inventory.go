@@ -0,0 +1,199 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"oms-services/models"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidAdjustment  = errors.New("inventory adjustment is invalid")
+	ErrStockBelowReserved = errors.New("stock on hand can't go below the reserved quantity")
+	ErrBundleInventory    = errors.New("bundles are stocked through their components")
+)
+
+// GetInventory returns the stock levels of a variant at a location, the default one when
+// locationID is nil. A variant never stocked there comes back untracked with empty levels.
+func GetInventory(db *gorm.DB, variantID uuid.UUID, locationID *uuid.UUID) (*models.Inventory, error) {
+	var variant models.ProductVariant
+	err := db.Select("id", "product_id").First(&variant, variantID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrVariantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isBundle, err := isBundleVariant(db, &variant); err != nil {
+		return nil, err
+	} else if isBundle {
+		return nil, ErrBundleInventory
+	}
+
+	location, err := resolveLocation(db, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	var inventory models.Inventory
+	err = db.Where("variant_id = ? AND location_id = ?", variant.ID, location.ID).First(&inventory).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.Inventory{VariantID: variant.ID, LocationID: location.ID, Location: location}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	inventory.Location = location
+	return &inventory, nil
+}
+
+// ListInventories returns the stock levels of a variant at every location stocking it
+func ListInventories(db *gorm.DB, variantID uuid.UUID) ([]models.Inventory, error) {
+	inventories := []models.Inventory{}
+	if err := db.Preload("Location").Where("variant_id = ?", variantID).Find(&inventories).Error; err != nil {
+		return nil, err
+	}
+	slices.SortFunc(inventories, func(a, b models.Inventory) int {
+		return strings.Compare(a.Location.Code, b.Location.Code)
+	})
+	return inventories, nil
+}
+
+// SetInventory overwrites the quantity on hand of a variant at a location, e.g. after a
+// stock take. The difference is recorded in the stock ledger as a correction.
+func SetInventory(db *gorm.DB, variantID uuid.UUID, locationID *uuid.UUID, qtyOnHand int, source MovementSource) (*models.Inventory, error) {
+	if qtyOnHand < 0 {
+		return nil, fmt.Errorf("%w: qty_on_hand can't be negative", ErrInvalidAdjustment)
+	}
+
+	var inventory *models.Inventory
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		inventory, err = lockInventory(tx, variantID, locationID)
+		if err != nil {
+			return err
+		}
+		source.Reason = models.MovementCorrection
+		if err := setQtyOnHand(tx, inventory, qtyOnHand, adjustmentMovement(source)); err != nil {
+			return err
+		}
+		return fillBackorders(tx, inventory)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inventory, nil
+}
+
+// AdjustInventory moves the quantity on hand of a variant at a location by delta for
+// source.Reason. Received stock must be positive, damaged stock negative, corrections
+// go either way.
+func AdjustInventory(db *gorm.DB, variantID uuid.UUID, locationID *uuid.UUID, delta int, source MovementSource) (*models.Inventory, error) {
+	switch reason := source.Reason; {
+	case delta == 0:
+		return nil, fmt.Errorf("%w: delta can't be zero", ErrInvalidAdjustment)
+	case reason == models.MovementReceive && delta < 0:
+		return nil, fmt.Errorf("%w: received stock must be positive", ErrInvalidAdjustment)
+	case reason == models.MovementDamage && delta > 0:
+		return nil, fmt.Errorf("%w: damaged stock must be negative", ErrInvalidAdjustment)
+	case reason != models.MovementReceive && reason != models.MovementDamage && reason != models.MovementCorrection:
+		return nil, fmt.Errorf("%w: unknown reason %q", ErrInvalidAdjustment, reason)
+	}
+
+	var inventory *models.Inventory
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		inventory, err = lockInventory(tx, variantID, locationID)
+		if err != nil {
+			return err
+		}
+		if err := setQtyOnHand(tx, inventory, inventory.QtyOnHand+delta, adjustmentMovement(source)); err != nil {
+			return err
+		}
+		return fillBackorders(tx, inventory)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inventory, nil
+}
+
+// SetBinLocation records where a variant is shelved at a location, the default one when
+// locationID is nil. nil clears it.
+func SetBinLocation(db *gorm.DB, variantID uuid.UUID, locationID *uuid.UUID, binLocation *string) (*models.Inventory, error) {
+	var inventory *models.Inventory
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		inventory, err = lockInventory(tx, variantID, locationID)
+		if err != nil {
+			return err
+		}
+		inventory.BinLocation = binLocation
+		return tx.Model(inventory).Update("bin_location", binLocation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return inventory, nil
+}
+
+// setQtyOnHand saves a new quantity on hand, which must still cover the reservations
+func setQtyOnHand(tx *gorm.DB, inventory *models.Inventory, qtyOnHand int, source MovementSource) error {
+	if qtyOnHand < inventory.QtyReserved {
+		return ErrStockBelowReserved
+	}
+	return moveStock(tx, inventory, qtyOnHand-inventory.QtyOnHand, 0, source)
+}
+
+// adjustmentMovement references manual stock changes as adjustments unless the caller
+// says otherwise
+func adjustmentMovement(source MovementSource) MovementSource {
+	if source.ReferenceType == nil {
+		referenceType := models.ReferenceAdjustment
+		source.ReferenceType = &referenceType
+	}
+	return source
+}
+
+// lockInventory locks the inventory of a variant at a location, the default one when
+// locationID is nil, creating it when the variant isn't stocked there yet
+func lockInventory(tx *gorm.DB, variantID uuid.UUID, locationID *uuid.UUID) (*models.Inventory, error) {
+	var variant models.ProductVariant
+	err := tx.Select("id", "product_id").First(&variant, variantID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrVariantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if isBundle, err := isBundleVariant(tx, &variant); err != nil {
+		return nil, err
+	} else if isBundle {
+		return nil, ErrBundleInventory
+	}
+
+	location, err := resolveLocation(tx, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Inventory{VariantID: variant.ID, LocationID: location.ID}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var inventory models.Inventory
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("variant_id = ? AND location_id = ?", variant.ID, location.ID).
+		First(&inventory).Error
+	if err != nil {
+		return nil, err
+	}
+	inventory.Location = location
+	return &inventory, nil
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"oms-services/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MovementSource describes why and by whom stock moves, for the stock ledger
+type MovementSource struct {
+	Reason        string
+	ReferenceType *string
+	ReferenceID   *uuid.UUID
+	Actor         *string // nil for changes made by the system
+	Note          *string
+}
+
+// StockDrift is the inventory of a variant at a location disagreeing with its stock ledger
+type StockDrift struct {
+	VariantID         uuid.UUID `json:"variant_id"`
+	SKU               string    `json:"sku"`
+	LocationID        uuid.UUID `json:"location_id"`
+	LocationCode      string    `json:"location_code"`
+	QtyOnHand         int       `json:"qty_on_hand"`
+	LedgerQtyOnHand   int       `json:"ledger_qty_on_hand"`
+	QtyReserved       int       `json:"qty_reserved"`
+	LedgerQtyReserved int       `json:"ledger_qty_reserved"`
+}
+
+// moveStock applies deltas to a locked inventory row and appends them to the ledger
+func moveStock(tx *gorm.DB, inventory *models.Inventory, onHandDelta, reservedDelta int, source MovementSource) error {
+	if onHandDelta == 0 && reservedDelta == 0 {
+		return nil
+	}
+
+	if err := tx.Model(inventory).Updates(map[string]interface{}{
+		"qty_on_hand":  gorm.Expr("qty_on_hand + ?", onHandDelta),
+		"qty_reserved": gorm.Expr("qty_reserved + ?", reservedDelta),
+	}).Error; err != nil {
+		return err
+	}
+	inventory.QtyOnHand += onHandDelta
+	inventory.QtyReserved += reservedDelta
+	inventory.AvailableToSell = inventory.QtyOnHand - inventory.QtyReserved
+
+	return tx.Create(&models.StockMovement{
+		VariantID:        inventory.VariantID,
+		LocationID:       inventory.LocationID,
+		QtyOnHandDelta:   onHandDelta,
+		QtyReservedDelta: reservedDelta,
+		Reason:           source.Reason,
+		ReferenceType:    source.ReferenceType,
+		ReferenceID:      source.ReferenceID,
+		Actor:            source.Actor,
+		Note:             source.Note,
+	}).Error
+}
+
+// orderMovement is the ledger source of stock moved by an order
+func orderMovement(order *models.Order, reason string) MovementSource {
+	referenceType := models.ReferenceOrder
+	return MovementSource{Reason: reason, ReferenceType: &referenceType, ReferenceID: &order.ID}
+}
+
+// OpenStockLedger records an opening balance for the inventory rows holding stock but
+// no movements yet, i.e. stock levels set before the ledger existed. It returns the
+// number of inventories opened.
+func OpenStockLedger(db *gorm.DB) (int64, error) {
+	result := db.Exec(`
+		INSERT INTO stock_movements (id, variant_id, location_id, qty_on_hand_delta, qty_reserved_delta, reason, created_at)
+		SELECT uuid_generate_v4(), inventories.variant_id, inventories.location_id, inventories.qty_on_hand, inventories.qty_reserved, ?, now()
+		FROM inventories
+		WHERE (inventories.qty_on_hand <> 0 OR inventories.qty_reserved <> 0)
+			AND NOT EXISTS (
+				SELECT 1 FROM stock_movements
+				WHERE stock_movements.variant_id = inventories.variant_id AND stock_movements.location_id = inventories.location_id
+			)`,
+		models.MovementOpeningBalance,
+	)
+	return result.RowsAffected, result.Error
+}
+
+// DetectStockDrift replays the stock ledger and returns the inventories that don't match it
+func DetectStockDrift(db *gorm.DB) ([]StockDrift, error) {
+	drifts := []StockDrift{}
+	err := db.Raw(`
+		SELECT inventories.variant_id, product_variants.sku, inventories.location_id, locations.code AS location_code,
+			inventories.qty_on_hand, COALESCE(ledger.qty_on_hand, 0) AS ledger_qty_on_hand,
+			inventories.qty_reserved, COALESCE(ledger.qty_reserved, 0) AS ledger_qty_reserved
+		FROM inventories
+		JOIN product_variants ON product_variants.id = inventories.variant_id
+		JOIN locations ON locations.id = inventories.location_id
+		LEFT JOIN (
+			SELECT variant_id, location_id, SUM(qty_on_hand_delta) AS qty_on_hand, SUM(qty_reserved_delta) AS qty_reserved
+			FROM stock_movements GROUP BY variant_id, location_id
+		) ledger ON ledger.variant_id = inventories.variant_id AND ledger.location_id = inventories.location_id
+		WHERE inventories.qty_on_hand <> COALESCE(ledger.qty_on_hand, 0)
+			OR inventories.qty_reserved <> COALESCE(ledger.qty_reserved, 0)
+		ORDER BY product_variants.sku, locations.code`,
+	).Scan(&drifts).Error
+	if err != nil {
+		return nil, err
+	}
+	return drifts, nil
+}
+
+// RepairStockDrift rewrites the inventory of a variant at a location from its ledger, the
+// ledger being the source of truth
+func RepairStockDrift(db *gorm.DB, variantID, locationID uuid.UUID) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		var inventory models.Inventory
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("variant_id = ? AND location_id = ?", variantID, locationID).
+			First(&inventory).Error
+		if err != nil {
+			return err
+		}
+
+		var ledger struct {
+			QtyOnHand   int
+			QtyReserved int
+		}
+		err = tx.Model(&models.StockMovement{}).
+			Select("COALESCE(SUM(qty_on_hand_delta), 0) AS qty_on_hand, COALESCE(SUM(qty_reserved_delta), 0) AS qty_reserved").
+			Where("variant_id = ? AND location_id = ?", variantID, locationID).
+			Scan(&ledger).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&inventory).Updates(map[string]interface{}{
+			"qty_on_hand":  ledger.QtyOnHand,
+			"qty_reserved": ledger.QtyReserved,
+		}).Error
+	})
+}
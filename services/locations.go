@@ -0,0 +1,103 @@
+package services
+
+import (
+	"errors"
+	"oms-services/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrLocationNotFound        = errors.New("location not found")
+	ErrDefaultLocationInactive = errors.New("the default location must be active")
+)
+
+// UpdateLocation applies column updates to a location. The default location can't be
+// deactivated, another one has to be made the default first.
+func UpdateLocation(db *gorm.DB, locationID uuid.UUID, updates map[string]interface{}) (*models.Location, error) {
+	var location *models.Location
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		location, err = lockLocation(tx, locationID)
+		if err != nil {
+			return err
+		}
+		if isActive, ok := updates["is_active"].(bool); ok && !isActive && location.IsDefault {
+			return ErrDefaultLocationInactive
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(location).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.First(location, location.ID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return location, nil
+}
+
+// SetDefaultLocation makes an active location the default one
+func SetDefaultLocation(db *gorm.DB, locationID uuid.UUID) (*models.Location, error) {
+	var location *models.Location
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		location, err = lockLocation(tx, locationID)
+		if err != nil {
+			return err
+		}
+		if !location.IsActive {
+			return ErrDefaultLocationInactive
+		}
+		if location.IsDefault {
+			return nil
+		}
+
+		if err := tx.Model(&models.Location{}).Where("is_default").Update("is_default", false).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(location).Update("is_default", true).Error; err != nil {
+			return err
+		}
+		location.IsDefault = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return location, nil
+}
+
+// resolveLocation returns the given location, or the default location when none is given
+func resolveLocation(tx *gorm.DB, locationID *uuid.UUID) (*models.Location, error) {
+	query := tx.Where("is_default")
+	if locationID != nil {
+		query = tx.Where("id = ?", *locationID)
+	}
+
+	var location models.Location
+	err := query.First(&location).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrLocationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
+
+func lockLocation(tx *gorm.DB, locationID uuid.UUID) (*models.Location, error) {
+	var location models.Location
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&location, locationID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrLocationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
@@ -0,0 +1,309 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/gif" // Registers the GIF decoder
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"oms-services/models"
+	"oms-services/storage"
+	"slices"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrMediaNotFound   = errors.New("media not found")
+	ErrMediaTooLarge   = errors.New("media file is too large")
+	ErrMediaType       = errors.New("unsupported media type, expected JPEG, PNG or GIF")
+	ErrMediaUnreadable = errors.New("media file is not a valid image")
+	ErrMediaVariant    = errors.New("variant does not belong to the product")
+	ErrMediaOrder      = errors.New("media order must list every media of the product once")
+)
+
+// MaxMediaBytes is the largest media file accepted
+var MaxMediaBytes int64 = 10 << 20
+
+const (
+	// thumbnailSize bounds the longest side of generated thumbnails
+	thumbnailSize = 320
+	// maxMediaPixels protects the thumbnailer against decompression bombs
+	maxMediaPixels = 40_000_000
+)
+
+// mediaExtensions are the accepted content types, sniffed from the file itself
+var mediaExtensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// MediaUpload is an image uploaded for a product
+type MediaUpload struct {
+	ProductID uuid.UUID
+	VariantID *uuid.UUID
+	AltText   *string
+	Data      io.Reader
+}
+
+// UploadProductMedia validates an image, stores it with a thumbnail and appends it to
+// the product's media
+func UploadProductMedia(db *gorm.DB, store storage.Storage, upload MediaUpload) (*models.ProductMedia, error) {
+	if err := checkMediaOwner(db, upload.ProductID, upload.VariantID); err != nil {
+		return nil, err
+	}
+
+	data, err := io.ReadAll(io.LimitReader(upload.Data, MaxMediaBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > MaxMediaBytes {
+		return nil, ErrMediaTooLarge
+	}
+	contentType := http.DetectContentType(data)
+	extension, ok := mediaExtensions[contentType]
+	if !ok {
+		return nil, ErrMediaType
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width == 0 || config.Height == 0 {
+		return nil, ErrMediaUnreadable
+	}
+	if config.Width*config.Height > maxMediaPixels {
+		return nil, ErrMediaTooLarge
+	}
+	source, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrMediaUnreadable
+	}
+	thumbnail, thumbnailExtension, err := encodeThumbnail(source, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	media := &models.ProductMedia{
+		ID:          uuid.New(),
+		ProductID:   upload.ProductID,
+		VariantID:   upload.VariantID,
+		ContentType: contentType,
+		SizeBytes:   int64(len(data)),
+		Width:       config.Width,
+		Height:      config.Height,
+		AltText:     upload.AltText,
+	}
+	media.StorageKey = fmt.Sprintf("products/%s/%s%s", media.ProductID, media.ID, extension)
+	media.ThumbnailKey = fmt.Sprintf("products/%s/%s_thumb%s", media.ProductID, media.ID, thumbnailExtension)
+	media.URL = store.URL(media.StorageKey)
+	media.ThumbnailURL = store.URL(media.ThumbnailKey)
+
+	if err := store.Save(media.StorageKey, bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	if err := store.Save(media.ThumbnailKey, bytes.NewReader(thumbnail)); err != nil {
+		deleteMediaFiles(store, media)
+		return nil, err
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := lockProduct(tx, media.ProductID); err != nil {
+			return err
+		}
+		var last *int
+		if err := tx.Model(&models.ProductMedia{}).Where("product_id = ?", media.ProductID).Select("MAX(position)").Scan(&last).Error; err != nil {
+			return err
+		}
+		if last != nil {
+			media.Position = *last + 1
+		}
+		return tx.Create(media).Error
+	})
+	if err != nil {
+		deleteMediaFiles(store, media)
+		return nil, err
+	}
+
+	return media, nil
+}
+
+// UpdateProductMedia changes the alt text of a media and the variant it shows
+func UpdateProductMedia(db *gorm.DB, mediaID uuid.UUID, updates map[string]interface{}) (*models.ProductMedia, error) {
+	var media models.ProductMedia
+	err := db.First(&media, mediaID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMediaNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if variantID, ok := updates["variant_id"].(uuid.UUID); ok {
+		if err := checkMediaOwner(db, media.ProductID, &variantID); err != nil {
+			return nil, err
+		}
+	}
+	if len(updates) == 0 {
+		return &media, nil
+	}
+
+	if err := db.Model(&media).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	if err := db.First(&media, mediaID).Error; err != nil {
+		return nil, err
+	}
+	return &media, nil
+}
+
+// ReorderProductMedia sets the display order of the product media to the given ids
+func ReorderProductMedia(db *gorm.DB, productID uuid.UUID, mediaIDs []uuid.UUID) ([]models.ProductMedia, error) {
+	var media []models.ProductMedia
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockProduct(tx, productID); err != nil {
+			return err
+		}
+		if err := tx.Where("product_id = ?", productID).Find(&media).Error; err != nil {
+			return err
+		}
+
+		positions := make(map[uuid.UUID]int, len(mediaIDs))
+		for i, id := range mediaIDs {
+			positions[id] = i
+		}
+		if len(positions) != len(mediaIDs) || len(positions) != len(media) {
+			return ErrMediaOrder
+		}
+		for i := range media {
+			position, ok := positions[media[i].ID]
+			if !ok {
+				return ErrMediaOrder
+			}
+			media[i].Position = position
+			if err := tx.Model(&media[i]).Update("position", position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.SortFunc(media, func(a, b models.ProductMedia) int { return a.Position - b.Position })
+	return media, nil
+}
+
+// DeleteProductMedia removes a media and its files
+func DeleteProductMedia(db *gorm.DB, store storage.Storage, mediaID uuid.UUID) error {
+	var media models.ProductMedia
+	err := db.First(&media, mediaID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrMediaNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := db.Delete(&media).Error; err != nil {
+		return err
+	}
+	deleteMediaFiles(store, &media)
+	return nil
+}
+
+// checkMediaOwner ensures the product exists and the variant, when given, is one of its variants
+func checkMediaOwner(db *gorm.DB, productID uuid.UUID, variantID *uuid.UUID) error {
+	var products int64
+	if err := db.Model(&models.Product{}).Where("id = ?", productID).Count(&products).Error; err != nil {
+		return err
+	}
+	if products == 0 {
+		return ErrProductNotFound
+	}
+	if variantID == nil {
+		return nil
+	}
+
+	var variants int64
+	if err := db.Model(&models.ProductVariant{}).Where("id = ? AND product_id = ?", *variantID, productID).Count(&variants).Error; err != nil {
+		return err
+	}
+	if variants == 0 {
+		return ErrMediaVariant
+	}
+	return nil
+}
+
+// deleteMediaFiles removes the stored files of a media. Failures only leave orphan
+// files behind, so they are logged rather than returned.
+func deleteMediaFiles(store storage.Storage, media *models.ProductMedia) {
+	for _, key := range []string{media.StorageKey, media.ThumbnailKey} {
+		if err := store.Delete(key); err != nil {
+			log.Printf("media: unable to delete %s: %v", key, err)
+		}
+	}
+}
+
+// encodeThumbnail scales the image down to fit thumbnailSize, as JPEG for photos and as
+// PNG for images that may be transparent
+func encodeThumbnail(source image.Image, contentType string) ([]byte, string, error) {
+	thumbnail := scaleDown(source, thumbnailSize)
+
+	var buf bytes.Buffer
+	if contentType == "image/jpeg" {
+		if err := jpeg.Encode(&buf, thumbnail, &jpeg.Options{Quality: 85}); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), ".jpg", nil
+	}
+	if err := png.Encode(&buf, thumbnail); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), ".png", nil
+}
+
+// scaleDown resizes the image so its longest side is at most size, averaging the
+// source pixels covered by each thumbnail pixel. Smaller images are only copied.
+func scaleDown(source image.Image, size int) *image.NRGBA {
+	bounds := source.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width > size || height > size {
+		if width >= height {
+			width, height = size, max(1, height*size/bounds.Dx())
+		} else {
+			width, height = max(1, width*size/bounds.Dy()), size
+		}
+	}
+
+	thumbnail := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*bounds.Dy()/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*bounds.Dy()/height)
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*bounds.Dx()/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*bounds.Dx()/width)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					pixel := color.NRGBAModel.Convert(source.At(sx, sy)).(color.NRGBA)
+					r += uint64(pixel.R)
+					g += uint64(pixel.G)
+					b += uint64(pixel.B)
+					a += uint64(pixel.A)
+					n++
+				}
+			}
+			thumbnail.SetNRGBA(x, y, color.NRGBA{R: uint8(r / n), G: uint8(g / n), B: uint8(b / n), A: uint8(a / n)})
+		}
+	}
+	return thumbnail
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"oms-services/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var ErrNotificationNotFound = errors.New("notification not found")
+
+// Notify records a back office notification with a JSON payload and logs it
+func Notify(tx *gorm.DB, notificationType string, variantID *uuid.UUID, message string, payload interface{}) error {
+	notification := models.Notification{
+		Type:      notificationType,
+		VariantID: variantID,
+		Message:   message,
+	}
+
+	if payload != nil {
+		raw, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body := string(raw)
+		notification.Payload = &body
+	}
+
+	if err := tx.Create(&notification).Error; err != nil {
+		return err
+	}
+	log.Printf("notification %s: %s", notificationType, message)
+	return nil
+}
+
+// MarkNotificationRead acknowledges a notification
+func MarkNotificationRead(db *gorm.DB, notificationID uuid.UUID) (*models.Notification, error) {
+	var notification models.Notification
+	err := db.First(&notification, notificationID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotificationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if notification.ReadAt != nil {
+		return &notification, nil
+	}
+
+	now := time.Now()
+	if err := db.Model(&notification).Update("read_at", now).Error; err != nil {
+		return nil, err
+	}
+	notification.ReadAt = &now
+	return &notification, nil
+}
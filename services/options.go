@@ -0,0 +1,290 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"oms-services/models"
+	"oms-services/money"
+	"oms-services/utils"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrProductOptions          = errors.New("product options are invalid")
+	ErrOptionsInUse            = errors.New("existing variants don't match the new options")
+	ErrVariantAttributes       = errors.New("variant attributes don't match the product options")
+	ErrVariantCombinationTaken = errors.New("another variant of the product has the same options")
+	ErrSKUPattern              = errors.New("sku pattern is invalid")
+	ErrSKUTaken                = errors.New("sku is already used by another variant")
+	ErrVariantMatrixTooLarge   = errors.New("variant matrix has too many combinations")
+)
+
+// maxVariantMatrixSize caps the combinations a product's options may produce
+const maxVariantMatrixSize = 500
+
+// VariantMatrix describes the variants created for every option combination of a
+// product. SKUPattern references options by name, e.g. "TEE-{color}-{size}".
+type VariantMatrix struct {
+	SKUPattern  string
+	Price       money.Money
+	WeightGrams int
+	IsActive    bool
+}
+
+// SetProductOptions replaces the option axes of a product. Existing variants must
+// still match the new options.
+func SetProductOptions(db *gorm.DB, productID uuid.UUID, options []models.ProductOption) ([]models.ProductOption, error) {
+	names := map[string]bool{}
+	combinations := 1
+	for i := range options {
+		options[i].Name = strings.TrimSpace(options[i].Name)
+		if options[i].Name == "" {
+			return nil, fmt.Errorf("%w: option name is required", ErrProductOptions)
+		}
+		if names[options[i].Name] {
+			return nil, fmt.Errorf("%w: option %q is declared twice", ErrProductOptions, options[i].Name)
+		}
+		names[options[i].Name] = true
+
+		if len(options[i].Values) == 0 {
+			return nil, fmt.Errorf("%w: option %q has no values", ErrProductOptions, options[i].Name)
+		}
+		values := map[string]bool{}
+		for _, value := range options[i].Values {
+			if value == "" || values[value] {
+				return nil, fmt.Errorf("%w: values of %q must be unique and not empty", ErrProductOptions, options[i].Name)
+			}
+			values[value] = true
+		}
+
+		combinations *= len(options[i].Values)
+		if combinations > maxVariantMatrixSize {
+			return nil, ErrVariantMatrixTooLarge
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockProduct(tx, productID); err != nil {
+			return err
+		}
+
+		var variants []models.ProductVariant
+		if err := tx.Where("product_id = ?", productID).Find(&variants).Error; err != nil {
+			return err
+		}
+		for _, variant := range variants {
+			if err := checkAttributes(options, variant.Attributes); err != nil {
+				return fmt.Errorf("%w: variant %s: %v", ErrOptionsInUse, variant.SKU, err)
+			}
+		}
+
+		if err := tx.Where("product_id = ?", productID).Delete(&models.ProductOption{}).Error; err != nil {
+			return err
+		}
+		if len(options) == 0 {
+			return nil
+		}
+		for i := range options {
+			options[i].ID = uuid.Nil
+			options[i].ProductID = productID
+			options[i].Position = i
+		}
+		return tx.Create(&options).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return options, nil
+}
+
+// ValidateVariantAttributes checks the attributes of a variant against its product
+// options and that no other variant of the product has the same combination.
+// variantID is uuid.Nil for new variants.
+func ValidateVariantAttributes(db *gorm.DB, productID, variantID uuid.UUID, attributes models.VariantAttributes) error {
+	var options []models.ProductOption
+	if err := db.Where("product_id = ?", productID).Order("position").Find(&options).Error; err != nil {
+		return err
+	}
+	if err := checkAttributes(options, attributes); err != nil {
+		return err
+	}
+	if len(attributes) == 0 {
+		return nil
+	}
+
+	var taken int64
+	err := db.Model(&models.ProductVariant{}).
+		Where("product_id = ? AND attributes = ? AND id <> ?", productID, attributes, variantID).
+		Count(&taken).Error
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrVariantCombinationTaken
+	}
+	return nil
+}
+
+// GenerateVariantMatrix creates a variant for every option combination of the product
+// that has none yet, returning the created variants
+func GenerateVariantMatrix(db *gorm.DB, productID uuid.UUID, matrix VariantMatrix) ([]models.ProductVariant, error) {
+	var created []models.ProductVariant
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := lockProduct(tx, productID); err != nil {
+			return err
+		}
+
+		var options []models.ProductOption
+		if err := tx.Where("product_id = ?", productID).Order("position").Find(&options).Error; err != nil {
+			return err
+		}
+		if len(options) == 0 {
+			return fmt.Errorf("%w: product has no options", ErrProductOptions)
+		}
+		for _, option := range options {
+			if !strings.Contains(matrix.SKUPattern, "{"+option.Name+"}") {
+				return fmt.Errorf("%w: missing {%s}", ErrSKUPattern, option.Name)
+			}
+		}
+
+		var existing []models.ProductVariant
+		if err := tx.Select("attributes").Where("product_id = ?", productID).Find(&existing).Error; err != nil {
+			return err
+		}
+		taken := map[string]bool{}
+		for _, variant := range existing {
+			taken[combinationKey(options, variant.Attributes)] = true
+		}
+
+		skus := []string{}
+		for _, attributes := range optionCombinations(options) {
+			if taken[combinationKey(options, attributes)] {
+				continue
+			}
+			sku := matrix.SKUPattern
+			for name, value := range attributes {
+				sku = strings.ReplaceAll(sku, "{"+name+"}", strings.ToUpper(utils.Slugify(value)))
+			}
+			skus = append(skus, sku)
+			created = append(created, models.ProductVariant{
+				ProductID:       productID,
+				SKU:             sku,
+				Attributes:      attributes,
+				Price:           matrix.Price,
+				Currency:        matrix.Price.Currency,
+				WeightGrams:     matrix.WeightGrams,
+				IsActive:        matrix.IsActive,
+				InventoryPolicy: models.InventoryPolicyDeny,
+			})
+		}
+		if len(created) == 0 {
+			return nil
+		}
+
+		var used []string
+		if err := tx.Model(&models.ProductVariant{}).Where("sku IN ?", skus).Pluck("sku", &used).Error; err != nil {
+			return err
+		}
+		if len(used) > 0 {
+			return fmt.Errorf("%w: %s", ErrSKUTaken, used[0])
+		}
+		slices.Sort(skus)
+		if unique := slices.Compact(skus); len(unique) != len(created) {
+			return fmt.Errorf("%w: option values produce duplicate skus", ErrSKUPattern)
+		}
+
+		// Every column is inserted, the is_active default would turn inactive variants on
+		return tx.Select("*").Create(&created).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return created, nil
+}
+
+// VariantsWithAttributes narrows a variants query to the variants having one of the
+// given values for each attribute, using the jsonb containment operator
+func VariantsWithAttributes(query *gorm.DB, filters map[string][]string) *gorm.DB {
+	for name, values := range filters {
+		conditions := make([]string, len(values))
+		args := make([]interface{}, len(values))
+		for i, value := range values {
+			document, _ := json.Marshal(map[string]string{name: value})
+			conditions[i] = "attributes @> ?"
+			args[i] = string(document)
+		}
+		query = query.Where("("+strings.Join(conditions, " OR ")+")", args...)
+	}
+	return query
+}
+
+// checkAttributes ensures the attributes set one allowed value per option and nothing
+// else. Products without options accept any attributes.
+func checkAttributes(options []models.ProductOption, attributes models.VariantAttributes) error {
+	if len(options) == 0 {
+		return nil
+	}
+
+	for _, option := range options {
+		value, ok := attributes[option.Name]
+		if !ok {
+			return fmt.Errorf("%w: %s is required", ErrVariantAttributes, option.Name)
+		}
+		if !slices.Contains(option.Values, value) {
+			return fmt.Errorf("%w: %q is not an allowed %s", ErrVariantAttributes, value, option.Name)
+		}
+	}
+	if len(attributes) != len(options) {
+		for name := range attributes {
+			if !slices.ContainsFunc(options, func(option models.ProductOption) bool { return option.Name == name }) {
+				return fmt.Errorf("%w: unknown option %s", ErrVariantAttributes, name)
+			}
+		}
+	}
+	return nil
+}
+
+// optionCombinations returns the cartesian product of the option values
+func optionCombinations(options []models.ProductOption) []models.VariantAttributes {
+	combinations := []models.VariantAttributes{{}}
+	for _, option := range options {
+		next := make([]models.VariantAttributes, 0, len(combinations)*len(option.Values))
+		for _, combination := range combinations {
+			for _, value := range option.Values {
+				attributes := models.VariantAttributes{option.Name: value}
+				for name, existing := range combination {
+					attributes[name] = existing
+				}
+				next = append(next, attributes)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+func combinationKey(options []models.ProductOption, attributes models.VariantAttributes) string {
+	values := make([]string, len(options))
+	for i, option := range options {
+		values[i] = attributes[option.Name]
+	}
+	return strings.Join(values, "\x00")
+}
+
+func lockProduct(tx *gorm.DB, productID uuid.UUID) error {
+	var product models.Product
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&product, productID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrProductNotFound
+	}
+	return err
+}
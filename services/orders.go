@@ -0,0 +1,238 @@
+package services
+
+import (
+	"errors"
+	"oms-services/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrOrderItemNotFound = errors.New("order item not found")
+	ErrVariantNotFound   = errors.New("variant not found")
+	ErrVariantInactive   = errors.New("variant is not active")
+)
+
+// UpdateDraftOrder edits the customer, currency, store and addresses of a draft order
+// and reprices it. Placed orders only change through their lifecycle, their stock,
+// coupon redemption and addresses are settled.
+func UpdateDraftOrder(db *gorm.DB, orderID uuid.UUID, updates map[string]interface{}) (*models.Order, error) {
+	var order *models.Order
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = LockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusDraft {
+			return ErrOrderNotDraft
+		}
+		if customerID, ok := updates["customer_id"].(uuid.UUID); ok {
+			if err := tx.Select("id").First(&models.Customer{}, customerID).Error; errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrCustomerNotFound
+			} else if err != nil {
+				return err
+			}
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(order).Updates(updates).Error; err != nil {
+			return err
+		}
+
+		// Prices are resolved again in the new currency, a failure rolls the edit back
+		order, err = LockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if err := repriceOrderItems(tx, order); err != nil {
+			return err
+		}
+		return RecalculateOrder(tx, order)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// AddOrderItem adds a variant to a draft order at its current price for the order's
+// currency, store and customer group, merging it
+// into the existing line when the variant is already on the order
+func AddOrderItem(db *gorm.DB, orderID, variantID uuid.UUID, quantity int) (*models.OrderItem, error) {
+	var item *models.OrderItem
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		order, err := LockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusDraft {
+			return ErrOrderNotDraft
+		}
+
+		var variant models.ProductVariant
+		err = tx.First(&variant, variantID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrVariantNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !variant.IsActive {
+			return ErrVariantInactive
+		}
+		pc, err := orderPriceContext(tx, order)
+		if err != nil {
+			return err
+		}
+		price, err := ResolveVariantPrice(tx, &variant, pc)
+		if err != nil {
+			return err
+		}
+
+		for i := range order.Items {
+			if order.Items[i].VariantID == variant.ID {
+				item = &order.Items[i]
+			}
+		}
+
+		if item == nil {
+			order.Items = append(order.Items, models.OrderItem{
+				OrderID:   order.ID,
+				VariantID: variant.ID,
+				Quantity:  quantity,
+				UnitPrice: price,
+				Currency:  price.Currency,
+				LineTotal: price.Mul(int64(quantity)),
+			})
+			item = &order.Items[len(order.Items)-1]
+			if err := tx.Omit("Order", "Variant").Create(item).Error; err != nil {
+				return err
+			}
+		} else {
+			item.Quantity += quantity
+			if err := tx.Model(item).Update("quantity", item.Quantity).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := RecalculateOrder(tx, order); err != nil {
+			return err
+		}
+
+		return RecordOrderEvent(tx, order.ID, models.EventItemAdded, map[string]interface{}{
+			"variant_id":       variant.ID,
+			"qty":              quantity,
+			"unit_price_minor": item.UnitPrice.Amount,
+			"line_total_minor": item.LineTotal.Amount,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// UpdateOrderItemQuantity changes the quantity of a line on a draft order
+func UpdateOrderItemQuantity(db *gorm.DB, itemID uuid.UUID, quantity int) (*models.OrderItem, error) {
+	var item *models.OrderItem
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		order, index, err := lockOrderOfItem(tx, itemID)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusDraft {
+			return ErrOrderNotDraft
+		}
+
+		item = &order.Items[index]
+		from := item.Quantity
+		item.Quantity = quantity
+		if err := tx.Model(item).Update("quantity", item.Quantity).Error; err != nil {
+			return err
+		}
+
+		if err := RecalculateOrder(tx, order); err != nil {
+			return err
+		}
+
+		return RecordOrderEvent(tx, order.ID, models.EventItemUpdated, map[string]interface{}{
+			"variant_id": item.VariantID,
+			"from_qty":   from,
+			"qty":        item.Quantity,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// RemoveOrderItem deletes a line from a draft order
+func RemoveOrderItem(db *gorm.DB, itemID uuid.UUID) (*models.Order, error) {
+	var order *models.Order
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var index int
+		var err error
+		order, index, err = lockOrderOfItem(tx, itemID)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusDraft {
+			return ErrOrderNotDraft
+		}
+
+		item := order.Items[index]
+		if err := tx.Delete(&item).Error; err != nil {
+			return err
+		}
+		order.Items = append(order.Items[:index], order.Items[index+1:]...)
+
+		if err := RecalculateOrder(tx, order); err != nil {
+			return err
+		}
+
+		return RecordOrderEvent(tx, order.ID, models.EventItemRemoved, map[string]interface{}{
+			"variant_id": item.VariantID,
+			"qty":        item.Quantity,
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// lockOrderOfItem locks the order owning the item and returns the item's index in order.Items
+func lockOrderOfItem(tx *gorm.DB, itemID uuid.UUID) (*models.Order, int, error) {
+	var item models.OrderItem
+	err := tx.Select("id", "order_id").First(&item, itemID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, 0, ErrOrderItemNotFound
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+
+	order, err := LockOrder(tx, item.OrderID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range order.Items {
+		if order.Items[i].ID == item.ID {
+			return order, i, nil
+		}
+	}
+	return nil, 0, ErrOrderItemNotFound
+}
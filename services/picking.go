@@ -0,0 +1,154 @@
+package services
+
+import (
+	"oms-services/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// PickList is the stock to take off the shelves of a location for a batch of orders,
+// in bin order so pickers walk the aisles once
+type PickList struct {
+	Location    models.Location `json:"location"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	OrderIDs    []uuid.UUID     `json:"order_ids"`
+	Units       int             `json:"units"`
+	Lines       []PickListLine  `json:"lines"`
+}
+
+// PickListLine is a variant to pick, with the units going to each order
+type PickListLine struct {
+	BinLocation *string         `json:"bin_location"`
+	VariantID   uuid.UUID       `json:"variant_id"`
+	SKU         string          `json:"sku"`
+	Title       string          `json:"title"`
+	Quantity    int             `json:"quantity"`
+	Orders      []PickListOrder `json:"orders"`
+}
+
+// PickListOrder is the units of a pick list line going to an order
+type PickListOrder struct {
+	OrderID  uuid.UUID `json:"order_id"`
+	Quantity int       `json:"quantity"`
+}
+
+// PackingSlip lists what a shipment holds, to put in the parcel
+type PackingSlip struct {
+	Shipment  models.Shipment         `json:"shipment"`
+	OrderID   uuid.UUID               `json:"order_id"`
+	OrderedAt time.Time               `json:"ordered_at"`
+	ShipTo    *models.AddressSnapshot `json:"ship_to"`
+	Units     int                     `json:"units"`
+	Lines     []PackingSlipLine       `json:"lines"`
+}
+
+// PackingSlipLine is a variant in a shipment. Bundle components name their bundle.
+type PackingSlipLine struct {
+	VariantID uuid.UUID `json:"variant_id"`
+	SKU       string    `json:"sku"`
+	Title     string    `json:"title"`
+	Quantity  int       `json:"quantity"`
+	BundleSKU *string   `json:"bundle_sku"`
+}
+
+// BuildPickList batches the stock still to pick at a location, the default one when
+// locationID is nil, for the orders being fulfilled, or only for orderIDs when given.
+// Stock already packed is left out.
+func BuildPickList(db *gorm.DB, locationID *uuid.UUID, orderIDs []uuid.UUID) (*PickList, error) {
+	location, err := resolveLocation(db, locationID)
+	if err != nil {
+		return nil, err
+	}
+
+	query := db.Table("stock_allocations").
+		Select("inventories.bin_location, stock_allocations.variant_id, product_variants.sku, products.title, stock_allocations.order_id, SUM(stock_allocations.quantity) AS quantity").
+		Joins("JOIN orders ON orders.id = stock_allocations.order_id").
+		Joins("JOIN product_variants ON product_variants.id = stock_allocations.variant_id").
+		Joins("JOIN products ON products.id = product_variants.product_id").
+		Joins("LEFT JOIN inventories ON inventories.variant_id = stock_allocations.variant_id AND inventories.location_id = stock_allocations.location_id").
+		Where("stock_allocations.location_id = ? AND orders.status = ?", location.ID, models.OrderStatusFulfillmentInProgress).
+		Where(`NOT EXISTS (
+			SELECT 1 FROM shipment_items JOIN shipments ON shipments.id = shipment_items.shipment_id
+			WHERE shipment_items.allocation_id = stock_allocations.id AND shipments.status <> ?
+		)`, models.ShipmentStatusPending)
+	if len(orderIDs) > 0 {
+		query = query.Where("stock_allocations.order_id IN ?", orderIDs)
+	}
+
+	var rows []struct {
+		BinLocation *string
+		VariantID   uuid.UUID
+		SKU         string
+		Title       string
+		OrderID     uuid.UUID
+		Quantity    int
+	}
+	err = query.
+		Group("inventories.bin_location, stock_allocations.variant_id, product_variants.sku, products.title, stock_allocations.order_id").
+		Order("inventories.bin_location NULLS LAST, product_variants.sku, stock_allocations.order_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	pickList := &PickList{Location: *location, GeneratedAt: time.Now(), OrderIDs: []uuid.UUID{}, Lines: []PickListLine{}}
+	seen := map[uuid.UUID]bool{}
+	for _, row := range rows {
+		if n := len(pickList.Lines); n == 0 || pickList.Lines[n-1].VariantID != row.VariantID {
+			pickList.Lines = append(pickList.Lines, PickListLine{
+				BinLocation: row.BinLocation,
+				VariantID:   row.VariantID,
+				SKU:         row.SKU,
+				Title:       row.Title,
+			})
+		}
+		line := &pickList.Lines[len(pickList.Lines)-1]
+		line.Quantity += row.Quantity
+		line.Orders = append(line.Orders, PickListOrder{OrderID: row.OrderID, Quantity: row.Quantity})
+		pickList.Units += row.Quantity
+		if !seen[row.OrderID] {
+			seen[row.OrderID] = true
+			pickList.OrderIDs = append(pickList.OrderIDs, row.OrderID)
+		}
+	}
+	return pickList, nil
+}
+
+// BuildPackingSlip lists the content of a shipment with the address it ships to
+func BuildPackingSlip(db *gorm.DB, shipmentID uuid.UUID) (*PackingSlip, error) {
+	shipment, err := GetShipment(db, shipmentID)
+	if err != nil {
+		return nil, err
+	}
+	var order models.Order
+	if err := db.First(&order, shipment.OrderID).Error; err != nil {
+		return nil, err
+	}
+
+	slip := &PackingSlip{
+		Shipment:  *shipment,
+		OrderID:   order.ID,
+		OrderedAt: order.CreatedAt,
+		ShipTo:    order.ShippingAddressSnapshot,
+		Lines:     []PackingSlipLine{},
+	}
+	err = db.Table("shipment_items").
+		Select("shipment_items.variant_id, product_variants.sku, products.title, SUM(shipment_items.quantity) AS quantity, bundles.sku AS bundle_sku").
+		Joins("JOIN product_variants ON product_variants.id = shipment_items.variant_id").
+		Joins("JOIN products ON products.id = product_variants.product_id").
+		Joins("JOIN order_items ON order_items.id = shipment_items.order_item_id").
+		Joins("LEFT JOIN product_variants bundles ON bundles.id = order_items.variant_id AND order_items.variant_id <> shipment_items.variant_id").
+		Where("shipment_items.shipment_id = ?", shipment.ID).
+		Group("shipment_items.variant_id, product_variants.sku, products.title, bundles.sku").
+		Order("bundles.sku NULLS FIRST, product_variants.sku").
+		Scan(&slip.Lines).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, line := range slip.Lines {
+		slip.Units += line.Quantity
+	}
+	return slip, nil
+}
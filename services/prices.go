@@ -0,0 +1,161 @@
+package services
+
+import (
+	"errors"
+	"oms-services/models"
+	"oms-services/money"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPriceNotFound        = errors.New("variant has no price in the order currency")
+	ErrVariantPriceNotFound = errors.New("variant price not found")
+)
+
+// PriceContext describes who is buying, where and when, to pick the right price list entry
+type PriceContext struct {
+	Currency      string
+	Store         *string
+	CustomerGroup *string
+	At            time.Time
+}
+
+// ResolveVariantPrice returns the variant price for the context. Price list entries
+// restricted to the context's store or customer group win over general ones, then the
+// most recently started one wins. The variant's own price is used when it is in the
+// requested currency and no entry matches.
+func ResolveVariantPrice(tx *gorm.DB, variant *models.ProductVariant, pc PriceContext) (money.Money, error) {
+	var prices []models.VariantPrice
+	err := priceListScope(tx.Where("variant_id = ?", variant.ID), pc).Limit(1).Find(&prices).Error
+	if err != nil {
+		return money.Money{}, err
+	}
+	if len(prices) > 0 {
+		return prices[0].Amount, nil
+	}
+
+	if variant.Currency == pc.Currency {
+		return variant.Price, nil
+	}
+	return money.Money{}, ErrPriceNotFound
+}
+
+// priceListScope restricts a query on price list entries, or on their history, to the
+// ones applying to the context, in the order ResolveVariantPrice picks them
+func priceListScope(query *gorm.DB, pc PriceContext) *gorm.DB {
+	query = query.Where("currency = ?", pc.Currency).
+		Where("(starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at > ?)", pc.At, pc.At)
+	if pc.Store != nil {
+		query = query.Where("store IS NULL OR store = ?", *pc.Store)
+	} else {
+		query = query.Where("store IS NULL")
+	}
+	if pc.CustomerGroup != nil {
+		query = query.Where("customer_group IS NULL OR customer_group = ?", *pc.CustomerGroup)
+	} else {
+		query = query.Where("customer_group IS NULL")
+	}
+	return query.Order("store IS NULL, customer_group IS NULL, starts_at DESC NULLS LAST, created_at DESC")
+}
+
+// AddVariantPrice adds an entry to the price list of a variant and records it in the
+// variant's price history
+func AddVariantPrice(db *gorm.DB, variant *models.ProductVariant, price *models.VariantPrice) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		price.VariantID = variant.ID
+		if err := tx.Create(price).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.VariantPriceHistory{
+			VariantID:      variant.ID,
+			Currency:       price.Currency,
+			Price:          price.Amount,
+			Reason:         models.PriceChangePriceList,
+			VariantPriceID: &price.ID,
+			Store:          price.Store,
+			CustomerGroup:  price.CustomerGroup,
+			StartsAt:       price.StartsAt,
+			EndsAt:         price.EndsAt,
+			EffectiveFrom:  price.CreatedAt,
+			CreatedAt:      price.CreatedAt,
+		}).Error
+	})
+}
+
+// DeleteVariantPrice removes an entry from the price list of a variant, its history
+// recording when it stopped applying
+func DeleteVariantPrice(db *gorm.DB, variantID, priceID uuid.UUID) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Where("id = ? AND variant_id = ?", priceID, variantID).Delete(&models.VariantPrice{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrVariantPriceNotFound
+		}
+		return tx.Model(&models.VariantPriceHistory{}).
+			Where("variant_price_id = ? AND removed_at IS NULL", priceID).
+			Update("removed_at", time.Now()).Error
+	})
+}
+
+// orderPriceContext builds the price context of an order from its currency, store
+// and customer group
+func orderPriceContext(tx *gorm.DB, order *models.Order) (PriceContext, error) {
+	pc := PriceContext{Currency: order.Currency, Store: order.Store, At: time.Now()}
+	if order.CustomerID == nil {
+		return pc, nil
+	}
+
+	var customer models.Customer
+	err := tx.Select("id", "customer_group").First(&customer, *order.CustomerID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return pc, nil
+	}
+	if err != nil {
+		return pc, err
+	}
+	pc.CustomerGroup = customer.CustomerGroup
+	return pc, nil
+}
+
+// repriceOrderItems re-resolves the unit price of every line of a draft order, used
+// when its currency, store or customer changed
+func repriceOrderItems(tx *gorm.DB, order *models.Order) error {
+	if len(order.Items) == 0 {
+		return nil
+	}
+
+	pc, err := orderPriceContext(tx, order)
+	if err != nil {
+		return err
+	}
+
+	for i := range order.Items {
+		item := &order.Items[i]
+		var variant models.ProductVariant
+		if err := tx.First(&variant, item.VariantID).Error; err != nil {
+			return err
+		}
+		price, err := ResolveVariantPrice(tx, &variant, pc)
+		if err != nil {
+			return err
+		}
+		if item.Currency == price.Currency && item.UnitPrice.Amount == price.Amount {
+			continue
+		}
+
+		item.UnitPrice = price
+		item.Currency = price.Currency
+		if err := tx.Model(item).Updates(map[string]interface{}{
+			"unit_price_minor": item.UnitPrice,
+			"currency":         item.Currency,
+		}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
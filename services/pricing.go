@@ -0,0 +1,192 @@
+package services
+
+import (
+	"errors"
+	"oms-services/models"
+	"oms-services/money"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RecalculateOrder re-derives line discounts, shipping, taxes and totals of a draft
+// order from its items, coupon, shipping method and address, dropping the coupon
+// when it no longer applies. The total is subtotal - discount + shipping + tax,
+// where only taxes not already included in the prices are added.
+// The order must have been loaded with LockOrder.
+func RecalculateOrder(tx *gorm.DB, order *models.Order) error {
+	subtotal := money.Zero(order.Currency)
+	bases := make([]money.Money, len(order.Items))
+	weights := make([]int64, len(order.Items))
+	for i, item := range order.Items {
+		bases[i] = item.UnitPrice.Mul(int64(item.Quantity))
+		weights[i] = bases[i].Amount
+		var err error
+		if subtotal, err = subtotal.Add(bases[i]); err != nil {
+			return err
+		}
+	}
+
+	coupon, discount, err := orderCouponDiscount(tx, order, subtotal)
+	if err != nil {
+		return err
+	}
+	discounted, err := subtotal.Sub(discount)
+	if err != nil {
+		return err
+	}
+
+	shipping, err := orderShipping(tx, order, coupon, discounted)
+	if err != nil {
+		return err
+	}
+
+	allocations, err := discount.Allocate(weights)
+	if err != nil {
+		return err
+	}
+	for i := range order.Items {
+		item := &order.Items[i]
+		item.Discount = allocations[i]
+		if item.LineTotal, err = bases[i].Sub(allocations[i]); err != nil {
+			return err
+		}
+	}
+
+	taxes, err := calculateOrderTax(tx, order)
+	if err != nil {
+		return err
+	}
+
+	order.Tax = money.Zero(order.Currency)
+	for i := range order.Items {
+		item := &order.Items[i]
+		item.Tax = taxes.LineTax[i]
+		if order.Tax, err = order.Tax.Add(item.Tax); err != nil {
+			return err
+		}
+		if err := tx.Model(item).Updates(map[string]interface{}{
+			"discount_minor":   item.Discount,
+			"tax_minor":        item.Tax,
+			"line_total_minor": item.LineTotal,
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	total, err := money.Sum(order.Currency, discounted, shipping, taxes.Exclusive)
+	if err != nil {
+		return err
+	}
+
+	order.Subtotal = subtotal
+	order.Discount = discount
+	order.Shipping = shipping
+	order.TaxBreakdown = taxes.Breakdown
+	order.Total = total
+
+	return tx.Model(order).Updates(map[string]interface{}{
+		"subtotal_minor": order.Subtotal,
+		"discount_minor": order.Discount,
+		"shipping_minor": order.Shipping,
+		"tax_minor":      order.Tax,
+		"tax_breakdown":  order.TaxBreakdown,
+		"total_minor":    order.Total,
+		"coupon_id":      order.CouponID,
+		"coupon_code":    order.CouponCode,
+	}).Error
+}
+
+// calculateOrderTax runs the tax calculator over the discounted order lines
+func calculateOrderTax(tx *gorm.DB, order *models.Order) (*TaxResult, error) {
+	address, err := orderDestination(tx, order)
+	if err != nil {
+		return nil, err
+	}
+
+	variantIDs := make([]uuid.UUID, len(order.Items))
+	for i, item := range order.Items {
+		variantIDs[i] = item.VariantID
+	}
+
+	var classes []struct {
+		VariantID uuid.UUID
+		TaxClass  string
+	}
+	if len(variantIDs) > 0 {
+		err = tx.Model(&models.ProductVariant{}).
+			Select("product_variants.id AS variant_id, products.tax_class").
+			Joins("JOIN products ON products.id = product_variants.product_id").
+			Where("product_variants.id IN ?", variantIDs).
+			Scan(&classes).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	taxClasses := map[uuid.UUID]string{}
+	for _, row := range classes {
+		taxClasses[row.VariantID] = row.TaxClass
+	}
+
+	request := TaxRequest{Currency: order.Currency, Address: address}
+	for _, item := range order.Items {
+		taxClass, ok := taxClasses[item.VariantID]
+		if !ok || taxClass == "" {
+			taxClass = models.DefaultTaxClass
+		}
+		request.Lines = append(request.Lines, TaxableLine{
+			ItemID:   item.ID,
+			TaxClass: taxClass,
+			Amount:   item.LineTotal,
+		})
+	}
+
+	return DefaultTaxCalculator.Calculate(tx, request)
+}
+
+// orderCouponDiscount returns the applied coupon and its order-level discount,
+// removing the coupon from the order when it stopped being applicable
+func orderCouponDiscount(tx *gorm.DB, order *models.Order, subtotal money.Money) (*models.Coupon, money.Money, error) {
+	if order.CouponID == nil {
+		return nil, money.Zero(order.Currency), nil
+	}
+
+	// Only a deleted or no longer applicable coupon is dropped, lookup failures are returned
+	var coupon models.Coupon
+	err := tx.First(&coupon, *order.CouponID).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		err = ErrCouponNotFound
+	case err != nil:
+		return nil, money.Zero(order.Currency), err
+	default:
+		err = validateCoupon(&coupon, order, subtotal, time.Now())
+	}
+	if err != nil {
+		reason := err.Error()
+		code := order.CouponCode
+		order.CouponID = nil
+		order.CouponCode = nil
+		return nil, money.Zero(order.Currency), RecordOrderEvent(tx, order.ID, models.EventCouponRemoved, map[string]interface{}{
+			"code":   code,
+			"reason": reason,
+		})
+	}
+
+	discount, err := couponDiscount(&coupon, subtotal)
+	return &coupon, discount, err
+}
+
+// couponDiscount computes the order-level discount granted by a coupon
+func couponDiscount(coupon *models.Coupon, subtotal money.Money) (money.Money, error) {
+	switch coupon.Type {
+	case models.CouponTypePercentage:
+		return subtotal.MulRate(int64(coupon.PercentOff) * 100), nil
+	case models.CouponTypeFixedAmount:
+		return coupon.AmountOff.Min(subtotal)
+	}
+	// Free shipping coupons don't discount the items
+	return money.Zero(subtotal.Currency), nil
+}
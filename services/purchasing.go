@@ -0,0 +1,375 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"oms-services/models"
+	"oms-services/money"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSupplierNotFound         = errors.New("supplier not found")
+	ErrSupplierInactive         = errors.New("supplier is inactive")
+	ErrPurchaseOrderNotFound    = errors.New("purchase order not found")
+	ErrPurchaseOrderStatus      = errors.New("purchase order status doesn't allow this")
+	ErrPurchaseOrderEmpty       = errors.New("purchase order has no lines")
+	ErrPurchaseOrderLine        = errors.New("purchase order line is invalid")
+	ErrPurchaseOrderOverReceipt = errors.New("received quantity exceeds the quantity ordered")
+)
+
+// PurchaseOrderReceipt is a quantity of a purchase order line delivered at once
+type PurchaseOrderReceipt struct {
+	LineID   uuid.UUID
+	Quantity int
+}
+
+// CreatePurchaseOrder creates a draft purchase order to an active supplier, in the
+// supplier currency unless another one is set, delivered at the default location unless
+// another one is set
+func CreatePurchaseOrder(db *gorm.DB, order *models.PurchaseOrder, lines []models.PurchaseOrderLine) (*models.PurchaseOrder, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var supplier models.Supplier
+		err := tx.First(&supplier, order.SupplierID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrSupplierNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if !supplier.IsActive {
+			return ErrSupplierInactive
+		}
+
+		var locationID *uuid.UUID
+		if order.LocationID != uuid.Nil {
+			locationID = &order.LocationID
+		}
+		location, err := resolveLocation(tx, locationID)
+		if err != nil {
+			return err
+		}
+
+		order.LocationID = location.ID
+		order.Status = models.PurchaseOrderStatusDraft
+		if order.Currency == "" {
+			order.Currency = supplier.Currency
+		}
+		order.Currency = strings.ToUpper(order.Currency)
+		order.Total = money.Zero(order.Currency)
+		if err := tx.Omit("Lines").Create(order).Error; err != nil {
+			return err
+		}
+		return setPurchaseOrderLines(tx, order, lines)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetPurchaseOrder(db, order.ID)
+}
+
+// GetPurchaseOrder loads a purchase order with its supplier, location and lines
+func GetPurchaseOrder(db *gorm.DB, orderID uuid.UUID) (*models.PurchaseOrder, error) {
+	var order models.PurchaseOrder
+	err := db.Preload("Supplier").Preload("Location").
+		Preload("Lines", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		Preload("Lines.Variant").
+		First(&order, orderID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPurchaseOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// UpdatePurchaseOrder applies column updates to a purchase order that isn't closed. The
+// delivery location can only change while it is a draft.
+func UpdatePurchaseOrder(db *gorm.DB, orderID uuid.UUID, updates map[string]interface{}) (*models.PurchaseOrder, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockPurchaseOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status == models.PurchaseOrderStatusClosed {
+			return fmt.Errorf("%w: the purchase order is closed", ErrPurchaseOrderStatus)
+		}
+		if locationID, ok := updates["location_id"].(uuid.UUID); ok {
+			if order.Status != models.PurchaseOrderStatusDraft {
+				return fmt.Errorf("%w: the location can only change on drafts", ErrPurchaseOrderStatus)
+			}
+			if _, err := resolveLocation(tx, &locationID); err != nil {
+				return err
+			}
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		return tx.Model(order).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetPurchaseOrder(db, orderID)
+}
+
+// SetPurchaseOrderLines replaces the lines of a draft purchase order
+func SetPurchaseOrderLines(db *gorm.DB, orderID uuid.UUID, lines []models.PurchaseOrderLine) (*models.PurchaseOrder, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockPurchaseOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.PurchaseOrderStatusDraft {
+			return fmt.Errorf("%w: only drafts can change their lines", ErrPurchaseOrderStatus)
+		}
+		if err := tx.Where("purchase_order_id = ?", order.ID).Delete(&models.PurchaseOrderLine{}).Error; err != nil {
+			return err
+		}
+		return setPurchaseOrderLines(tx, order, lines)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetPurchaseOrder(db, orderID)
+}
+
+// DeletePurchaseOrder deletes a draft purchase order, one that was sent is closed instead
+func DeletePurchaseOrder(db *gorm.DB, orderID uuid.UUID) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockPurchaseOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.PurchaseOrderStatusDraft {
+			return fmt.Errorf("%w: only drafts can be deleted", ErrPurchaseOrderStatus)
+		}
+		return tx.Delete(order).Error
+	})
+}
+
+// SendPurchaseOrder marks a draft purchase order as sent to the supplier, after which
+// its stock can be received
+func SendPurchaseOrder(db *gorm.DB, orderID uuid.UUID) (*models.PurchaseOrder, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockPurchaseOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.PurchaseOrderStatusDraft {
+			return fmt.Errorf("%w: only drafts can be sent", ErrPurchaseOrderStatus)
+		}
+		var lines int64
+		if err := tx.Model(&models.PurchaseOrderLine{}).Where("purchase_order_id = ?", order.ID).Count(&lines).Error; err != nil {
+			return err
+		}
+		if lines == 0 {
+			return ErrPurchaseOrderEmpty
+		}
+		return tx.Model(order).Updates(map[string]interface{}{
+			"status":  models.PurchaseOrderStatusSent,
+			"sent_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetPurchaseOrder(db, orderID)
+}
+
+// ReceivePurchaseOrder books a delivery of a sent purchase order into the stock of a
+// location, the purchase order one when locationID is nil. The received units are
+// recorded in the stock ledger, go to the backorders waiting for them and update the
+// variants cost. The purchase order is received once every line is, partially received
+// until then.
+func ReceivePurchaseOrder(db *gorm.DB, orderID uuid.UUID, locationID *uuid.UUID, receipts []PurchaseOrderReceipt, source MovementSource) (*models.PurchaseOrder, error) {
+	if len(receipts) == 0 {
+		return nil, fmt.Errorf("%w: nothing received", ErrPurchaseOrderLine)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockPurchaseOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.PurchaseOrderStatusSent && order.Status != models.PurchaseOrderStatusPartiallyReceived {
+			return fmt.Errorf("%w: only sent purchase orders can be received", ErrPurchaseOrderStatus)
+		}
+		if locationID == nil {
+			locationID = &order.LocationID
+		}
+
+		var lines []models.PurchaseOrderLine
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("purchase_order_id = ?", order.ID).
+			Order("variant_id").
+			Find(&lines).Error
+		if err != nil {
+			return err
+		}
+
+		received, err := receivedQuantities(lines, receipts)
+		if err != nil {
+			return err
+		}
+
+		referenceType := models.ReferencePurchaseOrder
+		source.Reason = models.MovementReceive
+		source.ReferenceType = &referenceType
+		source.ReferenceID = &order.ID
+		now := time.Now()
+
+		complete := true
+		// Lines are locked by variant so concurrent deliveries take the inventories in order
+		for i := range lines {
+			line := &lines[i]
+			quantity := received[line.ID]
+			if quantity > 0 {
+				if err := updateVariantCost(tx, line.VariantID, quantity, line.UnitCost, now); err != nil {
+					return err
+				}
+				inventory, err := lockInventory(tx, line.VariantID, locationID)
+				if err != nil {
+					return err
+				}
+				if err := moveStock(tx, inventory, quantity, 0, source); err != nil {
+					return err
+				}
+				if err := fillBackorders(tx, inventory); err != nil {
+					return err
+				}
+				line.QtyReceived += quantity
+				if err := tx.Model(line).Update("qty_received", line.QtyReceived).Error; err != nil {
+					return err
+				}
+			}
+			if line.QtyReceived < line.QtyOrdered {
+				complete = false
+			}
+		}
+
+		updates := map[string]interface{}{"status": models.PurchaseOrderStatusPartiallyReceived}
+		if complete {
+			updates = map[string]interface{}{"status": models.PurchaseOrderStatusReceived, "received_at": now}
+		}
+		return tx.Model(order).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetPurchaseOrder(db, orderID)
+}
+
+// receivedQuantities sums the units received per line of a purchase order, which can't
+// exceed the units ordered
+func receivedQuantities(lines []models.PurchaseOrderLine, receipts []PurchaseOrderReceipt) (map[uuid.UUID]int, error) {
+	received := map[uuid.UUID]int{}
+	for _, receipt := range receipts {
+		if receipt.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: received quantity must be positive", ErrPurchaseOrderLine)
+		}
+		if !slices.ContainsFunc(lines, func(line models.PurchaseOrderLine) bool { return line.ID == receipt.LineID }) {
+			return nil, fmt.Errorf("%w: line %s is not on the purchase order", ErrPurchaseOrderLine, receipt.LineID)
+		}
+		received[receipt.LineID] += receipt.Quantity
+	}
+	for _, line := range lines {
+		if quantity := received[line.ID]; line.QtyReceived+quantity > line.QtyOrdered {
+			return nil, fmt.Errorf("%w: %d more units of line %s", ErrPurchaseOrderOverReceipt, line.QtyReceived+quantity-line.QtyOrdered, line.ID)
+		}
+	}
+	return received, nil
+}
+
+// ClosePurchaseOrder closes a sent purchase order, whether or not all of it arrived. The
+// units still missing are no longer expected.
+func ClosePurchaseOrder(db *gorm.DB, orderID uuid.UUID) (*models.PurchaseOrder, error) {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		order, err := lockPurchaseOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		switch order.Status {
+		case models.PurchaseOrderStatusSent, models.PurchaseOrderStatusPartiallyReceived, models.PurchaseOrderStatusReceived:
+		default:
+			return fmt.Errorf("%w: only sent purchase orders can be closed", ErrPurchaseOrderStatus)
+		}
+		return tx.Model(order).Updates(map[string]interface{}{
+			"status":    models.PurchaseOrderStatusClosed,
+			"closed_at": time.Now(),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetPurchaseOrder(db, orderID)
+}
+
+// setPurchaseOrderLines validates and creates the lines of a purchase order, one per
+// stocked variant, and totals their cost on the order
+func setPurchaseOrderLines(tx *gorm.DB, order *models.PurchaseOrder, lines []models.PurchaseOrderLine) error {
+	total := money.Zero(order.Currency)
+	seen := map[uuid.UUID]bool{}
+	for i := range lines {
+		line := &lines[i]
+		if seen[line.VariantID] {
+			return fmt.Errorf("%w: variant %s is ordered twice", ErrPurchaseOrderLine, line.VariantID)
+		}
+		seen[line.VariantID] = true
+		if line.QtyOrdered <= 0 {
+			return fmt.Errorf("%w: qty_ordered must be positive", ErrPurchaseOrderLine)
+		}
+		if line.UnitCost.IsNegative() {
+			return fmt.Errorf("%w: unit_cost can't be negative", ErrPurchaseOrderLine)
+		}
+
+		var variant models.ProductVariant
+		err := tx.Select("id", "product_id").First(&variant, line.VariantID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrVariantNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if isBundle, err := isBundleVariant(tx, &variant); err != nil {
+			return err
+		} else if isBundle {
+			return ErrBundleInventory
+		}
+
+		line.ID = uuid.Nil
+		line.PurchaseOrderID = order.ID
+		line.QtyReceived = 0
+		line.Currency = order.Currency
+		line.UnitCost = line.UnitCost.WithCurrency(order.Currency)
+		if total, err = total.Add(line.UnitCost.Mul(int64(line.QtyOrdered))); err != nil {
+			return err
+		}
+	}
+	if len(lines) > 0 {
+		if err := tx.Create(&lines).Error; err != nil {
+			return err
+		}
+	}
+	order.Total = total
+	return tx.Model(order).Update("total_minor", order.Total).Error
+}
+
+func lockPurchaseOrder(tx *gorm.DB, orderID uuid.UUID) (*models.PurchaseOrder, error) {
+	var order models.PurchaseOrder
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&order, orderID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrPurchaseOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"oms-services/models"
+	"oms-services/money"
+
+	"github.com/google/uuid"
+)
+
+func TestAverageCost(t *testing.T) {
+	cost := func(amount int64) *money.Money {
+		m := money.New(amount, "EGP")
+		return &m
+	}
+
+	tests := []struct {
+		name     string
+		current  *money.Money
+		onHand   int
+		received int64
+		quantity int
+		want     int64
+	}{
+		{name: "first receipt", current: nil, onHand: 0, received: 1000, quantity: 10, want: 1000},
+		{name: "unknown cost with stock", current: nil, onHand: 5, received: 1000, quantity: 10, want: 1000},
+		{name: "same cost", current: cost(1000), onHand: 10, received: 1000, quantity: 10, want: 1000},
+		{name: "weighted", current: cost(1000), onHand: 10, received: 1300, quantity: 5, want: 1100},
+		{name: "rounds half away from zero", current: cost(100), onHand: 1, received: 101, quantity: 1, want: 101},
+		{name: "rounds down", current: cost(100), onHand: 2, received: 101, quantity: 1, want: 100},
+		{name: "empty shelves", current: cost(1000), onHand: 0, received: 1500, quantity: 3, want: 1500},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := averageCost(tt.current, tt.onHand, money.New(tt.received, "EGP"), tt.quantity)
+			if err != nil {
+				t.Fatalf("averageCost() error = %v", err)
+			}
+			if got.Amount != tt.want || got.Currency != "EGP" {
+				t.Errorf("averageCost() = %v, want %d EGP", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReceivedQuantities(t *testing.T) {
+	first, second := uuid.New(), uuid.New()
+	lines := []models.PurchaseOrderLine{
+		{ID: first, QtyOrdered: 10, QtyReceived: 4},
+		{ID: second, QtyOrdered: 5},
+	}
+
+	tests := []struct {
+		name     string
+		receipts []PurchaseOrderReceipt
+		want     map[uuid.UUID]int
+		err      error
+	}{
+		{
+			name:     "partial",
+			receipts: []PurchaseOrderReceipt{{LineID: first, Quantity: 2}},
+			want:     map[uuid.UUID]int{first: 2},
+		},
+		{
+			name:     "summed per line",
+			receipts: []PurchaseOrderReceipt{{LineID: first, Quantity: 2}, {LineID: second, Quantity: 5}, {LineID: first, Quantity: 4}},
+			want:     map[uuid.UUID]int{first: 6, second: 5},
+		},
+		{
+			name:     "over receipt",
+			receipts: []PurchaseOrderReceipt{{LineID: first, Quantity: 7}},
+			err:      ErrPurchaseOrderOverReceipt,
+		},
+		{
+			name:     "over receipt across receipts",
+			receipts: []PurchaseOrderReceipt{{LineID: second, Quantity: 3}, {LineID: second, Quantity: 3}},
+			err:      ErrPurchaseOrderOverReceipt,
+		},
+		{
+			name:     "zero quantity",
+			receipts: []PurchaseOrderReceipt{{LineID: first, Quantity: 0}},
+			err:      ErrPurchaseOrderLine,
+		},
+		{
+			name:     "unknown line",
+			receipts: []PurchaseOrderReceipt{{LineID: uuid.New(), Quantity: 1}},
+			err:      ErrPurchaseOrderLine,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := receivedQuantities(lines, tt.receipts)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("receivedQuantities() error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("receivedQuantities() = %v, want %v", got, tt.want)
+			}
+			for lineID, quantity := range tt.want {
+				if got[lineID] != quantity {
+					t.Errorf("line %s received %d, want %d", lineID, got[lineID], quantity)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"oms-services/models"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrReorderPolicy = errors.New("reorder policy is invalid")
+
+// variantStockLevels sums, per stock tracked variant, the units available to sell at the
+// active locations and the units backordered waiting for stock
+const variantStockLevels = `SELECT product_variants.id AS variant_id, product_variants.sku,
+		product_variants.reorder_point, product_variants.reorder_qty, product_variants.stock_alert,
+		stock.available_to_sell, COALESCE(waiting.qty_backordered, 0) AS qty_backordered
+	FROM product_variants
+	JOIN (
+		SELECT inventories.variant_id,
+			COALESCE(SUM(inventories.qty_on_hand - inventories.qty_reserved) FILTER (WHERE locations.is_active), 0) AS available_to_sell
+		FROM inventories
+		JOIN locations ON locations.id = inventories.location_id
+		GROUP BY inventories.variant_id
+	) stock ON stock.variant_id = product_variants.id
+	LEFT JOIN (
+		SELECT variant_id, SUM(quantity - qty_allocated) AS qty_backordered
+		FROM backorders
+		WHERE fulfilled_at IS NULL AND cancelled_at IS NULL
+		GROUP BY variant_id
+	) waiting ON waiting.variant_id = product_variants.id`
+
+// VariantStockLevel is the stock of a variant measured against its reorder point
+type VariantStockLevel struct {
+	VariantID       uuid.UUID `json:"variant_id"`
+	SKU             string    `json:"sku"`
+	ReorderPoint    *int      `json:"reorder_point"`
+	ReorderQty      *int      `json:"reorder_qty"`
+	StockAlert      *string   `json:"stock_alert"`
+	AvailableToSell int       `json:"available_to_sell"`
+	QtyBackordered  int       `json:"qty_backordered"`
+	SuggestedQty    int       `json:"suggested_qty" gorm:"-"` // Units to order to get back above the reorder point
+}
+
+// SetReorderPolicy sets the reorder point and quantity of a variant. The stock alert is
+// reset so the checker measures the variant against its new reorder point.
+func SetReorderPolicy(db *gorm.DB, variantID uuid.UUID, reorderPoint, reorderQty *int) (*models.ProductVariant, error) {
+	switch {
+	case reorderPoint != nil && *reorderPoint < 0:
+		return nil, fmt.Errorf("%w: reorder_point can't be negative", ErrReorderPolicy)
+	case reorderQty != nil && *reorderQty <= 0:
+		return nil, fmt.Errorf("%w: reorder_qty must be positive", ErrReorderPolicy)
+	case reorderQty != nil && reorderPoint == nil:
+		return nil, fmt.Errorf("%w: reorder_qty needs a reorder_point", ErrReorderPolicy)
+	}
+
+	var variant *models.ProductVariant
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		variant, err = lockVariant(tx, variantID)
+		if err != nil {
+			return err
+		}
+		if isBundle, err := isBundleVariant(tx, variant); err != nil {
+			return err
+		} else if isBundle {
+			return ErrBundleInventory
+		}
+
+		variant.ReorderPoint = reorderPoint
+		variant.ReorderQty = reorderQty
+		variant.StockAlert = nil
+		return tx.Model(variant).Updates(map[string]interface{}{
+			"reorder_point": reorderPoint,
+			"reorder_qty":   reorderQty,
+			"stock_alert":   nil,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return variant, nil
+}
+
+// ReplenishmentNeeds lists the variants at or below their reorder point, the emptiest first
+func ReplenishmentNeeds(db *gorm.DB) ([]VariantStockLevel, error) {
+	levels := []VariantStockLevel{}
+	err := db.Raw(variantStockLevels + `
+		WHERE product_variants.reorder_point IS NOT NULL
+			AND stock.available_to_sell <= product_variants.reorder_point
+		ORDER BY stock.available_to_sell, product_variants.sku`,
+	).Scan(&levels).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i, level := range levels {
+		levels[i].SuggestedQty = *level.ReorderPoint - level.AvailableToSell + level.QtyBackordered + 1
+		if level.ReorderQty != nil {
+			levels[i].SuggestedQty = max(levels[i].SuggestedQty, *level.ReorderQty)
+		}
+	}
+	return levels, nil
+}
+
+// CheckStockAlerts emits a low_stock or out_of_stock notification for the variants whose
+// available-to-sell crossed their reorder point or ran out since the last check,
+// returning how many were sent. A variant is alerted again only after recovering.
+func CheckStockAlerts(db *gorm.DB) (int, error) {
+	var levels []VariantStockLevel
+	err := db.Raw(variantStockLevels + `
+		WHERE product_variants.reorder_point IS NOT NULL`,
+	).Scan(&levels).Error
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, level := range levels {
+		if sameAlert(stockAlertLevel(level.AvailableToSell, *level.ReorderPoint), level.StockAlert) {
+			continue
+		}
+		alerted, err := updateStockAlert(db, level.VariantID)
+		if err != nil {
+			return sent, err
+		}
+		if alerted {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// RunStockAlertChecker checks the stock alerts every interval until the context is done
+func RunStockAlertChecker(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if sent, err := CheckStockAlerts(db); err != nil {
+			log.Printf("stock alerts: %v", err)
+		} else if sent > 0 {
+			log.Printf("stock alerts: %d notifications sent", sent)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateStockAlert measures a variant against its reorder point again under a lock, so
+// concurrent checkers alert once, and notifies when its stock got worse
+func updateStockAlert(db *gorm.DB, variantID uuid.UUID) (bool, error) {
+	alerted := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var variants []models.ProductVariant
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("id = ? AND reorder_point IS NOT NULL", variantID).
+			Find(&variants).Error
+		if err != nil || len(variants) == 0 {
+			return err
+		}
+		variant := variants[0]
+
+		available, err := variantStockAvailable(tx, variant.ID)
+		if err != nil || available == nil {
+			return err
+		}
+		alert := stockAlertLevel(*available, *variant.ReorderPoint)
+		if sameAlert(alert, variant.StockAlert) {
+			return nil
+		}
+		if err := tx.Model(&variant).Update("stock_alert", alert).Error; err != nil {
+			return err
+		}
+		// Recovering, even partly, is not alerted
+		if alert == nil || alertSeverity(alert) < alertSeverity(variant.StockAlert) {
+			return nil
+		}
+
+		message := fmt.Sprintf("%s is out of stock", variant.SKU)
+		if *alert == models.NotificationLowStock {
+			message = fmt.Sprintf("%s is low on stock: %d left, reorder point %d", variant.SKU, *available, *variant.ReorderPoint)
+		}
+		alerted = true
+		return Notify(tx, *alert, &variant.ID, message, map[string]interface{}{
+			"variant_id":        variant.ID,
+			"sku":               variant.SKU,
+			"available_to_sell": *available,
+			"reorder_point":     variant.ReorderPoint,
+			"reorder_qty":       variant.ReorderQty,
+		})
+	})
+	return alerted, err
+}
+
+// stockAlertLevel is the alert a variant with this many units available deserves
+func stockAlertLevel(available, reorderPoint int) *string {
+	alert := ""
+	switch {
+	case available <= 0:
+		alert = models.NotificationOutOfStock
+	case available <= reorderPoint:
+		alert = models.NotificationLowStock
+	default:
+		return nil
+	}
+	return &alert
+}
+
+func alertSeverity(alert *string) int {
+	switch {
+	case alert == nil:
+		return 0
+	case *alert == models.NotificationLowStock:
+		return 1
+	}
+	return 2
+}
+
+func sameAlert(a, b *string) bool {
+	return alertSeverity(a) == alertSeverity(b)
+}
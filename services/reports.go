@@ -0,0 +1,167 @@
+package services
+
+import (
+	"maps"
+	"oms-services/models"
+	"oms-services/money"
+	"slices"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// SalesReport sums the placed orders, settled payments and processed refunds of a
+// period in a single currency, along with the per currency figures they come from
+type SalesReport struct {
+	From       time.Time             `json:"from"`
+	To         time.Time             `json:"to"`
+	Currency   string                `json:"currency"`
+	OrderCount int                   `json:"order_count"`
+	Ordered    money.Money           `json:"ordered"`
+	Paid       money.Money           `json:"paid"`
+	Refunded   money.Money           `json:"refunded"`
+	Net        money.Money           `json:"net"` // Paid minus refunded
+	Currencies []SalesReportCurrency `json:"currencies"`
+}
+
+// SalesReportCurrency holds the figures of a report in their original currency
+type SalesReportCurrency struct {
+	Currency   string      `json:"currency"`
+	OrderCount int         `json:"order_count"`
+	Ordered    money.Money `json:"ordered"`
+	Paid       money.Money `json:"paid"`
+	Refunded   money.Money `json:"refunded"`
+}
+
+// reportRow is an amount of a currency on a day, with the rate frozen on orders if any
+type reportRow struct {
+	Currency          string
+	Day               time.Time
+	Count             int
+	AmountMinor       int64
+	ReportingCurrency *string
+	ExchangeRate      *money.Rate
+}
+
+// BuildSalesReport computes the sales report of [from, to) in the currency. Orders are
+// converted at the rate frozen at checkout when it targets the same currency, all other
+// amounts at the rate of the day they happened.
+func BuildSalesReport(db *gorm.DB, from, to time.Time, currency string) (*SalesReport, error) {
+	report := &SalesReport{
+		From:       from,
+		To:         to,
+		Currency:   currency,
+		Ordered:    money.Zero(currency),
+		Paid:       money.Zero(currency),
+		Refunded:   money.Zero(currency),
+		Currencies: []SalesReportCurrency{},
+	}
+
+	var orderRows []reportRow
+	err := db.Model(&models.Order{}).
+		Select("currency, placed_at::date AS day, COUNT(*) AS count, COALESCE(SUM(total_minor), 0) AS amount_minor, reporting_currency, exchange_rate").
+		Where("status IN ? AND placed_at >= ? AND placed_at < ?", placedOrderStatuses, from, to).
+		Group("currency, day, reporting_currency, exchange_rate").
+		Scan(&orderRows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var paymentRows []reportRow
+	err = db.Model(&models.Payment{}).
+		Select("currency, created_at::date AS day, COUNT(*) AS count, COALESCE(SUM(amount_minor), 0) AS amount_minor").
+		Where("status IN ? AND created_at >= ? AND created_at < ?", settledPaymentStatuses, from, to).
+		Group("currency, day").
+		Scan(&paymentRows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var refundRows []reportRow
+	err = db.Model(&models.Refund{}).
+		Select("currency, created_at::date AS day, COUNT(*) AS count, COALESCE(SUM(amount_minor), 0) AS amount_minor").
+		Where("status = ? AND created_at >= ? AND created_at < ?", models.RefundStatusProcessed, from, to).
+		Group("currency, day").
+		Scan(&refundRows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	byCurrency := map[string]*SalesReportCurrency{}
+	entry := func(code string) *SalesReportCurrency {
+		if byCurrency[code] == nil {
+			byCurrency[code] = &SalesReportCurrency{
+				Currency: code,
+				Ordered:  money.Zero(code),
+				Paid:     money.Zero(code),
+				Refunded: money.Zero(code),
+			}
+		}
+		return byCurrency[code]
+	}
+
+	for _, row := range orderRows {
+		amount := money.New(row.AmountMinor, row.Currency)
+		converted, err := convertReportRow(db, row, amount, currency)
+		if err != nil {
+			return nil, err
+		}
+		if report.Ordered, err = report.Ordered.Add(converted); err != nil {
+			return nil, err
+		}
+		report.OrderCount += row.Count
+
+		figures := entry(amount.Currency)
+		figures.OrderCount += row.Count
+		if figures.Ordered, err = figures.Ordered.Add(amount); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, row := range paymentRows {
+		amount := money.New(row.AmountMinor, row.Currency)
+		converted, err := convertReportRow(db, row, amount, currency)
+		if err != nil {
+			return nil, err
+		}
+		if report.Paid, err = report.Paid.Add(converted); err != nil {
+			return nil, err
+		}
+		figures := entry(amount.Currency)
+		if figures.Paid, err = figures.Paid.Add(amount); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, row := range refundRows {
+		amount := money.New(row.AmountMinor, row.Currency)
+		converted, err := convertReportRow(db, row, amount, currency)
+		if err != nil {
+			return nil, err
+		}
+		if report.Refunded, err = report.Refunded.Add(converted); err != nil {
+			return nil, err
+		}
+		figures := entry(amount.Currency)
+		if figures.Refunded, err = figures.Refunded.Add(amount); err != nil {
+			return nil, err
+		}
+	}
+
+	if report.Net, err = report.Paid.Sub(report.Refunded); err != nil {
+		return nil, err
+	}
+	for _, code := range slices.Sorted(maps.Keys(byCurrency)) {
+		report.Currencies = append(report.Currencies, *byCurrency[code])
+	}
+
+	return report, nil
+}
+
+// convertReportRow converts a report row amount, preferring the rate frozen on orders
+func convertReportRow(tx *gorm.DB, row reportRow, amount money.Money, currency string) (money.Money, error) {
+	if row.ExchangeRate != nil && row.ReportingCurrency != nil && *row.ReportingCurrency == currency {
+		return amount.Convert(currency, *row.ExchangeRate)
+	}
+	return ConvertAmount(tx, amount, currency, row.Day)
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"cmp"
+	"fmt"
+	"oms-services/models"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// RoutingStrategy decides which locations the items of an order ship from
+type RoutingStrategy string
+
+const (
+	// RoutingClosest ships every item from the closest location holding all of it
+	RoutingClosest RoutingStrategy = "closest"
+	// RoutingSingleLocation ships the whole order from the closest location holding all
+	// of it, falling back to RoutingClosest when no location does
+	RoutingSingleLocation RoutingStrategy = "single_location"
+	// RoutingSplit ships every item from the closest locations, splitting it across
+	// locations when none holds all of it
+	RoutingSplit RoutingStrategy = "split"
+)
+
+// FulfillmentRouting is the strategy orders are routed with at checkout
+var FulfillmentRouting = RoutingSingleLocation
+
+// ParseRoutingStrategy validates a routing strategy name
+func ParseRoutingStrategy(name string) (RoutingStrategy, error) {
+	strategy := RoutingStrategy(name)
+	switch strategy {
+	case RoutingClosest, RoutingSingleLocation, RoutingSplit:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown fulfillment routing %q", name)
+}
+
+// stockLine is a quantity of a stocked variant an order item takes from the inventory:
+// the item variant itself, or a component of a bundle item
+type stockLine struct {
+	OrderItemID uuid.UUID
+	VariantID   uuid.UUID
+	Quantity    int
+}
+
+type inventoryKey struct {
+	VariantID  uuid.UUID
+	LocationID uuid.UUID
+}
+
+// stockRouter allocates stock lines to locations, closest locations first
+type stockRouter struct {
+	locations []models.Location
+	available map[inventoryKey]int // Units left to allocate
+}
+
+// newStockRouter ranks the active locations by distance to the destination and
+// collects the units available at each of them
+func newStockRouter(locations []models.Location, inventories []models.Inventory, destination *models.AddressSnapshot) *stockRouter {
+	router := &stockRouter{available: map[inventoryKey]int{}}
+	active := map[uuid.UUID]bool{}
+	for _, location := range locations {
+		if location.IsActive {
+			router.locations = append(router.locations, location)
+			active[location.ID] = true
+		}
+	}
+	slices.SortFunc(router.locations, func(a, b models.Location) int {
+		return cmp.Or(
+			cmp.Compare(locationDistance(a, destination), locationDistance(b, destination)),
+			cmp.Compare(a.Priority, b.Priority),
+			strings.Compare(a.Code, b.Code),
+		)
+	})
+
+	for _, inventory := range inventories {
+		if active[inventory.LocationID] {
+			router.available[inventoryKey{inventory.VariantID, inventory.LocationID}] = inventory.QtyOnHand - inventory.QtyReserved
+		}
+	}
+	return router
+}
+
+// route allocates the lines with a strategy. When a line can't be allocated it returns
+// the variant short of stock.
+func (r *stockRouter) route(strategy RoutingStrategy, lines []stockLine) ([]models.StockAllocation, *uuid.UUID, error) {
+	switch strategy {
+	case RoutingClosest:
+		allocations, short := r.routeClosest(lines, false)
+		return allocations, short, nil
+	case RoutingSplit:
+		allocations, short := r.routeClosest(lines, true)
+		return allocations, short, nil
+	case RoutingSingleLocation:
+		if allocations := r.routeSingleLocation(lines); allocations != nil {
+			return allocations, nil, nil
+		}
+		allocations, short := r.routeClosest(lines, false)
+		return allocations, short, nil
+	}
+	return nil, nil, fmt.Errorf("unknown fulfillment routing %q", strategy)
+}
+
+// routeSingleLocation allocates all the lines to the closest location holding all of
+// them, nil when there is none
+func (r *stockRouter) routeSingleLocation(lines []stockLine) []models.StockAllocation {
+	needed := map[uuid.UUID]int{}
+	for _, line := range lines {
+		needed[line.VariantID] += line.Quantity
+	}
+
+	for _, location := range r.locations {
+		holdsAll := true
+		for variantID, quantity := range needed {
+			if r.available[inventoryKey{variantID, location.ID}] < quantity {
+				holdsAll = false
+				break
+			}
+		}
+		if !holdsAll {
+			continue
+		}
+
+		allocations := make([]models.StockAllocation, len(lines))
+		for i, line := range lines {
+			allocations[i] = r.allocate(line, location.ID, line.Quantity)
+		}
+		return allocations
+	}
+	return nil
+}
+
+// routeClosest allocates every line to the closest location holding all of it or, when
+// split is allowed and none does, across the closest locations holding some of it
+func (r *stockRouter) routeClosest(lines []stockLine, split bool) ([]models.StockAllocation, *uuid.UUID) {
+	var allocations []models.StockAllocation
+	for _, line := range lines {
+		allocated := false
+		for _, location := range r.locations {
+			if r.available[inventoryKey{line.VariantID, location.ID}] >= line.Quantity {
+				allocations = append(allocations, r.allocate(line, location.ID, line.Quantity))
+				allocated = true
+				break
+			}
+		}
+		if allocated {
+			continue
+		}
+		if !split || r.availableAnywhere(line.VariantID) < line.Quantity {
+			return nil, &line.VariantID
+		}
+
+		remaining := line.Quantity
+		for _, location := range r.locations {
+			quantity := min(remaining, r.available[inventoryKey{line.VariantID, location.ID}])
+			if quantity <= 0 {
+				continue
+			}
+			allocations = append(allocations, r.allocate(line, location.ID, quantity))
+			remaining -= quantity
+			if remaining == 0 {
+				break
+			}
+		}
+	}
+	return allocations, nil
+}
+
+func (r *stockRouter) allocate(line stockLine, locationID uuid.UUID, quantity int) models.StockAllocation {
+	r.available[inventoryKey{line.VariantID, locationID}] -= quantity
+	return models.StockAllocation{
+		OrderItemID: line.OrderItemID,
+		VariantID:   line.VariantID,
+		LocationID:  locationID,
+		Quantity:    quantity,
+	}
+}
+
+func (r *stockRouter) availableAnywhere(variantID uuid.UUID) int {
+	total := 0
+	for _, location := range r.locations {
+		total += max(r.available[inventoryKey{variantID, location.ID}], 0)
+	}
+	return total
+}
+
+// locationDistance ranks how close a location is to where an order ships: 0 in the same
+// city, 1 in the same region, 2 in the same country and 3 abroad. Every location is as
+// close as any other to an unknown destination.
+func locationDistance(location models.Location, destination *models.AddressSnapshot) int {
+	if destination == nil {
+		return 0
+	}
+	switch {
+	case !strings.EqualFold(location.Country, destination.Country):
+		return 3
+	case location.City != nil && strings.EqualFold(*location.City, destination.City):
+		return 0
+	case location.Region != nil && destination.Region != nil && strings.EqualFold(*location.Region, *destination.Region):
+		return 1
+	}
+	return 2
+}
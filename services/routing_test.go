@@ -0,0 +1,197 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"oms-services/models"
+
+	"github.com/google/uuid"
+)
+
+func TestLocationDistance(t *testing.T) {
+	cairo, giza, alexandria := "Cairo", "Giza", "Alexandria"
+	location := models.Location{Country: "EG", City: &cairo, Region: &cairo}
+
+	tests := []struct {
+		name        string
+		destination *models.AddressSnapshot
+		want        int
+	}{
+		{name: "unknown destination", destination: nil, want: 0},
+		{name: "same city", destination: &models.AddressSnapshot{Country: "EG", City: "cairo"}, want: 0},
+		{name: "same region", destination: &models.AddressSnapshot{Country: "EG", City: "New Cairo", Region: &cairo}, want: 1},
+		{name: "same country", destination: &models.AddressSnapshot{Country: "EG", City: alexandria, Region: &alexandria}, want: 2},
+		{name: "same country without region", destination: &models.AddressSnapshot{Country: "EG", City: giza}, want: 2},
+		{name: "country case", destination: &models.AddressSnapshot{Country: "eg", City: cairo}, want: 0},
+		{name: "abroad", destination: &models.AddressSnapshot{Country: "AE", City: cairo}, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := locationDistance(location, tt.destination); got != tt.want {
+				t.Errorf("locationDistance() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStockRouterRoute(t *testing.T) {
+	cairo, alexandria := "Cairo", "Alexandria"
+	locations := []models.Location{
+		{ID: uuid.New(), Code: "alex", Country: "EG", City: &alexandria, IsActive: true},
+		{ID: uuid.New(), Code: "cairo", Country: "EG", City: &cairo, IsActive: true},
+		{ID: uuid.New(), Code: "dubai", Country: "AE", IsActive: true},
+		{ID: uuid.New(), Code: "closed", Country: "EG", City: &cairo, IsActive: false},
+	}
+	codes := map[uuid.UUID]string{}
+	byCode := map[string]uuid.UUID{}
+	for _, location := range locations {
+		codes[location.ID] = location.Code
+		byCode[location.Code] = location.ID
+	}
+	variants := map[string]uuid.UUID{"A": uuid.New(), "B": uuid.New()}
+	names := map[uuid.UUID]string{variants["A"]: "A", variants["B"]: "B"}
+	destination := &models.AddressSnapshot{Country: "EG", City: cairo}
+
+	// stock is keyed "variant@location"
+	inventories := func(stock map[string]int) []models.Inventory {
+		var inventories []models.Inventory
+		for key, quantity := range stock {
+			variant, location, _ := strings.Cut(key, "@")
+			inventories = append(inventories, models.Inventory{VariantID: variants[variant], LocationID: byCode[location], QtyOnHand: quantity})
+		}
+		return inventories
+	}
+
+	tests := []struct {
+		name     string
+		strategy RoutingStrategy
+		stock    map[string]int
+		lines    map[string]int
+		want     []string
+		short    string
+	}{
+		{
+			name:     "closest ships from the same city",
+			strategy: RoutingClosest,
+			stock:    map[string]int{"A@alex": 5, "A@cairo": 5},
+			lines:    map[string]int{"A": 2},
+			want:     []string{"A@cairo:2"},
+		},
+		{
+			name:     "closest picks per item",
+			strategy: RoutingClosest,
+			stock:    map[string]int{"A@cairo": 5, "B@alex": 5},
+			lines:    map[string]int{"A": 1, "B": 1},
+			want:     []string{"A@cairo:1", "B@alex:1"},
+		},
+		{
+			name:     "closest skips a location short of the item",
+			strategy: RoutingClosest,
+			stock:    map[string]int{"A@cairo": 1, "A@dubai": 5},
+			lines:    map[string]int{"A": 2},
+			want:     []string{"A@dubai:2"},
+		},
+		{
+			name:     "closest doesn't split",
+			strategy: RoutingClosest,
+			stock:    map[string]int{"A@cairo": 1, "A@alex": 1},
+			lines:    map[string]int{"A": 2},
+			short:    "A",
+		},
+		{
+			name:     "inactive locations don't ship",
+			strategy: RoutingClosest,
+			stock:    map[string]int{"A@closed": 5},
+			lines:    map[string]int{"A": 1},
+			short:    "A",
+		},
+		{
+			name:     "single location keeps the order together",
+			strategy: RoutingSingleLocation,
+			stock:    map[string]int{"A@cairo": 5, "A@alex": 5, "B@alex": 5},
+			lines:    map[string]int{"A": 1, "B": 1},
+			want:     []string{"A@alex:1", "B@alex:1"},
+		},
+		{
+			name:     "single location falls back to closest",
+			strategy: RoutingSingleLocation,
+			stock:    map[string]int{"A@cairo": 5, "B@alex": 5},
+			lines:    map[string]int{"A": 1, "B": 1},
+			want:     []string{"A@cairo:1", "B@alex:1"},
+		},
+		{
+			name:     "split spreads an item over the closest locations",
+			strategy: RoutingSplit,
+			stock:    map[string]int{"A@cairo": 2, "A@alex": 2},
+			lines:    map[string]int{"A": 3},
+			want:     []string{"A@alex:1", "A@cairo:2"},
+		},
+		{
+			name:     "split prefers a location holding the whole item",
+			strategy: RoutingSplit,
+			stock:    map[string]int{"A@cairo": 2, "A@dubai": 5},
+			lines:    map[string]int{"A": 3},
+			want:     []string{"A@dubai:3"},
+		},
+		{
+			name:     "split short of stock",
+			strategy: RoutingSplit,
+			stock:    map[string]int{"A@cairo": 1, "A@alex": 1},
+			lines:    map[string]int{"A": 3},
+			short:    "A",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lines []stockLine
+			for _, variant := range []string{"A", "B"} {
+				if quantity, ok := tt.lines[variant]; ok {
+					lines = append(lines, stockLine{OrderItemID: uuid.New(), VariantID: variants[variant], Quantity: quantity})
+				}
+			}
+
+			router := newStockRouter(locations, inventories(tt.stock), destination)
+			allocations, short, err := router.route(tt.strategy, lines)
+			if err != nil {
+				t.Fatalf("route() error = %v", err)
+			}
+			if tt.short != "" {
+				if short == nil || names[*short] != tt.short {
+					t.Fatalf("route() short = %v, want %s", short, tt.short)
+				}
+				return
+			}
+			if short != nil {
+				t.Fatalf("route() short of %s", names[*short])
+			}
+
+			got := make([]string, len(allocations))
+			for i, allocation := range allocations {
+				got[i] = fmt.Sprintf("%s@%s:%d", names[allocation.VariantID], codes[allocation.LocationID], allocation.Quantity)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("route() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRoutingStrategy(t *testing.T) {
+	for _, name := range []string{"closest", "single_location", "split"} {
+		if strategy, err := ParseRoutingStrategy(name); err != nil || string(strategy) != name {
+			t.Errorf("ParseRoutingStrategy(%q) = %q, %v", name, strategy, err)
+		}
+	}
+	if _, err := ParseRoutingStrategy("nearest"); err == nil {
+		t.Error("ParseRoutingStrategy(\"nearest\") accepted an unknown strategy")
+	}
+	if _, _, err := newStockRouter(nil, nil, nil).route("nearest", nil); err == nil {
+		t.Error("route() accepted an unknown strategy")
+	}
+}
@@ -0,0 +1,358 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"oms-services/models"
+	"oms-services/money"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrScheduledPriceNotFound = errors.New("scheduled price not found")
+	ErrScheduledPriceWindow   = errors.New("ends_at must be after starts_at")
+	ErrScheduledPriceOverlap  = errors.New("another sale is scheduled on the variant for this period")
+	ErrScheduledPriceFinished = errors.New("scheduled price has already ended")
+	ErrPriceHistoryNotFound   = errors.New("no price recorded for the variant at this date")
+	ErrVariantOnSale          = errors.New("the variant price can't be edited while a sale is running, cancel it first")
+)
+
+// scheduledPricesBatchSize caps the sales started or ended by a scheduler run
+const scheduledPricesBatchSize = 100
+
+// CreateScheduledPrice plans a sale on the variant's base price between startsAt and
+// endsAt. Sales of a variant can't overlap.
+func CreateScheduledPrice(db *gorm.DB, variantID uuid.UUID, salePriceMinor int64, startsAt time.Time, endsAt *time.Time) (*models.ScheduledPrice, error) {
+	if endsAt != nil && !startsAt.Before(*endsAt) {
+		return nil, ErrScheduledPriceWindow
+	}
+
+	var sale *models.ScheduledPrice
+	err := db.Transaction(func(tx *gorm.DB) error {
+		variant, err := lockVariant(tx, variantID)
+		if err != nil {
+			return err
+		}
+
+		query := tx.Model(&models.ScheduledPrice{}).
+			Where("variant_id = ? AND status IN ?", variant.ID, []models.ScheduledPriceStatus{models.ScheduledPriceStatusScheduled, models.ScheduledPriceStatusActive}).
+			Where("ends_at IS NULL OR ends_at > ?", startsAt)
+		if endsAt != nil {
+			query = query.Where("starts_at < ?", *endsAt)
+		}
+		var overlapping int64
+		if err := query.Count(&overlapping).Error; err != nil {
+			return err
+		}
+		if overlapping > 0 {
+			return ErrScheduledPriceOverlap
+		}
+
+		sale = &models.ScheduledPrice{
+			VariantID: variant.ID,
+			Currency:  variant.Currency,
+			SalePrice: money.New(salePriceMinor, variant.Currency),
+			StartsAt:  startsAt,
+			EndsAt:    endsAt,
+			Status:    models.ScheduledPriceStatusScheduled,
+		}
+		return tx.Create(sale).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sale, nil
+}
+
+// CancelScheduledPrice cancels a planned sale, restoring the regular price right away
+// when the sale is running
+func CancelScheduledPrice(db *gorm.DB, saleID uuid.UUID) (*models.ScheduledPrice, error) {
+	var sale models.ScheduledPrice
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sale, saleID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrScheduledPriceNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		switch sale.Status {
+		case models.ScheduledPriceStatusActive:
+			return endSale(tx, &sale, models.ScheduledPriceStatusCancelled, time.Now())
+		case models.ScheduledPriceStatusScheduled:
+			now := time.Now()
+			sale.Status = models.ScheduledPriceStatusCancelled
+			sale.EndedAt = &now
+			return tx.Model(&sale).Updates(map[string]interface{}{"status": sale.Status, "ended_at": sale.EndedAt}).Error
+		}
+		return ErrScheduledPriceFinished
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &sale, nil
+}
+
+// ApplyScheduledPrices starts the sales that are due and ends the expired ones,
+// returning how many sales changed state. Each sale is applied in its own
+// transaction and rows locked by another instance are skipped.
+func ApplyScheduledPrices(db *gorm.DB, now time.Time) (int, error) {
+	applied := 0
+
+	var due []models.ScheduledPrice
+	err := db.Select("id").
+		Where("status = ? AND starts_at <= ?", models.ScheduledPriceStatusScheduled, now).
+		Order("starts_at").
+		Limit(scheduledPricesBatchSize).
+		Find(&due).Error
+	if err != nil {
+		return applied, err
+	}
+	for _, sale := range due {
+		changed, err := startSale(db, sale.ID, now)
+		if err != nil {
+			return applied, err
+		}
+		if changed {
+			applied++
+		}
+	}
+
+	var expired []models.ScheduledPrice
+	err = db.Select("id").
+		Where("status = ? AND ends_at <= ?", models.ScheduledPriceStatusActive, now).
+		Order("ends_at").
+		Limit(scheduledPricesBatchSize).
+		Find(&expired).Error
+	if err != nil {
+		return applied, err
+	}
+	for _, sale := range expired {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			locked, err := lockDueSale(tx, sale.ID, models.ScheduledPriceStatusActive)
+			if err != nil || locked == nil {
+				return err
+			}
+			applied++
+			return endSale(tx, locked, models.ScheduledPriceStatusExpired, now)
+		})
+		if err != nil {
+			return applied, err
+		}
+	}
+
+	return applied, nil
+}
+
+// RunPriceScheduler applies scheduled prices every interval until the context is done
+func RunPriceScheduler(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if applied, err := ApplyScheduledPrices(db, time.Now()); err != nil {
+			log.Printf("price scheduler: %v", err)
+		} else if applied > 0 {
+			log.Printf("price scheduler: %d scheduled prices applied", applied)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// startSale swaps the variant price for the sale price, keeping the regular price as
+// compare-at price. Sales whose window passed while the scheduler was down are
+// expired without touching the price.
+func startSale(db *gorm.DB, saleID uuid.UUID, now time.Time) (bool, error) {
+	changed := false
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		sale, err := lockDueSale(tx, saleID, models.ScheduledPriceStatusScheduled)
+		if err != nil || sale == nil {
+			return err
+		}
+		changed = true
+
+		if sale.EndsAt != nil && !now.Before(*sale.EndsAt) {
+			sale.Status = models.ScheduledPriceStatusExpired
+			sale.EndedAt = &now
+			return tx.Model(sale).Updates(map[string]interface{}{"status": sale.Status, "ended_at": sale.EndedAt}).Error
+		}
+
+		variant, err := lockVariant(tx, sale.VariantID)
+		if err != nil {
+			return err
+		}
+
+		regular := variant.Price
+		sale.Status = models.ScheduledPriceStatusActive
+		sale.RegularPrice = &regular
+		sale.ActivatedAt = &now
+		if err := tx.Model(sale).Updates(map[string]interface{}{
+			"status":              sale.Status,
+			"regular_price_minor": sale.RegularPrice,
+			"activated_at":        sale.ActivatedAt,
+		}).Error; err != nil {
+			return err
+		}
+
+		return setVariantPrice(tx, variant, sale.SalePrice, &regular, models.PriceChangeSaleStarted, &sale.ID, now)
+	})
+
+	return changed, err
+}
+
+// endSale restores the regular price of a running sale
+func endSale(tx *gorm.DB, sale *models.ScheduledPrice, status models.ScheduledPriceStatus, now time.Time) error {
+	variant, err := lockVariant(tx, sale.VariantID)
+	if err != nil {
+		return err
+	}
+
+	sale.Status = status
+	sale.EndedAt = &now
+	if err := tx.Model(sale).Updates(map[string]interface{}{"status": sale.Status, "ended_at": sale.EndedAt}).Error; err != nil {
+		return err
+	}
+
+	regular := variant.Price
+	if sale.RegularPrice != nil {
+		regular = *sale.RegularPrice
+	}
+	return setVariantPrice(tx, variant, regular, nil, models.PriceChangeSaleEnded, &sale.ID, now)
+}
+
+// lockDueSale locks a sale still in the expected status, returning nil when another
+// scheduler instance holds it or already moved it on
+func lockDueSale(tx *gorm.DB, saleID uuid.UUID, status models.ScheduledPriceStatus) (*models.ScheduledPrice, error) {
+	var sales []models.ScheduledPrice
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("id = ? AND status = ?", saleID, status).
+		Find(&sales).Error
+	if err != nil || len(sales) == 0 {
+		return nil, err
+	}
+	return &sales[0], nil
+}
+
+func lockVariant(tx *gorm.DB, variantID uuid.UUID) (*models.ProductVariant, error) {
+	var variant models.ProductVariant
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&variant, variantID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrVariantNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// setVariantPrice changes the base price of a variant and records it in its history
+func setVariantPrice(tx *gorm.DB, variant *models.ProductVariant, price money.Money, compareAt *money.Money, reason string, saleID *uuid.UUID, at time.Time) error {
+	variant.Price = price
+	variant.CompareAtPrice = compareAt
+	if err := tx.Model(variant).Updates(map[string]interface{}{
+		"price_minor":            variant.Price,
+		"compare_at_price_minor": variant.CompareAtPrice,
+		"updated_at":             at,
+	}).Error; err != nil {
+		return err
+	}
+	return recordVariantPrice(tx, variant, reason, saleID, at)
+}
+
+func recordVariantPrice(tx *gorm.DB, variant *models.ProductVariant, reason string, saleID *uuid.UUID, at time.Time) error {
+	return tx.Create(&models.VariantPriceHistory{
+		VariantID:        variant.ID,
+		Currency:         variant.Currency,
+		Price:            variant.Price,
+		CompareAtPrice:   variant.CompareAtPrice,
+		Reason:           reason,
+		ScheduledPriceID: saleID,
+		EffectiveFrom:    at,
+	}).Error
+}
+
+// CheckManualPriceChange refuses to change the price of a variant with a running sale,
+// ending the sale would restore the regular price captured when it started
+func CheckManualPriceChange(db *gorm.DB, variant *models.ProductVariant, price money.Money) error {
+	if variant.Price.Amount == price.Amount && strings.EqualFold(variant.Currency, price.Currency) {
+		return nil
+	}
+
+	var count int64
+	err := db.Model(&models.ScheduledPrice{}).
+		Where("variant_id = ? AND status = ?", variant.ID, models.ScheduledPriceStatusActive).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrVariantOnSale
+	}
+	return nil
+}
+
+// RecordManualPriceChange adds a history entry after a variant was edited, when its
+// price or currency differs from the last recorded one
+func RecordManualPriceChange(db *gorm.DB, variantID uuid.UUID) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		variant, err := lockVariant(tx, variantID)
+		if err != nil {
+			return err
+		}
+
+		var latest []models.VariantPriceHistory
+		err = tx.Where("variant_id = ? AND variant_price_id IS NULL", variant.ID).Order("effective_from DESC").Limit(1).Find(&latest).Error
+		if err != nil {
+			return err
+		}
+		if len(latest) > 0 && latest[0].Currency == variant.Currency && latest[0].Price.Amount == variant.Price.Amount {
+			return nil
+		}
+		return recordVariantPrice(tx, variant, models.PriceChangeManual, nil, time.Now())
+	})
+}
+
+// VariantPriceAt returns the price the variant had at pc.At for the context: the price
+// list entry ResolveVariantPrice picked then, or the base price when it was in the
+// context currency. Without a currency the base price is returned whatever its currency.
+func VariantPriceAt(db *gorm.DB, variantID uuid.UUID, pc PriceContext) (*models.VariantPriceHistory, error) {
+	var entries []models.VariantPriceHistory
+	if pc.Currency != "" {
+		query := db.Where("variant_id = ? AND variant_price_id IS NOT NULL AND effective_from <= ?", variantID, pc.At).
+			Where("removed_at IS NULL OR removed_at > ?", pc.At)
+		if err := priceListScope(query, pc).Limit(1).Find(&entries).Error; err != nil {
+			return nil, err
+		}
+		if len(entries) > 0 {
+			return &entries[0], nil
+		}
+	}
+
+	err := db.Where("variant_id = ? AND variant_price_id IS NULL AND effective_from <= ?", variantID, pc.At).
+		Order("effective_from DESC, created_at DESC").
+		Limit(1).
+		Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 || (pc.Currency != "" && entries[0].Currency != pc.Currency) {
+		return nil, ErrPriceHistoryNotFound
+	}
+	return &entries[0], nil
+}
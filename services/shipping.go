@@ -0,0 +1,301 @@
+package services
+
+import (
+	"errors"
+	"oms-services/models"
+	"oms-services/money"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrShippingMethodNotFound    = errors.New("shipping method not found")
+	ErrShippingMethodUnavailable = errors.New("shipping method is not available for this order")
+	ErrShippingMethodRequired    = errors.New("a shipping method must be selected")
+)
+
+// ShippingQuote is the price of shipping a draft order with a method
+type ShippingQuote struct {
+	ShippingMethodID uuid.UUID               `json:"shipping_method_id"`
+	Name             string                  `json:"name"`
+	Type             models.ShippingRateType `json:"type"`
+	Rate             money.Money             `json:"rate"`
+}
+
+// shippingMethodServes reports whether the method ships the currency to the destination
+func shippingMethodServes(method *models.ShippingMethod, currency string, destination *models.AddressSnapshot) bool {
+	if !method.IsActive || method.Currency != currency {
+		return false
+	}
+	if len(method.Countries) == 0 {
+		return true
+	}
+	return destination != nil && method.Countries.Contains(destination.Country)
+}
+
+// shippingRate prices a shipment of the given weight and discounted subtotal,
+// returning false when a weight based method has no tier for the weight
+func shippingRate(method *models.ShippingMethod, weightGrams int, subtotal money.Money) (money.Money, bool) {
+	switch method.Type {
+	case models.ShippingRateTypeWeightBased:
+		for _, tier := range method.Tiers {
+			if weightGrams >= tier.MinWeightGrams && (tier.MaxWeightGrams == nil || weightGrams <= *tier.MaxWeightGrams) {
+				return tier.Rate, true
+			}
+		}
+		return money.Zero(method.Currency), false
+	case models.ShippingRateTypeFreeOverThreshold:
+		if method.FreeOver != nil {
+			if cmp, err := subtotal.Cmp(*method.FreeOver); err == nil && cmp >= 0 {
+				return money.Zero(method.Currency), true
+			}
+		}
+	}
+	return method.Rate, true
+}
+
+// discountedSubtotal is the amount shipping thresholds are compared against
+func discountedSubtotal(order *models.Order) money.Money {
+	discounted, err := order.Subtotal.Sub(order.Discount)
+	if err != nil {
+		return order.Subtotal
+	}
+	return discounted
+}
+
+// orderWeightGrams sums the weight of the order items
+func orderWeightGrams(tx *gorm.DB, order *models.Order) (int, error) {
+	if len(order.Items) == 0 {
+		return 0, nil
+	}
+
+	quantities := map[uuid.UUID]int{}
+	variantIDs := make([]uuid.UUID, 0, len(order.Items))
+	for _, item := range order.Items {
+		quantities[item.VariantID] += item.Quantity
+		variantIDs = append(variantIDs, item.VariantID)
+	}
+
+	var variants []models.ProductVariant
+	if err := tx.Select("id", "weight_grams").Where("id IN ?", variantIDs).Find(&variants).Error; err != nil {
+		return 0, err
+	}
+
+	weight := 0
+	for _, variant := range variants {
+		weight += variant.WeightGrams * quantities[variant.ID]
+	}
+	return weight, nil
+}
+
+func loadShippingMethod(tx *gorm.DB, methodID uuid.UUID) (*models.ShippingMethod, error) {
+	var method models.ShippingMethod
+	err := tx.Preload("Tiers", func(tx *gorm.DB) *gorm.DB { return tx.Order("min_weight_grams") }).
+		First(&method, methodID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShippingMethodNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &method, nil
+}
+
+// orderShipping prices the selected shipping method of the order. A free shipping
+// coupon waives the cost.
+func orderShipping(tx *gorm.DB, order *models.Order, coupon *models.Coupon, subtotal money.Money) (money.Money, error) {
+	none := money.Zero(order.Currency)
+	if order.ShippingMethodID == nil {
+		return none, nil
+	}
+	if coupon != nil && coupon.Type == models.CouponTypeFreeShipping {
+		return none, nil
+	}
+
+	method, err := loadShippingMethod(tx, *order.ShippingMethodID)
+	if err != nil {
+		return none, err
+	}
+	weight, err := orderWeightGrams(tx, order)
+	if err != nil {
+		return none, err
+	}
+
+	rate, _ := shippingRate(method, weight, subtotal)
+	return rate, nil
+}
+
+// QuoteShipping lists the shipping methods serving the draft order with their rate.
+// The destination defaults to the order's shipping address.
+func QuoteShipping(db *gorm.DB, orderID uuid.UUID, destination *models.AddressSnapshot) ([]ShippingQuote, error) {
+	quotes := []ShippingQuote{}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		order, err := LockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusDraft {
+			return ErrOrderNotDraft
+		}
+
+		if destination == nil {
+			if destination, err = orderDestination(tx, order); err != nil {
+				return err
+			}
+		}
+		weight, err := orderWeightGrams(tx, order)
+		if err != nil {
+			return err
+		}
+
+		var methods []models.ShippingMethod
+		err = tx.Preload("Tiers", func(tx *gorm.DB) *gorm.DB { return tx.Order("min_weight_grams") }).
+			Where("is_active AND currency = ?", order.Currency).
+			Order("name").
+			Find(&methods).Error
+		if err != nil {
+			return err
+		}
+
+		for i := range methods {
+			method := &methods[i]
+			if !shippingMethodServes(method, order.Currency, destination) {
+				continue
+			}
+			rate, ok := shippingRate(method, weight, discountedSubtotal(order))
+			if !ok {
+				continue
+			}
+			if order.CouponID != nil {
+				var coupon models.Coupon
+				if tx.First(&coupon, *order.CouponID).Error == nil && coupon.Type == models.CouponTypeFreeShipping {
+					rate = money.Zero(method.Currency)
+				}
+			}
+			quotes = append(quotes, ShippingQuote{
+				ShippingMethodID: method.ID,
+				Name:             method.Name,
+				Type:             method.Type,
+				Rate:             rate,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return quotes, nil
+}
+
+// SelectShippingMethod sets the shipping method of a draft order and recalculates it
+func SelectShippingMethod(db *gorm.DB, orderID, methodID uuid.UUID) (*models.Order, error) {
+	var order *models.Order
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, err = LockOrder(tx, orderID)
+		if err != nil {
+			return err
+		}
+		if order.Status != models.OrderStatusDraft {
+			return ErrOrderNotDraft
+		}
+		return selectShippingMethod(tx, order, methodID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return order, nil
+}
+
+// selectShippingMethod sets the shipping method of a locked draft order and recalculates it
+func selectShippingMethod(tx *gorm.DB, order *models.Order, methodID uuid.UUID) error {
+	method, err := loadShippingMethod(tx, methodID)
+	if err != nil {
+		return err
+	}
+	if err := validateShippingMethod(tx, order, method); err != nil {
+		return err
+	}
+
+	order.ShippingMethodID = &method.ID
+	if err := tx.Model(order).Update("shipping_method_id", method.ID).Error; err != nil {
+		return err
+	}
+	if err := RecalculateOrder(tx, order); err != nil {
+		return err
+	}
+
+	return RecordOrderEvent(tx, order.ID, models.EventShippingMethodSelected, map[string]interface{}{
+		"shipping_method_id": method.ID,
+		"name":               method.Name,
+		"shipping_minor":     order.Shipping.Amount,
+	})
+}
+
+// UpdateShippingMethod applies a partial update to a shipping method
+func UpdateShippingMethod(db *gorm.DB, methodID uuid.UUID, updates map[string]interface{}) (*models.ShippingMethod, error) {
+	var method *models.ShippingMethod
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var locked models.ShippingMethod
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&locked, methodID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrShippingMethodNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if len(updates) > 0 {
+			if err := tx.Model(&locked).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		method, err = loadShippingMethod(tx, methodID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return method, nil
+}
+
+// validateShippingMethod checks the method serves the order's destination and weight
+func validateShippingMethod(tx *gorm.DB, order *models.Order, method *models.ShippingMethod) error {
+	destination, err := orderDestination(tx, order)
+	if err != nil {
+		return err
+	}
+	if !shippingMethodServes(method, order.Currency, destination) {
+		return ErrShippingMethodUnavailable
+	}
+
+	weight, err := orderWeightGrams(tx, order)
+	if err != nil {
+		return err
+	}
+	if _, ok := shippingRate(method, weight, discountedSubtotal(order)); !ok {
+		return ErrShippingMethodUnavailable
+	}
+	return nil
+}
+
+// validateOrderShipping makes sure a placed order has a shipping method serving it
+func validateOrderShipping(tx *gorm.DB, order *models.Order) error {
+	if order.ShippingMethodID == nil {
+		return ErrShippingMethodRequired
+	}
+
+	method, err := loadShippingMethod(tx, *order.ShippingMethodID)
+	if errors.Is(err, ErrShippingMethodNotFound) {
+		return ErrShippingMethodUnavailable
+	}
+	if err != nil {
+		return err
+	}
+	return validateShippingMethod(tx, order, method)
+}
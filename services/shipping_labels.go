@@ -0,0 +1,183 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"oms-services/carriers"
+	"oms-services/models"
+	"oms-services/storage"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// shippingLabel is a label bought for a shipment, kept to void it when the shipment
+// can't be saved
+type shippingLabel struct {
+	TrackingNumber string
+	Key            string
+}
+
+// buyShipmentLabel buys the label of a new shipment, stores its PDF and records it on
+// the shipment. The shipment ID must be set, it is the label reference.
+func buyShipmentLabel(ctx context.Context, tx *gorm.DB, store storage.Storage, carrier carriers.Carrier, order *models.Order, shipment *models.Shipment, service string) (*shippingLabel, error) {
+	var location models.Location
+	if err := tx.First(&location, shipment.LocationID).Error; err != nil {
+		return nil, err
+	}
+
+	variantIDs := make([]uuid.UUID, len(shipment.Items))
+	for i, item := range shipment.Items {
+		variantIDs[i] = item.VariantID
+	}
+	var variants []models.ProductVariant
+	if err := tx.Select("id", "weight_grams").Where("id IN ?", variantIDs).Find(&variants).Error; err != nil {
+		return nil, err
+	}
+	weights := map[uuid.UUID]int{}
+	for _, variant := range variants {
+		weights[variant.ID] = variant.WeightGrams
+	}
+	weight := 0
+	for _, item := range shipment.Items {
+		weight += weights[item.VariantID] * item.Quantity
+	}
+
+	label, err := carrier.CreateLabel(ctx, carriers.LabelRequest{
+		Reference:   shipment.ID.String(),
+		Service:     service,
+		From:        locationAddress(&location),
+		To:          snapshotAddress(order.ShippingAddressSnapshot),
+		WeightGrams: weight,
+		Currency:    order.Currency,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bought := shippingLabel{TrackingNumber: label.TrackingNumber, Key: fmt.Sprintf("labels/%s.pdf", shipment.ID)}
+	if err := store.Save(bought.Key, bytes.NewReader(label.PDF)); err != nil {
+		voidShippingLabel(ctx, store, carrier, bought)
+		return nil, err
+	}
+
+	code, url, currency := carrier.Code(), store.URL(bought.Key), label.Cost.Currency
+	shipment.Carrier = &code
+	shipment.Service = &label.Service
+	shipment.TrackingNumber = &label.TrackingNumber
+	shipment.LabelKey = &bought.Key
+	shipment.LabelURL = &url
+	shipment.LabelCost = &label.Cost
+	shipment.LabelCurrency = &currency
+	return &bought, nil
+}
+
+// labelVoidTimeout bounds the void of a label bought by a failed request
+const labelVoidTimeout = 30 * time.Second
+
+// voidShippingLabel voids a label and deletes its PDF. Failures only leave an unused
+// label behind, so they are logged rather than returned. The void outlives the request
+// context, which is often cancelled by then.
+func voidShippingLabel(ctx context.Context, store storage.Storage, carrier carriers.Carrier, label shippingLabel) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), labelVoidTimeout)
+	defer cancel()
+
+	if err := carrier.VoidLabel(ctx, label.TrackingNumber); err != nil {
+		log.Printf("shipping labels: unable to void %s label %s: %v", carrier.Code(), label.TrackingNumber, err)
+	}
+	if err := store.Delete(label.Key); err != nil {
+		log.Printf("shipping labels: unable to delete %s: %v", label.Key, err)
+	}
+}
+
+// CancelShipment voids the label of a shipment not handed over yet and deletes the
+// shipment, so its stock can be shipped again. A label the carrier already handed over
+// blocks the cancel; one it no longer knows, already voided or from a carrier no longer
+// configured is logged and the shipment is cancelled anyway.
+func CancelShipment(ctx context.Context, db *gorm.DB, store storage.Storage, registry *carriers.Registry, shipmentID uuid.UUID) error {
+	var labelKey *string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		shipment, err := lockShipment(tx, shipmentID)
+		if err != nil {
+			return err
+		}
+		if shipment.Status != models.ShipmentStatusPending && shipment.Status != models.ShipmentStatusPacked {
+			return fmt.Errorf("%w: only pending or packed shipments can be cancelled", ErrShipmentStatus)
+		}
+		labelKey = shipment.LabelKey
+
+		if err := tx.Delete(shipment).Error; err != nil {
+			return err
+		}
+		err = RecordOrderEvent(tx, shipment.OrderID, models.EventShipmentCancelled, map[string]interface{}{
+			"shipment_id":     shipment.ID,
+			"carrier":         shipment.Carrier,
+			"tracking_number": shipment.TrackingNumber,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Void last, a voided label can't be restored if the transaction fails
+		if shipment.Carrier == nil || shipment.TrackingNumber == nil {
+			return nil
+		}
+		carrier, err := registry.Get(*shipment.Carrier)
+		if err == nil {
+			err = carrier.VoidLabel(ctx, *shipment.TrackingNumber)
+		}
+		if errors.Is(err, carriers.ErrUnknownCarrier) || errors.Is(err, carriers.ErrTrackingNotFound) || errors.Is(err, carriers.ErrLabelVoided) {
+			log.Printf("shipping labels: %s label %s of cancelled shipment %s not voided: %v", *shipment.Carrier, *shipment.TrackingNumber, shipment.ID, err)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if labelKey != nil {
+		if err := store.Delete(*labelKey); err != nil {
+			log.Printf("shipping labels: unable to delete %s: %v", *labelKey, err)
+		}
+	}
+	return nil
+}
+
+// locationAddress is the address parcels leave a location from
+func locationAddress(location *models.Location) carriers.Address {
+	return carriers.Address{
+		Name:       location.Name,
+		Line1:      stringValue(location.Line1),
+		City:       stringValue(location.City),
+		Region:     stringValue(location.Region),
+		PostalCode: stringValue(location.PostalCode),
+		Country:    location.Country,
+	}
+}
+
+// snapshotAddress is the address parcels of an order are delivered to
+func snapshotAddress(address *models.AddressSnapshot) carriers.Address {
+	return carriers.Address{
+		Name:       strings.TrimSpace(address.FirstName + " " + address.LastName),
+		Line1:      address.Line1,
+		Line2:      stringValue(address.Line2),
+		City:       address.City,
+		Region:     stringValue(address.Region),
+		PostalCode: stringValue(address.PostalCode),
+		Country:    address.Country,
+		Phone:      stringValue(address.Phone),
+	}
+}
+
+func stringValue(value *string) string {
+	if value == nil {
+		return ""
+	}
+	return *value
+}
@@ -0,0 +1,299 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"oms-services/models"
+	"slices"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrInsufficientStock = errors.New("not enough stock")
+
+// reservedOrderStatuses are the statuses of orders holding reserved stock
+var reservedOrderStatuses = []models.OrderStatus{
+	models.OrderStatusPendingPayment,
+	models.OrderStatusPaid,
+	models.OrderStatusFulfillmentInProgress,
+}
+
+// updateOrderStock follows an order status change on the inventory: checkout reserves
+// the stock of the order, shipping consumes it and cancelling releases it
+func updateOrderStock(tx *gorm.DB, order *models.Order, from, to models.OrderStatus) error {
+	held := slices.Contains(reservedOrderStatuses, from)
+	switch {
+	case from == models.OrderStatusDraft && slices.Contains(reservedOrderStatuses, to):
+		return reserveOrderStock(tx, order)
+	case held && to == models.OrderStatusShipped:
+		return consumeOrderStock(tx, order)
+	case held && to == models.OrderStatusCancelled:
+		return releaseOrderStock(tx, order)
+	}
+	return nil
+}
+
+// reserveOrderStock routes the order's variants, or their components for bundle items,
+// to the locations they ship from and reserves them there. Units out of stock are
+// backordered when the variant allows it. Variants without inventory are not stock
+// tracked.
+func reserveOrderStock(tx *gorm.DB, order *models.Order) error {
+	lines, err := orderStockLines(tx, order)
+	if err != nil {
+		return err
+	}
+	inventories, err := lockInventories(tx, lines)
+	if err != nil {
+		return err
+	}
+	var locations []models.Location
+	if err := tx.Where("is_active").Find(&locations).Error; err != nil {
+		return err
+	}
+
+	tracked := map[uuid.UUID]bool{}
+	for _, inventory := range inventories {
+		tracked[inventory.VariantID] = true
+	}
+	lines = slices.DeleteFunc(lines, func(line stockLine) bool { return !tracked[line.VariantID] })
+	policies, err := stockPolicies(tx, lines)
+	if err != nil {
+		return err
+	}
+
+	router := newStockRouter(locations, inventories, order.ShippingAddressSnapshot)
+	lines, backordered := splitShortfall(lines, router, policies)
+	var allocations []models.StockAllocation
+	for {
+		router = newStockRouter(locations, inventories, order.ShippingAddressSnapshot)
+		var short *uuid.UUID
+		allocations, short, err = router.route(FulfillmentRouting, lines)
+		if err != nil {
+			return err
+		}
+		if short == nil {
+			break
+		}
+		variant := policies[*short]
+		if variant.InventoryPolicy == models.InventoryPolicyDeny {
+			return fmt.Errorf("%w: %s", ErrInsufficientStock, variant.SKU)
+		}
+		// The strategy can't ship the units in stock either, e.g. without splitting an
+		// item across locations, so they wait for stock too
+		lines = slices.DeleteFunc(lines, func(line stockLine) bool {
+			if line.VariantID != *short {
+				return false
+			}
+			backordered = append(backordered, line)
+			return true
+		})
+	}
+	if err := createBackorders(tx, order, backordered, policies); err != nil {
+		return err
+	}
+
+	byKey := indexInventories(inventories)
+	for i := range allocations {
+		allocations[i].OrderID = order.ID
+		if err := tx.Create(&allocations[i]).Error; err != nil {
+			return err
+		}
+		inventory := byKey[inventoryKey{allocations[i].VariantID, allocations[i].LocationID}]
+		if err := moveStock(tx, inventory, 0, allocations[i].Quantity, orderMovement(order, models.MovementReservation)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consumeOrderStock takes the reserved units of a shipped order off the shelves of the
+// locations they were allocated to. Orders still waiting for stock can't ship.
+func consumeOrderStock(tx *gorm.DB, order *models.Order) error {
+	if backordered, err := orderHasOpenBackorders(tx, order); err != nil {
+		return err
+	} else if backordered {
+		return ErrOrderBackordered
+	}
+
+	allocations, inventories, err := lockOrderAllocations(tx, order)
+	if err != nil {
+		return err
+	}
+
+	for _, allocation := range allocations {
+		inventory, ok := inventories[inventoryKey{allocation.VariantID, allocation.LocationID}]
+		if !ok {
+			continue
+		}
+		released := min(allocation.Quantity, inventory.QtyReserved)
+		if err := moveStock(tx, inventory, -allocation.Quantity, -released, orderMovement(order, models.MovementShipment)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseOrderStock gives the reserved units of a cancelled order back to their
+// locations, where they go to the orders waiting for them, and cancels its backorders
+func releaseOrderStock(tx *gorm.DB, order *models.Order) error {
+	if err := cancelOrderBackorders(tx, order); err != nil {
+		return err
+	}
+	allocations, inventories, err := lockOrderAllocations(tx, order)
+	if err != nil {
+		return err
+	}
+
+	var released []*models.Inventory
+	for _, allocation := range allocations {
+		inventory, ok := inventories[inventoryKey{allocation.VariantID, allocation.LocationID}]
+		if !ok {
+			continue
+		}
+		quantity := min(allocation.Quantity, inventory.QtyReserved)
+		if err := moveStock(tx, inventory, 0, -quantity, orderMovement(order, models.MovementRelease)); err != nil {
+			return err
+		}
+		if !slices.Contains(released, inventory) {
+			released = append(released, inventory)
+		}
+	}
+
+	for _, inventory := range released {
+		if err := fillBackorders(tx, inventory); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lockOrderAllocations loads the stock allocations of an order and locks the inventories
+// they reserved. Orders reserved before locations existed have neither allocations nor
+// backorders, their stock was moved to the default location.
+func lockOrderAllocations(tx *gorm.DB, order *models.Order) ([]models.StockAllocation, map[inventoryKey]*models.Inventory, error) {
+	var allocations []models.StockAllocation
+	if err := tx.Where("order_id = ?", order.ID).Order("created_at").Find(&allocations).Error; err != nil {
+		return nil, nil, err
+	}
+
+	lines := make([]stockLine, len(allocations))
+	for i, allocation := range allocations {
+		lines[i] = stockLine{OrderItemID: allocation.OrderItemID, VariantID: allocation.VariantID, Quantity: allocation.Quantity}
+	}
+	var backorders int64
+	if len(allocations) == 0 {
+		if err := tx.Model(&models.Backorder{}).Where("order_id = ?", order.ID).Count(&backorders).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(allocations) == 0 && backorders == 0 {
+		var err error
+		if lines, err = orderStockLines(tx, order); err != nil {
+			return nil, nil, err
+		}
+		if len(lines) > 0 {
+			location, err := resolveLocation(tx, nil)
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, line := range lines {
+				allocations = append(allocations, models.StockAllocation{
+					OrderID:     order.ID,
+					OrderItemID: line.OrderItemID,
+					VariantID:   line.VariantID,
+					LocationID:  location.ID,
+					Quantity:    line.Quantity,
+				})
+			}
+		}
+	}
+
+	inventories, err := lockInventories(tx, lines)
+	if err != nil {
+		return nil, nil, err
+	}
+	return allocations, indexInventories(inventories), nil
+}
+
+// orderStockLines lists the units per variant each order item takes from the inventory,
+// the frozen components of bundle items standing for the bundles themselves
+func orderStockLines(tx *gorm.DB, order *models.Order) ([]stockLine, error) {
+	itemIDs := make([]uuid.UUID, len(order.Items))
+	for i, item := range order.Items {
+		itemIDs[i] = item.ID
+	}
+
+	var components []models.OrderItemComponent
+	if len(itemIDs) > 0 {
+		if err := tx.Where("order_item_id IN ?", itemIDs).Order("created_at").Find(&components).Error; err != nil {
+			return nil, err
+		}
+	}
+	componentsByItem := map[uuid.UUID][]models.OrderItemComponent{}
+	for _, component := range components {
+		componentsByItem[component.OrderItemID] = append(componentsByItem[component.OrderItemID], component)
+	}
+
+	var lines []stockLine
+	for _, item := range order.Items {
+		itemComponents, bundled := componentsByItem[item.ID]
+		if !bundled {
+			lines = append(lines, stockLine{OrderItemID: item.ID, VariantID: item.VariantID, Quantity: item.Quantity})
+			continue
+		}
+		for _, component := range itemComponents {
+			lines = append(lines, stockLine{OrderItemID: item.ID, VariantID: component.VariantID, Quantity: component.Quantity})
+		}
+	}
+	return lines, nil
+}
+
+// lockInventories locks the inventories of the lines' variants at every location, in a
+// stable order so concurrent checkouts can't deadlock
+func lockInventories(tx *gorm.DB, lines []stockLine) ([]models.Inventory, error) {
+	var inventories []models.Inventory
+	if len(lines) == 0 {
+		return inventories, nil
+	}
+
+	variantIDs := map[uuid.UUID]bool{}
+	for _, line := range lines {
+		variantIDs[line.VariantID] = true
+	}
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("variant_id IN ?", slices.Collect(maps.Keys(variantIDs))).
+		Order("variant_id, location_id").
+		Find(&inventories).Error
+	return inventories, err
+}
+
+func indexInventories(inventories []models.Inventory) map[inventoryKey]*models.Inventory {
+	byKey := make(map[inventoryKey]*models.Inventory, len(inventories))
+	for i := range inventories {
+		byKey[inventoryKey{inventories[i].VariantID, inventories[i].LocationID}] = &inventories[i]
+	}
+	return byKey
+}
+
+// variantStockAvailable returns the units of a variant on hand and not reserved at the
+// active locations, nil when its stock is not tracked
+func variantStockAvailable(db *gorm.DB, variantID uuid.UUID) (*int, error) {
+	var stock struct {
+		Inventories int
+		Available   int
+	}
+	err := db.Model(&models.Inventory{}).
+		Select("COUNT(*) AS inventories, COALESCE(SUM(qty_on_hand - qty_reserved) FILTER (WHERE location_id IN (SELECT id FROM locations WHERE is_active)), 0) AS available").
+		Where("variant_id = ?", variantID).
+		Scan(&stock).Error
+	if err != nil {
+		return nil, err
+	}
+	if stock.Inventories == 0 {
+		return nil, nil
+	}
+	return &stock.Available, nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"errors"
+	"oms-services/models"
+	"oms-services/money"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrTaxRateNotFound = errors.New("tax rate not found")
+
+// UpdateTaxRate applies column updates to a tax rate
+func UpdateTaxRate(db *gorm.DB, rateID uuid.UUID, updates map[string]interface{}) (*models.TaxRate, error) {
+	var rate models.TaxRate
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&rate, rateID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTaxRateNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if len(updates) == 0 {
+			return nil
+		}
+		if err := tx.Model(&rate).Updates(updates).Error; err != nil {
+			return err
+		}
+		return tx.First(&rate, rateID).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &rate, nil
+}
+
+// TaxableLine is an order line handed to a TaxCalculator
+type TaxableLine struct {
+	ItemID   uuid.UUID
+	TaxClass string
+	Amount   money.Money // Line amount after discounts
+}
+
+// TaxRequest describes what has to be taxed and where it ships to
+type TaxRequest struct {
+	Currency string
+	Address  *models.AddressSnapshot
+	Lines    []TaxableLine
+}
+
+// TaxResult holds the tax per line (same order as the request) and the order breakdown.
+// Exclusive is the part of the tax that has to be added on top of the prices.
+type TaxResult struct {
+	LineTax   []money.Money
+	Exclusive money.Money
+	Breakdown models.TaxBreakdown
+}
+
+// TaxCalculator computes taxes for an order, implementations can call out to
+// external tax providers
+type TaxCalculator interface {
+	Calculate(tx *gorm.DB, request TaxRequest) (*TaxResult, error)
+}
+
+// DefaultTaxCalculator is the calculator used when recalculating orders
+var DefaultTaxCalculator TaxCalculator = RulesTaxCalculator{}
+
+// RulesTaxCalculator applies the TaxRate rows matching the destination country,
+// region and product tax class; a region rule wins over a country-wide one
+type RulesTaxCalculator struct{}
+
+func (RulesTaxCalculator) Calculate(tx *gorm.DB, request TaxRequest) (*TaxResult, error) {
+	if request.Address == nil || len(request.Lines) == 0 {
+		return applyTaxRates(request, nil)
+	}
+
+	var rates []models.TaxRate
+	// Countries are stored upper-cased, addresses saved before that may not be
+	query := tx.Where("is_active AND country = ?", strings.ToUpper(request.Address.Country))
+	if request.Address.Region != nil {
+		query = query.Where("region IS NULL OR lower(region) = lower(?)", *request.Address.Region)
+	} else {
+		query = query.Where("region IS NULL")
+	}
+	if err := query.Find(&rates).Error; err != nil {
+		return nil, err
+	}
+	return applyTaxRates(request, rates)
+}
+
+// applyTaxRates taxes the lines of a request with the rates matching its destination,
+// a region rate winning over a country-wide one of the same tax class
+func applyTaxRates(request TaxRequest, rates []models.TaxRate) (*TaxResult, error) {
+	result := &TaxResult{
+		LineTax:   make([]money.Money, len(request.Lines)),
+		Exclusive: money.Zero(request.Currency),
+		Breakdown: models.TaxBreakdown{},
+	}
+	for i := range result.LineTax {
+		result.LineTax[i] = money.Zero(request.Currency)
+	}
+
+	byClass := map[string]*models.TaxRate{}
+	for i := range rates {
+		rate := &rates[i]
+		if current, ok := byClass[rate.TaxClass]; !ok || (current.Region == nil && rate.Region != nil) {
+			byClass[rate.TaxClass] = rate
+		}
+	}
+
+	var err error
+	breakdown := map[uuid.UUID]int{}
+	for i, line := range request.Lines {
+		rate, ok := byClass[line.TaxClass]
+		if !ok {
+			continue
+		}
+
+		tax := lineTax(line.Amount, rate)
+		result.LineTax[i] = tax
+		if !rate.IsInclusive {
+			if result.Exclusive, err = result.Exclusive.Add(tax); err != nil {
+				return nil, err
+			}
+		}
+
+		index, ok := breakdown[rate.ID]
+		if !ok {
+			index = len(result.Breakdown)
+			breakdown[rate.ID] = index
+			result.Breakdown = append(result.Breakdown, models.TaxBreakdownLine{
+				TaxRateID:       rate.ID,
+				Name:            rate.Name,
+				TaxClass:        rate.TaxClass,
+				RateBasisPoints: rate.RateBasisPoints,
+				IsInclusive:     rate.IsInclusive,
+				Taxable:         money.Zero(request.Currency),
+				Tax:             money.Zero(request.Currency),
+			})
+		}
+		entry := &result.Breakdown[index]
+		if entry.Taxable, err = entry.Taxable.Add(line.Amount); err != nil {
+			return nil, err
+		}
+		if entry.Tax, err = entry.Tax.Add(tax); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
+
+// lineTax rounds half up the tax of a line; inclusive rates extract the tax
+// already contained in the amount
+func lineTax(amount money.Money, rate *models.TaxRate) money.Money {
+	basisPoints := int64(rate.RateBasisPoints)
+	if rate.IsInclusive {
+		return amount.MulFraction(basisPoints, 10000+basisPoints)
+	}
+	return amount.MulRate(basisPoints)
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"slices"
+	"testing"
+
+	"oms-services/models"
+	"oms-services/money"
+
+	"github.com/google/uuid"
+)
+
+func TestLineTax(t *testing.T) {
+	tests := []struct {
+		name        string
+		amount      int64
+		basisPoints int
+		inclusive   bool
+		want        int64
+	}{
+		{name: "exclusive", amount: 10000, basisPoints: 1400, want: 1400},
+		{name: "exclusive rounds half up", amount: 25, basisPoints: 1000, want: 3},
+		{name: "inclusive", amount: 11400, basisPoints: 1400, inclusive: true, want: 1400},
+		{name: "inclusive rounds", amount: 1000, basisPoints: 1400, inclusive: true, want: 123},
+		{name: "zero rate", amount: 10000, basisPoints: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate := &models.TaxRate{RateBasisPoints: tt.basisPoints, IsInclusive: tt.inclusive}
+			got := lineTax(money.New(tt.amount, "EGP"), rate)
+			if got.Amount != tt.want || got.Currency != "EGP" {
+				t.Errorf("lineTax() = %v, want %d EGP", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyTaxRates(t *testing.T) {
+	cairo := "Cairo"
+	countryVAT := models.TaxRate{ID: uuid.New(), Name: "VAT", TaxClass: "standard", RateBasisPoints: 1400}
+	regionVAT := models.TaxRate{ID: uuid.New(), Name: "Cairo VAT", Region: &cairo, TaxClass: "standard", RateBasisPoints: 1000}
+	reduced := models.TaxRate{ID: uuid.New(), Name: "Reduced", TaxClass: "reduced", RateBasisPoints: 500}
+	included := models.TaxRate{ID: uuid.New(), Name: "Included VAT", TaxClass: "standard", RateBasisPoints: 1400, IsInclusive: true}
+
+	line := func(class string, amount int64) TaxableLine {
+		return TaxableLine{ItemID: uuid.New(), TaxClass: class, Amount: money.New(amount, "EGP")}
+	}
+
+	tests := []struct {
+		name      string
+		rates     []models.TaxRate
+		lines     []TaxableLine
+		lineTax   []int64
+		exclusive int64
+		breakdown []string
+	}{
+		{
+			name:      "no rates",
+			lines:     []TaxableLine{line("standard", 1000)},
+			lineTax:   []int64{0},
+			breakdown: []string{},
+		},
+		{
+			name:      "country rate",
+			rates:     []models.TaxRate{countryVAT},
+			lines:     []TaxableLine{line("standard", 1000), line("standard", 500)},
+			lineTax:   []int64{140, 70},
+			exclusive: 210,
+			breakdown: []string{"VAT"},
+		},
+		{
+			name:      "region wins over country",
+			rates:     []models.TaxRate{countryVAT, regionVAT},
+			lines:     []TaxableLine{line("standard", 1000)},
+			lineTax:   []int64{100},
+			exclusive: 100,
+			breakdown: []string{"Cairo VAT"},
+		},
+		{
+			name:      "region wins whatever the order",
+			rates:     []models.TaxRate{regionVAT, countryVAT},
+			lines:     []TaxableLine{line("standard", 1000)},
+			lineTax:   []int64{100},
+			exclusive: 100,
+			breakdown: []string{"Cairo VAT"},
+		},
+		{
+			name:      "rate per tax class",
+			rates:     []models.TaxRate{countryVAT, reduced},
+			lines:     []TaxableLine{line("reduced", 1000), line("standard", 1000), line("exempt", 1000)},
+			lineTax:   []int64{50, 140, 0},
+			exclusive: 190,
+			breakdown: []string{"Reduced", "VAT"},
+		},
+		{
+			name:      "inclusive rate adds nothing on top",
+			rates:     []models.TaxRate{included},
+			lines:     []TaxableLine{line("standard", 1140)},
+			lineTax:   []int64{140},
+			breakdown: []string{"Included VAT"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := TaxRequest{Currency: "EGP", Lines: tt.lines}
+			result, err := applyTaxRates(request, tt.rates)
+			if err != nil {
+				t.Fatalf("applyTaxRates() error = %v", err)
+			}
+
+			lineTax := make([]int64, len(result.LineTax))
+			for i, tax := range result.LineTax {
+				lineTax[i] = tax.Amount
+			}
+			if !slices.Equal(lineTax, tt.lineTax) {
+				t.Errorf("line taxes = %v, want %v", lineTax, tt.lineTax)
+			}
+			if result.Exclusive.Amount != tt.exclusive {
+				t.Errorf("exclusive tax = %d, want %d", result.Exclusive.Amount, tt.exclusive)
+			}
+
+			names := make([]string, len(result.Breakdown))
+			var collected int64
+			for i, entry := range result.Breakdown {
+				names[i] = entry.Name
+				collected += entry.Tax.Amount
+			}
+			if !slices.Equal(names, tt.breakdown) {
+				t.Errorf("breakdown = %v, want %v", names, tt.breakdown)
+			}
+			var total int64
+			for _, tax := range lineTax {
+				total += tax
+			}
+			if collected != total {
+				t.Errorf("breakdown collects %d, lines are taxed %d", collected, total)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"oms-services/carriers"
+	"oms-services/models"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrShipmentNotTracked = errors.New("shipment has no carrier tracking")
+
+// trackingBatchSize is how many shipments a tracking poll asks their carrier about
+const trackingBatchSize = 100
+
+// trackingStatuses maps the carrier statuses onto the shipment statuses. Parcels in
+// pre_transit haven't been handed over, their shipment keeps its status.
+var trackingStatuses = map[carriers.Status]models.ShipmentStatus{
+	carriers.StatusInTransit:      models.ShipmentStatusInTransit,
+	carriers.StatusOutForDelivery: models.ShipmentStatusInTransit,
+	carriers.StatusDelivered:      models.ShipmentStatusDelivered,
+	carriers.StatusFailure:        models.ShipmentStatusFailed,
+}
+
+// trackedShipmentStatuses are the statuses of the shipments the carriers are polled about
+var trackedShipmentStatuses = []models.ShipmentStatus{
+	models.ShipmentStatusPending,
+	models.ShipmentStatusPacked,
+	models.ShipmentStatusInTransit,
+}
+
+// ApplyTracking records a tracking update of a carrier on the shipment of the tracking
+// number: its new checkpoints, its status, and the order status once all its shipments
+// are on their way or delivered
+func ApplyTracking(db *gorm.DB, carrierCode string, tracking carriers.Tracking) (*models.Shipment, error) {
+	shipmentID, _, err := updateShipmentTracking(db, carrierCode, tracking)
+	if err != nil {
+		return nil, err
+	}
+	return GetShipment(db, shipmentID)
+}
+
+// RefreshShipmentTracking asks the carrier of a shipment where its parcel stands now
+func RefreshShipmentTracking(ctx context.Context, db *gorm.DB, registry *carriers.Registry, shipmentID uuid.UUID) (*models.Shipment, error) {
+	var shipment models.Shipment
+	err := db.Select("id", "carrier", "tracking_number").First(&shipment, shipmentID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrShipmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if shipment.Carrier == nil || shipment.TrackingNumber == nil {
+		return nil, ErrShipmentNotTracked
+	}
+
+	if _, err := trackShipment(ctx, db, registry, &shipment); err != nil {
+		return nil, err
+	}
+	return GetShipment(db, shipmentID)
+}
+
+// PollShipmentTracking asks the carriers about the shipments not delivered yet that were
+// tracked the longest ago. Returns the number of shipments whose status changed.
+func PollShipmentTracking(ctx context.Context, db *gorm.DB, registry *carriers.Registry) (int, error) {
+	var shipments []models.Shipment
+	err := db.Select("id", "carrier", "tracking_number").
+		Where("status IN ? AND tracking_number IS NOT NULL", trackedShipmentStatuses).
+		Order("tracked_at NULLS FIRST").
+		Limit(trackingBatchSize).
+		Find(&shipments).Error
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	for i := range shipments {
+		if err := ctx.Err(); err != nil {
+			return changed, err
+		}
+		shipment := &shipments[i]
+		updated, err := trackShipment(ctx, db, registry, shipment)
+		if err != nil {
+			log.Printf("shipment tracking: %s %s: %v", *shipment.Carrier, *shipment.TrackingNumber, err)
+			continue
+		}
+		if updated {
+			changed++
+		}
+	}
+	return changed, nil
+}
+
+// RunTrackingPoller polls the shipment tracking every interval until the context is done
+func RunTrackingPoller(ctx context.Context, db *gorm.DB, registry *carriers.Registry, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if changed, err := PollShipmentTracking(ctx, db, registry); err != nil {
+			log.Printf("shipment tracking: %v", err)
+		} else if changed > 0 {
+			log.Printf("shipment tracking: %d shipments changed status", changed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// trackShipment fetches the tracking of a shipment from its carrier and applies it. A
+// shipment the carrier can't track still counts as tracked, so it doesn't hold the
+// shipments behind it in the polling queue.
+func trackShipment(ctx context.Context, db *gorm.DB, registry *carriers.Registry, shipment *models.Shipment) (bool, error) {
+	carrier, err := registry.Get(*shipment.Carrier)
+	if err != nil {
+		return false, err
+	}
+	tracking, err := carrier.Track(ctx, *shipment.TrackingNumber)
+	if err != nil {
+		if err := db.Model(shipment).UpdateColumn("tracked_at", time.Now()).Error; err != nil {
+			log.Printf("shipment tracking: unable to requeue shipment %s: %v", shipment.ID, err)
+		}
+		return false, err
+	}
+
+	_, changed, err := updateShipmentTracking(db, carrier.Code(), *tracking)
+	return changed, err
+}
+
+// updateShipmentTracking applies a tracking update, telling whether the shipment status
+// changed
+func updateShipmentTracking(db *gorm.DB, carrierCode string, tracking carriers.Tracking) (uuid.UUID, bool, error) {
+	var shipmentID uuid.UUID
+	changed := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var shipment models.Shipment
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("carrier = ? AND tracking_number = ?", carrierCode, tracking.TrackingNumber).
+			First(&shipment).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrShipmentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		shipmentID = shipment.ID
+
+		checkpoints := make([]models.TrackingCheckpoint, 0, len(tracking.Events))
+		for _, event := range tracking.Events {
+			checkpoint := models.TrackingCheckpoint{
+				ShipmentID:  shipment.ID,
+				Code:        event.Code,
+				Status:      string(event.Status),
+				Description: event.Description,
+				OccurredAt:  event.OccurredAt,
+			}
+			if event.Location != "" {
+				location := event.Location
+				checkpoint.Location = &location
+			}
+			checkpoints = append(checkpoints, checkpoint)
+		}
+		if len(checkpoints) > 0 {
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&checkpoints).Error; err != nil {
+				return err
+			}
+		}
+
+		from := shipment.Status
+		updates := trackingTransition(&shipment, tracking)
+		changed = updates != nil
+		if !changed {
+			updates = map[string]interface{}{}
+		}
+		updates["tracked_at"] = time.Now()
+		if err := tx.Model(&shipment).Updates(updates).Error; err != nil {
+			return err
+		}
+		if !changed {
+			return nil
+		}
+
+		err = RecordOrderEvent(tx, shipment.OrderID, models.EventShipmentStatusChanged, map[string]interface{}{
+			"shipment_id":     shipment.ID,
+			"tracking_number": tracking.TrackingNumber,
+			"from":            from,
+			"to":              updates["status"],
+		})
+		if err != nil {
+			return err
+		}
+		return advanceOrderShipping(tx, shipment.OrderID)
+	})
+	return shipmentID, changed, err
+}
+
+// trackingTransition returns the shipment fields a tracking update changes, nil when it
+// leaves the shipment status as is
+func trackingTransition(shipment *models.Shipment, tracking carriers.Tracking) map[string]interface{} {
+	to, ok := trackingStatuses[tracking.Status]
+	// Delivered is final, late events of a delivered parcel don't move it back
+	if !ok || to == shipment.Status || shipment.Status == models.ShipmentStatusDelivered {
+		return nil
+	}
+
+	updates := map[string]interface{}{"status": to}
+	if to != models.ShipmentStatusFailed && shipment.ShippedAt == nil {
+		updates["shipped_at"] = trackingEventTime(tracking, carriers.StatusInTransit, carriers.StatusOutForDelivery, carriers.StatusDelivered)
+	}
+	if to == models.ShipmentStatusDelivered {
+		updates["delivered_at"] = trackingEventTime(tracking, carriers.StatusDelivered)
+	}
+	return updates
+}
+
+// trackingEventTime is when the first event of the statuses occurred, now when the
+// carrier reported none
+func trackingEventTime(tracking carriers.Tracking, statuses ...carriers.Status) time.Time {
+	for _, event := range tracking.Events {
+		if slices.Contains(statuses, event.Status) {
+			return event.OccurredAt
+		}
+	}
+	return time.Now()
+}
+
+// advanceOrderShipping moves an order being fulfilled to shipped once all its stock left
+// in shipments handed over to the carrier, and a shipped order to completed once all its
+// shipments are delivered
+func advanceOrderShipping(tx *gorm.DB, orderID uuid.UUID) error {
+	order, err := LockOrder(tx, orderID)
+	if err != nil {
+		return err
+	}
+	if order.Status != models.OrderStatusFulfillmentInProgress && order.Status != models.OrderStatusShipped {
+		return nil
+	}
+
+	var statuses []models.ShipmentStatus
+	if err := tx.Model(&models.Shipment{}).Where("order_id = ?", order.ID).Pluck("status", &statuses).Error; err != nil {
+		return err
+	}
+	handedOver, delivered := shipmentsProgress(statuses)
+	if !handedOver {
+		return nil
+	}
+
+	if order.Status == models.OrderStatusFulfillmentInProgress {
+		var unshipped int64
+		err := tx.Model(&models.StockAllocation{}).
+			Where("order_id = ? AND NOT EXISTS (SELECT 1 FROM shipment_items WHERE shipment_items.allocation_id = stock_allocations.id)", order.ID).
+			Count(&unshipped).Error
+		if err != nil || unshipped > 0 {
+			return err
+		}
+		err = ChangeOrderStatus(tx, order, models.OrderStatusShipped)
+		if errors.Is(err, ErrOrderBackordered) {
+			// Backordered units ship later, in shipments of their own
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if delivered {
+		return ChangeOrderStatus(tx, order, models.OrderStatusCompleted)
+	}
+	return nil
+}
+
+// shipmentsProgress tells whether all the shipments were handed over to their carrier,
+// and whether all of them were delivered
+func shipmentsProgress(statuses []models.ShipmentStatus) (bool, bool) {
+	if len(statuses) == 0 {
+		return false, false
+	}
+	delivered := true
+	for _, status := range statuses {
+		if status != models.ShipmentStatusInTransit && status != models.ShipmentStatusDelivered {
+			return false, false
+		}
+		delivered = delivered && status == models.ShipmentStatusDelivered
+	}
+	return true, delivered
+}
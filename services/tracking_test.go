@@ -0,0 +1,111 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"oms-services/carriers"
+	"oms-services/models"
+)
+
+func TestTrackingTransition(t *testing.T) {
+	pickedUp := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	handedOver := pickedUp.Add(-time.Hour)
+	deliveredAt := pickedUp.Add(48 * time.Hour)
+	events := []carriers.TrackingEvent{
+		{Code: "LBL", Status: carriers.StatusPreTransit, OccurredAt: pickedUp.Add(-24 * time.Hour)},
+		{Code: "PU", Status: carriers.StatusInTransit, OccurredAt: pickedUp},
+		{Code: "OFD", Status: carriers.StatusOutForDelivery, OccurredAt: pickedUp.Add(24 * time.Hour)},
+		{Code: "DL", Status: carriers.StatusDelivered, OccurredAt: deliveredAt},
+	}
+
+	tests := []struct {
+		name       string
+		from       models.ShipmentStatus
+		shippedAt  *time.Time
+		status     carriers.Status
+		events     []carriers.TrackingEvent
+		want       models.ShipmentStatus // empty when the status stays
+		shipped    *time.Time            // nil when shipped_at isn't set
+		delivered  *time.Time            // nil when delivered_at isn't set
+		stampedNow bool                  // shipped_at is set to now, the carrier reported no event
+	}{
+		{name: "pre transit keeps the status", from: models.ShipmentStatusPacked, status: carriers.StatusPreTransit, events: events[:1]},
+		{name: "unknown status", from: models.ShipmentStatusPacked, status: "lost_in_space"},
+		{name: "picked up", from: models.ShipmentStatusPacked, status: carriers.StatusInTransit, events: events[:2], want: models.ShipmentStatusInTransit, shipped: &pickedUp},
+		{name: "out for delivery stays in transit", from: models.ShipmentStatusInTransit, shippedAt: &handedOver, status: carriers.StatusOutForDelivery, events: events[:3]},
+		{name: "delivered", from: models.ShipmentStatusInTransit, shippedAt: &handedOver, status: carriers.StatusDelivered, events: events, want: models.ShipmentStatusDelivered, delivered: &deliveredAt},
+		{name: "delivered straight from packed", from: models.ShipmentStatusPacked, status: carriers.StatusDelivered, events: events, want: models.ShipmentStatusDelivered, shipped: &pickedUp, delivered: &deliveredAt},
+		{name: "delivered is final", from: models.ShipmentStatusDelivered, status: carriers.StatusFailure, events: events},
+		{name: "failure", from: models.ShipmentStatusInTransit, shippedAt: &handedOver, status: carriers.StatusFailure, events: events[:3], want: models.ShipmentStatusFailed},
+		{name: "failure before hand over", from: models.ShipmentStatusPacked, status: carriers.StatusFailure, want: models.ShipmentStatusFailed},
+		{name: "in transit without events", from: models.ShipmentStatusPending, status: carriers.StatusInTransit, want: models.ShipmentStatusInTransit, stampedNow: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shipment := &models.Shipment{Status: tt.from, ShippedAt: tt.shippedAt}
+			tracking := carriers.Tracking{TrackingNumber: "TRK1", Status: tt.status, Events: tt.events}
+			before := time.Now()
+			updates := trackingTransition(shipment, tracking)
+			if tt.want == "" {
+				if updates != nil {
+					t.Fatalf("trackingTransition() = %v, want no change", updates)
+				}
+				return
+			}
+			if updates["status"] != tt.want {
+				t.Fatalf("status = %v, want %v", updates["status"], tt.want)
+			}
+
+			shipped, ok := updates["shipped_at"].(time.Time)
+			switch {
+			case tt.stampedNow:
+				if !ok || shipped.Before(before) {
+					t.Errorf("shipped_at = %v, want now", updates["shipped_at"])
+				}
+			case tt.shipped == nil:
+				if ok {
+					t.Errorf("shipped_at = %v, want unset", shipped)
+				}
+			case !ok || !shipped.Equal(*tt.shipped):
+				t.Errorf("shipped_at = %v, want %v", updates["shipped_at"], *tt.shipped)
+			}
+
+			delivered, ok := updates["delivered_at"].(time.Time)
+			switch {
+			case tt.delivered == nil:
+				if ok {
+					t.Errorf("delivered_at = %v, want unset", delivered)
+				}
+			case !ok || !delivered.Equal(*tt.delivered):
+				t.Errorf("delivered_at = %v, want %v", updates["delivered_at"], *tt.delivered)
+			}
+		})
+	}
+}
+
+func TestShipmentsProgress(t *testing.T) {
+	tests := []struct {
+		name           string
+		statuses       []models.ShipmentStatus
+		wantHandedOver bool
+		wantDelivered  bool
+	}{
+		{name: "no shipments", statuses: nil},
+		{name: "one still packed", statuses: []models.ShipmentStatus{models.ShipmentStatusInTransit, models.ShipmentStatusPacked}},
+		{name: "one failed", statuses: []models.ShipmentStatus{models.ShipmentStatusDelivered, models.ShipmentStatusFailed}},
+		{name: "all in transit", statuses: []models.ShipmentStatus{models.ShipmentStatusInTransit, models.ShipmentStatusInTransit}, wantHandedOver: true},
+		{name: "partly delivered", statuses: []models.ShipmentStatus{models.ShipmentStatusDelivered, models.ShipmentStatusInTransit}, wantHandedOver: true},
+		{name: "all delivered", statuses: []models.ShipmentStatus{models.ShipmentStatusDelivered, models.ShipmentStatusDelivered}, wantHandedOver: true, wantDelivered: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handedOver, delivered := shipmentsProgress(tt.statuses)
+			if handedOver != tt.wantHandedOver || delivered != tt.wantDelivered {
+				t.Errorf("shipmentsProgress(%v) = %t, %t, want %t, %t", tt.statuses, handedOver, delivered, tt.wantHandedOver, tt.wantDelivered)
+			}
+		})
+	}
+}
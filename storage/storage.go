@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+var ErrInvalidKey = errors.New("invalid storage key")
+
+// Storage keeps uploaded files under slash separated keys (e.g. "products/<id>/<file>")
+// and tells where they are served from
+type Storage interface {
+	Save(key string, data io.Reader) error
+	Delete(key string) error
+	URL(key string) string
+}
+
+// Local stores files below a directory of the local filesystem, served under BaseURL
+type Local struct {
+	Dir     string
+	BaseURL string
+}
+
+// NewLocal returns a storage writing below dir, creating the directory when missing
+func NewLocal(dir, baseURL string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Local{Dir: dir, BaseURL: strings.TrimSuffix(baseURL, "/")}, nil
+}
+
+// Save writes the file atomically, replacing any file stored under the same key
+func (l *Local) Save(key string, data io.Reader) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// Delete removes a file, ignoring files already gone
+func (l *Local) Delete(key string) error {
+	target, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(target); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// URL is the address the file is served at
+func (l *Local) URL(key string) string {
+	return l.BaseURL + "/" + key
+}
+
+// path maps a key below the storage directory, rejecting keys escaping it
+func (l *Local) path(key string) (string, error) {
+	clean := path.Clean("/" + key)
+	if key == "" || clean != "/"+key {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(l.Dir, filepath.FromSlash(clean)), nil
+}
@@ -1,8 +1,10 @@
 package utils
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -10,10 +12,37 @@ import (
 )
 
 type ViewSet[T any, C any, U any] struct {
-	DB                   *gorm.DB
-	PerformCreateFunc    func(c *gin.Context, obj *T) error
+	DB                *gorm.DB
+	PerformCreateFunc func(c *gin.Context, obj *T) error
+	PerformUpdateFunc func(c *gin.Context, obj *T) error // Runs after the update was saved
+	// ValidateUpdateFunc checks the changes against the loaded object before they are saved
+	ValidateUpdateFunc   func(c *gin.Context, obj *T, updates *T) error
 	InputOfCreateToModel func(n *C) T
 	InputOfUpdateToModel func(n *U) T
+	// SearchFields are the columns matched by the "search" query param (defaults to title and description)
+	SearchFields []string
+	// Preloads are the relationships loaded when retrieving a single object
+	Preloads []string
+	// ListPreloads are the relationships loaded for every object of the list
+	ListPreloads []string
+	// FilterFunc narrows the List query from the request's query params
+	FilterFunc func(c *gin.Context, query *gorm.DB) *gorm.DB
+	// RespondError answers the errors of the injected funcs, e.g. with the status of a
+	// validation error. Without it they are answered with 500, or 400 when validating.
+	RespondError func(c *gin.Context, err error)
+	// CreateZeroValues inserts the zero values of created objects too, e.g. a false
+	// is_active, instead of leaving those columns to their defaults
+	CreateZeroValues bool
+}
+
+// respondFuncError answers an error of an injected func, with status when the viewset
+// has no RespondError
+func (v ViewSet[T, C, U]) respondFuncError(c *gin.Context, status int, err error) {
+	if v.RespondError != nil {
+		v.RespondError(c, err)
+		return
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
 }
 
 func (v ViewSet[T, C, U]) Retrieve(c *gin.Context) {
@@ -25,7 +54,12 @@ func (v ViewSet[T, C, U]) Retrieve(c *gin.Context) {
 		return
 	}
 
-	if err := v.DB.First(&obj, uuidID).Error; err != nil {
+	query := v.DB
+	for _, preload := range v.Preloads {
+		query = query.Preload(preload)
+	}
+
+	if err := query.First(&obj, uuidID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Object not found"})
 		return
 	}
@@ -48,11 +82,25 @@ func (v ViewSet[T, C, U]) List(c *gin.Context) {
 	query := v.DB.Model(&model)
 
 	if search != "" {
-		query = query.Where("title ILIKE ? OR description ILIKE ?", "%"+search+"%", "%"+search+"%")
+		searchFields := v.SearchFields
+		if len(searchFields) == 0 {
+			searchFields = []string{"title", "description"}
+		}
+
+		conditions := make([]string, len(searchFields))
+		args := make([]interface{}, len(searchFields))
+		for i, field := range searchFields {
+			conditions[i] = field + " ILIKE ?"
+			args[i] = "%" + search + "%"
+		}
+		query = query.Where(strings.Join(conditions, " OR "), args...)
 	}
 	if active != "" {
 		query = query.Where("is_active = ?", active == "true")
 	}
+	if v.FilterFunc != nil {
+		query = v.FilterFunc(c, query)
+	}
 
 	// Get total count
 	var total int64
@@ -61,6 +109,9 @@ func (v ViewSet[T, C, U]) List(c *gin.Context) {
 	if includeVariants {
 		query = query.Preload("Variants")
 	}
+	for _, preload := range v.ListPreloads {
+		query = query.Preload(preload)
+	}
 
 	err := query.Offset(offset).Limit(limit).Order("created_at DESC").Find(&objs).Error
 	if err != nil {
@@ -94,13 +145,17 @@ func (v ViewSet[T, C, U]) Create(c *gin.Context) {
 	// Call the injected custom create logic
 	if v.PerformCreateFunc != nil {
 		if err := v.PerformCreateFunc(c, &obj); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			v.respondFuncError(c, http.StatusInternalServerError, err)
 			return
 		}
 	}
 
 	// Save the object after performing custom logic
-	if err := v.DB.Create(&obj).Error; err != nil {
+	query := v.DB
+	if v.CreateZeroValues {
+		query = query.Select("*")
+	}
+	if err := query.Create(&obj).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create object"})
 		return
 	}
@@ -131,6 +186,13 @@ func (v ViewSet[T, C, U]) Update(c *gin.Context) {
 	// Build the updates struct from input without overwriting the loaded object's primary key
 	updates := v.InputOfUpdateToModel(&input)
 
+	if v.ValidateUpdateFunc != nil {
+		if err := v.ValidateUpdateFunc(c, &obj, &updates); err != nil {
+			v.respondFuncError(c, http.StatusBadRequest, err)
+			return
+		}
+	}
+
 	// Apply updates onto the existing row using its bound primary key (obj)
 	// Omit immutable fields like ID (and optionally CreatedAt if present on the model)
 	if err := v.DB.Model(&obj).Omit("id").Updates(updates).Error; err != nil {
@@ -138,6 +200,14 @@ func (v ViewSet[T, C, U]) Update(c *gin.Context) {
 		return
 	}
 
+	// Call the injected custom update logic
+	if v.PerformUpdateFunc != nil {
+		if err := v.PerformUpdateFunc(c, &obj); err != nil {
+			v.respondFuncError(c, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
 	// Re-fetch to return the latest state after update
 	if err := v.DB.First(&obj, uuidID).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to load updated object"})
@@ -162,6 +232,12 @@ func (v ViewSet[T, C, U]) Delete(c *gin.Context) {
 	}
 
 	if err := v.DB.Delete(&obj).Error; err != nil {
+		// Rows kept by a RESTRICT foreign key, e.g. a variant with stock movements
+		if translator, ok := v.DB.Dialector.(gorm.ErrorTranslator); ok &&
+			errors.Is(translator.Translate(err), gorm.ErrForeignKeyViolated) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Object is still referenced and can't be deleted"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to delete object"})
 		return
 	}
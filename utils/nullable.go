@@ -0,0 +1,37 @@
+package utils
+
+import "encoding/json"
+
+// Nullable is an optional field of a PATCH request that tells an absent field, left
+// as it is, apart from an explicit null, which clears it
+type Nullable[T any] struct {
+	Set   bool // The field was in the request
+	Value *T   // nil when the field was null
+}
+
+func (n *Nullable[T]) UnmarshalJSON(data []byte) error {
+	n.Set = true
+	if string(data) == "null" {
+		n.Value = nil
+		return nil
+	}
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	n.Value = &value
+	return nil
+}
+
+// Put records the field in the updates under its column when it was in the request,
+// as nil when it was null
+func (n Nullable[T]) Put(updates map[string]interface{}, column string) {
+	if !n.Set {
+		return
+	}
+	if n.Value == nil {
+		updates[column] = nil
+		return
+	}
+	updates[column] = *n.Value
+}
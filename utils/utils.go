@@ -3,6 +3,8 @@ package utils
 import (
 	"fmt"
 	"log"
+	"strings"
+	"unicode"
 )
 
 func FailOnError(err error, msg string) {
@@ -16,3 +18,19 @@ func LogOnError(err error, msg string) {
 		fmt.Printf("%s: %s\n", msg, err)
 	}
 }
+
+// Slugify turns a name into a lowercase, dash separated identifier usable in URLs
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}